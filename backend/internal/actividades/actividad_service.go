@@ -5,25 +5,30 @@ import (
 	"errors"
 	"log"
 
+	"proyecto/internal/apperrors"
 	"proyecto/internal/database"
 	"proyecto/internal/models"
 )
 
 //  1. EL CONTRATO
 
-// GetDatosProyectoResponse es un struct para agrupar la respuesta
+// GetDatosProyectoResponse es un struct para agrupar la respuesta. La página
+// (next_cursor, total) es la de las actividades; los catálogos van completos.
 type GetDatosProyectoResponse struct {
 	Labores     []models.LaborAgronomica   `json:"labores"`
 	Equipos     []models.EquipoImplemento  `json:"equipos"`
 	Encargados  []models.EncargadoResponse `json:"encargados"`
 	Actividades []models.ActividadResponse `json:"actividades"`
+	NextCursor  *string                    `json:"next_cursor"`
+	Total       *int                       `json:"total,omitempty"`
 }
 
 type ActividadService interface {
-	GetDatosProyecto(proyectoID int) (*GetDatosProyectoResponse, error)
+	GetDatosProyecto(req models.GetDatosProyectoRequest) (*GetDatosProyectoResponse, error)
 	CreateActividad(req models.CreateActividadRequest) ([]models.ActividadResponse, error)
 	UpdateActividad(req models.UpdateActividadRequest) ([]models.ActividadResponse, error)
 	DeleteActividad(id int) (int64, error)
+	GetActividadProyectoID(id int) (int, error)
 }
 
 // 2. LA IMPLEMENTACIÓN (Struct)
@@ -38,7 +43,8 @@ func NewActividadService() ActividadService {
 
 //  4. LOS MÉTODOS (Lógica de Negocio)
 
-func (s *actividadService) GetDatosProyecto(proyectoID int) (*GetDatosProyectoResponse, error) {
+func (s *actividadService) GetDatosProyecto(req models.GetDatosProyectoRequest) (*GetDatosProyectoResponse, error) {
+	proyectoID := req.ProyectoID
 	labores, err := database.GetLaboresByProyectoID(proyectoID)
 	if err != nil {
 		log.Printf("Error en GetDatosProyecto (GetLabores): %v", err)
@@ -57,8 +63,11 @@ func (s *actividadService) GetDatosProyecto(proyectoID int) (*GetDatosProyectoRe
 		return nil, errors.New("Error al obtener encargados.")
 	}
 
-	actividades, err := database.GetActividadesByProyectoID(proyectoID)
+	actividades, page, err := database.GetActividades(req)
 	if err != nil {
+		if _, ok := apperrors.As(err); ok {
+			return nil, err
+		}
 		log.Printf("Error en GetDatosProyecto (GetActividades): %v", err)
 		return nil, errors.New("Error al obtener actividades.")
 	}
@@ -68,12 +77,19 @@ func (s *actividadService) GetDatosProyecto(proyectoID int) (*GetDatosProyectoRe
 		Equipos:     equipos,
 		Encargados:  encargados,
 		Actividades: actividades,
+		NextCursor:  page.NextCursor,
+		Total:       page.Total,
 	}, nil
 }
 
 func (s *actividadService) CreateActividad(req models.CreateActividadRequest) ([]models.ActividadResponse, error) {
-	if req.ProyectoID == 0 || req.Actividad == "" || req.Costo == 0 || req.RecursoHumano == 0 {
-		return nil, errors.New("ProyectoID, Actividad, RecursoHumano y Costo son requeridos.")
+	var check apperrors.Check
+	check.Required("proyecto_id", req.ProyectoID != 0)
+	check.Required("actividad", req.Actividad != "")
+	check.Required("recurso_humano", req.RecursoHumano != 0)
+	check.Required("costo", req.Costo != 0)
+	if err := check.Err("ProyectoID, Actividad, RecursoHumano y Costo son requeridos."); err != nil {
+		return nil, err
 	}
 
 	// Manejo de valores opcionales (IDs)
@@ -120,8 +136,14 @@ func (s *actividadService) CreateActividad(req models.CreateActividadRequest) ([
 }
 
 func (s *actividadService) UpdateActividad(req models.UpdateActividadRequest) ([]models.ActividadResponse, error) {
-	if req.ID == 0 || req.ProyectoID == 0 || req.Actividad == "" || req.Costo == 0 || req.RecursoHumano == 0 {
-		return nil, errors.New("ID, ProyectoID, Actividad, RecursoHumano y Costo son requeridos.")
+	var check apperrors.Check
+	check.Required("id", req.ID != 0)
+	check.Required("proyecto_id", req.ProyectoID != 0)
+	check.Required("actividad", req.Actividad != "")
+	check.Required("recurso_humano", req.RecursoHumano != 0)
+	check.Required("costo", req.Costo != 0)
+	if err := check.Err("ID, ProyectoID, Actividad, RecursoHumano y Costo son requeridos."); err != nil {
+		return nil, err
 	}
 
 	// Manejo de valores opcionales
@@ -158,7 +180,7 @@ func (s *actividadService) UpdateActividad(req models.UpdateActividadRequest) ([
 		return nil, errors.New("Error al actualizar la actividad.")
 	}
 	if affected == 0 {
-		return nil, errors.New("Actividad no encontrada.")
+		return nil, apperrors.NotFound("Actividad no encontrada.")
 	}
 
 	// Devolvemos la lista actualizada
@@ -173,7 +195,7 @@ func (s *actividadService) UpdateActividad(req models.UpdateActividadRequest) ([
 
 func (s *actividadService) DeleteActividad(id int) (int64, error) {
 	if id == 0 {
-		return 0, errors.New("ID de actividad requerido.")
+		return 0, apperrors.Required("id", "ID de actividad requerido.")
 	}
 	affected, err := database.DeleteActividad(id)
 	if err != nil {
@@ -182,3 +204,15 @@ func (s *actividadService) DeleteActividad(id int) (int64, error) {
 	}
 	return affected, nil
 }
+
+// GetActividadProyectoID: proyecto dueño del registro (para verificar permisos por proyecto)
+func (s *actividadService) GetActividadProyectoID(id int) (int, error) {
+	proyectoID, err := database.GetActividadProyectoID(id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error en actividadService.GetActividadProyectoID (ID: %d): %v", id, err)
+		}
+		return 0, apperrors.NotFound("registro no encontrado")
+	}
+	return proyectoID, nil
+}
@@ -0,0 +1,171 @@
+package apperrors
+
+import (
+	"errors"
+	"net/http"
+
+	"proyecto/internal/i18n"
+	"proyecto/internal/models"
+)
+
+//  ERRORES DE DOMINIO
+// Los servicios devuelven *Error en los casos que el cliente tiene que poder
+// distinguir (validación, no encontrado, conflicto, prohibido). Los handlers
+// responden con el código HTTP del tipo y con un code estable: el cliente decide
+// con el code y los detalles por campo, el mensaje es solo para mostrar.
+
+// Code identifica el tipo de error en la respuesta; no cambia entre versiones
+type Code string
+
+const (
+	CodeBadRequest      Code = "bad_request"
+	CodeValidation      Code = "validation_failed"
+	CodeUnauthorized    Code = "unauthorized"
+	CodeForbidden       Code = "forbidden"
+	CodeNotFound        Code = "not_found"
+	CodeConflict        Code = "conflict"
+	CodeTooManyRequests Code = "too_many_requests"
+	CodeInternal        Code = "internal_error"
+	CodeBadGateway      Code = "bad_gateway"
+	CodeUnavailable     Code = "service_unavailable"
+)
+
+// Códigos de los detalles por campo
+const (
+	FieldRequired  = "required"
+	FieldInvalid   = "invalid"
+	FieldDuplicate = "duplicate"
+)
+
+var statusByCode = map[Code]int{
+	CodeBadRequest:      http.StatusBadRequest,
+	CodeValidation:      http.StatusBadRequest,
+	CodeUnauthorized:    http.StatusUnauthorized,
+	CodeForbidden:       http.StatusForbidden,
+	CodeNotFound:        http.StatusNotFound,
+	CodeConflict:        http.StatusConflict,
+	CodeTooManyRequests: http.StatusTooManyRequests,
+	CodeInternal:        http.StatusInternalServerError,
+	CodeBadGateway:      http.StatusBadGateway,
+	CodeUnavailable:     http.StatusServiceUnavailable,
+}
+
+// Error es un error de dominio con su tipo y, si aplica, los campos que lo causaron
+type Error struct {
+	Code    Code
+	Message string
+	Fields  []models.FieldError
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func New(code Code, message string, fields ...models.FieldError) *Error {
+	return &Error{Code: code, Message: message, Fields: fields}
+}
+
+func Validation(message string, fields ...models.FieldError) *Error {
+	return New(CodeValidation, message, fields...)
+}
+
+func NotFound(message string) *Error {
+	return New(CodeNotFound, message)
+}
+
+func Conflict(message string, fields ...models.FieldError) *Error {
+	return New(CodeConflict, message, fields...)
+}
+
+func Forbidden(message string) *Error {
+	return New(CodeForbidden, message)
+}
+
+// Required: error de validación por un único campo requerido que falta
+func Required(field, message string) *Error {
+	var c Check
+	c.Required(field, false)
+	return Validation(message, c.fields...)
+}
+
+// InvalidField: error de validación por el valor de un único campo
+func InvalidField(field, message string) *Error {
+	return Validation(message, Invalid(field, message))
+}
+
+// Invalid: detalle de un campo con un valor no aceptado
+func Invalid(field, message string) models.FieldError {
+	return models.FieldError{Field: field, Code: FieldInvalid, Message: message}
+}
+
+// Duplicate: detalle de un campo cuyo valor ya usa otro registro
+func Duplicate(field, message string) models.FieldError {
+	return models.FieldError{Field: field, Code: FieldDuplicate, Message: message}
+}
+
+// As devuelve el error de dominio contenido en err, si lo hay
+func As(err error) (*Error, bool) {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr, true
+	}
+	return nil, false
+}
+
+// Is indica si err es un error de dominio del tipo code
+func Is(err error, code Code) bool {
+	appErr, ok := As(err)
+	return ok && appErr.Code == code
+}
+
+// Status: código HTTP de un tipo de error
+func Status(code Code) int {
+	if status, ok := statusByCode[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeForStatus: tipo de error de una respuesta armada solo con el código HTTP
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusBadGateway:
+		return CodeBadGateway
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	return CodeInternal
+}
+
+// Check acumula los campos requeridos que faltan en una petición
+type Check struct {
+	fields []models.FieldError
+}
+
+// Required anota field como faltante si present es falso
+func (c *Check) Required(field string, present bool) {
+	if !present {
+		message, _ := i18n.Message(i18n.Default, FieldRequired)
+		c.fields = append(c.fields, models.FieldError{Field: field, Code: FieldRequired, Message: message})
+	}
+}
+
+// Err devuelve un error de validación con message si falta algún campo (nil si no)
+func (c *Check) Err(message string) error {
+	if len(c.fields) == 0 {
+		return nil
+	}
+	return Validation(message, c.fields...)
+}
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"proyecto/internal/apperrors"
+	"proyecto/internal/database"
+	"proyecto/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// API keys de cuentas de servicio (integraciones: nómina, inventario...).
+// Formato: "agk_<prefijo>_<secreto>". El prefijo es público y sirve para buscar la
+// llave; de la llave completa solo se guarda el hash.
+
+const (
+	APIKeyPrefix     = "agk_"
+	apiKeyPrefixLen  = 8
+	defaultAPIKeyTTL = 90 * 24 * time.Hour
+	maxAPIKeyDays    = 365
+)
+
+var serviceAccountPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{2,39}$`)
+
+// IsAPIKey indica si una credencial tiene el formato de API key (y no de JWT)
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// CreateServiceAccount crea un usuario no humano; su rol limita lo que pueden hacer sus llaves
+func (s *authService) CreateServiceAccount(req models.CreateServiceAccountRequest) (int64, error) {
+	username := strings.ToLower(strings.TrimSpace(req.Username))
+	if !serviceAccountPattern.MatchString(username) {
+		return 0, apperrors.InvalidField("username", "username inválido (minúsculas, números, '.', '-' o '_', de 3 a 40 caracteres)")
+	}
+	nombre := strings.TrimSpace(req.Nombre)
+	if nombre == "" {
+		return 0, apperrors.Required("nombre", "el nombre es requerido")
+	}
+	role := strings.TrimSpace(req.Role)
+	if role == "" {
+		role = models.RoleUser
+	}
+	exists, err := database.RoleExists(role)
+	if err != nil {
+		log.Printf("Error en authService.CreateServiceAccount (RoleExists %s): %v", role, err)
+		return 0, errors.New("error al crear la cuenta de servicio")
+	}
+	if !exists {
+		return 0, apperrors.InvalidField("role", fmt.Sprintf("rol desconocido: %q", role))
+	}
+
+	// Contraseña aleatoria descartada: la cuenta no puede iniciar sesión
+	secret, err := newOpaqueToken()
+	if err != nil {
+		return 0, errors.New("error al crear la cuenta de servicio")
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, errors.New("error al crear la cuenta de servicio")
+	}
+
+	id, err := database.CreateServiceAccount(username, nombre, role, string(hashed))
+	if err != nil {
+		if apperrors.Is(err, apperrors.CodeConflict) {
+			return 0, err
+		}
+		log.Printf("Error en authService.CreateServiceAccount (%s): %v", username, err)
+		return 0, errors.New("error al crear la cuenta de servicio")
+	}
+	return id, nil
+}
+
+func (s *authService) GetServiceAccounts() ([]models.ServiceAccount, error) {
+	accounts, err := database.GetServiceAccounts()
+	if err != nil {
+		log.Printf("Error en authService.GetServiceAccounts: %v", err)
+		return nil, errors.New("error al obtener las cuentas de servicio")
+	}
+	return accounts, nil
+}
+
+// CreateAPIKey emite una llave para una cuenta de servicio. La llave en claro solo
+// se devuelve aquí; después solo se ven el prefijo y los metadatos.
+func (s *authService) CreateAPIKey(req models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	nombre := strings.TrimSpace(req.Nombre)
+	var check apperrors.Check
+	check.Required("service_account_id", req.ServiceAccountID != 0)
+	check.Required("nombre", nombre != "")
+	if err := check.Err("service_account_id y nombre son requeridos"); err != nil {
+		return nil, err
+	}
+	account, err := database.GetUserByID(req.ServiceAccountID)
+	if err != nil || !account.EsServicio {
+		return nil, apperrors.NotFound("cuenta de servicio no encontrada")
+	}
+
+	scopes, err := validateScopes(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := defaultAPIKeyTTL
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAPIKeyDays {
+		return nil, apperrors.InvalidField("expires_in_days", fmt.Sprintf("expires_in_days debe estar entre 1 y %d", maxAPIKeyDays))
+	}
+	if req.ExpiresInDays > 0 {
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+
+	prefijo, err := newAPIKeyPrefix()
+	if err != nil {
+		log.Printf("Error en authService.CreateAPIKey (prefijo): %v", err)
+		return nil, errors.New("error al generar la API key")
+	}
+	secret, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("Error en authService.CreateAPIKey (secreto): %v", err)
+		return nil, errors.New("error al generar la API key")
+	}
+	key := APIKeyPrefix + prefijo + "_" + secret
+
+	id, err := database.CreateAPIKey(account.ID, nombre, prefijo, hashToken(key), scopes, time.Now().Add(ttl))
+	if err != nil {
+		log.Printf("Error en authService.CreateAPIKey (cuenta %d): %v", account.ID, err)
+		return nil, errors.New("error al guardar la API key")
+	}
+	created, err := database.GetAPIKeyByID(int(id))
+	if err != nil {
+		log.Printf("Error en authService.CreateAPIKey (GetAPIKeyByID %d): %v", id, err)
+		return nil, errors.New("error al guardar la API key")
+	}
+	return &models.CreateAPIKeyResponse{Key: key, APIKey: *created}, nil
+}
+
+func (s *authService) RevokeAPIKey(id int) error {
+	affected, err := database.RevokeAPIKey(id)
+	if err != nil {
+		log.Printf("Error en authService.RevokeAPIKey (%d): %v", id, err)
+		return errors.New("error al revocar la API key")
+	}
+	if affected == 0 {
+		return apperrors.NotFound("API key no encontrada o ya revocada")
+	}
+	return nil
+}
+
+// ValidateAPIKey autentica una petición hecha con API key y devuelve la identidad de
+// la cuenta de servicio, limitada a los permisos de la llave
+func (s *authService) ValidateAPIKey(key string) (*Identity, error) {
+	rest := strings.TrimPrefix(key, APIKeyPrefix)
+	prefijo, _, ok := strings.Cut(rest, "_")
+	if !IsAPIKey(key) || !ok || len(prefijo) != apiKeyPrefixLen {
+		return nil, errors.New("API key inválida")
+	}
+
+	record, err := database.GetAPIKeyByPrefix(prefijo)
+	if err != nil {
+		return nil, errors.New("API key inválida")
+	}
+	if subtle.ConstantTimeCompare([]byte(record.KeyHash), []byte(hashToken(key))) != 1 {
+		return nil, errors.New("API key inválida")
+	}
+	if record.Revocada {
+		return nil, errors.New("API key revocada")
+	}
+	now := time.Now()
+	if now.After(record.ExpiresAt) {
+		return nil, errors.New("API key expirada")
+	}
+
+	if err := database.TouchAPIKey(record.ID, now); err != nil {
+		log.Printf("Error en authService.ValidateAPIKey (TouchAPIKey %d): %v", record.ID, err)
+	}
+
+	return &Identity{
+		UserID:   record.UserID,
+		Username: record.Username,
+		Role:     record.Role,
+		APIKeyID: record.ID,
+		Scopes:   record.Permissions,
+	}, nil
+}
+
+// validateScopes exige al menos un permiso y que todos existan en el catálogo
+func validateScopes(permissions []string) ([]string, error) {
+	if len(permissions) == 0 {
+		return nil, apperrors.Required("permissions", "la API key necesita al menos un permiso")
+	}
+	catalog, err := database.GetAllPermissions()
+	if err != nil {
+		log.Printf("Error en validateScopes: %v", err)
+		return nil, errors.New("error al obtener permisos")
+	}
+	known := make(map[string]bool, len(catalog))
+	for _, p := range catalog {
+		known[p.Name] = true
+	}
+
+	scopes := make([]string, 0, len(permissions))
+	for _, perm := range permissions {
+		perm = strings.TrimSpace(perm)
+		if !known[perm] {
+			return nil, apperrors.InvalidField("permissions", fmt.Sprintf("permiso desconocido: %q", perm))
+		}
+		if !containsFold(scopes, perm) {
+			scopes = append(scopes, perm)
+		}
+	}
+	return scopes, nil
+}
+
+func newAPIKeyPrefix() (string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return strings.ToLower(totpEncoding.EncodeToString(buf))[:apiKeyPrefixLen], nil
+}
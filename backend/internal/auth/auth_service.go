@@ -1,127 +1,615 @@
 package auth
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	netmail "net/mail"
+	"os"
 	"strings"
 	"time"
 
+	"proyecto/internal/apperrors"
+	"proyecto/internal/cedula"
 	"proyecto/internal/database"
+	"proyecto/internal/mail"
 	"proyecto/internal/models"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// jwtKey se mueve del handler al servicio.
-var jwtKey = []byte("mi_llave_secreta_super_segura_12345")
+// Vigencia de los tokens: el access token es corto y se renueva con el refresh token.
+var (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+	resetTokenTTL   = 30 * time.Minute
+)
+
+// envPasswordResetURL: página del frontend que recibe el token de recuperación
+const (
+	envPasswordResetURL     = "PASSWORD_RESET_URL"
+	defaultPasswordResetURL = "http://localhost:3000/reset-password"
+)
 
 // 1. EL CONTRATO (Interface)
 type AuthService interface {
-	Register(user models.User) (int64, error)
-	Login(username, password string) (*models.LoginResponse, error)
-	CheckPermission(username string, roles ...string) (bool, error)
+	Register(user models.User) (int64, string, error)
+	Login(username, password string, client ClientInfo) (*models.LoginResponse, error)
+	CheckPermission(caller *Identity, permission string) (bool, error)
+	CheckProjectPermission(caller *Identity, proyectoID int, permission string) (bool, error)
+	CanGrantProjectRole(caller *Identity, proyectoID int, role string) (bool, error)
+	ValidateToken(tokenString string) (*Identity, error)
+	Refresh(refreshToken string) (*models.LoginResponse, error)
+	Logout(sessionID int) error
+	RevokeUserTokens(userID int) error
+	ChangePassword(userID, sessionID int, currentPassword, newPassword string) error
+	ResetPassword(userID int) (string, error)
+	RequestPasswordReset(username string) (int, error)
+	ResetPasswordWithToken(token, newPassword string) (*Identity, error)
+	UnlockUser(userID int) error
+	SetupTwoFactor(userID int) (*models.TwoFactorSetupResponse, error)
+	EnableTwoFactor(userID int, code string) ([]string, error)
+	DisableTwoFactor(userID int, password, code string) error
+	VerifyTwoFactor(challengeToken, code, recoveryCode string, client ClientInfo) (*models.LoginResponse, error)
+	GetTwoFactorRoles() ([]string, error)
+	SetTwoFactorRoles(roles []string) error
+	CreateServiceAccount(req models.CreateServiceAccountRequest) (int64, error)
+	GetServiceAccounts() ([]models.ServiceAccount, error)
+	CreateAPIKey(req models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error)
+	RevokeAPIKey(id int) error
+	ValidateAPIKey(key string) (*Identity, error)
+	GetProviders() []string
+	StartExternalLogin(ctx context.Context, provider string) (*models.ExternalLoginStart, error)
+	CompleteExternalLogin(ctx context.Context, state, code string, client ClientInfo) (*models.LoginResponse, error)
+	IsRegistrationOpen() (bool, error)
+	SetRegistrationOpen(open bool) error
+	CreateInvitation(req models.CreateInvitationRequest, createdBy string) (*models.CreateInvitationResponse, error)
+	GetInvitations() ([]models.Invitation, error)
+	RevokeInvitation(id int) error
+	GetSessions(userID, currentSessionID int) ([]models.Session, error)
+	RevokeSession(userID, sessionID int) error
+	GetLoginHistory(userID int) ([]models.LoginRecord, error)
+	Impersonate(caller *Identity, targetID int) (*models.LoginResponse, error)
 }
 
+// ErrInvalidCredentials: usuario inexistente o contraseña incorrecta (no se distingue)
+var ErrInvalidCredentials = apperrors.New(apperrors.CodeUnauthorized, "credenciales inválidas")
+
+// ErrAccountDisabled: la cuenta fue desactivada por un administrador. Solo se informa
+// después de verificar la contraseña, para no revelar qué cuentas existen.
+var ErrAccountDisabled = apperrors.Forbidden("la cuenta está desactivada, contacte al administrador")
+
+// ErrUserNotFound: el usuario indicado no existe
+var ErrUserNotFound = apperrors.NotFound("usuario no encontrado")
+
+// errInvalidRefresh: refresh token desconocido, revocado o vencido
+var errInvalidRefresh = apperrors.New(apperrors.CodeUnauthorized, "refresh token inválido o expirado")
+
+// errInvalidResetToken: token de recuperación desconocido, usado o vencido
+var errInvalidResetToken = apperrors.InvalidField("token", "token de recuperación inválido o expirado")
+
 // 2. LA IMPLEMENTACIÓN (Struct)
 type authService struct {
-	// (En el futuro, aquí irán dependencias como un UserRepository)
+	keys     *KeyRing                    // Llaves de firma de los JWT (ver keys.go)
+	mailer   mail.Sender                 // Entrega de correos (recuperación de contraseña)
+	policy   LoginPolicy                 // Bloqueo de cuentas y backoff por IP (ver login_policy.go)
+	password PasswordProvider            // Verificación de contraseñas (ver providers.go)
+	external map[string]RedirectProvider // Proveedores externos (OIDC) por nombre
 }
 
 // 3. EL CONSTRUCTOR
-func NewAuthService() AuthService {
-	return &authService{}
+// Sin un PasswordProvider en providers se usa la contraseña local (bcrypt).
+func NewAuthService(keys *KeyRing, mailer mail.Sender, policy LoginPolicy, providers ...AuthProvider) AuthService {
+	s := &authService{
+		keys:     keys,
+		mailer:   mailer,
+		policy:   policy,
+		password: NewLocalProvider(),
+		external: make(map[string]RedirectProvider),
+	}
+	for _, p := range providers {
+		switch p := p.(type) {
+		case PasswordProvider:
+			s.password = p
+		case RedirectProvider:
+			s.external[p.Name()] = p
+		}
+	}
+	return s
 }
 
 //  4. LOS MÉTODOS
 
-func (s *authService) Register(user models.User) (int64, error) {
-	if user.Username == "" || user.Password == "" || user.Nombre == "" || user.Apellido == "" || user.Cedula == "" {
-		return 0, errors.New("todos los campos (username, password, nombre, apellido, cedula) son requeridos")
+// Register crea la cuenta y devuelve su ID y rol. Con código de invitación, el rol y
+// el proyecto salen de la invitación; sin código, solo se permite si el registro está
+// abierto y el rol es 'user'.
+func (s *authService) Register(user models.User) (int64, string, error) {
+	var check apperrors.Check
+	check.Required("username", user.Username != "")
+	check.Required("password", user.Password != "")
+	check.Required("nombre", user.Nombre != "")
+	check.Required("apellido", user.Apellido != "")
+	check.Required("cedula", user.Cedula != "")
+	if err := check.Err("todos los campos (username, password, nombre, apellido, cedula) son requeridos"); err != nil {
+		return 0, "", err
+	}
+
+	if err := validatePassword("password", user.Password); err != nil {
+		return 0, "", err
+	}
+	if err := validateEmail(user.Email); err != nil {
+		return 0, "", err
+	}
+	canonical, err := cedula.Normalize(user.Cedula)
+	if err != nil {
+		return 0, "", apperrors.InvalidField("cedula", err.Error())
+	}
+	user.Cedula = canonical
+
+	code := strings.TrimSpace(user.InvitationCode)
+	if code != "" {
+		id, role, err := database.RegisterUserWithInvitation(user.Username, user.Password, user.Nombre, user.Apellido, user.Cedula, user.Email, hashToken(code), time.Now())
+		if err != nil {
+			log.Printf("Error en authService.Register (invitación): %v", err)
+			return 0, "", err
+		}
+		return id, role, nil
 	}
 
-	// Validar longitud de contraseña
-	if len(user.Password) < 6 {
-		return 0, errors.New("la contraseña debe tener al menos 6 caracteres")
+	open, err := s.IsRegistrationOpen()
+	if err != nil {
+		return 0, "", err
+	}
+	if !open {
+		return 0, "", ErrRegistrationClosed
 	}
 
-	id, err := database.RegisterUser(user.Username, user.Password, user.Nombre, user.Apellido, user.Cedula)
+	id, err := database.RegisterUser(user.Username, user.Password, user.Nombre, user.Apellido, user.Cedula, user.Email)
 	if err != nil {
 		log.Printf("Error en authService.Register: %v", err)
-		return 0, err
+		return 0, "", err
 	}
 
-	return id, nil
+	return id, models.RoleUser, nil
 }
 
-func (s *authService) Login(username, password string) (*models.LoginResponse, error) {
-	if username == "" || password == "" {
-		return nil, errors.New("usuario y contraseña son requeridos")
+func (s *authService) Login(username, password string, client ClientInfo) (*models.LoginResponse, error) {
+	var check apperrors.Check
+	check.Required("username", username != "")
+	check.Required("password", password != "")
+	if err := check.Err("usuario y contraseña son requeridos"); err != nil {
+		return nil, err
+	}
+	ip := client.IP
+
+	// 1. Backoff por IP: no se revisa ninguna contraseña mientras la IP esté en espera
+	now := time.Now()
+	ipFailures, lastFailure, err := database.GetIPLoginFailures(ip)
+	if err != nil {
+		log.Printf("Error en authService.Login (GetIPLoginFailures %s): %v", ip, err)
+	} else if now.Sub(lastFailure) < s.policy.IPResetAfter {
+		if wait := lastFailure.Add(s.policy.ipDelay(ipFailures)).Sub(now); wait > 0 {
+			return nil, &LoginBlockedError{RetryAfter: wait}
+		}
 	}
 
 	user, err := database.GetUserByUsername(username)
 	if err != nil {
-		return nil, errors.New("credenciales inválidas")
+		s.recordIPFailure(ip, now)
+		return nil, ErrInvalidCredentials
+	}
+	// Las cuentas de servicio solo se autentican con API keys
+	if user.EsServicio {
+		s.recordIPFailure(ip, now)
+		return nil, ErrInvalidCredentials
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password))
+	// 2. Cuenta bloqueada
+	failures, lockedUntil, err := database.GetUserLockout(user.ID)
 	if err != nil {
-		return nil, errors.New("credenciales inválidas")
+		log.Printf("Error en authService.Login (GetUserLockout %d): %v", user.ID, err)
+		return nil, errors.New("error al verificar el estado de la cuenta")
+	}
+	if now.Before(lockedUntil) {
+		return nil, &LoginBlockedError{RetryAfter: lockedUntil.Sub(now), AccountLocked: true, Username: user.Username}
 	}
 
-	//  Si la contraseña es correcta, genera el token
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &models.Claims{
-		UserID: user.ID,
-		Role:   user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+	// 3. Contraseña
+	if !s.password.VerifyPassword(user, password) {
+		s.recordIPFailure(ip, now)
+		if blocked := s.registerFailedLogin(user, now); blocked != nil {
+			return nil, blocked
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if !user.Activo {
+		return nil, ErrAccountDisabled
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	// 4. Con 2FA activo todavía no hay token: se devuelve el desafío del segundo factor.
+	// Los fallos acumulados se limpian recién cuando se verifica el código.
+	if user.TOTPEnabled {
+		return s.twoFactorChallenge(user)
+	}
+
+	if failures > 0 || !lockedUntil.IsZero() {
+		if _, err := database.ResetUserLockout(user.ID); err != nil {
+			log.Printf("Error en authService.Login (ResetUserLockout %d): %v", user.ID, err)
+		}
+	}
+
+	//  Si la contraseña es correcta, abre una sesión nueva (access + refresh token)
+	return s.issueSession(user, client, LoginMethodPassword)
+}
+
+// registerFailedLogin suma un fallo a la cuenta y la bloquea al llegar al máximo.
+// Devuelve el error de bloqueo si este intento fue el que bloqueó la cuenta.
+func (s *authService) registerFailedLogin(user *models.UserDB, now time.Time) *LoginBlockedError {
+	failures, err := database.IncrementUserFailedLogins(user.ID)
 	if err != nil {
-		log.Printf("Error en authService.Login (SignedString): %v", err)
-		return nil, errors.New("error al generar el token")
+		log.Printf("Error en authService.registerFailedLogin (user %d): %v", user.ID, err)
+		return nil
+	}
+	if failures < s.policy.MaxFailures {
+		return nil
 	}
+	if err := database.LockUser(user.ID, now.Add(s.policy.LockoutDuration)); err != nil {
+		log.Printf("Error en authService.registerFailedLogin (LockUser %d): %v", user.ID, err)
+		return nil
+	}
+	return &LoginBlockedError{RetryAfter: s.policy.LockoutDuration, AccountLocked: true, JustLocked: true, Username: user.Username}
+}
 
-	userDetails := models.UserDetails{
-		Username: user.Username,
-		Nombre:   user.Nombre,
-		Apellido: user.Apellido,
-		Cedula:   user.Cedula,
+// recordIPFailure suma un fallo a la IP de origen (el error solo se registra en el log)
+func (s *authService) recordIPFailure(ip string, now time.Time) {
+	if _, err := database.RecordIPLoginFailure(ip, now, now.Add(-s.policy.IPResetAfter)); err != nil {
+		log.Printf("Error en authService.recordIPFailure (%s): %v", ip, err)
 	}
+}
 
-	response := &models.LoginResponse{
-		Token:  tokenString,
-		User:   userDetails,
-		Role:   user.Role,
-		UserId: user.ID,
+// UnlockUser quita el bloqueo por intentos fallidos de una cuenta
+func (s *authService) UnlockUser(userID int) error {
+	if userID == 0 {
+		return apperrors.Required("id", "id de usuario requerido")
+	}
+	affected, err := database.ResetUserLockout(userID)
+	if err != nil {
+		log.Printf("Error en authService.UnlockUser (user %d): %v", userID, err)
+		return errors.New("error al desbloquear la cuenta")
 	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
 
-	return response, nil
+// CheckPermission consulta si el rol del usuario tiene el permiso (tabla role_permissions).
+// Si la petición llegó con una API key, el permiso además debe estar en su alcance.
+func (s *authService) CheckPermission(caller *Identity, permission string) (bool, error) {
+	if !caller.InScope(permission) {
+		log.Printf("CheckPermission: Acceso denegado. La API key %d de '%s' no incluye '%s'", caller.APIKeyID, caller.Username, permission)
+		return false, nil
+	}
+	allowed, err := database.UserHasPermission(caller.Username, permission)
+	if err != nil {
+		log.Printf("CheckPermission: Error al verificar '%s' para '%s': %v", permission, caller.Username, err)
+		return false, err
+	}
+	if !allowed {
+		log.Printf("CheckPermission: Acceso denegado. Usuario '%s' no tiene el permiso '%s'", caller.Username, permission)
+	}
+	return allowed, nil
 }
 
-// CheckPermission
-func (s *authService) CheckPermission(username string, requiredRoles ...string) (bool, error) {
-	role, err := database.GetUserRole(username)
+// CheckProjectPermission consulta el permiso con el rol que el usuario tiene en el
+// proyecto (project_members); si no es miembro, cuenta su rol global
+func (s *authService) CheckProjectPermission(caller *Identity, proyectoID int, permission string) (bool, error) {
+	if !caller.InScope(permission) {
+		log.Printf("CheckProjectPermission: Acceso denegado. La API key %d de '%s' no incluye '%s'", caller.APIKeyID, caller.Username, permission)
+		return false, nil
+	}
+	allowed, err := database.UserHasProjectPermission(caller.Username, proyectoID, permission)
 	if err != nil {
-		if strings.Contains(err.Error(), "Usuario no encontrado") {
-			log.Printf("CheckPermission: Usuario no encontrado '%s'", username)
-			return false, nil //  Devolvemos (false, nil)
+		log.Printf("CheckProjectPermission: Error al verificar '%s' para '%s' (proyecto %d): %v", permission, caller.Username, proyectoID, err)
+		return false, err
+	}
+	if !allowed {
+		log.Printf("CheckProjectPermission: Acceso denegado. Usuario '%s' no tiene el permiso '%s' en el proyecto %d", caller.Username, permission, proyectoID)
+	}
+	return allowed, nil
+}
+
+// CanGrantProjectRole indica si caller puede dar role en el proyecto: debe tener
+// en él cada permiso del rol, para que nadie reparta más de lo que tiene
+func (s *authService) CanGrantProjectRole(caller *Identity, proyectoID int, role string) (bool, error) {
+	permissions, err := database.GetRolePermissions(role)
+	if err != nil {
+		return false, err
+	}
+	for _, permission := range permissions {
+		allowed, err := s.CheckProjectPermission(caller, proyectoID, permission)
+		if err != nil || !allowed {
+			return false, err
 		}
+	}
+	return true, nil
+}
 
-		log.Printf("CheckPermission: Error al obtener rol de '%s': %v", username, err)
-		return false, err //  Devolvemos (false, err)
+// ValidateToken verifica la firma y expiración del JWT y devuelve la identidad
+// del usuario con el rol vigente en la DB (no el que quedó grabado en el token).
+func (s *authService) ValidateToken(tokenString string) (*Identity, error) {
+	if tokenString == "" {
+		return nil, errors.New("token requerido")
 	}
 
-	for _, reqRole := range requiredRoles {
-		if strings.EqualFold(role, reqRole) {
-			return true, nil // El usuario tiene el rol
+	claims := &models.Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return s.keys.VerificationKey(kid)
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err == nil && claims.SessionID == 0 {
+		// Tokens sin sesión (p. ej. el desafío de 2FA) no sirven como access token
+		err = errors.New("token sin sesión")
+	}
+	if err != nil || !token.Valid {
+		// Los problemas de llave (retirada, desconocida, sin kid) se informan tal cual
+		for _, keyErr := range []error{errRetiredKey, errUnknownKey, errMissingKID} {
+			if errors.Is(err, keyErr) {
+				return nil, keyErr
+			}
 		}
+		return nil, errors.New("token inválido o expirado")
+	}
+
+	// La sesión (refresh token) debe seguir activa: así logout y revocación
+	// invalidan también los access tokens ya emitidos.
+	// En una suplantación la sesión es la del admin.
+	sessionOwner := claims.UserID
+	if claims.ImpersonatorID != 0 {
+		sessionOwner = claims.ImpersonatorID
+	}
+	session, err := database.GetRefreshTokenByID(claims.SessionID)
+	if err != nil || session.Revocado || session.UserID != sessionOwner {
+		return nil, errors.New("sesión revocada o inexistente")
+	}
+	if claims.ImpersonatorID != 0 {
+		return s.impersonationIdentity(claims)
+	}
+
+	user, err := database.GetUserByID(claims.UserID)
+	if err != nil {
+		log.Printf("ValidateToken: usuario del token (ID %d) no disponible: %v", claims.UserID, err)
+		return nil, errors.New("token inválido o expirado")
+	}
+	if !user.Activo {
+		return nil, ErrAccountDisabled
+	}
+
+	return &Identity{
+		UserID:             user.ID,
+		Username:           user.Username,
+		Role:               user.Role,
+		SessionID:          session.ID,
+		MustChangePassword: user.MustChangePassword,
+		MustSetupTwoFactor: s.mustSetupTwoFactor(user),
+		Idioma:             user.Idioma,
+	}, nil
+}
+
+// Refresh canjea un refresh token vigente por un access token nuevo.
+// El refresh token se rota: el anterior deja de ser válido.
+func (s *authService) Refresh(refreshToken string) (*models.LoginResponse, error) {
+	if refreshToken == "" {
+		return nil, apperrors.Required("refresh_token", "refresh_token requerido")
 	}
 
-	log.Printf("CheckPermission: Acceso denegado. Usuario '%s' (Rol: '%s') no tiene rol requerido (%v)", username, role, requiredRoles)
-	return false, nil // No se encontró el rol
+	session, err := database.GetRefreshTokenByHash(hashToken(refreshToken))
+	if err != nil || session.Revocado || time.Now().After(session.ExpiresAt) {
+		return nil, errInvalidRefresh
+	}
+
+	user, err := database.GetUserByID(session.UserID)
+	if err != nil {
+		return nil, errInvalidRefresh
+	}
+	if !user.Activo {
+		return nil, ErrAccountDisabled
+	}
+
+	newRefresh, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("Error en authService.Refresh (newOpaqueToken): %v", err)
+		return nil, errors.New("error al generar el token")
+	}
+	affected, err := database.RotateRefreshToken(session.ID, hashToken(newRefresh), time.Now().Add(refreshTokenTTL))
+	if err != nil || affected == 0 {
+		log.Printf("Error en authService.Refresh (Rotate sesión %d): %v", session.ID, err)
+		return nil, errInvalidRefresh
+	}
+
+	return s.buildLoginResponse(user, session.ID, newRefresh)
+}
+
+// Logout revoca la sesión indicada (y con ella sus access tokens)
+func (s *authService) Logout(sessionID int) error {
+	if sessionID == 0 {
+		return apperrors.New(apperrors.CodeUnauthorized, "sesión requerida")
+	}
+	if _, err := database.RevokeRefreshToken(sessionID); err != nil {
+		log.Printf("Error en authService.Logout (sesión %d): %v", sessionID, err)
+		return errors.New("error al cerrar la sesión")
+	}
+	return nil
+}
+
+// RevokeUserTokens cierra todas las sesiones de un usuario (borrado, cambio de rol...)
+func (s *authService) RevokeUserTokens(userID int) error {
+	if _, err := database.RevokeUserRefreshTokens(userID); err != nil {
+		log.Printf("Error en authService.RevokeUserTokens (user %d): %v", userID, err)
+		return errors.New("error al revocar las sesiones del usuario")
+	}
+	return nil
+}
+
+// ChangePassword cambia la contraseña del propio usuario verificando la actual.
+// Las demás sesiones del usuario se cierran; la sesión desde la que se cambia sigue activa.
+func (s *authService) ChangePassword(userID, sessionID int, currentPassword, newPassword string) error {
+	var check apperrors.Check
+	check.Required("current_password", currentPassword != "")
+	check.Required("new_password", newPassword != "")
+	if err := check.Err("current_password y new_password son requeridos"); err != nil {
+		return err
+	}
+	if err := validatePassword("new_password", newPassword); err != nil {
+		return err
+	}
+	if currentPassword == newPassword {
+		return apperrors.InvalidField("new_password", "la nueva contraseña debe ser distinta de la actual")
+	}
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if !s.password.VerifyPassword(user, currentPassword) {
+		return apperrors.InvalidField("current_password", "la contraseña actual es incorrecta")
+	}
+
+	if _, err := database.UpdateUserPassword(userID, newPassword, false); err != nil {
+		log.Printf("Error en authService.ChangePassword (user %d): %v", userID, err)
+		return errors.New("error al cambiar la contraseña")
+	}
+	if _, err := database.RevokeOtherRefreshTokens(userID, sessionID); err != nil {
+		log.Printf("Error en authService.ChangePassword (revocar sesiones de %d): %v", userID, err)
+	}
+	return nil
+}
+
+// ResetPassword asigna una contraseña temporal (que se devuelve al admin),
+// obliga a cambiarla en el próximo login y cierra todas las sesiones del usuario.
+func (s *authService) ResetPassword(userID int) (string, error) {
+	if userID == 0 {
+		return "", apperrors.Required("id", "id de usuario requerido")
+	}
+
+	temporary, err := newTemporaryPassword()
+	if err != nil {
+		log.Printf("Error en authService.ResetPassword (newTemporaryPassword): %v", err)
+		return "", errors.New("error al generar la contraseña temporal")
+	}
+
+	affected, err := database.UpdateUserPassword(userID, temporary, true)
+	if err != nil {
+		log.Printf("Error en authService.ResetPassword (user %d): %v", userID, err)
+		return "", errors.New("error al restablecer la contraseña")
+	}
+	if affected == 0 {
+		return "", ErrUserNotFound
+	}
+
+	if err := s.RevokeUserTokens(userID); err != nil {
+		return "", err
+	}
+	return temporary, nil
+}
+
+// RequestPasswordReset genera un token de recuperación de un solo uso y lo envía
+// por correo. Devuelve el ID del usuario (0 si no existe o no tiene email): el
+// handler responde lo mismo en ambos casos para no revelar qué usuarios existen.
+func (s *authService) RequestPasswordReset(username string) (int, error) {
+	if username == "" {
+		return 0, apperrors.Required("username", "username requerido")
+	}
+
+	user, err := database.GetUserByUsername(username)
+	if err != nil || user.Email == "" || !user.Activo {
+		return 0, nil
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("Error en authService.RequestPasswordReset (newOpaqueToken): %v", err)
+		return 0, errors.New("error al generar el token de recuperación")
+	}
+	if _, err := database.CreatePasswordResetToken(user.ID, hashToken(token), time.Now().Add(resetTokenTTL)); err != nil {
+		log.Printf("Error en authService.RequestPasswordReset (user %d): %v", user.ID, err)
+		return 0, errors.New("error al generar el token de recuperación")
+	}
+
+	link := os.Getenv(envPasswordResetURL)
+	if link == "" {
+		link = defaultPasswordResetURL
+	}
+	msg := models.MailMessage{
+		To:      user.Email,
+		Subject: "Recuperación de contraseña",
+		Body: fmt.Sprintf("Hola %s,\n\nPara elegir una contraseña nueva ingresa a:\n%s?token=%s\n\n"+
+			"El enlace vence en %d minutos y solo puede usarse una vez. Si no lo solicitaste, ignora este correo.",
+			user.Nombre, link, token, int(resetTokenTTL.Minutes())),
+	}
+	if err := s.mailer.Send(msg); err != nil {
+		log.Printf("Error en authService.RequestPasswordReset (envío a user %d): %v", user.ID, err)
+		return 0, errors.New("error al enviar el correo de recuperación")
+	}
+
+	return user.ID, nil
+}
+
+// ResetPasswordWithToken canjea un token de recuperación por una contraseña nueva
+// y cierra todas las sesiones del usuario. Devuelve la identidad del usuario afectado.
+func (s *authService) ResetPasswordWithToken(token, newPassword string) (*Identity, error) {
+	var check apperrors.Check
+	check.Required("token", token != "")
+	check.Required("new_password", newPassword != "")
+	if err := check.Err("token y new_password son requeridos"); err != nil {
+		return nil, err
+	}
+	if err := validatePassword("new_password", newPassword); err != nil {
+		return nil, err
+	}
+
+	resetToken, err := database.GetPasswordResetTokenByHash(hashToken(token))
+	if err != nil || resetToken.Usado || time.Now().After(resetToken.ExpiresAt) {
+		return nil, errInvalidResetToken
+	}
+
+	// Consumir primero garantiza el uso único aunque lleguen dos peticiones a la vez
+	consumed, err := database.ConsumePasswordResetToken(resetToken.ID)
+	if err != nil || consumed == 0 {
+		return nil, errInvalidResetToken
+	}
+
+	user, err := database.GetUserByID(resetToken.UserID)
+	if err != nil {
+		return nil, errInvalidResetToken
+	}
+	if _, err := database.UpdateUserPassword(user.ID, newPassword, false); err != nil {
+		log.Printf("Error en authService.ResetPasswordWithToken (user %d): %v", user.ID, err)
+		return nil, errors.New("error al cambiar la contraseña")
+	}
+	if err := s.RevokeUserTokens(user.ID); err != nil {
+		return nil, err
+	}
+
+	return &Identity{UserID: user.ID, Username: user.Username, Role: user.Role}, nil
+}
+
+// validateEmail: el email es opcional, pero si viene debe ser válido
+func validateEmail(email string) error {
+	if email == "" {
+		return nil
+	}
+	if addr, err := netmail.ParseAddress(email); err != nil || addr.Address != email {
+		return apperrors.InvalidField("email", "el email no es válido")
+	}
+	return nil
+}
+
+// validatePassword aplica la política mínima de contraseñas (field: campo de la petición)
+func validatePassword(field, password string) error {
+	if len(password) < 6 {
+		return apperrors.InvalidField(field, "la contraseña debe tener al menos 6 caracteres")
+	}
+	return nil
 }
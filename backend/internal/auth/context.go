@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+)
+
+// Identity representa al usuario autenticado de la petición actual.
+// La construye el middleware a partir del token Bearer y los datos vigentes en la DB.
+type Identity struct {
+	UserID    int
+	Username  string
+	Role      string
+	SessionID int
+	// MustChangePassword: la contraseña es temporal y solo se permite cambiarla
+	MustChangePassword bool
+	// MustSetupTwoFactor: su rol exige 2FA y aún no lo activó
+	MustSetupTwoFactor bool
+	// APIKeyID y Scopes solo se llenan si la petición se autenticó con una API key
+	// de una cuenta de servicio; Scopes limita los permisos que la llave puede usar.
+	APIKeyID int
+	Scopes   []string
+	// ImpersonatorID e ImpersonatorUsername: admin que actúa como este usuario
+	// (token de suplantación). Los permisos son los del usuario suplantado.
+	ImpersonatorID       int
+	ImpersonatorUsername string
+	// Idioma: idioma preferido del usuario ("" = el de Accept-Language)
+	Idioma string
+}
+
+// Impersonated indica si la petición la hace un admin suplantando al usuario
+func (id *Identity) Impersonated() bool {
+	return id.ImpersonatorID != 0
+}
+
+// InScope indica si el permiso está dentro del alcance de la credencial usada.
+// Las sesiones JWT no tienen restricción de alcance.
+func (id *Identity) InScope(permission string) bool {
+	if id.APIKeyID == 0 {
+		return true
+	}
+	for _, scope := range id.Scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey string
+
+const identityKey contextKey = "auth.identity"
+
+// WithIdentity devuelve un contexto hijo que transporta la identidad del usuario.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, id)
+}
+
+// IdentityFromContext recupera la identidad guardada por el middleware.
+// Devuelve nil si la petición no pasó por la autenticación.
+func IdentityFromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey).(*Identity)
+	return id
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"proyecto/internal/apperrors"
+	"proyecto/internal/database"
+	"proyecto/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Login con proveedores externos (ver providers.go y oidc.go).
+// 1. StartExternalLogin arma la URL del proveedor con un state firmado y un nonce.
+// 2. El proveedor devuelve code y state al frontend, que los envía a CompleteExternalLogin.
+// 3. Se verifica el ID token, se busca el usuario vinculado (o se crea) y se abre la sesión.
+
+const (
+	externalStateTTL     = 10 * time.Minute
+	externalStatePurpose = "external-login"
+)
+
+var (
+	// ErrUnknownProvider: el proveedor pedido no está configurado
+	ErrUnknownProvider = apperrors.NotFound("proveedor de autenticación desconocido")
+	// ErrExternalLoginFailed: state inválido, código rechazado o ID token no válido
+	ErrExternalLoginFailed = errors.New("no se pudo completar el inicio de sesión externo")
+)
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// GetProviders lista los proveedores habilitados ("local" primero)
+func (s *authService) GetProviders() []string {
+	names := make([]string, 0, len(s.external))
+	for name := range s.external {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{s.password.Name()}, names...)
+}
+
+func (s *authService) StartExternalLogin(ctx context.Context, provider string) (*models.ExternalLoginStart, error) {
+	p, ok := s.external[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	nonce, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("Error en authService.StartExternalLogin (nonce): %v", err)
+		return nil, errors.New("error al iniciar el login externo")
+	}
+	now := time.Now()
+	claims := &models.ExternalStateClaims{
+		Provider: provider,
+		Nonce:    nonce,
+		Purpose:  externalStatePurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(externalStateTTL)),
+		},
+	}
+	kid, key := s.keys.SigningKey()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	state, err := token.SignedString(key)
+	if err != nil {
+		log.Printf("Error en authService.StartExternalLogin (SignedString): %v", err)
+		return nil, errors.New("error al iniciar el login externo")
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, state, nonce)
+	if err != nil {
+		log.Printf("Error en authService.StartExternalLogin (%s): %v", provider, err)
+		return nil, errors.New("el proveedor de autenticación no está disponible")
+	}
+	return &models.ExternalLoginStart{Provider: provider, AuthorizationURL: authURL, State: state}, nil
+}
+
+func (s *authService) CompleteExternalLogin(ctx context.Context, state, code string, client ClientInfo) (*models.LoginResponse, error) {
+	if state == "" || code == "" {
+		return nil, errors.New("state y code son requeridos")
+	}
+
+	claims := &models.ExternalStateClaims{}
+	token, err := jwt.ParseWithClaims(state, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return s.keys.VerificationKey(kid)
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid || claims.Purpose != externalStatePurpose {
+		return nil, ErrExternalLoginFailed
+	}
+	p, ok := s.external[claims.Provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	identity, err := p.Exchange(ctx, code, claims.Nonce)
+	if err != nil {
+		log.Printf("Error en authService.CompleteExternalLogin (%s): %v", claims.Provider, err)
+		return nil, ErrExternalLoginFailed
+	}
+
+	user, err := s.resolveExternalUser(identity)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.TouchExternalIdentity(identity.Provider, identity.Subject, time.Now()); err != nil {
+		log.Printf("Error en authService.CompleteExternalLogin (TouchExternalIdentity): %v", err)
+	}
+
+	// El segundo factor queda a cargo del proveedor externo
+	return s.issueSession(user, client, loginMethodExternal+identity.Provider)
+}
+
+// resolveExternalUser devuelve el usuario vinculado a la identidad, creándolo en el
+// primer login. Si el mapeo de grupos da un rol, se sincroniza en cada login.
+func (s *authService) resolveExternalUser(identity *ExternalIdentity) (*models.UserDB, error) {
+	role := s.mappedRole(identity)
+
+	userID, linked, err := database.GetUserIDByExternalIdentity(identity.Provider, identity.Subject)
+	if err != nil {
+		log.Printf("Error en authService.resolveExternalUser: %v", err)
+		return nil, ErrExternalLoginFailed
+	}
+
+	if !linked {
+		if role == "" {
+			role = models.RoleUser
+		}
+		id, err := s.createExternalUser(identity, role)
+		if err != nil {
+			log.Printf("Error en authService.resolveExternalUser (alta %s/%s): %v", identity.Provider, identity.Subject, err)
+			return nil, ErrExternalLoginFailed
+		}
+		userID = int(id)
+	}
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error en authService.resolveExternalUser (GetUserByID %d): %v", userID, err)
+		return nil, ErrExternalLoginFailed
+	}
+	if user.EsServicio {
+		return nil, ErrExternalLoginFailed
+	}
+	if !user.Activo {
+		return nil, ErrAccountDisabled
+	}
+
+	if linked && role != "" && role != user.Role {
+		if _, err := database.UpdateUserRole(user.ID, role); err != nil {
+			log.Printf("Error en authService.resolveExternalUser (UpdateUserRole %d): %v", user.ID, err)
+		} else {
+			user.Role = role
+		}
+	}
+	return user, nil
+}
+
+// mappedRole valida que el rol que sale del mapeo exista; si no, se ignora
+func (s *authService) mappedRole(identity *ExternalIdentity) string {
+	if identity.Role == "" {
+		return ""
+	}
+	exists, err := database.RoleExists(identity.Role)
+	if err != nil || !exists {
+		log.Printf("authService.mappedRole: el rol %q del proveedor %s no existe, se ignora", identity.Role, identity.Provider)
+		return ""
+	}
+	return identity.Role
+}
+
+func (s *authService) createExternalUser(identity *ExternalIdentity, role string) (int64, error) {
+	username, err := availableUsername(identity)
+	if err != nil {
+		return 0, err
+	}
+
+	secret, err := newOpaqueToken()
+	if err != nil {
+		return 0, err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	nombre, apellido := identity.Nombre, identity.Apellido
+	if nombre == "" {
+		nombre = username
+	}
+	if apellido == "" {
+		apellido = "-"
+	}
+	email := identity.Email
+	if validateEmail(email) != nil {
+		email = ""
+	}
+
+	return database.CreateExternalUser(identity.Provider, identity.Subject, username, string(hashed), role, nombre, apellido, email)
+}
+
+// availableUsername normaliza el username sugerido por el proveedor y le agrega un
+// sufijo numérico si ya está tomado
+func availableUsername(identity *ExternalIdentity) (string, error) {
+	base := usernameInvalidChars.ReplaceAllString(strings.ToLower(identity.Username), "")
+	if len(base) < 3 {
+		base = identity.Provider + "-" + usernameInvalidChars.ReplaceAllString(strings.ToLower(identity.Subject), "")
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	candidate := base
+	for i := 2; i <= 100; i++ {
+		exists, err := database.UsernameExists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", base, i)
+	}
+	return "", fmt.Errorf("no hay username disponible para %q", base)
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"proyecto/internal/apperrors"
+	"proyecto/internal/database"
+	"proyecto/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// impersonationTTL: el token de suplantación es corto y no se puede renovar
+var impersonationTTL = 30 * time.Minute
+
+// ErrImpersonationNotAllowed: el usuario no puede ser suplantado (o el que pide no puede suplantar)
+var ErrImpersonationNotAllowed = apperrors.Forbidden("no está permitido suplantar a este usuario")
+
+// Impersonate emite un access token con la identidad del usuario destino y el admin
+// que lo pide. Va ligado a la sesión del admin: al cerrarla, la suplantación termina.
+func (s *authService) Impersonate(caller *Identity, targetID int) (*models.LoginResponse, error) {
+	if caller.APIKeyID != 0 || caller.SessionID == 0 {
+		return nil, apperrors.Forbidden("la suplantación requiere una sesión de usuario")
+	}
+	if caller.Impersonated() {
+		return nil, apperrors.Forbidden("no se puede suplantar a otro usuario durante una suplantación")
+	}
+	if targetID == 0 {
+		return nil, apperrors.Required("user_id", "user_id requerido")
+	}
+	if targetID == caller.UserID {
+		return nil, apperrors.InvalidField("user_id", "no puede suplantarse a sí mismo")
+	}
+
+	target, err := database.GetUserByID(targetID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !target.Activo || target.EsServicio {
+		return nil, ErrImpersonationNotAllowed
+	}
+	// Quien puede suplantar no puede ser suplantado (evita escalar entre admins)
+	privileged, err := s.CheckPermission(&Identity{UserID: target.ID, Username: target.Username, Role: target.Role}, models.PermUsersImpersonate)
+	if err != nil {
+		return nil, err
+	}
+	if privileged {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	now := time.Now()
+	claims := &models.Claims{
+		UserID:         target.ID,
+		Username:       target.Username,
+		Role:           target.Role,
+		SessionID:      caller.SessionID,
+		ImpersonatorID: caller.UserID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(impersonationTTL)),
+		},
+	}
+	kid, key := s.keys.SigningKey()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	tokenString, err := token.SignedString(key)
+	if err != nil {
+		log.Printf("Error en authService.Impersonate (SignedString): %v", err)
+		return nil, errors.New("error al generar el token")
+	}
+
+	return &models.LoginResponse{
+		Token:     tokenString,
+		ExpiresIn: int(impersonationTTL.Seconds()),
+		User: models.UserDetails{
+			Username: target.Username,
+			Nombre:   target.Nombre,
+			Apellido: target.Apellido,
+			Cedula:   target.Cedula,
+		},
+		Role:           target.Role,
+		UserId:         target.ID,
+		ImpersonatedBy: caller.Username,
+	}, nil
+}
+
+// impersonationIdentity valida un token de suplantación: el admin debe seguir activo
+// y conservar el permiso, y el suplantado debe seguir siendo suplantable
+func (s *authService) impersonationIdentity(claims *models.Claims) (*Identity, error) {
+	admin, err := database.GetUserByID(claims.ImpersonatorID)
+	if err != nil || !admin.Activo {
+		return nil, errors.New("sesión revocada o inexistente")
+	}
+	allowed, err := s.CheckPermission(&Identity{UserID: admin.ID, Username: admin.Username, Role: admin.Role}, models.PermUsersImpersonate)
+	if err != nil || !allowed {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	user, err := database.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, errors.New("token inválido o expirado")
+	}
+	if !user.Activo {
+		return nil, ErrAccountDisabled
+	}
+
+	// Los pasos pendientes del usuario (contraseña temporal, 2FA) no aplican al admin
+	return &Identity{
+		UserID:               user.ID,
+		Username:             user.Username,
+		Role:                 user.Role,
+		SessionID:            claims.SessionID,
+		ImpersonatorID:       admin.ID,
+		ImpersonatorUsername: admin.Username,
+	}, nil
+}
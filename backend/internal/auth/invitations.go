@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"proyecto/internal/apperrors"
+	"proyecto/internal/database"
+	"proyecto/internal/models"
+)
+
+// Registro por invitación: el admin puede cerrar el registro abierto y emitir códigos
+// que fijan el rol (y opcionalmente el proyecto) de quien se registra con ellos.
+
+const (
+	// settingRegistrationOpen: "true"/"false". Si no está definida, el registro es abierto.
+	settingRegistrationOpen = "registration_open"
+
+	defaultInvitationTTL = 7 * 24 * time.Hour
+	maxInvitationDays    = 90
+	maxInvitationUses    = 1000
+)
+
+// ErrRegistrationClosed: el registro abierto está desactivado y no se envió código
+var ErrRegistrationClosed = apperrors.Forbidden("el registro está cerrado: se requiere un código de invitación")
+
+// IsRegistrationOpen indica si se puede registrar sin código de invitación
+func (s *authService) IsRegistrationOpen() (bool, error) {
+	value, ok, err := database.GetSetting(settingRegistrationOpen)
+	if err != nil {
+		log.Printf("Error en authService.IsRegistrationOpen: %v", err)
+		return false, errors.New("error al leer la política de registro")
+	}
+	if !ok {
+		return true, nil
+	}
+	open, err := strconv.ParseBool(value)
+	if err != nil {
+		// Un valor corrupto no debe abrir el registro
+		log.Printf("Error en authService.IsRegistrationOpen (valor %q): %v", value, err)
+		return false, nil
+	}
+	return open, nil
+}
+
+// SetRegistrationOpen activa o desactiva el registro sin invitación
+func (s *authService) SetRegistrationOpen(open bool) error {
+	if err := database.SetSetting(settingRegistrationOpen, strconv.FormatBool(open)); err != nil {
+		log.Printf("Error en authService.SetRegistrationOpen: %v", err)
+		return errors.New("error al guardar la política de registro")
+	}
+	return nil
+}
+
+// CreateInvitation emite un código de invitación. El código en claro solo se devuelve aquí.
+func (s *authService) CreateInvitation(req models.CreateInvitationRequest, createdBy string) (*models.CreateInvitationResponse, error) {
+	role := strings.ToLower(strings.TrimSpace(req.Role))
+	if role == "" {
+		role = models.RoleUser
+	}
+	exists, err := database.RoleExists(role)
+	if err != nil {
+		log.Printf("Error en authService.CreateInvitation (RoleExists %s): %v", role, err)
+		return nil, errors.New("error al crear la invitación")
+	}
+	if !exists {
+		return nil, apperrors.InvalidField("role", fmt.Sprintf("rol desconocido: %q", role))
+	}
+	if req.ProyectoID != 0 {
+		if _, err := database.GetProjectByID(int64(req.ProyectoID)); err != nil {
+			return nil, apperrors.NotFound("proyecto no encontrado")
+		}
+	}
+
+	maxUsos := req.MaxUsos
+	if maxUsos == 0 {
+		maxUsos = 1
+	}
+	if maxUsos < 0 || maxUsos > maxInvitationUses {
+		return nil, apperrors.InvalidField("max_usos", fmt.Sprintf("max_usos debe estar entre 1 y %d", maxInvitationUses))
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxInvitationDays {
+		return nil, apperrors.InvalidField("expires_in_days", fmt.Sprintf("expires_in_days debe estar entre 1 y %d", maxInvitationDays))
+	}
+	ttl := defaultInvitationTTL
+	if req.ExpiresInDays > 0 {
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+
+	code, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("Error en authService.CreateInvitation (código): %v", err)
+		return nil, errors.New("error al generar el código de invitación")
+	}
+
+	id, err := database.CreateInvitation(hashToken(code), role, req.ProyectoID, maxUsos, time.Now().Add(ttl), createdBy)
+	if err != nil {
+		log.Printf("Error en authService.CreateInvitation: %v", err)
+		return nil, errors.New("error al guardar la invitación")
+	}
+	created, err := database.GetInvitationByID(int(id))
+	if err != nil {
+		log.Printf("Error en authService.CreateInvitation (GetInvitationByID %d): %v", id, err)
+		return nil, errors.New("error al guardar la invitación")
+	}
+	return &models.CreateInvitationResponse{Codigo: code, Invitation: *created}, nil
+}
+
+func (s *authService) GetInvitations() ([]models.Invitation, error) {
+	invitations, err := database.GetInvitations()
+	if err != nil {
+		log.Printf("Error en authService.GetInvitations: %v", err)
+		return nil, errors.New("error al obtener las invitaciones")
+	}
+	return invitations, nil
+}
+
+func (s *authService) RevokeInvitation(id int) error {
+	affected, err := database.RevokeInvitation(id)
+	if err != nil {
+		log.Printf("Error en authService.RevokeInvitation (%d): %v", id, err)
+		return errors.New("error al revocar la invitación")
+	}
+	if affected == 0 {
+		return apperrors.NotFound("invitación no encontrada o ya revocada")
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Variables de entorno que configuran las llaves de firma de los JWT:
+//
+//	JWT_KEYS         pares "kid:secreto" separados por comas (llaves activas)
+//	JWT_ACTIVE_KID   kid con el que se firman los tokens nuevos (por defecto, el último de JWT_KEYS)
+//	JWT_RETIRED_KIDS kids retirados: sus tokens se rechazan con un error explícito
+//	JWT_SECRET       atajo para una sola llave (kid "default") si no se define JWT_KEYS
+const (
+	envJWTKeys        = "JWT_KEYS"
+	envJWTActiveKID   = "JWT_ACTIVE_KID"
+	envJWTRetiredKIDs = "JWT_RETIRED_KIDS"
+	envJWTSecret      = "JWT_SECRET"
+)
+
+// minKeyLength evita secretos triviales para HS256
+const minKeyLength = 32
+
+// devKeyID / devKey solo se usan si no hay configuración (desarrollo y tests)
+const (
+	devKeyID = "dev"
+	devKey   = "mi_llave_secreta_super_segura_12345"
+)
+
+var (
+	errMissingKID = errors.New("token sin identificador de llave (kid)")
+	errRetiredKey = errors.New("token firmado con una llave retirada, inicie sesión de nuevo")
+	errUnknownKey = errors.New("token firmado con una llave desconocida")
+)
+
+// KeyRing agrupa las llaves de firma de los JWT.
+// Todas las llaves activas sirven para verificar; solo la de signingKID firma.
+// Rotar consiste en agregar una llave nueva, hacerla la activa y, cuando los
+// tokens viejos ya hayan expirado, moverla a la lista de retiradas.
+type KeyRing struct {
+	signingKID string
+	keys       map[string][]byte
+	retired    map[string]bool
+}
+
+// NewKeyRing valida y construye un llavero a partir de llaves ya cargadas
+func NewKeyRing(signingKID string, keys map[string][]byte, retiredKIDs []string) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("se requiere al menos una llave de firma")
+	}
+	if _, ok := keys[signingKID]; !ok {
+		return nil, fmt.Errorf("la llave activa %q no está entre las llaves configuradas", signingKID)
+	}
+
+	ring := &KeyRing{
+		signingKID: signingKID,
+		keys:       make(map[string][]byte, len(keys)),
+		retired:    make(map[string]bool, len(retiredKIDs)),
+	}
+	for kid, key := range keys {
+		if kid == "" {
+			return nil, errors.New("el kid de una llave no puede estar vacío")
+		}
+		if len(key) < minKeyLength {
+			return nil, fmt.Errorf("la llave %q debe tener al menos %d caracteres", kid, minKeyLength)
+		}
+		ring.keys[kid] = key
+	}
+	for _, kid := range retiredKIDs {
+		if _, ok := ring.keys[kid]; ok {
+			return nil, fmt.Errorf("la llave %q no puede estar activa y retirada a la vez", kid)
+		}
+		ring.retired[kid] = true
+	}
+
+	return ring, nil
+}
+
+// LoadKeyRingFromEnv lee las llaves desde las variables de entorno.
+// Sin configuración se usa una llave de desarrollo y se avisa en el log.
+func LoadKeyRingFromEnv() (*KeyRing, error) {
+	retired := splitList(os.Getenv(envJWTRetiredKIDs))
+
+	if raw := strings.TrimSpace(os.Getenv(envJWTKeys)); raw != "" {
+		keys := make(map[string][]byte)
+		lastKID := ""
+		for _, pair := range splitList(raw) {
+			kid, secret, ok := strings.Cut(pair, ":")
+			kid = strings.TrimSpace(kid)
+			if !ok || kid == "" || secret == "" {
+				return nil, fmt.Errorf("%s: entrada inválida %q (formato kid:secreto)", envJWTKeys, pair)
+			}
+			if _, dup := keys[kid]; dup {
+				return nil, fmt.Errorf("%s: kid duplicado %q", envJWTKeys, kid)
+			}
+			keys[kid] = []byte(secret)
+			lastKID = kid
+		}
+
+		active := strings.TrimSpace(os.Getenv(envJWTActiveKID))
+		if active == "" {
+			active = lastKID
+		}
+		return NewKeyRing(active, keys, retired)
+	}
+
+	if secret := os.Getenv(envJWTSecret); secret != "" {
+		return NewKeyRing("default", map[string][]byte{"default": []byte(secret)}, retired)
+	}
+
+	log.Printf("⚠️ %s/%s no definidos: se usa la llave de desarrollo. No usar en producción.", envJWTKeys, envJWTSecret)
+	return NewKeyRing(devKeyID, map[string][]byte{devKeyID: []byte(devKey)}, retired)
+}
+
+// SigningKey devuelve el kid y la llave con la que se firman los tokens nuevos
+func (k *KeyRing) SigningKey() (string, []byte) {
+	return k.signingKID, k.keys[k.signingKID]
+}
+
+// VerificationKey busca la llave de un kid, distinguiendo retiradas de desconocidas
+func (k *KeyRing) VerificationKey(kid string) ([]byte, error) {
+	if kid == "" {
+		return nil, errMissingKID
+	}
+	if k.retired[kid] {
+		return nil, errRetiredKey
+	}
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+func splitList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Variables de entorno de la protección contra fuerza bruta en el login
+const (
+	envLoginMaxFailures    = "LOGIN_MAX_FAILURES"     // fallos seguidos antes de bloquear la cuenta
+	envLoginLockoutMinutes = "LOGIN_LOCKOUT_MINUTES"  // duración del bloqueo de cuenta
+	envLoginIPFreeAttempts = "LOGIN_IP_FREE_ATTEMPTS" // fallos por IP antes de empezar el backoff
+)
+
+// LoginPolicy define cuándo se bloquea una cuenta y cómo crece la espera por IP
+type LoginPolicy struct {
+	MaxFailures     int           // Fallos seguidos de una cuenta antes de bloquearla
+	LockoutDuration time.Duration // Tiempo que la cuenta queda bloqueada
+	IPFreeAttempts  int           // Fallos por IP sin espera
+	IPBaseDelay     time.Duration // Primera espera; se duplica con cada fallo extra
+	IPMaxDelay      time.Duration // Tope de la espera por IP
+	IPResetAfter    time.Duration // Sin fallos durante este tiempo, el contador de la IP se reinicia
+}
+
+// DefaultLoginPolicy son los valores usados si no hay configuración
+func DefaultLoginPolicy() LoginPolicy {
+	return LoginPolicy{
+		MaxFailures:     5,
+		LockoutDuration: 15 * time.Minute,
+		IPFreeAttempts:  10,
+		IPBaseDelay:     2 * time.Second,
+		IPMaxDelay:      15 * time.Minute,
+		IPResetAfter:    time.Hour,
+	}
+}
+
+// LoadLoginPolicyFromEnv aplica las variables de entorno sobre los valores por defecto
+func LoadLoginPolicyFromEnv() (LoginPolicy, error) {
+	policy := DefaultLoginPolicy()
+
+	settings := []struct {
+		env   string
+		apply func(n int)
+	}{
+		{envLoginMaxFailures, func(n int) { policy.MaxFailures = n }},
+		{envLoginLockoutMinutes, func(n int) { policy.LockoutDuration = time.Duration(n) * time.Minute }},
+		{envLoginIPFreeAttempts, func(n int) { policy.IPFreeAttempts = n }},
+	}
+	for _, setting := range settings {
+		raw := os.Getenv(setting.env)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return policy, fmt.Errorf("%s debe ser un entero positivo (valor: %q)", setting.env, raw)
+		}
+		setting.apply(n)
+	}
+
+	return policy, nil
+}
+
+// ipDelay calcula la espera exigida a una IP tras acumular failures fallos
+func (p LoginPolicy) ipDelay(failures int) time.Duration {
+	extra := failures - p.IPFreeAttempts
+	if extra <= 0 {
+		return 0
+	}
+	delay := p.IPBaseDelay
+	for i := 1; i < extra && delay < p.IPMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.IPMaxDelay {
+		delay = p.IPMaxDelay
+	}
+	return delay
+}
+
+// LoginBlockedError indica que el login se rechazó sin comprobar la contraseña
+// (cuenta bloqueada o IP en espera). RetryAfter sirve para la cabecera Retry-After.
+type LoginBlockedError struct {
+	RetryAfter    time.Duration
+	AccountLocked bool   // true: bloqueo de la cuenta; false: backoff de la IP
+	JustLocked    bool   // true si este intento fue el que bloqueó la cuenta
+	Username      string // Cuenta afectada (vacío en el backoff por IP)
+}
+
+func (e *LoginBlockedError) Error() string {
+	minutes := int(e.RetryAfter.Round(time.Minute).Minutes())
+	if e.AccountLocked {
+		if minutes < 1 {
+			minutes = 1
+		}
+		return fmt.Sprintf("cuenta bloqueada temporalmente por intentos fallidos, intente de nuevo en %d minuto(s)", minutes)
+	}
+	return fmt.Sprintf("demasiados intentos fallidos desde esta dirección, espere %d segundo(s)", int(e.RetryAfter.Seconds()+0.999))
+}
@@ -0,0 +1,353 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Variables de entorno del proveedor OpenID Connect (si OIDC_ISSUER no está definido,
+// el login externo queda desactivado):
+//
+//	OIDC_ISSUER         URL del emisor; la configuración se descubre en /.well-known/openid-configuration
+//	OIDC_CLIENT_ID      client_id registrado en el proveedor
+//	OIDC_CLIENT_SECRET  secreto del cliente
+//	OIDC_REDIRECT_URL   página del frontend que recibe code y state
+//	OIDC_PROVIDER_NAME  nombre del proveedor en la API (por defecto "oidc")
+//	OIDC_SCOPES         scopes separados por comas (por defecto "openid,profile,email")
+//	OIDC_ROLE_CLAIM     claim con los grupos del usuario (por defecto "groups")
+//	OIDC_ROLE_MAP       pares "grupo=rol" separados por comas; el primero que coincide gana
+const (
+	envOIDCIssuer       = "OIDC_ISSUER"
+	envOIDCClientID     = "OIDC_CLIENT_ID"
+	envOIDCClientSecret = "OIDC_CLIENT_SECRET"
+	envOIDCRedirectURL  = "OIDC_REDIRECT_URL"
+	envOIDCProviderName = "OIDC_PROVIDER_NAME"
+	envOIDCScopes       = "OIDC_SCOPES"
+	envOIDCRoleClaim    = "OIDC_ROLE_CLAIM"
+	envOIDCRoleMap      = "OIDC_ROLE_MAP"
+)
+
+const (
+	defaultOIDCProviderName = "oidc"
+	defaultOIDCRoleClaim    = "groups"
+	oidcHTTPTimeout         = 10 * time.Second
+)
+
+var defaultOIDCScopes = []string{"openid", "profile", "email"}
+
+// RoleMapping asigna un rol local a quienes traen un grupo (o valor) en el claim de roles
+type RoleMapping struct {
+	Group string
+	Role  string
+}
+
+// OIDCConfig es la configuración de un proveedor OpenID Connect
+type OIDCConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	RoleClaim    string
+	RoleMap      []RoleMapping
+}
+
+// LoadOIDCConfigFromEnv lee la configuración; ok es false si OIDC no está configurado
+func LoadOIDCConfigFromEnv() (cfg OIDCConfig, ok bool, err error) {
+	cfg.Issuer = strings.TrimRight(strings.TrimSpace(os.Getenv(envOIDCIssuer)), "/")
+	if cfg.Issuer == "" {
+		return cfg, false, nil
+	}
+	cfg.ClientID = strings.TrimSpace(os.Getenv(envOIDCClientID))
+	cfg.ClientSecret = os.Getenv(envOIDCClientSecret)
+	cfg.RedirectURL = strings.TrimSpace(os.Getenv(envOIDCRedirectURL))
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return cfg, false, fmt.Errorf("%s y %s son requeridos si se define %s", envOIDCClientID, envOIDCRedirectURL, envOIDCIssuer)
+	}
+
+	cfg.Name = strings.TrimSpace(os.Getenv(envOIDCProviderName))
+	if cfg.Name == "" {
+		cfg.Name = defaultOIDCProviderName
+	}
+	if cfg.Name == LocalProviderName {
+		return cfg, false, fmt.Errorf("%s no puede ser %q", envOIDCProviderName, LocalProviderName)
+	}
+	cfg.Scopes = splitList(os.Getenv(envOIDCScopes))
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = defaultOIDCScopes
+	}
+	cfg.RoleClaim = strings.TrimSpace(os.Getenv(envOIDCRoleClaim))
+	if cfg.RoleClaim == "" {
+		cfg.RoleClaim = defaultOIDCRoleClaim
+	}
+	for _, pair := range splitList(os.Getenv(envOIDCRoleMap)) {
+		group, role, found := strings.Cut(pair, "=")
+		group, role = strings.TrimSpace(group), strings.ToLower(strings.TrimSpace(role))
+		if !found || group == "" || role == "" {
+			return cfg, false, fmt.Errorf("%s: entrada inválida %q (formato grupo=rol)", envOIDCRoleMap, pair)
+		}
+		cfg.RoleMap = append(cfg.RoleMap, RoleMapping{Group: group, Role: role})
+	}
+	return cfg, true, nil
+}
+
+// oidcDiscovery es la parte del documento de descubrimiento que se usa
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcProvider implementa RedirectProvider. La configuración del emisor y sus llaves
+// públicas se descargan la primera vez que se usan (el backend arranca aunque el
+// proveedor no esté disponible) y las llaves se recargan si aparece un kid nuevo.
+type oidcProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	jwks      map[string]*rsa.PublicKey
+}
+
+// NewOIDCProvider construye el proveedor; client nil usa un cliente HTTP con timeout
+func NewOIDCProvider(cfg OIDCConfig, client *http.Client) RedirectProvider {
+	if client == nil {
+		client = &http.Client{Timeout: oidcHTTPTimeout}
+	}
+	return &oidcProvider{cfg: cfg, client: client}
+}
+
+func (p *oidcProvider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, state, nonce string) (string, error) {
+	disc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.cfg.ClientID},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"scope":         {strings.Join(p.cfg.Scopes, " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	sep := "?"
+	if strings.Contains(disc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return disc.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code, nonce string) (*ExternalIdentity, error) {
+	disc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Canje del código en el token endpoint (client_secret_basic)
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {p.cfg.RedirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, disc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: petición de token: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: respuesta del token endpoint: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: el token endpoint respondió %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil || tokens.IDToken == "" {
+		return nil, errors.New("oidc: la respuesta del token endpoint no trae id_token")
+	}
+
+	// 2. Verificación del ID token: firma, emisor, audiencia, expiración y nonce
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokens.IDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(disc.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: id_token inválido: %w", err)
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, errors.New("oidc: el nonce del id_token no coincide")
+	}
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("oidc: el id_token no trae sub")
+	}
+
+	identity := &ExternalIdentity{
+		Provider: p.cfg.Name,
+		Subject:  subject,
+		Email:    stringClaim(claims, "email"),
+		Nombre:   stringClaim(claims, "given_name"),
+		Apellido: stringClaim(claims, "family_name"),
+		Username: stringClaim(claims, "preferred_username"),
+		Role:     p.mapRole(claims[p.cfg.RoleClaim]),
+	}
+	if identity.Username == "" {
+		identity.Username, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if identity.Nombre == "" {
+		identity.Nombre = stringClaim(claims, "name")
+	}
+	return identity, nil
+}
+
+// mapRole recorre el mapeo en orden y devuelve el rol del primer grupo que trae el usuario
+func (p *oidcProvider) mapRole(claim interface{}) string {
+	var groups []string
+	switch v := claim.(type) {
+	case string:
+		groups = strings.Fields(strings.ReplaceAll(v, ",", " "))
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	}
+	for _, m := range p.cfg.RoleMap {
+		for _, g := range groups {
+			if g == m.Group {
+				return m.Role
+			}
+		}
+	}
+	return ""
+}
+
+func (p *oidcProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var disc oidcDiscovery
+	if err := p.getJSON(ctx, p.cfg.Issuer+"/.well-known/openid-configuration", &disc); err != nil {
+		return nil, fmt.Errorf("oidc: descubrimiento: %w", err)
+	}
+	if strings.TrimRight(disc.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: el emisor publicado (%q) no coincide con %s", disc.Issuer, envOIDCIssuer)
+	}
+	if disc.AuthorizationEndpoint == "" || disc.TokenEndpoint == "" || disc.JWKSURI == "" {
+		return nil, errors.New("oidc: el documento de descubrimiento está incompleto")
+	}
+	p.discovery = &disc
+	return p.discovery, nil
+}
+
+// publicKey devuelve la llave RSA de un kid, recargando el JWKS si no la conoce
+func (p *oidcProvider) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.jwks[kid]
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	disc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, disc.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc: jwks: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	p.mu.Lock()
+	p.jwks = keys
+	p.mu.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("oidc: llave desconocida (kid %q)", kid)
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s respondió %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"context"
+
+	"proyecto/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Proveedores de autenticación. La contraseña local (bcrypt en la tabla users) es uno
+// más; los proveedores externos (OpenID Connect) delegan el login por redirección y
+// devuelven una identidad que se vincula a un usuario local (o lo crea en el momento).
+
+// LocalProviderName identifica las cuentas con contraseña propia
+const LocalProviderName = "local"
+
+// 1. EL CONTRATO (Interfaces)
+
+// AuthProvider es cualquier origen de identidades; Name lo identifica en la API y en la DB
+type AuthProvider interface {
+	Name() string
+}
+
+// PasswordProvider verifica la contraseña de un usuario ya cargado. El bloqueo de
+// cuentas y el backoff por IP quedan en authService.Login, fuera del proveedor.
+type PasswordProvider interface {
+	AuthProvider
+	VerifyPassword(user *models.UserDB, password string) bool
+}
+
+// RedirectProvider delega el login en un proveedor externo (flujo authorization code)
+type RedirectProvider interface {
+	AuthProvider
+	// AuthCodeURL arma la URL a la que se envía al usuario para iniciar sesión
+	AuthCodeURL(ctx context.Context, state, nonce string) (string, error)
+	// Exchange canjea el código recibido en el callback y devuelve la identidad verificada
+	Exchange(ctx context.Context, code, nonce string) (*ExternalIdentity, error)
+}
+
+// ExternalIdentity son los datos que un proveedor externo afirma sobre el usuario
+type ExternalIdentity struct {
+	Provider string
+	Subject  string // Identificador estable del usuario en el proveedor (claim "sub")
+	Username string // Sugerencia de username (preferred_username o email)
+	Email    string
+	Nombre   string
+	Apellido string
+	Role     string // Rol local según el mapeo de grupos; vacío si ningún grupo coincide
+}
+
+// 2. LA IMPLEMENTACIÓN (Struct)
+
+// localProvider compara la contraseña con el hash bcrypt guardado
+type localProvider struct{}
+
+// 3. EL CONSTRUCTOR
+func NewLocalProvider() PasswordProvider {
+	return &localProvider{}
+}
+
+// 4. LOS MÉTODOS
+func (p *localProvider) Name() string {
+	return LocalProviderName
+}
+
+func (p *localProvider) VerifyPassword(user *models.UserDB, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password)) == nil
+}
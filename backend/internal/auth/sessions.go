@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"proyecto/internal/apperrors"
+	"proyecto/internal/database"
+	"proyecto/internal/models"
+)
+
+// Métodos con los que se abre una sesión (columna login_history.metodo)
+const (
+	LoginMethodPassword  = "password"
+	LoginMethodTwoFactor = "2fa"
+	loginMethodExternal  = "oidc:" // + nombre del proveedor
+)
+
+// loginHistoryLimit: cuántos logins devuelve el historial de un usuario
+const loginHistoryLimit = 50
+
+// maxUserAgentLength evita guardar cabeceras User-Agent desmesuradas
+const maxUserAgentLength = 255
+
+// ClientInfo identifica desde dónde se inicia sesión
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+func (c ClientInfo) userAgent() string {
+	if len(c.UserAgent) > maxUserAgentLength {
+		return c.UserAgent[:maxUserAgentLength]
+	}
+	return c.UserAgent
+}
+
+// ErrSessionNotFound: la sesión no existe, ya fue revocada o es de otro usuario
+var ErrSessionNotFound = apperrors.NotFound("sesión no encontrada")
+
+// GetSessions lista las sesiones abiertas del usuario y marca la actual
+func (s *authService) GetSessions(userID, currentSessionID int) ([]models.Session, error) {
+	sessions, err := database.GetActiveSessions(userID, time.Now())
+	if err != nil {
+		log.Printf("Error en authService.GetSessions (user %d): %v", userID, err)
+		return nil, errors.New("error al obtener las sesiones")
+	}
+	for i := range sessions {
+		sessions[i].Actual = sessions[i].ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+// RevokeSession cierra una sesión propia (por ejemplo, la de un equipo perdido)
+func (s *authService) RevokeSession(userID, sessionID int) error {
+	if sessionID == 0 {
+		return apperrors.Required("id", "id de sesión requerido")
+	}
+	affected, err := database.RevokeSessionOfUser(userID, sessionID)
+	if err != nil {
+		log.Printf("Error en authService.RevokeSession (user %d, sesión %d): %v", userID, sessionID, err)
+		return errors.New("error al cerrar la sesión")
+	}
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// GetLoginHistory devuelve los últimos inicios de sesión de un usuario
+func (s *authService) GetLoginHistory(userID int) ([]models.LoginRecord, error) {
+	if userID == 0 {
+		return nil, apperrors.Required("user_id", "user_id requerido")
+	}
+	history, err := database.GetLoginHistory(userID, loginHistoryLimit)
+	if err != nil {
+		log.Printf("Error en authService.GetLoginHistory (user %d): %v", userID, err)
+		return nil, errors.New("error al obtener el historial de inicios de sesión")
+	}
+	return history, nil
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"proyecto/internal/database"
+	"proyecto/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// issueSession crea una sesión nueva (refresh token persistido), la anota en el
+// historial de logins y firma su access token
+func (s *authService) issueSession(user *models.UserDB, client ClientInfo, metodo string) (*models.LoginResponse, error) {
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("Error en issueSession (newOpaqueToken): %v", err)
+		return nil, errors.New("error al generar el token")
+	}
+
+	now := time.Now()
+	sessionID, err := database.CreateRefreshToken(user.ID, hashToken(refreshToken), now.Add(refreshTokenTTL), client.IP, client.userAgent())
+	if err != nil {
+		log.Printf("Error en issueSession (CreateRefreshToken): %v", err)
+		return nil, errors.New("error al generar el token")
+	}
+	// El historial es informativo: si falla, el login sigue adelante
+	if err := database.RecordLogin(user.ID, int(sessionID), client.IP, client.userAgent(), metodo, now); err != nil {
+		log.Printf("Error en issueSession (RecordLogin user %d): %v", user.ID, err)
+	}
+
+	return s.buildLoginResponse(user, int(sessionID), refreshToken)
+}
+
+// buildLoginResponse firma el access token ligado a la sesión y arma la respuesta
+func (s *authService) buildLoginResponse(user *models.UserDB, sessionID int, refreshToken string) (*models.LoginResponse, error) {
+	now := time.Now()
+	claims := &models.Claims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+		},
+	}
+
+	kid, key := s.keys.SigningKey()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	tokenString, err := token.SignedString(key)
+	if err != nil {
+		log.Printf("Error en buildLoginResponse (SignedString): %v", err)
+		return nil, errors.New("error al generar el token")
+	}
+
+	return &models.LoginResponse{
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		User: models.UserDetails{
+			Username: user.Username,
+			Nombre:   user.Nombre,
+			Apellido: user.Apellido,
+			Cedula:   user.Cedula,
+		},
+		Role:                   user.Role,
+		UserId:                 user.ID,
+		MustChangePassword:     user.MustChangePassword,
+		TwoFactorSetupRequired: s.mustSetupTwoFactor(user),
+	}, nil
+}
+
+// newOpaqueToken genera un token aleatorio apto para URLs (refresh tokens, etc.)
+func newOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// newTemporaryPassword genera una contraseña temporal legible (12 caracteres)
+func newTemporaryPassword() (string, error) {
+	buf := make([]byte, 9)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken: en la DB solo se guarda el SHA-256 del token, nunca el valor original
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,306 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"proyecto/internal/apperrors"
+	"proyecto/internal/database"
+	"proyecto/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Segundo factor (TOTP): enrolamiento, verificación en el login y política por rol.
+
+const (
+	challengeTTL      = 5 * time.Minute
+	challengePurpose  = "2fa"
+	recoveryCodeCount = 10
+
+	// settingTwoFactorRoles: roles (separados por comas) que deben usar 2FA
+	settingTwoFactorRoles = "two_factor_required_roles"
+
+	envTOTPIssuer     = "TOTP_ISSUER"
+	defaultTOTPIssuer = "Gestion Agricola"
+)
+
+// errInvalidChallenge: token de desafío vencido, ajeno o de un usuario que ya no aplica
+var errInvalidChallenge = apperrors.New(apperrors.CodeUnauthorized, "desafío inválido o expirado, inicie sesión de nuevo")
+
+// SecondFactorError: código 2FA o de recuperación incorrecto.
+// Username permite auditar el intento aunque el cliente solo envíe el desafío.
+type SecondFactorError struct {
+	Username string
+}
+
+func (e *SecondFactorError) Error() string {
+	return "código de verificación inválido"
+}
+
+// SetupTwoFactor genera un secreto nuevo (pendiente hasta EnableTwoFactor)
+func (s *authService) SetupTwoFactor(userID int) (*models.TwoFactorSetupResponse, error) {
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.TOTPEnabled {
+		return nil, apperrors.Validation("la verificación en dos pasos ya está activa")
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		log.Printf("Error en authService.SetupTwoFactor (newTOTPSecret): %v", err)
+		return nil, errors.New("error al generar el secreto")
+	}
+	if err := database.SetPendingTOTPSecret(userID, secret); err != nil {
+		log.Printf("Error en authService.SetupTwoFactor (user %d): %v", userID, err)
+		return nil, errors.New("error al generar el secreto")
+	}
+
+	issuer := os.Getenv(envTOTPIssuer)
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+	return &models.TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(issuer, user.Username, secret),
+	}, nil
+}
+
+// EnableTwoFactor confirma el enrolamiento con un código de la app y devuelve
+// los códigos de recuperación (solo se muestran esta vez)
+func (s *authService) EnableTwoFactor(userID int, code string) ([]string, error) {
+	secret, enabled, lastStep, err := database.GetUserTOTP(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if enabled {
+		return nil, apperrors.Validation("la verificación en dos pasos ya está activa")
+	}
+	if secret == "" {
+		return nil, apperrors.Validation("primero debe iniciar la configuración (2fa/setup)")
+	}
+
+	step, ok := matchTOTP(secret, strings.TrimSpace(code), time.Now(), lastStep)
+	if !ok {
+		return nil, apperrors.InvalidField("code", "código de verificación inválido")
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		c, err := newRecoveryCode()
+		if err != nil {
+			log.Printf("Error en authService.EnableTwoFactor (newRecoveryCode): %v", err)
+			return nil, errors.New("error al generar los códigos de recuperación")
+		}
+		codes = append(codes, c)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(c)))
+	}
+
+	if err := database.EnableTOTP(userID, step, hashes); err != nil {
+		log.Printf("Error en authService.EnableTwoFactor (user %d): %v", userID, err)
+		return nil, errors.New("error al activar la verificación en dos pasos")
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor desactiva el 2FA del propio usuario (pide contraseña y código).
+// No se permite si su rol lo exige.
+func (s *authService) DisableTwoFactor(userID int, password, code string) error {
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if !user.TOTPEnabled {
+		return apperrors.Validation("la verificación en dos pasos no está activa")
+	}
+	if required, err := s.roleRequiresTwoFactor(user.Role); err != nil || required {
+		return apperrors.Forbidden("su rol exige la verificación en dos pasos")
+	}
+	if !s.password.VerifyPassword(user, password) {
+		return apperrors.InvalidField("password", "la contraseña es incorrecta")
+	}
+	if err := s.checkSecondFactor(user, code, ""); err != nil {
+		return apperrors.InvalidField("code", "código de verificación inválido")
+	}
+
+	if err := database.DisableTOTP(userID); err != nil {
+		log.Printf("Error en authService.DisableTwoFactor (user %d): %v", userID, err)
+		return errors.New("error al desactivar la verificación en dos pasos")
+	}
+	return nil
+}
+
+// VerifyTwoFactor completa un login que quedó pendiente del segundo factor.
+// Los códigos incorrectos cuentan como intentos fallidos de login (bloqueo de cuenta).
+func (s *authService) VerifyTwoFactor(challengeToken, code, recoveryCode string, client ClientInfo) (*models.LoginResponse, error) {
+	var check apperrors.Check
+	check.Required("challenge_token", challengeToken != "")
+	check.Required("code", code != "" || recoveryCode != "")
+	if err := check.Err("challenge_token y code (o recovery_code) son requeridos"); err != nil {
+		return nil, err
+	}
+
+	claims := &models.ChallengeClaims{}
+	token, err := jwt.ParseWithClaims(challengeToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return s.keys.VerificationKey(kid)
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid || claims.Purpose != challengePurpose {
+		return nil, errInvalidChallenge
+	}
+
+	user, err := database.GetUserByID(claims.UserID)
+	if err != nil || !user.TOTPEnabled || !user.Activo {
+		return nil, errInvalidChallenge
+	}
+
+	now := time.Now()
+	_, lockedUntil, err := database.GetUserLockout(user.ID)
+	if err != nil {
+		log.Printf("Error en authService.VerifyTwoFactor (GetUserLockout %d): %v", user.ID, err)
+		return nil, errors.New("error al verificar el estado de la cuenta")
+	}
+	if now.Before(lockedUntil) {
+		return nil, &LoginBlockedError{RetryAfter: lockedUntil.Sub(now), AccountLocked: true, Username: user.Username}
+	}
+
+	if err := s.checkSecondFactor(user, code, recoveryCode); err != nil {
+		if blocked := s.registerFailedLogin(user, now); blocked != nil {
+			return nil, blocked
+		}
+		return nil, &SecondFactorError{Username: user.Username}
+	}
+
+	if _, err := database.ResetUserLockout(user.ID); err != nil {
+		log.Printf("Error en authService.VerifyTwoFactor (ResetUserLockout %d): %v", user.ID, err)
+	}
+	return s.issueSession(user, client, LoginMethodTwoFactor)
+}
+
+// GetTwoFactorRoles devuelve los roles que deben usar 2FA
+func (s *authService) GetTwoFactorRoles() ([]string, error) {
+	value, _, err := database.GetSetting(settingTwoFactorRoles)
+	if err != nil {
+		log.Printf("Error en authService.GetTwoFactorRoles: %v", err)
+		return nil, errors.New("error al leer la política de 2FA")
+	}
+	roles := splitList(value)
+	if roles == nil {
+		roles = []string{}
+	}
+	return roles, nil
+}
+
+// SetTwoFactorRoles define qué roles deben usar 2FA
+func (s *authService) SetTwoFactorRoles(roles []string) error {
+	clean := make([]string, 0, len(roles))
+	for _, role := range roles {
+		role = strings.ToLower(strings.TrimSpace(role))
+		exists, err := database.RoleExists(role)
+		if err != nil {
+			log.Printf("Error en authService.SetTwoFactorRoles (RoleExists %s): %v", role, err)
+			return errors.New("error al guardar la política de 2FA")
+		}
+		if !exists {
+			return apperrors.InvalidField("required_roles", fmt.Sprintf("rol desconocido: %q", role))
+		}
+		if !containsFold(clean, role) {
+			clean = append(clean, role)
+		}
+	}
+
+	if err := database.SetSetting(settingTwoFactorRoles, strings.Join(clean, ",")); err != nil {
+		log.Printf("Error en authService.SetTwoFactorRoles: %v", err)
+		return errors.New("error al guardar la política de 2FA")
+	}
+	return nil
+}
+
+// twoFactorChallenge responde al primer paso del login cuando el usuario tiene 2FA
+func (s *authService) twoFactorChallenge(user *models.UserDB) (*models.LoginResponse, error) {
+	now := time.Now()
+	claims := &models.ChallengeClaims{
+		UserID:  user.ID,
+		Purpose: challengePurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(challengeTTL)),
+		},
+	}
+
+	kid, key := s.keys.SigningKey()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	challenge, err := token.SignedString(key)
+	if err != nil {
+		log.Printf("Error en twoFactorChallenge (SignedString): %v", err)
+		return nil, errors.New("error al generar el token")
+	}
+
+	return &models.LoginResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+		UserId:            user.ID,
+		User:              models.UserDetails{Username: user.Username},
+	}, nil
+}
+
+// checkSecondFactor valida un código TOTP (sin reutilizar pasos) o un código de recuperación
+func (s *authService) checkSecondFactor(user *models.UserDB, code, recoveryCode string) error {
+	if code != "" {
+		secret, _, lastStep, err := database.GetUserTOTP(user.ID)
+		if err != nil {
+			return err
+		}
+		step, ok := matchTOTP(secret, strings.TrimSpace(code), time.Now(), lastStep)
+		if !ok {
+			return errors.New("código TOTP inválido")
+		}
+		if advanced, err := database.AdvanceTOTPStep(user.ID, step); err != nil || advanced == 0 {
+			return errors.New("código TOTP ya utilizado")
+		}
+		return nil
+	}
+
+	consumed, err := database.ConsumeRecoveryCode(user.ID, hashToken(normalizeRecoveryCode(recoveryCode)))
+	if err != nil || consumed == 0 {
+		return errors.New("código de recuperación inválido")
+	}
+	return nil
+}
+
+// mustSetupTwoFactor: el rol del usuario exige 2FA y todavía no lo activó
+func (s *authService) mustSetupTwoFactor(user *models.UserDB) bool {
+	if user.TOTPEnabled {
+		return false
+	}
+	required, err := s.roleRequiresTwoFactor(user.Role)
+	if err != nil {
+		log.Printf("mustSetupTwoFactor: %v", err)
+	}
+	return required
+}
+
+func (s *authService) roleRequiresTwoFactor(role string) (bool, error) {
+	roles, err := s.GetTwoFactorRoles()
+	if err != nil {
+		return false, err
+	}
+	return containsFold(roles, role), nil
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package cedula
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Documentos de identidad venezolanos. Una cédula se guarda siempre en su forma
+// canónica, así "V-123456", "v123456" y "123456" son la misma persona:
+//
+//	V-12345678    venezolano (1 a 8 dígitos, distinto de cero)
+//	E-12345678    extranjero residente (1 a 8 dígitos, distinto de cero)
+//	J-12345678-9  persona jurídica (RIF: 8 dígitos y dígito verificador)
+//	P-AB123456    pasaporte (5 a 15 letras o dígitos)
+//
+// Sin prefijo se asume "V". Se aceptan puntos, espacios y guiones como separadores.
+// Los ceros a la izquierda se aceptan: en V y E se quitan ("V-00123" es "V-123") y
+// en el RIF se completan hasta 8 dígitos ("J-123-5" es "J-00000123-5").
+
+// Cedula es una cédula validada en forma canónica; solo se obtiene con Parse
+type Cedula string
+
+const (
+	TipoVenezolano = "V"
+	TipoExtranjero = "E"
+	TipoJuridico   = "J"
+	TipoPasaporte  = "P"
+)
+
+const (
+	maxNumeroPersona = 99999999
+	minPasaporte     = 5
+	maxPasaporte     = 15
+)
+
+// ErrInvalida envuelve todos los errores de validación
+var ErrInvalida = errors.New("cédula inválida")
+
+// rifPesos y rifValorTipo son los del dígito verificador del RIF (SENIAT)
+var (
+	rifPesos     = []int{3, 2, 7, 6, 5, 4, 3, 2}
+	rifValorTipo = map[string]int{"V": 1, "E": 2, "J": 3, "P": 4, "G": 5}
+)
+
+// Parse valida un documento y devuelve su forma canónica
+func Parse(raw string) (Cedula, error) {
+	value := strings.ToUpper(strings.TrimSpace(raw))
+	value = strings.NewReplacer(".", "", " ", "").Replace(value)
+	if value == "" {
+		return "", fmt.Errorf("%w: vacía", ErrInvalida)
+	}
+
+	tipo := TipoVenezolano
+	if c := value[0]; c < '0' || c > '9' {
+		tipo = string(c)
+		value = strings.TrimPrefix(value[1:], "-")
+	}
+
+	switch tipo {
+	case TipoVenezolano, TipoExtranjero:
+		n, err := parseNumero(value)
+		if err != nil {
+			return "", fmt.Errorf("%w: %q (se esperan hasta 8 dígitos)", ErrInvalida, raw)
+		}
+		return Cedula(fmt.Sprintf("%s-%d", tipo, n)), nil
+
+	case TipoJuridico:
+		base, check, ok := strings.Cut(value, "-")
+		if !ok {
+			if len(value) < 2 {
+				return "", fmt.Errorf("%w: %q (RIF incompleto)", ErrInvalida, raw)
+			}
+			base, check = value[:len(value)-1], value[len(value)-1:]
+		}
+		n, err := parseNumero(base)
+		if err != nil || len(check) != 1 || check[0] < '0' || check[0] > '9' {
+			return "", fmt.Errorf("%w: %q (formato J-12345678-9)", ErrInvalida, raw)
+		}
+		if want := digitoRIF(tipo, n); int(check[0]-'0') != want {
+			return "", fmt.Errorf("%w: %q (dígito verificador incorrecto)", ErrInvalida, raw)
+		}
+		return Cedula(fmt.Sprintf("%s-%08d-%s", tipo, n, check)), nil
+
+	case TipoPasaporte:
+		if len(value) < minPasaporte || len(value) > maxPasaporte || strings.Trim(value, "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789") != "" {
+			return "", fmt.Errorf("%w: %q (pasaporte de %d a %d letras o dígitos)", ErrInvalida, raw, minPasaporte, maxPasaporte)
+		}
+		return Cedula(tipo + "-" + value), nil
+	}
+
+	return "", fmt.Errorf("%w: %q (prefijo desconocido, use V, E, J o P)", ErrInvalida, raw)
+}
+
+// Normalize es Parse para quien solo necesita el texto canónico
+func Normalize(raw string) (string, error) {
+	c, err := Parse(raw)
+	return string(c), err
+}
+
+func (c Cedula) String() string {
+	return string(c)
+}
+
+// Tipo devuelve el prefijo (V, E, J o P)
+func (c Cedula) Tipo() string {
+	if c == "" {
+		return ""
+	}
+	return string(c[0])
+}
+
+// parseNumero acepta de 1 a 8 dígitos (con ceros a la izquierda) distintos de cero
+func parseNumero(value string) (int, error) {
+	if value == "" || strings.Trim(value, "0123456789") != "" {
+		return 0, errors.New("no numérico")
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxNumeroPersona {
+		return 0, errors.New("fuera de rango")
+	}
+	return n, nil
+}
+
+// digitoRIF calcula el dígito verificador del RIF
+func digitoRIF(tipo string, numero int) int {
+	digits := fmt.Sprintf("%08d", numero)
+	sum := rifValorTipo[tipo] * 4
+	for i, peso := range rifPesos {
+		sum += int(digits[i]-'0') * peso
+	}
+	check := 11 - sum%11
+	if check >= 10 {
+		return 0
+	}
+	return check
+}
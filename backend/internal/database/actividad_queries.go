@@ -1,8 +1,8 @@
 package database
 
 import (
+	"database/sql"
 	"fmt"
-	"log"
 
 	"proyecto/internal/models"
 )
@@ -36,47 +36,63 @@ func CreateActividad(act models.Actividad) (int64, error) {
 	return id, nil
 }
 
-// GetActividadesByProyectoID
-func GetActividadesByProyectoID(proyectoID int) ([]models.ActividadResponse, error) {
-
-	query := `
-		SELECT 
-			a.id, a.proyecto_id, a.actividad, a.labor_agronomica_id, a.equipo_implemento_id,
-			a.encargado_id, a.recurso_humano, a.costo, a.observaciones, a.fecha_creacion,
-			
-			COALESCE(l.descripcion, '') AS labor_descripcion,
-			COALESCE(e.nombre, '') AS equipo_nombre,
-			COALESCE(u.nombre || ' ' || u.apellido, '') AS encargado_nombre
-
-		FROM actividades a
+// actividadesList: actividades con los nombres de su labor, equipo y encargado.
+// El costo no se ofrece como orden: puede estar oculto para el rol.
+var actividadesList = listSpec{
+	name: "GetActividades",
+	columns: `a.id, a.proyecto_id, a.actividad, a.labor_agronomica_id, a.equipo_implemento_id,
+		a.encargado_id, a.recurso_humano, a.costo, a.observaciones, a.fecha_creacion,
+		COALESCE(l.descripcion, '') AS labor_descripcion,
+		COALESCE(e.nombre, '') AS equipo_nombre,
+		COALESCE(u.nombre || ' ' || u.apellido, '') AS encargado_nombre`,
+	from: `actividades a
 		LEFT JOIN labores_agronomicas l ON a.labor_agronomica_id = l.id
 		LEFT JOIN equipos_implementos e ON a.equipo_implemento_id = e.id
-		LEFT JOIN users u ON a.encargado_id = u.id
-		WHERE a.proyecto_id = ?
-		ORDER BY a.id ASC;
-	`
+		LEFT JOIN users u ON a.encargado_id = u.id`,
+	id: "a.id",
+	sorts: map[string]string{
+		"id":             "a.id",
+		"actividad":      "a.actividad",
+		"recurso_humano": "a.recurso_humano",
+		"fecha_creacion": "COALESCE(a.fecha_creacion, '')",
+	},
+	sort:   "id",
+	search: []string{"a.actividad", "a.observaciones"},
+	count:  true,
+}
 
-	rows, err := DB.Query(query, proyectoID)
-	if err != nil {
-		log.Printf("Error en GetActividadesByProyectoID (Query): %v", err)
-		return nil, err
-	}
-	defer rows.Close()
+// GetActividades: una página de las actividades de un proyecto
+func GetActividades(req models.GetDatosProyectoRequest) ([]models.ActividadResponse, *models.Page, error) {
+	var filter listFilter
+	filter.add("a.proyecto_id = ?", req.ProyectoID)
+	filter.equal("a.labor_agronomica_id", req.LaborAgronomicaID)
+	filter.equal("a.equipo_implemento_id", req.EquipoImplementoID)
+	filter.equal("a.encargado_id", req.EncargadoID)
 
-	var actividades []models.ActividadResponse
-	for rows.Next() {
+	actividades := []models.ActividadResponse{}
+	page, err := queryList(actividadesList, req.ListParams, filter, func(rows *sql.Rows, key *cursorKey) error {
 		var act models.ActividadResponse
-		if err := rows.Scan(
+		dest := []interface{}{
 			&act.ID, &act.ProyectoID, &act.Actividad, &act.LaborAgronomicaID, &act.EquipoImplementoID,
 			&act.EncargadoID, &act.RecursoHumano, &act.Costo, &act.Observaciones, &act.FechaCreacion,
 			&act.LaborDescripcion, &act.EquipoNombre, &act.EncargadoNombre,
-		); err != nil {
-			log.Printf("Error escaneando actividad: %v", err)
-			continue
+		}
+		if err := rows.Scan(append(dest, key.dest()...)...); err != nil {
+			return err
 		}
 		actividades = append(actividades, act)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	return actividades, nil
+	return actividades, page, nil
+}
+
+// GetActividadesByProyectoID: todas las actividades de un proyecto
+func GetActividadesByProyectoID(proyectoID int) ([]models.ActividadResponse, error) {
+	actividades, _, err := GetActividades(models.GetDatosProyectoRequest{ProyectoID: proyectoID})
+	return actividades, err
 }
 
 func UpdateActividad(act models.Actividad) (int64, error) {
@@ -124,3 +140,8 @@ func DeleteActividad(id int) (int64, error) {
 	}
 	return affected, nil
 }
+
+// GetActividadProyectoID devuelve el proyecto al que pertenece el registro
+func GetActividadProyectoID(id int) (int, error) {
+	return proyectoIDOf("actividades", id)
+}
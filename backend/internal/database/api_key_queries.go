@@ -0,0 +1,169 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"proyecto/internal/models"
+)
+
+// QUERIES DE CUENTAS DE SERVICIO Y API KEYS
+
+// CreateServiceAccount crea el usuario de una cuenta de servicio. La contraseña es un
+// hash aleatorio que nadie conoce: estas cuentas solo entran con API keys.
+func CreateServiceAccount(username, nombre, role, unusableHash string) (int64, error) {
+	res, err := DB.Exec(`
+		INSERT INTO users (username, password, role, nombre, apellido, cedula, es_servicio)
+		VALUES (?, ?, ?, ?, 'Cuenta de servicio', ?, 1)
+	`, username, unusableHash, role, nombre, "SVC-"+username)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return 0, errUsernameTaken
+		}
+		return 0, fmt.Errorf("error al crear cuenta de servicio: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetServiceAccounts lista las cuentas de servicio con sus llaves
+func GetServiceAccounts() ([]models.ServiceAccount, error) {
+	rows, err := DB.Query("SELECT id, username, nombre, role FROM users WHERE es_servicio = 1 ORDER BY id ASC")
+	if err != nil {
+		log.Printf("Error en GetServiceAccounts (Query): %v", err)
+		return nil, err
+	}
+	accounts := []models.ServiceAccount{}
+	for rows.Next() {
+		var a models.ServiceAccount
+		if err := rows.Scan(&a.ID, &a.Username, &a.Nombre, &a.Role); err != nil {
+			log.Printf("Error en GetServiceAccounts (Scan): %v", err)
+			continue
+		}
+		a.Keys = []models.APIKey{}
+		accounts = append(accounts, a)
+	}
+	rows.Close()
+
+	keys, err := getAllAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		for _, k := range keys {
+			if k.UserID == accounts[i].ID {
+				accounts[i].Keys = append(accounts[i].Keys, k)
+			}
+		}
+	}
+	return accounts, nil
+}
+
+func getAllAPIKeys() ([]models.APIKey, error) {
+	rows, err := DB.Query(`
+		SELECT id, user_id, nombre, prefijo, permisos, expires_at, last_used_at, created_at, revocada
+		FROM api_keys ORDER BY id ASC
+	`)
+	if err != nil {
+		log.Printf("Error en getAllAPIKeys (Query): %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var k models.APIKey
+		var permisos string
+		var lastUsed sql.NullString
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Nombre, &k.Prefijo, &permisos, &k.ExpiresAt, &lastUsed, &k.CreatedAt, &k.Revocada); err != nil {
+			log.Printf("Error en getAllAPIKeys (Scan): %v", err)
+			continue
+		}
+		k.Permissions = splitPermissions(permisos)
+		if lastUsed.Valid {
+			k.LastUsedAt = &lastUsed.String
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// CreateAPIKey guarda una llave nueva (solo el hash) y devuelve su ID
+func CreateAPIKey(userID int, nombre, prefijo, keyHash string, permissions []string, expiresAt time.Time) (int64, error) {
+	res, err := DB.Exec(`
+		INSERT INTO api_keys (user_id, nombre, prefijo, key_hash, permisos, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, nombre, prefijo, keyHash, strings.Join(permissions, ","), expiresAt.UTC().Format(time.DateTime))
+	if err != nil {
+		return 0, fmt.Errorf("error al crear API key: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetAPIKeyByPrefix busca una llave (y su cuenta) por el prefijo público
+func GetAPIKeyByPrefix(prefijo string) (*models.APIKeyRecord, error) {
+	var k models.APIKeyRecord
+	var permisos, expiresAt string
+	err := DB.QueryRow(`
+		SELECT k.id, k.user_id, u.username, u.role, k.key_hash, k.permisos, k.expires_at, k.revocada
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.prefijo = ? AND u.es_servicio = 1 AND u.activo = 1
+	`, prefijo).Scan(&k.ID, &k.UserID, &k.Username, &k.Role, &k.KeyHash, &permisos, &expiresAt, &k.Revocada)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("API key no encontrada")
+		}
+		return nil, fmt.Errorf("error al buscar API key: %w", err)
+	}
+
+	parsed, err := parseDBTime(expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("fecha de expiración inválida en API key %d: %w", k.ID, err)
+	}
+	k.ExpiresAt = parsed
+	k.Permissions = splitPermissions(permisos)
+	return &k, nil
+}
+
+// GetAPIKeyByID devuelve la descripción pública de una llave
+func GetAPIKeyByID(id int) (*models.APIKey, error) {
+	keys, err := getAllAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if k.ID == id {
+			return &k, nil
+		}
+	}
+	return nil, errors.New("API key no encontrada")
+}
+
+// TouchAPIKey registra el último uso de la llave
+func TouchAPIKey(id int, usedAt time.Time) error {
+	_, err := DB.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", usedAt.UTC().Format(time.DateTime), id)
+	return err
+}
+
+// RevokeAPIKey invalida una llave; devuelve 0 si no existía o ya estaba revocada
+func RevokeAPIKey(id int) (int64, error) {
+	res, err := DB.Exec("UPDATE api_keys SET revocada = 1 WHERE id = ? AND revocada = 0", id)
+	if err != nil {
+		return 0, fmt.Errorf("error al revocar API key %d: %w", id, err)
+	}
+	return res.RowsAffected()
+}
+
+func splitPermissions(value string) []string {
+	perms := []string{}
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
@@ -2,7 +2,13 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"strings"
+	"time"
+
+	"proyecto/internal/cedula"
+	"proyecto/internal/models"
 
 	// 'time' se mantiene por la creación de tablas
 	"golang.org/x/crypto/bcrypt"
@@ -44,6 +50,22 @@ func InitDB(dbPath string) {
 	createRecursosTable()
 	createMaterialesTable()
 
+	createRefreshTokensTable()
+	createPasswordResetTokensTable()
+	createMailOutboxTable()
+	createLoginFailuresTable()
+	createRecoveryCodesTable()
+	createSettingsTable()
+	createRolesTables()
+	createProjectMembersTable()
+	createAPIKeysTable()
+	createInvitationsTable()
+	createExternalIdentitiesTable()
+	createLoginHistoryTable()
+	createHiddenFieldsTable()
+
+	migrateCedulas()
+
 	_, err = DB.Exec("PRAGMA foreign_keys = ON;")
 	if err != nil {
 		log.Fatalf("Error PRAGMA ON: %v", err)
@@ -52,6 +74,9 @@ func InitDB(dbPath string) {
 
 //  CREACIÓN DE TABLAS
 
+// adminCedula: cédula provisional del admin creado al instalar
+const adminCedula = "V-99999999"
+
 func createUsersTable() {
 	_, err := DB.Exec(`
     CREATE TABLE IF NOT EXISTS users (
@@ -62,7 +87,16 @@ func createUsersTable() {
         nombre TEXT NOT NULL,
         apellido TEXT NOT NULL,
         cedula TEXT NOT NULL UNIQUE,
-        proyecto_id INTEGER,
+        proyecto_id INTEGER, -- obsoleto: las asignaciones están en project_members
+        must_change_password INTEGER NOT NULL DEFAULT 0,
+        email TEXT,
+        failed_logins INTEGER NOT NULL DEFAULT 0,
+        locked_until TIMESTAMP,
+        totp_secret TEXT,
+        totp_enabled INTEGER NOT NULL DEFAULT 0,
+        totp_last_step INTEGER NOT NULL DEFAULT 0,
+        es_servicio INTEGER NOT NULL DEFAULT 0,
+        activo INTEGER NOT NULL DEFAULT 1,
         FOREIGN KEY (proyecto_id) REFERENCES proyectos(id) ON DELETE SET NULL
     );
     `)
@@ -70,7 +104,21 @@ func createUsersTable() {
 		log.Fatalf("Error al crear tabla users: %v", err)
 	}
 
-	// Crear usuario admin si no existe
+	// Columnas agregadas después de la primera versión de la tabla
+	addColumnIfMissing("users", "must_change_password", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("users", "email", "TEXT")
+	addColumnIfMissing("users", "failed_logins", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("users", "locked_until", "TIMESTAMP")
+	addColumnIfMissing("users", "totp_secret", "TEXT")
+	addColumnIfMissing("users", "totp_enabled", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("users", "es_servicio", "INTEGER NOT NULL DEFAULT 0")
+	addColumnIfMissing("users", "activo", "INTEGER NOT NULL DEFAULT 1")
+	addColumnIfMissing("users", "last_login_at", "TIMESTAMP")
+	addColumnIfMissing("users", "idioma", "TEXT NOT NULL DEFAULT ''")
+
+	// Crear usuario admin si no existe. Su cédula es un valor provisional, válido
+	// y canónico, para que se pueda editar el perfil sin tocarla.
 	row := DB.QueryRow("SELECT id FROM users WHERE username = 'admin'")
 	var id int
 	if err := row.Scan(&id); err == sql.ErrNoRows {
@@ -79,12 +127,16 @@ func createUsersTable() {
 			log.Fatalf("Error al hashear password de admin: %v", err)
 		}
 		_, err = DB.Exec("INSERT INTO users (username, password, role, nombre, apellido, cedula) VALUES (?, ?, ?, ?, ?, ?)",
-			"admin", string(hashedPassword), "admin", "Administrador", "Del Sistema", "000000")
+			"admin", string(hashedPassword), "admin", "Administrador", "Del Sistema", adminCedula)
 		if err != nil {
 			log.Fatalf("Error al crear usuario admin: %v", err)
 		}
 		log.Println("Usuario 'admin' (pass: 'admin123') creado.")
 	}
+	// Las instalaciones anteriores crearon al admin con "000000", que no es una cédula válida
+	if _, err := DB.Exec("UPDATE users SET cedula = ? WHERE username = 'admin' AND cedula = '000000'", adminCedula); err != nil {
+		log.Fatalf("Error al actualizar la cédula del admin: %v", err)
+	}
 }
 
 func createProyectosTable() {
@@ -179,6 +231,8 @@ func createEventLogsTable() {
 	if err != nil {
 		log.Fatalf("Error al crear tabla event_logs: %v", err)
 	}
+
+	addColumnIfMissing("event_logs", "suplantado_por", "TEXT")
 }
 
 func createUnidadesTable() {
@@ -267,3 +321,452 @@ func createMaterialesTable() {
 		log.Fatalf("Error al crear tabla materiales_insumos: %v", err)
 	}
 }
+
+func createRefreshTokensTable() {
+	// Cada fila es una sesión: guarda el hash del refresh token vigente
+	// y permite revocar también los access tokens emitidos con ella (claim "sid").
+	_, err := DB.Exec(`
+    CREATE TABLE IF NOT EXISTS refresh_tokens (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        token_hash TEXT NOT NULL UNIQUE,
+        expires_at TIMESTAMP NOT NULL,
+        revocado INTEGER NOT NULL DEFAULT 0,
+        fecha_creacion TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `)
+	if err != nil {
+		log.Fatalf("Error al crear tabla refresh_tokens: %v", err)
+	}
+
+	// Desde dónde se abrió cada sesión y cuándo se renovó por última vez
+	addColumnIfMissing("refresh_tokens", "ip", "TEXT NOT NULL DEFAULT ''")
+	addColumnIfMissing("refresh_tokens", "user_agent", "TEXT NOT NULL DEFAULT ''")
+	addColumnIfMissing("refresh_tokens", "last_used_at", "TIMESTAMP")
+}
+
+func createPasswordResetTokensTable() {
+	// Tokens de un solo uso para recuperar la contraseña (solo se guarda el hash)
+	_, err := DB.Exec(`
+    CREATE TABLE IF NOT EXISTS password_reset_tokens (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        token_hash TEXT NOT NULL UNIQUE,
+        expires_at TIMESTAMP NOT NULL,
+        usado INTEGER NOT NULL DEFAULT 0,
+        fecha_creacion TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `)
+	if err != nil {
+		log.Fatalf("Error al crear tabla password_reset_tokens: %v", err)
+	}
+}
+
+func createMailOutboxTable() {
+	// Bandeja de salida local: el sender por defecto deja aquí los correos
+	_, err := DB.Exec(`
+    CREATE TABLE IF NOT EXISTS mail_outbox (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        destinatario TEXT NOT NULL,
+        asunto TEXT NOT NULL,
+        cuerpo TEXT NOT NULL,
+        fecha_creacion TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    `)
+	if err != nil {
+		log.Fatalf("Error al crear tabla mail_outbox: %v", err)
+	}
+}
+
+func createLoginFailuresTable() {
+	// Intentos fallidos de login por IP de origen (backoff exponencial)
+	_, err := DB.Exec(`
+    CREATE TABLE IF NOT EXISTS login_failures_ip (
+        ip TEXT PRIMARY KEY,
+        failures INTEGER NOT NULL DEFAULT 0,
+        last_failure TIMESTAMP NOT NULL
+    );
+    `)
+	if err != nil {
+		log.Fatalf("Error al crear tabla login_failures_ip: %v", err)
+	}
+}
+
+func createRecoveryCodesTable() {
+	// Códigos de recuperación del segundo factor (un solo uso, solo el hash)
+	_, err := DB.Exec(`
+    CREATE TABLE IF NOT EXISTS recovery_codes (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        code_hash TEXT NOT NULL,
+        usado INTEGER NOT NULL DEFAULT 0,
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `)
+	if err != nil {
+		log.Fatalf("Error al crear tabla recovery_codes: %v", err)
+	}
+}
+
+func createSettingsTable() {
+	// Configuración modificable en tiempo de ejecución (clave/valor)
+	_, err := DB.Exec(`
+    CREATE TABLE IF NOT EXISTS app_settings (
+        clave TEXT PRIMARY KEY,
+        valor TEXT NOT NULL
+    );
+    `)
+	if err != nil {
+		log.Fatalf("Error al crear tabla app_settings: %v", err)
+	}
+}
+
+func createRolesTables() {
+	_, err := DB.Exec(`
+    CREATE TABLE IF NOT EXISTS roles (
+        name TEXT PRIMARY KEY,
+        descripcion TEXT NOT NULL DEFAULT '',
+        sistema INTEGER NOT NULL DEFAULT 0
+    );
+    CREATE TABLE IF NOT EXISTS permissions (
+        name TEXT PRIMARY KEY,
+        descripcion TEXT NOT NULL DEFAULT ''
+    );
+    CREATE TABLE IF NOT EXISTS role_permissions (
+        role TEXT NOT NULL,
+        permission TEXT NOT NULL,
+        PRIMARY KEY (role, permission),
+        FOREIGN KEY (role) REFERENCES roles(name) ON DELETE CASCADE,
+        FOREIGN KEY (permission) REFERENCES permissions(name) ON DELETE CASCADE
+    );
+    `)
+	if err != nil {
+		log.Fatalf("Error al crear tablas de roles y permisos: %v", err)
+	}
+
+	seedRolesAndPermissions()
+}
+
+// seedRolesAndPermissions crea los roles del sistema y el catálogo de permisos.
+// Las asignaciones por defecto solo se insertan cuando el permiso o el rol es nuevo,
+// así no se pisan los cambios que el admin haya hecho por la API.
+func seedRolesAndPermissions() {
+	newRoles := map[string]bool{}
+	for _, role := range models.DefaultRoles {
+		res, err := DB.Exec("INSERT OR IGNORE INTO roles (name, descripcion, sistema) VALUES (?, ?, 1)", role.Name, role.Descripcion)
+		if err != nil {
+			log.Fatalf("Error al crear rol %s: %v", role.Name, err)
+		}
+		if created, _ := res.RowsAffected(); created > 0 {
+			newRoles[role.Name] = true
+		}
+	}
+
+	for _, perm := range models.DefaultPermissions {
+		res, err := DB.Exec("INSERT OR IGNORE INTO permissions (name, descripcion) VALUES (?, ?)", perm.Name, perm.Descripcion)
+		if err != nil {
+			log.Fatalf("Error al crear permiso %s: %v", perm.Name, err)
+		}
+		created, _ := res.RowsAffected()
+		for _, role := range perm.Roles {
+			if created == 0 && !newRoles[role] {
+				continue
+			}
+			if _, err := DB.Exec("INSERT OR IGNORE INTO role_permissions (role, permission) VALUES (?, ?)", role, perm.Name); err != nil {
+				log.Fatalf("Error al asignar %s a %s: %v", perm.Name, role, err)
+			}
+		}
+	}
+}
+
+func createProjectMembersTable() {
+	// Un usuario puede pertenecer a varios proyectos, con un rol distinto en cada uno
+	_, err := DB.Exec(`
+    CREATE TABLE IF NOT EXISTS project_members (
+        user_id INTEGER NOT NULL,
+        proyecto_id INTEGER NOT NULL,
+        role TEXT NOT NULL,
+        fecha_asignacion TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (user_id, proyecto_id),
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY (proyecto_id) REFERENCES proyectos(id) ON DELETE CASCADE
+    );
+    CREATE INDEX IF NOT EXISTS idx_project_members_proyecto ON project_members(proyecto_id);
+    `)
+	if err != nil {
+		log.Fatalf("Error al crear tabla project_members: %v", err)
+	}
+
+	migrateLegacyProjectAssignments()
+}
+
+// migrateLegacyProjectAssignments pasa la asignación única de users.proyecto_id a
+// project_members (con el rol global del usuario) y deja la columna vacía para no
+// volver a migrarla en el próximo arranque.
+func migrateLegacyProjectAssignments() {
+	tx, err := DB.Begin()
+	if err != nil {
+		log.Fatalf("Error al migrar asignaciones de proyecto: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+        INSERT OR IGNORE INTO project_members (user_id, proyecto_id, role)
+        SELECT id, proyecto_id, role FROM users WHERE proyecto_id IS NOT NULL
+    `); err != nil {
+		log.Fatalf("Error al migrar asignaciones de proyecto: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE users SET proyecto_id = NULL WHERE proyecto_id IS NOT NULL"); err != nil {
+		log.Fatalf("Error al migrar asignaciones de proyecto: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Error al migrar asignaciones de proyecto: %v", err)
+	}
+}
+
+func createAPIKeysTable() {
+	// Llaves de las cuentas de servicio: se guarda el prefijo (para buscarla) y el hash
+	_, err := DB.Exec(`
+    CREATE TABLE IF NOT EXISTS api_keys (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        nombre TEXT NOT NULL,
+        prefijo TEXT NOT NULL UNIQUE,
+        key_hash TEXT NOT NULL,
+        permisos TEXT NOT NULL DEFAULT '',
+        expires_at TIMESTAMP NOT NULL,
+        last_used_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        revocada INTEGER NOT NULL DEFAULT 0,
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    `)
+	if err != nil {
+		log.Fatalf("Error al crear tabla api_keys: %v", err)
+	}
+}
+
+// addColumnIfMissing agrega una columna a una tabla ya existente.
+// CREATE TABLE IF NOT EXISTS no toca las tablas de una DB creada con una versión anterior.
+func addColumnIfMissing(table, column, definition string) {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		log.Fatalf("Error al leer columnas de %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			log.Fatalf("Error al escanear columnas de %s: %v", table, err)
+		}
+		if name == column {
+			return
+		}
+	}
+	rows.Close()
+
+	if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		log.Fatalf("Error al agregar columna %s.%s: %v", table, column, err)
+	}
+	log.Printf("Columna %s.%s agregada.", table, column)
+}
+
+func createInvitationsTable() {
+	// Códigos de invitación para registrarse con un rol (y opcionalmente un proyecto).
+	// Del código solo se guarda el hash.
+	_, err := DB.Exec(`
+    CREATE TABLE IF NOT EXISTS invitations (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        code_hash TEXT NOT NULL UNIQUE,
+        role TEXT NOT NULL,
+        proyecto_id INTEGER,
+        max_usos INTEGER NOT NULL DEFAULT 1,
+        usos INTEGER NOT NULL DEFAULT 0,
+        expires_at TIMESTAMP NOT NULL,
+        created_by TEXT NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        revocada BOOLEAN NOT NULL DEFAULT 0
+    );
+    `)
+	if err != nil {
+		log.Fatalf("Error al crear tabla invitations: %v", err)
+	}
+}
+
+func createExternalIdentitiesTable() {
+	// Vincula un usuario local con su identidad en un proveedor externo (OIDC)
+	_, err := DB.Exec(`
+    CREATE TABLE IF NOT EXISTS external_identities (
+        provider TEXT NOT NULL,
+        subject TEXT NOT NULL,
+        user_id INTEGER NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        last_login_at TIMESTAMP,
+        PRIMARY KEY (provider, subject),
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    CREATE INDEX IF NOT EXISTS idx_external_identities_user ON external_identities(user_id);
+    `)
+	if err != nil {
+		log.Fatalf("Error al crear tabla external_identities: %v", err)
+	}
+}
+
+func createLoginHistoryTable() {
+	// Un registro por inicio de sesión exitoso (las sesiones se revocan, el historial queda)
+	_, err := DB.Exec(`
+    CREATE TABLE IF NOT EXISTS login_history (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        session_id INTEGER NOT NULL,
+        ip TEXT NOT NULL,
+        user_agent TEXT NOT NULL,
+        metodo TEXT NOT NULL,
+        fecha TIMESTAMP NOT NULL,
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+    CREATE INDEX IF NOT EXISTS idx_login_history_user ON login_history(user_id, fecha);
+    `)
+	if err != nil {
+		log.Fatalf("Error al crear tabla login_history: %v", err)
+	}
+}
+
+func createHiddenFieldsTable() {
+	// Campos de cada entidad que no se muestran a un rol (ver models/visibility.go)
+	_, err := DB.Exec(`
+    CREATE TABLE IF NOT EXISTS hidden_fields (
+        role TEXT NOT NULL,
+        entidad TEXT NOT NULL,
+        campo TEXT NOT NULL,
+        PRIMARY KEY (role, entidad, campo),
+        FOREIGN KEY (role) REFERENCES roles(name) ON DELETE CASCADE
+    );
+    `)
+	if err != nil {
+		log.Fatalf("Error al crear tabla hidden_fields: %v", err)
+	}
+
+	seedHiddenFields()
+}
+
+const camposOcultosSembradosKey = "campos_ocultos_iniciales_v1"
+
+// seedHiddenFields inserta una sola vez los campos ocultos por defecto; después
+// los administra el admin por la API (y puede dejar un rol sin campos ocultos).
+func seedHiddenFields() {
+	if _, done, err := GetSetting(camposOcultosSembradosKey); err != nil {
+		log.Fatalf("Error al leer estado de campos ocultos: %v", err)
+	} else if done {
+		return
+	}
+
+	for _, seed := range models.DefaultHiddenFields {
+		for _, campo := range seed.Campos {
+			if _, err := DB.Exec("INSERT OR IGNORE INTO hidden_fields (role, entidad, campo) VALUES (?, ?, ?)", seed.Role, seed.Entidad, campo); err != nil {
+				log.Fatalf("Error al ocultar %s.%s a %s: %v", seed.Entidad, campo, seed.Role, err)
+			}
+		}
+	}
+	if err := SetSetting(camposOcultosSembradosKey, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		log.Fatalf("Error al guardar estado de campos ocultos: %v", err)
+	}
+}
+
+//  MIGRACIONES DE DATOS
+
+const cedulasMigradasKey = "migracion_cedulas_v1"
+
+// migrateCedulas lleva una sola vez las cédulas existentes a su forma canónica
+func migrateCedulas() {
+	if _, done, err := GetSetting(cedulasMigradasKey); err != nil {
+		log.Fatalf("Error al leer estado de migración de cédulas: %v", err)
+	} else if done {
+		return
+	}
+
+	changed, err := NormalizeCedulas()
+	if err != nil {
+		log.Fatalf("Error al normalizar cédulas: %v", err)
+	}
+	if err := SetSetting(cedulasMigradasKey, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		log.Fatalf("Error al guardar estado de migración de cédulas: %v", err)
+	}
+	if changed > 0 {
+		log.Printf("Migración de cédulas: %d registros normalizados.", changed)
+	}
+}
+
+// NormalizeCedulas reescribe en forma canónica las cédulas de users y recursos_humanos.
+// Las que no se pueden interpretar, o que chocarían con otro usuario, se dejan como
+// están y se reportan en el log para corregirlas a mano. Devuelve cuántas filas cambió.
+func NormalizeCedulas() (int, error) {
+	changed := 0
+
+	users, err := cedulasToNormalize("SELECT id, cedula FROM users WHERE es_servicio = 0 AND cedula NOT LIKE 'EXT-%'")
+	if err != nil {
+		return changed, err
+	}
+	for _, row := range users {
+		if _, err := DB.Exec("UPDATE users SET cedula = ? WHERE id = ?", row.canonical, row.id); err != nil {
+			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+				log.Printf("Migración de cédulas: usuario %d (%q) duplica a otro usuario como %q; se deja sin cambios", row.id, row.raw, row.canonical)
+				continue
+			}
+			return changed, fmt.Errorf("error al actualizar cédula del usuario %d: %w", row.id, err)
+		}
+		changed++
+	}
+
+	recursos, err := cedulasToNormalize("SELECT id, cedula FROM recursos_humanos WHERE cedula IS NOT NULL AND TRIM(cedula) <> ''")
+	if err != nil {
+		return changed, err
+	}
+	for _, row := range recursos {
+		if _, err := DB.Exec("UPDATE recursos_humanos SET cedula = ? WHERE id = ?", row.canonical, row.id); err != nil {
+			return changed, fmt.Errorf("error al actualizar cédula del recurso %d: %w", row.id, err)
+		}
+		changed++
+	}
+
+	return changed, nil
+}
+
+type cedulaRow struct {
+	id             int
+	raw, canonical string
+}
+
+// cedulasToNormalize devuelve las filas (id, cedula) cuya cédula es válida pero no canónica
+func cedulasToNormalize(query string) ([]cedulaRow, error) {
+	rows, err := DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer cédulas: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []cedulaRow
+	for rows.Next() {
+		var row cedulaRow
+		if err := rows.Scan(&row.id, &row.raw); err != nil {
+			return nil, fmt.Errorf("error al escanear cédula: %w", err)
+		}
+		canonical, err := cedula.Normalize(row.raw)
+		if err != nil {
+			log.Printf("Migración de cédulas: %v; se deja sin cambios (id %d)", err, row.id)
+			continue
+		}
+		if canonical != row.raw {
+			row.canonical = canonical
+			pending = append(pending, row)
+		}
+	}
+	return pending, rows.Err()
+}
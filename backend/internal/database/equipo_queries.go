@@ -6,37 +6,57 @@ import (
 	"log"
 	"strings"
 
+	"proyecto/internal/apperrors"
 	"proyecto/internal/models"
 )
 
 // QUERIES DE EQUIPOS E IMPLEMENTOS
 
-// GetEquiposByProyectoID obtiene todos los equipos de un proyecto
-func GetEquiposByProyectoID(proyectoID int) ([]models.EquipoImplemento, error) {
-	query := `
-        SELECT id, proyecto_id, codigo_equipo, nombre, tipo, estado, fecha_creacion 
-        FROM equipos_implementos 
-        WHERE proyecto_id = ? 
-        ORDER BY fecha_creacion DESC
-    `
-	rows, err := DB.Query(query, proyectoID)
-	if err != nil {
-		log.Printf("Error en GetEquiposByProyectoID (Query): %v", err)
-		return nil, err
-	}
-	defer rows.Close()
+// equiposList: listado de equipos (por defecto, los más recientes primero)
+var equiposList = listSpec{
+	name:    "GetEquipos",
+	columns: "id, proyecto_id, codigo_equipo, nombre, tipo, estado, fecha_creacion",
+	from:    "equipos_implementos",
+	id:      "id",
+	sorts: map[string]string{
+		"id":             "id",
+		"codigo_equipo":  "codigo_equipo",
+		"nombre":         "nombre",
+		"tipo":           "tipo",
+		"estado":         "estado",
+		"fecha_creacion": "COALESCE(fecha_creacion, '')",
+	},
+	sort:   "-fecha_creacion",
+	search: []string{"codigo_equipo", "nombre"},
+	count:  true,
+}
+
+// GetEquipos obtiene una página de los equipos de un proyecto
+func GetEquipos(req models.GetEquiposRequest) ([]models.EquipoImplemento, *models.Page, error) {
+	var filter listFilter
+	filter.add("proyecto_id = ?", req.ProyectoID)
+	filter.equal("tipo", req.Tipo)
+	filter.equal("estado", req.Estado)
 
-	var equipos []models.EquipoImplemento
-	for rows.Next() {
+	equipos := []models.EquipoImplemento{}
+	page, err := queryList(equiposList, req.ListParams, filter, func(rows *sql.Rows, key *cursorKey) error {
 		var e models.EquipoImplemento
-		if err := rows.Scan(&e.ID, &e.ProyectoID, &e.CodigoEquipo, &e.Nombre, &e.Tipo, &e.Estado, &e.FechaCreacion); err != nil {
-			log.Printf("Error en GetEquiposByProyectoID (Scan): %v", err)
-			continue
+		if err := rows.Scan(append([]interface{}{&e.ID, &e.ProyectoID, &e.CodigoEquipo, &e.Nombre, &e.Tipo, &e.Estado, &e.FechaCreacion}, key.dest()...)...); err != nil {
+			return err
 		}
 		equipos = append(equipos, e)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
+	return equipos, page, nil
+}
 
-	return equipos, nil
+// GetEquiposByProyectoID obtiene todos los equipos de un proyecto
+func GetEquiposByProyectoID(proyectoID int) ([]models.EquipoImplemento, error) {
+	equipos, _, err := GetEquipos(models.GetEquiposRequest{ProyectoID: proyectoID})
+	return equipos, err
 }
 
 // GetEquipoByID obtiene un equipo específico por su ID
@@ -69,7 +89,8 @@ func CreateEquipo(equipo models.EquipoImplemento) (int64, error) {
 		return 0, err
 	}
 	if exists > 0 {
-		return 0, errors.New("el código de equipo ya existe para este proyecto")
+		return 0, apperrors.Conflict("el código de equipo ya existe para este proyecto",
+			apperrors.Duplicate("codigo_equipo", "ya existe en este proyecto"))
 	}
 
 	// Inserción
@@ -88,7 +109,8 @@ func CreateEquipo(equipo models.EquipoImplemento) (int64, error) {
 	if err != nil {
 		log.Printf("Error en CreateEquipo (Exec): %v", err)
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			return 0, errors.New("el código de equipo ya existe para este proyecto")
+			return 0, apperrors.Conflict("el código de equipo ya existe para este proyecto",
+				apperrors.Duplicate("codigo_equipo", "ya existe en este proyecto"))
 		}
 		return 0, err
 	}
@@ -113,7 +135,8 @@ func UpdateEquipo(id int, codigoEquipo, nombre, tipo, estado string) (int64, err
 	if err != nil {
 		log.Printf("Error en UpdateEquipo (Exec): %v", err)
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			return 0, errors.New("el código de equipo ya existe para este proyecto")
+			return 0, apperrors.Conflict("el código de equipo ya existe para este proyecto",
+				apperrors.Duplicate("codigo_equipo", "ya existe en este proyecto"))
 		}
 		return 0, err
 	}
@@ -160,3 +183,8 @@ func GetNextEquipoCodigo(proyectoID int) (int, error) {
 
 	return nextCodigo, nil
 }
+
+// GetEquipoProyectoID devuelve el proyecto al que pertenece el registro
+func GetEquipoProyectoID(id int) (int, error) {
+	return proyectoIDOf("equipos_implementos", id)
+}
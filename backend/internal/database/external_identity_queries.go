@@ -0,0 +1,70 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// QUERIES DE IDENTIDADES EXTERNAS (OIDC)
+
+// GetUserIDByExternalIdentity busca el usuario vinculado a (proveedor, sub); ok es false
+// si no hay vínculo (o el usuario vinculado fue eliminado)
+func GetUserIDByExternalIdentity(provider, subject string) (int, bool, error) {
+	var userID int
+	err := DB.QueryRow(`
+		SELECT ei.user_id FROM external_identities ei
+		JOIN users u ON u.id = ei.user_id
+		WHERE ei.provider = ? AND ei.subject = ?
+	`, provider, subject).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("error al buscar identidad externa %s/%s: %w", provider, subject, err)
+	}
+	return userID, true, nil
+}
+
+// CreateExternalUser crea el usuario de una identidad externa (alta en el primer login)
+// y lo vincula a (proveedor, sub). La contraseña es un hash aleatorio: el usuario entra
+// solo por su proveedor.
+func CreateExternalUser(provider, subject, username, unusableHash, role, nombre, apellido, email string) (int64, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error al iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT INTO users (username, password, role, nombre, apellido, cedula, email) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		username, unusableHash, role, nombre, apellido, "EXT-"+provider+"-"+subject, nullIfEmpty(email),
+	)
+	if err != nil {
+		return 0, userUniqueError(err)
+	}
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error al obtener último ID: %w", err)
+	}
+
+	// Reemplaza un vínculo huérfano si el usuario anterior fue eliminado
+	if _, err := tx.Exec(
+		"INSERT OR REPLACE INTO external_identities (provider, subject, user_id) VALUES (?, ?, ?)",
+		provider, subject, userID,
+	); err != nil {
+		return 0, fmt.Errorf("error al vincular identidad externa: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error al confirmar alta externa: %w", err)
+	}
+	return userID, nil
+}
+
+// TouchExternalIdentity registra el último login por el proveedor
+func TouchExternalIdentity(provider, subject string, now time.Time) error {
+	_, err := DB.Exec("UPDATE external_identities SET last_login_at = ? WHERE provider = ? AND subject = ?",
+		now.UTC().Format(time.DateTime), provider, subject)
+	return err
+}
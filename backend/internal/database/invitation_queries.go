@@ -0,0 +1,163 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"proyecto/internal/apperrors"
+	"proyecto/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// QUERIES DE INVITACIONES
+
+// ErrInvitationInvalid: el código no existe, expiró, fue revocado o ya no tiene usos
+var ErrInvitationInvalid = apperrors.InvalidField("invitation_code", "código de invitación inválido, expirado o agotado")
+
+// CreateInvitation guarda una invitación (solo el hash del código) y devuelve su ID
+func CreateInvitation(codeHash, role string, proyectoID, maxUsos int, expiresAt time.Time, createdBy string) (int64, error) {
+	res, err := DB.Exec(`
+		INSERT INTO invitations (code_hash, role, proyecto_id, max_usos, expires_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, codeHash, role, nullIfZero(proyectoID), maxUsos, expiresAt.UTC().Format(time.DateTime), createdBy)
+	if err != nil {
+		return 0, fmt.Errorf("error al crear invitación: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetInvitations lista las invitaciones, las más recientes primero
+func GetInvitations() ([]models.Invitation, error) {
+	rows, err := DB.Query(`
+		SELECT id, role, proyecto_id, max_usos, usos, expires_at, created_by, created_at, revocada
+		FROM invitations ORDER BY id DESC
+	`)
+	if err != nil {
+		log.Printf("Error en GetInvitations (Query): %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		var inv models.Invitation
+		var proyectoID sql.NullInt64
+		if err := rows.Scan(&inv.ID, &inv.Role, &proyectoID, &inv.MaxUsos, &inv.Usos, &inv.ExpiresAt, &inv.CreatedBy, &inv.CreatedAt, &inv.Revocada); err != nil {
+			log.Printf("Error en GetInvitations (Scan): %v", err)
+			continue
+		}
+		if proyectoID.Valid {
+			id := int(proyectoID.Int64)
+			inv.ProyectoID = &id
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, nil
+}
+
+// GetInvitationByID devuelve una invitación por su ID
+func GetInvitationByID(id int) (*models.Invitation, error) {
+	invitations, err := GetInvitations()
+	if err != nil {
+		return nil, err
+	}
+	for _, inv := range invitations {
+		if inv.ID == id {
+			return &inv, nil
+		}
+	}
+	return nil, errors.New("invitación no encontrada")
+}
+
+// RevokeInvitation invalida una invitación; devuelve 0 si no existía o ya estaba revocada
+func RevokeInvitation(id int) (int64, error) {
+	res, err := DB.Exec("UPDATE invitations SET revocada = 1 WHERE id = ? AND revocada = 0", id)
+	if err != nil {
+		return 0, fmt.Errorf("error al revocar invitación %d: %w", id, err)
+	}
+	return res.RowsAffected()
+}
+
+// RegisterUserWithInvitation crea el usuario con el rol (y proyecto) de la invitación y
+// consume un uso del código. Todo ocurre en una transacción: si el registro falla
+// (username o cédula repetidos) el uso no se descuenta.
+func RegisterUserWithInvitation(username, password, nombre, apellido, cedula, email, codeHash string, now time.Time) (int64, string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, "", fmt.Errorf("error al hashear password: %w", err)
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, "", fmt.Errorf("error al iniciar transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	var invitationID, maxUsos, usos int
+	var role, expiresAt string
+	var proyectoID sql.NullInt64
+	var revocada bool
+	err = tx.QueryRow(`
+		SELECT id, role, proyecto_id, max_usos, usos, expires_at, revocada
+		FROM invitations WHERE code_hash = ?
+	`, codeHash).Scan(&invitationID, &role, &proyectoID, &maxUsos, &usos, &expiresAt, &revocada)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrInvitationInvalid
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("error al buscar invitación: %w", err)
+	}
+	expires, err := parseDBTime(expiresAt)
+	if err != nil {
+		return 0, "", fmt.Errorf("fecha de expiración inválida en invitación %d: %w", invitationID, err)
+	}
+	if revocada || usos >= maxUsos || !now.Before(expires) {
+		return 0, "", ErrInvitationInvalid
+	}
+
+	// El rol o el proyecto pudieron borrarse después de emitir la invitación
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM roles WHERE name = ?", role).Scan(&count); err != nil || count == 0 {
+		return 0, "", ErrInvitationInvalid
+	}
+	if proyectoID.Valid {
+		if err := tx.QueryRow("SELECT COUNT(*) FROM proyectos WHERE id = ?", proyectoID.Int64).Scan(&count); err != nil || count == 0 {
+			return 0, "", ErrInvitationInvalid
+		}
+	}
+
+	res, err := tx.Exec("UPDATE invitations SET usos = usos + 1 WHERE id = ? AND usos < max_usos AND revocada = 0", invitationID)
+	if err != nil {
+		return 0, "", fmt.Errorf("error al consumir invitación %d: %w", invitationID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, "", ErrInvitationInvalid
+	}
+
+	res, err = tx.Exec(
+		"INSERT INTO users (username, password, role, nombre, apellido, cedula, email) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		username, string(hashedPassword), role, nombre, apellido, cedula, nullIfEmpty(email),
+	)
+	if err != nil {
+		return 0, "", userUniqueError(err)
+	}
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return 0, "", fmt.Errorf("error al obtener último ID: %w", err)
+	}
+
+	if proyectoID.Valid {
+		if _, err := tx.Exec("INSERT INTO project_members (user_id, proyecto_id, role) VALUES (?, ?, ?)", userID, proyectoID.Int64, role); err != nil {
+			return 0, "", fmt.Errorf("error al asignar proyecto de la invitación: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", fmt.Errorf("error al confirmar registro: %w", err)
+	}
+	return userID, role, nil
+}
@@ -6,37 +6,55 @@ import (
 	"log"
 	"strings"
 
+	"proyecto/internal/apperrors"
 	"proyecto/internal/models"
 )
 
 // QUERIES DE LABORES AGRONÓMICAS
 
-// GetLaboresByProyectoID obtiene todas las labores de un proyecto
-func GetLaboresByProyectoID(proyectoID int) ([]models.LaborAgronomica, error) {
-	query := `
-        SELECT id, proyecto_id, codigo_labor, descripcion, estado, fecha_creacion 
-        FROM labores_agronomicas 
-        WHERE proyecto_id = ? 
-        ORDER BY fecha_creacion DESC
-    `
-	rows, err := DB.Query(query, proyectoID)
-	if err != nil {
-		log.Printf("Error en GetLaboresByProyectoID (Query): %v", err)
-		return nil, err
-	}
-	defer rows.Close()
+// laboresList: listado de labores (por defecto, las más recientes primero)
+var laboresList = listSpec{
+	name:    "GetLabores",
+	columns: "id, proyecto_id, codigo_labor, descripcion, estado, fecha_creacion",
+	from:    "labores_agronomicas",
+	id:      "id",
+	sorts: map[string]string{
+		"id":             "id",
+		"codigo_labor":   "codigo_labor",
+		"descripcion":    "descripcion",
+		"estado":         "estado",
+		"fecha_creacion": "COALESCE(fecha_creacion, '')",
+	},
+	sort:   "-fecha_creacion",
+	search: []string{"codigo_labor", "descripcion"},
+	count:  true,
+}
+
+// GetLabores obtiene una página de las labores de un proyecto
+func GetLabores(req models.GetLaboresRequest) ([]models.LaborAgronomica, *models.Page, error) {
+	var filter listFilter
+	filter.add("proyecto_id = ?", req.ProyectoID)
+	filter.equal("estado", req.Estado)
 
-	var labores []models.LaborAgronomica
-	for rows.Next() {
+	labores := []models.LaborAgronomica{}
+	page, err := queryList(laboresList, req.ListParams, filter, func(rows *sql.Rows, key *cursorKey) error {
 		var l models.LaborAgronomica
-		if err := rows.Scan(&l.ID, &l.ProyectoID, &l.CodigoLabor, &l.Descripcion, &l.Estado, &l.FechaCreacion); err != nil {
-			log.Printf("Error en GetLaboresByProyectoID (Scan): %v", err)
-			continue
+		if err := rows.Scan(append([]interface{}{&l.ID, &l.ProyectoID, &l.CodigoLabor, &l.Descripcion, &l.Estado, &l.FechaCreacion}, key.dest()...)...); err != nil {
+			return err
 		}
 		labores = append(labores, l)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
+	return labores, page, nil
+}
 
-	return labores, nil
+// GetLaboresByProyectoID obtiene todas las labores de un proyecto
+func GetLaboresByProyectoID(proyectoID int) ([]models.LaborAgronomica, error) {
+	labores, _, err := GetLabores(models.GetLaboresRequest{ProyectoID: proyectoID})
+	return labores, err
 }
 
 // GetLaborByID obtiene una labor específica por su ID
@@ -69,7 +87,8 @@ func CreateLabor(labor models.LaborAgronomica) (int64, error) {
 		return 0, err
 	}
 	if exists > 0 {
-		return 0, errors.New("el código de labor ya existe para este proyecto")
+		return 0, apperrors.Conflict("el código de labor ya existe para este proyecto",
+			apperrors.Duplicate("codigo_labor", "ya existe en este proyecto"))
 	}
 
 	// Inserción
@@ -89,7 +108,8 @@ func CreateLabor(labor models.LaborAgronomica) (int64, error) {
 		log.Printf("Error en CreateLabor (Exec): %v", err)
 		// Verificamos si es un error de unicidad
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			return 0, errors.New("el código de labor ya existe para este proyecto")
+			return 0, apperrors.Conflict("el código de labor ya existe para este proyecto",
+				apperrors.Duplicate("codigo_labor", "ya existe en este proyecto"))
 		}
 		return 0, err
 	}
@@ -115,7 +135,8 @@ func UpdateLabor(id int, codigoLabor, descripcion, estado string) (int64, error)
 	if err != nil {
 		log.Printf("Error en UpdateLabor (Exec): %v", err)
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			return 0, errors.New("el código de labor ya existe para este proyecto")
+			return 0, apperrors.Conflict("el código de labor ya existe para este proyecto",
+				apperrors.Duplicate("codigo_labor", "ya existe en este proyecto"))
 		}
 		return 0, err
 	}
@@ -166,3 +187,8 @@ func GetNextLaborCodigo(proyectoID int) (int, error) {
 
 	return nextCodigo, nil
 }
+
+// GetLaborProyectoID devuelve el proyecto al que pertenece el registro
+func GetLaborProyectoID(id int) (int, error) {
+	return proyectoIDOf("labores_agronomicas", id)
+}
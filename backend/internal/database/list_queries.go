@@ -0,0 +1,215 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"proyecto/internal/apperrors"
+	"proyecto/internal/models"
+)
+
+//  LISTADOS PAGINADOS
+// Todos los listados comparten la paginación por cursor (keyset): la página
+// siguiente empieza después del último (valor de orden, id) de la anterior, así
+// que las filas nuevas o borradas no desplazan las páginas. El cursor es opaco
+// para el cliente y solo vale con el mismo orden con el que se emitió.
+
+// MaxListLimit: tope de filas por página, y tamaño de la página si el cliente no
+// manda limit
+const MaxListLimit = 500
+
+// listSpec describe un listado: de dónde salen las filas y por qué campos se
+// puede ordenar y buscar
+type listSpec struct {
+	name       string            // para los logs de error
+	columns    string            // columnas del SELECT, en el orden del scan
+	columnArgs []interface{}     // argumentos de las columnas (si tienen ?)
+	from       string            // FROM con sus JOINs
+	id         string            // columna única: desempata el orden y el cursor
+	sorts      map[string]string // campo de la API -> expresión SQL (nunca NULL)
+	sort       string            // orden por defecto ("-campo" = descendente)
+	search     []string          // columnas en las que busca q
+	count      bool              // calcular el total (listados chicos)
+	unpaged    int               // filas si no se pide página (ni limit ni cursor); 0 = MaxListLimit
+}
+
+// listFilter acumula las condiciones del WHERE
+type listFilter struct {
+	where []string
+	args  []interface{}
+}
+
+func (f *listFilter) add(condition string, args ...interface{}) {
+	f.where = append(f.where, condition)
+	f.args = append(f.args, args...)
+}
+
+// equal filtra por igualdad si value no está vacío
+func (f *listFilter) equal(column, value string) {
+	if value != "" {
+		f.add(column+" = ?", value)
+	}
+}
+
+// cursorKey: valor de orden e id de una fila; el scan de cada listado los lee
+// al final de la fila (ver dest)
+type cursorKey struct {
+	Value interface{}
+	ID    int64
+}
+
+func (k *cursorKey) dest() []interface{} {
+	return []interface{}{&k.Value, &k.ID}
+}
+
+// cursor: contenido (en base64) de next_cursor
+type cursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	ID    int64       `json:"id"`
+}
+
+func encodeCursor(sortParam string, key cursorKey) string {
+	value := key.Value
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	raw, _ := json.Marshal(cursor{Sort: sortParam, Value: value, ID: key.ID})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(encoded, sortParam string) (*cursor, error) {
+	invalid := apperrors.InvalidField("cursor", "cursor inválido")
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, invalid
+	}
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	var c cursor
+	if err := dec.Decode(&c); err != nil {
+		return nil, invalid
+	}
+	if c.Sort != sortParam {
+		return nil, apperrors.InvalidField("cursor", "el cursor se emitió con otro orden (sort)")
+	}
+	// Los números vuelven como enteros si lo eran (ids, cantidades)
+	if n, ok := c.Value.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			c.Value = i
+		} else if f, err := n.Float64(); err == nil {
+			c.Value = f
+		}
+	}
+	return &c, nil
+}
+
+// queryList ejecuta el listado con los filtros, el orden y la página pedidos.
+// scan lee una fila: sus columnas seguidas de key.dest().
+func queryList(spec listSpec, params models.ListParams, filter listFilter, scan func(rows *sql.Rows, key *cursorKey) error) (*models.Page, error) {
+	limit := int(params.Limit)
+	if limit < 0 || limit > MaxListLimit {
+		return nil, apperrors.InvalidField("limit", fmt.Sprintf("limit no puede ser negativo ni mayor que %d", MaxListLimit))
+	}
+	if limit == 0 {
+		limit = MaxListLimit
+		if !params.Paged() && spec.unpaged > 0 {
+			limit = spec.unpaged
+		}
+	}
+
+	sortParam := strings.TrimSpace(params.Sort)
+	if sortParam == "" {
+		sortParam = spec.sort
+	}
+	field, desc := strings.TrimPrefix(sortParam, "-"), strings.HasPrefix(sortParam, "-")
+	sortExpr, ok := spec.sorts[field]
+	if !ok {
+		return nil, apperrors.InvalidField("sort", fmt.Sprintf("no se puede ordenar por %q (válidos: %s)", field, strings.Join(sortFields(spec), ", ")))
+	}
+
+	if q := strings.TrimSpace(params.Q); q != "" && len(spec.search) > 0 {
+		var likes []string
+		var args []interface{}
+		for _, column := range spec.search {
+			likes = append(likes, column+" LIKE ?")
+			args = append(args, "%"+q+"%")
+		}
+		filter.add("("+strings.Join(likes, " OR ")+")", args...)
+	}
+
+	var where strings.Builder
+	where.WriteString(" WHERE 1=1")
+	for _, condition := range filter.where {
+		where.WriteString(" AND " + condition)
+	}
+
+	page := &models.Page{}
+	if spec.count {
+		var total int
+		if err := DB.QueryRow("SELECT COUNT(*) FROM "+spec.from+where.String(), filter.args...).Scan(&total); err != nil {
+			log.Printf("Error en %s (Count): %v", spec.name, err)
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	cmp, dir := ">", "ASC"
+	if desc {
+		cmp, dir = "<", "DESC"
+	}
+	args := append(append([]interface{}{}, spec.columnArgs...), filter.args...)
+	if params.Cursor != "" {
+		after, err := decodeCursor(params.Cursor, sortParam)
+		if err != nil {
+			return nil, err
+		}
+		where.WriteString(fmt.Sprintf(" AND (%s %s ? OR (%s = ? AND %s %s ?))", sortExpr, cmp, sortExpr, spec.id, cmp))
+		args = append(args, after.Value, after.Value, after.ID)
+	}
+
+	var query strings.Builder
+	query.WriteString(fmt.Sprintf("SELECT %s, %s, %s FROM %s", spec.columns, sortExpr, spec.id, spec.from))
+	query.WriteString(where.String())
+	query.WriteString(fmt.Sprintf(" ORDER BY %s %s, %s %s", sortExpr, dir, spec.id, dir))
+	// Una fila de más indica que hay otra página
+	query.WriteString(fmt.Sprintf(" LIMIT %d", limit+1))
+
+	rows, err := DB.Query(query.String(), args...)
+	if err != nil {
+		log.Printf("Error en %s (Query): %v", spec.name, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var last cursorKey
+	for n := 0; rows.Next(); n++ {
+		if n == limit {
+			next := encodeCursor(sortParam, last)
+			page.NextCursor = &next
+			break
+		}
+		var key cursorKey
+		if err := scan(rows, &key); err != nil {
+			log.Printf("Error en %s (Scan): %v", spec.name, err)
+			continue
+		}
+		last = key
+	}
+	return page, rows.Err()
+}
+
+// sortFields: campos de orden válidos de un listado (para el mensaje de error)
+func sortFields(spec listSpec) []string {
+	fields := make([]string, 0, len(spec.sorts))
+	for field := range spec.sorts {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -1,8 +1,8 @@
 package database
 
 import (
+	"database/sql"
 	"log"
-	"strings"
 
 	"proyecto/internal/models"
 )
@@ -13,8 +13,8 @@ import (
 func InsertLog(logEntry models.EventLog) (int64, error) {
 	stmt, err := DB.Prepare(`
 		INSERT INTO event_logs 
-		(timestamp, usuario_username, usuario_rol, accion, entidad, entidad_id) 
-		VALUES (strftime('%Y-%m-%d %H:%M:%S', 'now', 'localtime'), ?, ?, ?, ?, ?)
+		(timestamp, usuario_username, usuario_rol, accion, entidad, entidad_id, suplantado_por) 
+		VALUES (strftime('%Y-%m-%d %H:%M:%S', 'now', 'localtime'), ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		log.Printf("Error preparando InsertLog: %v", err)
@@ -28,6 +28,7 @@ func InsertLog(logEntry models.EventLog) (int64, error) {
 		logEntry.Accion,
 		logEntry.Entidad,
 		logEntry.EntidadID,
+		nullIfEmpty(logEntry.SuplantadoPor),
 	)
 	if err != nil {
 		log.Printf("Error ejecutando InsertLog: %v", err)
@@ -37,46 +38,42 @@ func InsertLog(logEntry models.EventLog) (int64, error) {
 	return res.LastInsertId()
 }
 
-// GetLogs recupera los logs con filtros dinámicos
-func GetLogs(filtros models.GetLogsRequest) ([]models.EventLogResponse, error) {
-	var query strings.Builder
-	var args []interface{}
-
-	query.WriteString("SELECT id, timestamp, usuario_username, usuario_rol, accion, entidad, entidad_id FROM event_logs WHERE 1=1")
+// logsList: los eventos crecen sin tope, así que no se cuentan. Sin página se
+// mantiene el tope de 1000 eventos que tenía el arreglo de get-logs.
+var logsList = listSpec{
+	name:    "GetLogs",
+	columns: "id, timestamp, usuario_username, usuario_rol, accion, entidad, entidad_id, suplantado_por",
+	from:    "event_logs",
+	id:      "id",
+	sorts: map[string]string{
+		"id":               "id",
+		"timestamp":        "COALESCE(timestamp, '')",
+		"usuario_username": "usuario_username",
+		"accion":           "accion",
+		"entidad":          "entidad",
+	},
+	sort:    "-timestamp",
+	search:  []string{"usuario_username", "accion", "entidad"},
+	unpaged: 1000,
+}
 
+// GetLogs recupera los logs con filtros dinámicos
+func GetLogs(filtros models.GetLogsRequest) ([]models.EventLogResponse, *models.Page, error) {
+	var filter listFilter
 	if filtros.UsuarioUsername != "" {
-		query.WriteString(" AND usuario_username LIKE ?")
-		args = append(args, "%"+filtros.UsuarioUsername+"%")
-	}
-	if filtros.Accion != "" {
-		query.WriteString(" AND accion = ?")
-		args = append(args, filtros.Accion)
-	}
-	if filtros.Entidad != "" {
-		query.WriteString(" AND entidad = ?")
-		args = append(args, filtros.Entidad)
+		filter.add("usuario_username LIKE ?", "%"+filtros.UsuarioUsername+"%")
 	}
+	filter.equal("accion", filtros.Accion)
+	filter.equal("entidad", filtros.Entidad)
 	if filtros.FechaInicio != "" {
-		query.WriteString(" AND date(timestamp) >= date(?)")
-		args = append(args, filtros.FechaInicio)
+		filter.add("date(timestamp) >= date(?)", filtros.FechaInicio)
 	}
 	if filtros.FechaCierre != "" {
-		query.WriteString(" AND date(timestamp) <= date(?)")
-		args = append(args, filtros.FechaCierre)
+		filter.add("date(timestamp) <= date(?)", filtros.FechaCierre)
 	}
 
-	query.WriteString(" ORDER BY timestamp DESC")
-	query.WriteString(" LIMIT 1000")
-
-	rows, err := DB.Query(query.String(), args...)
-	if err != nil {
-		log.Printf("Error en GetLogs (Query): %v", err)
-		return nil, err
-	}
-	defer rows.Close()
-
-	var logs []models.EventLogResponse
-	for rows.Next() {
+	logs := []models.EventLogResponse{}
+	page, err := queryList(logsList, filtros.ListParams, filter, func(rows *sql.Rows, key *cursorKey) error {
 		var l models.EventLogResponse
 		if err := rows.Scan(
 			&l.ID,
@@ -86,14 +83,19 @@ func GetLogs(filtros models.GetLogsRequest) ([]models.EventLogResponse, error) {
 			&l.Accion,
 			&l.Entidad,
 			&l.EntidadID,
+			&l.SuplantadoPor,
+			&key.Value,
+			&key.ID,
 		); err != nil {
-			log.Printf("Error en GetLogs (Scan): %v", err)
-			continue
+			return err
 		}
 		logs = append(logs, l)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return logs, nil
+	return logs, page, nil
 }
 
 // DeleteLog elimina un log específico por ID
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"proyecto/internal/models"
+)
+
+// QUERIES DE PROTECCIÓN DEL LOGIN (intentos fallidos y bloqueos)
+
+// ipTimeLayout guarda milisegundos: el backoff por IP trabaja con esperas cortas
+const ipTimeLayout = "2006-01-02 15:04:05.000"
+
+// GetUserLockout devuelve los fallos acumulados de un usuario y hasta cuándo está bloqueado
+// (tiempo cero si no lo está)
+func GetUserLockout(userID int) (int, time.Time, error) {
+	var failures int
+	var lockedUntil sql.NullString
+	err := DB.QueryRow("SELECT failed_logins, locked_until FROM users WHERE id = ?", userID).Scan(&failures, &lockedUntil)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("error al leer bloqueo del usuario %d: %w", userID, err)
+	}
+	if !lockedUntil.Valid || lockedUntil.String == "" {
+		return failures, time.Time{}, nil
+	}
+
+	until, err := parseDBTime(lockedUntil.String)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("locked_until inválido para el usuario %d: %w", userID, err)
+	}
+	return failures, until, nil
+}
+
+// IncrementUserFailedLogins suma un fallo y devuelve el total acumulado
+func IncrementUserFailedLogins(userID int) (int, error) {
+	var failures int
+	err := DB.QueryRow("UPDATE users SET failed_logins = failed_logins + 1 WHERE id = ? RETURNING failed_logins", userID).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("error al registrar fallo de login del usuario %d: %w", userID, err)
+	}
+	return failures, nil
+}
+
+// LockUser bloquea la cuenta hasta la fecha indicada y reinicia el contador de fallos
+func LockUser(userID int, until time.Time) error {
+	_, err := DB.Exec("UPDATE users SET failed_logins = 0, locked_until = ? WHERE id = ?", until.UTC().Format(time.DateTime), userID)
+	if err != nil {
+		return fmt.Errorf("error al bloquear al usuario %d: %w", userID, err)
+	}
+	return nil
+}
+
+// ResetUserLockout limpia fallos y bloqueo (login correcto o desbloqueo manual)
+func ResetUserLockout(userID int) (int64, error) {
+	res, err := DB.Exec("UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = ?", userID)
+	if err != nil {
+		return 0, fmt.Errorf("error al desbloquear al usuario %d: %w", userID, err)
+	}
+	return res.RowsAffected()
+}
+
+// GetIPLoginFailures devuelve los fallos registrados para una IP y la fecha del último
+func GetIPLoginFailures(ip string) (int, time.Time, error) {
+	var failures int
+	var lastFailure string
+	err := DB.QueryRow("SELECT failures, last_failure FROM login_failures_ip WHERE ip = ?", ip).Scan(&failures, &lastFailure)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, nil
+	}
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("error al leer fallos de la IP %s: %w", ip, err)
+	}
+
+	last, err := parseDBTime(lastFailure)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("last_failure inválido para la IP %s: %w", ip, err)
+	}
+	return failures, last, nil
+}
+
+// RecordIPLoginFailure registra un fallo para la IP. Si el último fallo es anterior
+// a resetBefore, el contador vuelve a empezar. Devuelve el total acumulado.
+func RecordIPLoginFailure(ip string, now, resetBefore time.Time) (int, error) {
+	var failures int
+	err := DB.QueryRow(`
+		INSERT INTO login_failures_ip (ip, failures, last_failure) VALUES (?, 1, ?)
+		ON CONFLICT(ip) DO UPDATE SET
+			failures = CASE WHEN last_failure < ? THEN 1 ELSE failures + 1 END,
+			last_failure = excluded.last_failure
+		RETURNING failures
+	`, ip, now.UTC().Format(ipTimeLayout), resetBefore.UTC().Format(ipTimeLayout)).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("error al registrar fallo de la IP %s: %w", ip, err)
+	}
+	return failures, nil
+}
+
+// QUERIES DE HISTORIAL DE LOGINS
+
+// RecordLogin guarda un inicio de sesión exitoso y actualiza users.last_login_at
+func RecordLogin(userID, sessionID int, ip, userAgent, metodo string, at time.Time) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error al iniciar transacción (RecordLogin): %w", err)
+	}
+	defer tx.Rollback()
+
+	fecha := at.UTC().Format(time.DateTime)
+	if _, err := tx.Exec("INSERT INTO login_history (user_id, session_id, ip, user_agent, metodo, fecha) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, sessionID, ip, userAgent, metodo, fecha); err != nil {
+		return fmt.Errorf("error al registrar login del usuario %d: %w", userID, err)
+	}
+	if _, err := tx.Exec("UPDATE users SET last_login_at = ? WHERE id = ?", fecha, userID); err != nil {
+		return fmt.Errorf("error al actualizar last_login_at del usuario %d: %w", userID, err)
+	}
+	return tx.Commit()
+}
+
+// GetLoginHistory devuelve los últimos inicios de sesión de un usuario (más recientes primero)
+func GetLoginHistory(userID, limit int) ([]models.LoginRecord, error) {
+	rows, err := DB.Query(`
+		SELECT id, session_id, ip, user_agent, metodo, fecha
+		FROM login_history WHERE user_id = ?
+		ORDER BY id DESC LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer historial de logins del usuario %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	history := []models.LoginRecord{}
+	for rows.Next() {
+		var rec models.LoginRecord
+		if err := rows.Scan(&rec.ID, &rec.SessionID, &rec.IP, &rec.UserAgent, &rec.Metodo, &rec.Fecha); err != nil {
+			return nil, fmt.Errorf("error al escanear historial de logins: %w", err)
+		}
+		history = append(history, rec)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,24 @@
+package database
+
+import (
+	"fmt"
+
+	"proyecto/internal/models"
+)
+
+// QUERIES DE LA BANDEJA DE SALIDA (mail_outbox)
+
+// InsertOutboxMail encola un correo en la bandeja de salida local
+func InsertOutboxMail(msg models.MailMessage) (int64, error) {
+	stmt, err := DB.Prepare("INSERT INTO mail_outbox (destinatario, asunto, cuerpo) VALUES (?, ?, ?)")
+	if err != nil {
+		return 0, fmt.Errorf("error al preparar inserción (InsertOutboxMail): %w", err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(msg.To, msg.Subject, msg.Body)
+	if err != nil {
+		return 0, fmt.Errorf("error al ejecutar inserción (InsertOutboxMail): %w", err)
+	}
+	return res.LastInsertId()
+}
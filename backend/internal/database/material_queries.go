@@ -0,0 +1,56 @@
+package database
+
+import (
+	"database/sql"
+
+	"proyecto/internal/models"
+)
+
+// QUERIES DE MATERIALES E INSUMOS (tabla materiales_insumos)
+
+// GetMaterialProyectoID devuelve el proyecto al que pertenece el registro
+func GetMaterialProyectoID(id int) (int, error) {
+	return proyectoIDOf("materiales_insumos", id)
+}
+
+var materialesList = listSpec{
+	name:    "GetMateriales",
+	columns: "id, proyecto_id, actividad, accion, categoria, COALESCE(responsable, ''), nombre, unidad, cantidad, costo_unitario, monto",
+	from:    "materiales_insumos",
+	id:      "id",
+	sorts: map[string]string{
+		"id":          "id",
+		"actividad":   "COALESCE(actividad, '')",
+		"accion":      "COALESCE(accion, '')",
+		"categoria":   "COALESCE(categoria, '')",
+		"responsable": "COALESCE(responsable, '')",
+		"nombre":      "COALESCE(nombre, '')",
+		"cantidad":    "COALESCE(cantidad, 0)",
+	},
+	sort:   "id",
+	search: []string{"actividad", "accion", "nombre", "responsable"},
+	count:  true,
+}
+
+// GetMateriales: una página de los materiales e insumos de un proyecto
+func GetMateriales(req models.GetMaterialesRequest) ([]models.MaterialInsumo, *models.Page, error) {
+	var filter listFilter
+	filter.add("proyecto_id = ?", req.ProyectoID)
+	filter.equal("actividad", req.Actividad)
+	filter.equal("categoria", req.Categoria)
+
+	materiales := []models.MaterialInsumo{}
+	page, err := queryList(materialesList, req.ListParams, filter, func(rows *sql.Rows, key *cursorKey) error {
+		var m models.MaterialInsumo
+		dest := []interface{}{&m.ID, &m.ProyectoID, &m.Actividad, &m.Accion, &m.Categoria, &m.Responsable, &m.Nombre, &m.Unidad, &m.Cantidad, &m.CostoUnitario, &m.Monto}
+		if err := rows.Scan(append(dest, key.dest()...)...); err != nil {
+			return err
+		}
+		materiales = append(materiales, m)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return materiales, page, nil
+}
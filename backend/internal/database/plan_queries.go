@@ -0,0 +1,56 @@
+package database
+
+import (
+	"database/sql"
+
+	"proyecto/internal/models"
+)
+
+// QUERIES DE PLANES DE ACCIÓN (tabla planes_accion)
+
+// GetPlanProyectoID devuelve el proyecto al que pertenece el registro
+func GetPlanProyectoID(id int) (int, error) {
+	return proyectoIDOf("planes_accion", id)
+}
+
+var planesList = listSpec{
+	name:    "GetPlanes",
+	columns: "id, proyecto_id, actividad, accion, fecha_inicio, fecha_cierre, horas, responsable, costo_unitario, monto",
+	from:    "planes_accion",
+	id:      "id",
+	sorts: map[string]string{
+		"id":           "id",
+		"actividad":    "COALESCE(actividad, '')",
+		"accion":       "COALESCE(accion, '')",
+		"fecha_inicio": "COALESCE(fecha_inicio, '')",
+		"fecha_cierre": "COALESCE(fecha_cierre, '')",
+		"horas":        "COALESCE(horas, 0)",
+		"responsable":  "COALESCE(responsable, '')",
+	},
+	sort:   "id",
+	search: []string{"actividad", "accion", "responsable"},
+	count:  true,
+}
+
+// GetPlanes: una página de los planes de acción de un proyecto
+func GetPlanes(req models.GetPlanesRequest) ([]models.PlanAccion, *models.Page, error) {
+	var filter listFilter
+	filter.add("proyecto_id = ?", req.ProyectoID)
+	filter.equal("actividad", req.Actividad)
+	filter.equal("responsable", req.Responsable)
+
+	planes := []models.PlanAccion{}
+	page, err := queryList(planesList, req.ListParams, filter, func(rows *sql.Rows, key *cursorKey) error {
+		var p models.PlanAccion
+		dest := []interface{}{&p.ID, &p.ProyectoID, &p.Actividad, &p.Accion, &p.FechaInicio, &p.FechaCierre, &p.Horas, &p.Responsable, &p.CostoUnitario, &p.Monto}
+		if err := rows.Scan(append(dest, key.dest()...)...); err != nil {
+			return err
+		}
+		planes = append(planes, p)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return planes, page, nil
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"proyecto/internal/models"
+)
+
+// QUERIES DE MIEMBROS DE PROYECTO (tabla project_members)
+
+// AddProjectMember agrega al usuario al proyecto o, si ya es miembro, cambia su rol
+func AddProjectMember(userID, proyectoID int, role string) error {
+	_, err := DB.Exec(`
+		INSERT INTO project_members (user_id, proyecto_id, role) VALUES (?, ?, ?)
+		ON CONFLICT(user_id, proyecto_id) DO UPDATE SET role = excluded.role
+	`, userID, proyectoID, role)
+	if err != nil {
+		return fmt.Errorf("error al agregar miembro %d al proyecto %d: %w", userID, proyectoID, err)
+	}
+	return nil
+}
+
+// RemoveProjectMember quita al usuario del proyecto
+func RemoveProjectMember(userID, proyectoID int) (int64, error) {
+	res, err := DB.Exec("DELETE FROM project_members WHERE user_id = ? AND proyecto_id = ?", userID, proyectoID)
+	if err != nil {
+		return 0, fmt.Errorf("error al quitar miembro %d del proyecto %d: %w", userID, proyectoID, err)
+	}
+	return res.RowsAffected()
+}
+
+// RemoveUserFromAllProjects quita al usuario de todos sus proyectos
+func RemoveUserFromAllProjects(userID int) (int64, error) {
+	res, err := DB.Exec("DELETE FROM project_members WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, fmt.Errorf("error al quitar proyectos del usuario %d: %w", userID, err)
+	}
+	return res.RowsAffected()
+}
+
+// GetProjectMemberRole devuelve el rol del usuario en el proyecto ("" si no es miembro)
+func GetProjectMemberRole(userID, proyectoID int) (string, error) {
+	var role string
+	err := DB.QueryRow("SELECT role FROM project_members WHERE user_id = ? AND proyecto_id = ?", userID, proyectoID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error al buscar rol de %d en proyecto %d: %w", userID, proyectoID, err)
+	}
+	return role, nil
+}
+
+// GetProjectMembers lista los miembros de un proyecto con su rol en él
+func GetProjectMembers(proyectoID int) ([]models.ProjectMember, error) {
+	rows, err := DB.Query(`
+		SELECT u.id, u.username, u.nombre, u.apellido, pm.role
+		FROM project_members pm
+		JOIN users u ON u.id = pm.user_id
+		WHERE pm.proyecto_id = ?
+		ORDER BY pm.role ASC, u.apellido ASC, u.nombre ASC
+	`, proyectoID)
+	if err != nil {
+		log.Printf("Error en GetProjectMembers (Query %d): %v", proyectoID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.ProjectMember{}
+	for rows.Next() {
+		var m models.ProjectMember
+		if err := rows.Scan(&m.ID, &m.Username, &m.Nombre, &m.Apellido, &m.Role); err != nil {
+			log.Printf("Error en GetProjectMembers (Scan): %v", err)
+			continue
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// UserHasProjectPermission verifica un permiso dentro de un proyecto. Vale el rol que el
+// usuario tiene en el proyecto (project_members) o su rol global, pero este último solo
+// si además tiene proyectos:all (acceso a todos los proyectos).
+func UserHasProjectPermission(username string, proyectoID int, permission string) (bool, error) {
+	var exists int
+	err := DB.QueryRow(`
+		SELECT 1 FROM users u
+		WHERE u.username = ? AND (
+			EXISTS (
+				SELECT 1 FROM project_members pm
+				JOIN role_permissions rp ON rp.role = pm.role
+				WHERE pm.user_id = u.id AND pm.proyecto_id = ? AND rp.permission = ?
+			)
+			OR (
+				EXISTS (SELECT 1 FROM role_permissions rp WHERE rp.role = u.role AND rp.permission = ?)
+				AND EXISTS (SELECT 1 FROM role_permissions rp WHERE rp.role = u.role AND rp.permission = ?)
+			)
+		)
+	`, username, proyectoID, permission, permission, models.PermProyectosAll).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error al verificar permiso %s de %s en proyecto %d: %w", permission, username, proyectoID, err)
+	}
+	return true, nil
+}
+
+// getAllMemberships agrupa por usuario los proyectos a los que pertenece (en orden de asignación)
+func getAllMemberships() (map[int][]models.UserProjectRef, error) {
+	rows, err := DB.Query(`
+		SELECT pm.user_id, pm.proyecto_id, p.nombre, pm.role
+		FROM project_members pm
+		JOIN proyectos p ON p.id = pm.proyecto_id
+		ORDER BY pm.fecha_asignacion ASC, pm.proyecto_id ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byUser := make(map[int][]models.UserProjectRef)
+	for rows.Next() {
+		var userID int
+		var ref models.UserProjectRef
+		if err := rows.Scan(&userID, &ref.ProyectoID, &ref.Nombre, &ref.Role); err != nil {
+			log.Printf("Error en getAllMemberships (Scan): %v", err)
+			continue
+		}
+		byUser[userID] = append(byUser[userID], ref)
+	}
+	return byUser, nil
+}
+
+// GetProjectDetailsForUser devuelve todos los proyectos del usuario, cada uno con
+// sus gerentes y sus compañeros (miembros con rol 'user', excluyendo al propio usuario)
+func GetProjectDetailsForUser(userID int) (*models.UserProjectDetailsResponse, error) {
+	// 1. Verificar que el usuario exista
+	var exists int
+	if err := DB.QueryRow("SELECT 1 FROM users WHERE id = ?", userID).Scan(&exists); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("Usuario no encontrado.")
+		}
+		log.Printf("Error buscando usuario %d: %v", userID, err)
+		return nil, errors.New("Error al buscar el usuario.")
+	}
+
+	// 2. Proyectos a los que pertenece
+	rows, err := DB.Query(`
+		SELECT p.id, p.nombre, p.fecha_inicio, p.fecha_cierre, p.estado, p.fecha_creacion, pm.role
+		FROM project_members pm
+		JOIN proyectos p ON p.id = pm.proyecto_id
+		WHERE pm.user_id = ?
+		ORDER BY pm.fecha_asignacion ASC, p.id ASC
+	`, userID)
+	if err != nil {
+		log.Printf("Error obteniendo proyectos del usuario %d: %v", userID, err)
+		return nil, errors.New("Error al obtener los proyectos del usuario.")
+	}
+	var proyectos []models.ProjectDetails
+	for rows.Next() {
+		var d models.ProjectDetails
+		p := &d.Proyecto
+		if err := rows.Scan(&p.ID, &p.Nombre, &p.FechaInicio, &p.FechaCierre, &p.Estado, &p.FechaCreacion, &d.Role); err != nil {
+			log.Printf("Error escaneando proyecto del usuario %d: %v", userID, err)
+			continue
+		}
+		proyectos = append(proyectos, d)
+	}
+	rows.Close()
+
+	// 3. Gerentes y compañeros de cada proyecto
+	for i := range proyectos {
+		members, err := GetProjectMembers(proyectos[i].Proyecto.ID)
+		if err != nil {
+			return nil, errors.New("Error al obtener miembros del proyecto.")
+		}
+		for _, m := range members {
+			switch {
+			case m.Role == models.RoleGerente:
+				proyectos[i].Gerentes = append(proyectos[i].Gerentes, m)
+			case m.Role == models.RoleUser && m.ID != userID:
+				proyectos[i].Miembros = append(proyectos[i].Miembros, m)
+			}
+		}
+	}
+
+	// 4. Construir la respuesta (el primer proyecto también va en los campos de siempre)
+	response := &models.UserProjectDetailsResponse{Proyectos: []models.ProjectDetails{}}
+	if len(proyectos) > 0 {
+		response.Proyectos = proyectos
+		response.Proyecto = &proyectos[0].Proyecto
+		response.Gerentes = proyectos[0].Gerentes
+		response.Miembros = proyectos[0].Miembros
+	}
+	return response, nil
+}
+
+// proyectoIDOf devuelve el proyecto dueño de un registro (para autorizar updates y deletes por id)
+func proyectoIDOf(table string, id int) (int, error) {
+	var proyectoID int
+	err := DB.QueryRow("SELECT proyecto_id FROM "+table+" WHERE id = ?", id).Scan(&proyectoID)
+	if err != nil {
+		return 0, err
+	}
+	return proyectoID, nil
+}
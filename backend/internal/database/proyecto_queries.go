@@ -7,29 +7,55 @@ import (
 	"log"
 	"strings"
 
+	"proyecto/internal/apperrors"
 	"proyecto/internal/models"
 )
 
 // QUERIES DE PROYECTOS
 
-func GetAllProyectos() ([]models.Proyecto, error) {
-	rows, err := DB.Query("SELECT id, nombre, fecha_inicio, fecha_cierre, estado, fecha_creacion FROM proyectos ORDER BY id ASC")
-	if err != nil {
-		log.Printf("Error en GetAllProyectos (Query): %v", err)
-		return nil, err
+var proyectosList = listSpec{
+	name:    "GetProyectos",
+	columns: "p.id, p.nombre, p.fecha_inicio, p.fecha_cierre, p.estado, p.fecha_creacion",
+	from:    "proyectos p",
+	id:      "p.id",
+	sorts: map[string]string{
+		"id":             "p.id",
+		"nombre":         "p.nombre",
+		"fecha_inicio":   "p.fecha_inicio",
+		"fecha_cierre":   "p.fecha_cierre",
+		"estado":         "p.estado",
+		"fecha_creacion": "COALESCE(p.fecha_creacion, '')",
+	},
+	sort:   "id",
+	search: []string{"p.nombre"},
+	count:  true,
+}
+
+// GetProyectos: una página de proyectos. Con memberID solo los proyectos en los
+// que el rol de ese usuario tiene permission (0 = todos).
+func GetProyectos(req models.GetProyectosRequest, memberID int, permission string) ([]models.Proyecto, *models.Page, error) {
+	var filter listFilter
+	if memberID != 0 {
+		filter.add(`p.id IN (
+			SELECT pm.proyecto_id FROM project_members pm
+			JOIN role_permissions rp ON rp.role = pm.role AND rp.permission = ?
+			WHERE pm.user_id = ?)`, permission, memberID)
 	}
-	defer rows.Close()
+	filter.equal("p.estado", req.Estado)
 
-	var proyectos []models.Proyecto
-	for rows.Next() {
+	proyectos := []models.Proyecto{}
+	page, err := queryList(proyectosList, req.ListParams, filter, func(rows *sql.Rows, key *cursorKey) error {
 		var p models.Proyecto
-		if err := rows.Scan(&p.ID, &p.Nombre, &p.FechaInicio, &p.FechaCierre, &p.Estado, &p.FechaCreacion); err != nil {
-			log.Printf("Error en GetAllProyectos (Scan): %v", err)
-			continue
+		if err := rows.Scan(append([]interface{}{&p.ID, &p.Nombre, &p.FechaInicio, &p.FechaCierre, &p.Estado, &p.FechaCreacion}, key.dest()...)...); err != nil {
+			return err
 		}
 		proyectos = append(proyectos, p)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	return proyectos, nil
+	return proyectos, page, nil
 }
 
 func GetProjectByID(id int64) (*models.Proyecto, error) {
@@ -56,7 +82,7 @@ func CreateProyecto(nombre, fechaInicio, fechaCierre string) (int64, error) {
 	res, err := stmt.Exec(nombre, fechaInicio, fechaCierre)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint failed: proyectos.nombre") {
-			return 0, errors.New("El nombre del proyecto ya existe.")
+			return 0, apperrors.Conflict("El nombre del proyecto ya existe.", apperrors.Duplicate("nombre", "ya existe otro proyecto con este nombre"))
 		}
 		return 0, fmt.Errorf("error al ejecutar inserción (CreateProyecto): %w", err)
 	}
@@ -78,7 +104,7 @@ func UpdateProyecto(id int, nombre, fechaInicio, fechaCierre string) (int64, err
 	res, err := stmt.Exec(nombre, fechaInicio, fechaCierre, id)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint failed: proyectos.nombre") {
-			return 0, errors.New("El nombre del proyecto ya existe.")
+			return 0, apperrors.Conflict("El nombre del proyecto ya existe.", apperrors.Duplicate("nombre", "ya existe otro proyecto con este nombre"))
 		}
 		return 0, fmt.Errorf("error al ejecutar update (UpdateProyecto): %w", err)
 	}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"database/sql"
+
+	"proyecto/internal/models"
+)
+
+// QUERIES DE RECURSOS HUMANOS (tabla recursos_humanos)
+
+// GetRecursoProyectoID devuelve el proyecto al que pertenece el registro
+func GetRecursoProyectoID(id int) (int, error) {
+	return proyectoIDOf("recursos_humanos", id)
+}
+
+var recursosList = listSpec{
+	name:    "GetRecursos",
+	columns: "id, proyecto_id, actividad, accion, nombre, cedula, tiempo, cantidad, costo_unitario, monto",
+	from:    "recursos_humanos",
+	id:      "id",
+	sorts: map[string]string{
+		"id":        "id",
+		"actividad": "COALESCE(actividad, '')",
+		"accion":    "COALESCE(accion, '')",
+		"nombre":    "COALESCE(nombre, '')",
+		"cedula":    "COALESCE(cedula, '')",
+		"tiempo":    "COALESCE(tiempo, 0)",
+		"cantidad":  "COALESCE(cantidad, 0)",
+	},
+	sort:   "id",
+	search: []string{"actividad", "accion", "nombre", "cedula"},
+	count:  true,
+}
+
+// GetRecursos: una página de los recursos humanos de un proyecto
+func GetRecursos(req models.GetRecursosRequest) ([]models.RecursoHumano, *models.Page, error) {
+	var filter listFilter
+	filter.add("proyecto_id = ?", req.ProyectoID)
+	filter.equal("actividad", req.Actividad)
+	filter.equal("cedula", req.Cedula)
+
+	recursos := []models.RecursoHumano{}
+	page, err := queryList(recursosList, req.ListParams, filter, func(rows *sql.Rows, key *cursorKey) error {
+		var r models.RecursoHumano
+		dest := []interface{}{&r.ID, &r.ProyectoID, &r.Actividad, &r.Accion, &r.Nombre, &r.Cedula, &r.Tiempo, &r.Cantidad, &r.CostoUnitario, &r.Monto}
+		if err := rows.Scan(append(dest, key.dest()...)...); err != nil {
+			return err
+		}
+		recursos = append(recursos, r)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return recursos, page, nil
+}
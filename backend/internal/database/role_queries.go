@@ -0,0 +1,215 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"proyecto/internal/apperrors"
+	"proyecto/internal/models"
+)
+
+// QUERIES DE ROLES Y PERMISOS
+
+// UserHasPermission indica si el rol actual del usuario tiene el permiso
+func UserHasPermission(username, permission string) (bool, error) {
+	var exists int
+	err := DB.QueryRow(`
+		SELECT 1 FROM users u
+		JOIN role_permissions rp ON rp.role = u.role
+		WHERE u.username = ? AND rp.permission = ?
+	`, username, permission).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error al verificar permiso %s de %s: %w", permission, username, err)
+	}
+	return true, nil
+}
+
+// RoleExists indica si el rol está definido en la tabla roles
+func RoleExists(name string) (bool, error) {
+	var exists int
+	err := DB.QueryRow("SELECT 1 FROM roles WHERE name = ?", name).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error al buscar rol %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// GetRolePermissions devuelve los permisos de un rol
+func GetRolePermissions(name string) ([]string, error) {
+	rows, err := DB.Query("SELECT permission FROM role_permissions WHERE role = ? ORDER BY permission ASC", name)
+	if err != nil {
+		return nil, fmt.Errorf("error al buscar permisos del rol %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			log.Printf("Error en GetRolePermissions (Scan): %v", err)
+			continue
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, nil
+}
+
+// GetAllRoles devuelve los roles con sus permisos
+func GetAllRoles() ([]models.Role, error) {
+	rows, err := DB.Query(`
+		SELECT r.name, r.descripcion, r.sistema, COALESCE(GROUP_CONCAT(rp.permission), '')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role = r.name
+		GROUP BY r.name
+		ORDER BY r.sistema DESC, r.name ASC
+	`)
+	if err != nil {
+		log.Printf("Error en GetAllRoles (Query): %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		var role models.Role
+		var perms string
+		if err := rows.Scan(&role.Name, &role.Descripcion, &role.Sistema, &perms); err != nil {
+			log.Printf("Error en GetAllRoles (Scan): %v", err)
+			continue
+		}
+		role.Permissions = []string{}
+		if perms != "" {
+			role.Permissions = strings.Split(perms, ",")
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// GetAllPermissions devuelve el catálogo de permisos
+func GetAllPermissions() ([]models.Permission, error) {
+	rows, err := DB.Query("SELECT name, descripcion FROM permissions ORDER BY name ASC")
+	if err != nil {
+		log.Printf("Error en GetAllPermissions (Query): %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	perms := []models.Permission{}
+	for rows.Next() {
+		var p models.Permission
+		if err := rows.Scan(&p.Name, &p.Descripcion); err != nil {
+			log.Printf("Error en GetAllPermissions (Scan): %v", err)
+			continue
+		}
+		perms = append(perms, p)
+	}
+	return perms, nil
+}
+
+// CreateRole crea un rol (no de sistema) con sus permisos
+func CreateRole(name, descripcion string, permissions []string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error al iniciar transacción (CreateRole): %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO roles (name, descripcion, sistema) VALUES (?, ?, 0)", name, descripcion); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return apperrors.Conflict("El rol ya existe.", apperrors.Duplicate("name", "ya existe un rol con este nombre"))
+		}
+		return fmt.Errorf("error al crear rol %s: %w", name, err)
+	}
+	if err := insertRolePermissions(tx, name, permissions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetRolePermissions reemplaza el conjunto de permisos de un rol
+func SetRolePermissions(name string, permissions []string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error al iniciar transacción (SetRolePermissions): %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role = ?", name); err != nil {
+		return fmt.Errorf("error al limpiar permisos del rol %s: %w", name, err)
+	}
+	if err := insertRolePermissions(tx, name, permissions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertRolePermissions(tx *sql.Tx, role string, permissions []string) error {
+	for _, perm := range permissions {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO role_permissions (role, permission) VALUES (?, ?)", role, perm); err != nil {
+			return fmt.Errorf("error al asignar permiso %s al rol %s: %w", perm, role, err)
+		}
+	}
+	return nil
+}
+
+// GetRoleSistema indica si el rol es de sistema; error si no existe
+func GetRoleSistema(name string) (bool, error) {
+	var sistema bool
+	err := DB.QueryRow("SELECT sistema FROM roles WHERE name = ?", name).Scan(&sistema)
+	if err == sql.ErrNoRows {
+		return false, apperrors.NotFound("Rol no encontrado.")
+	}
+	if err != nil {
+		return false, fmt.Errorf("error al buscar rol %s: %w", name, err)
+	}
+	return sistema, nil
+}
+
+// CountUsersWithRole cuenta los usuarios que tienen asignado el rol
+func CountUsersWithRole(name string) (int, error) {
+	var count int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM users WHERE role = ?", name).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error al contar usuarios del rol %s: %w", name, err)
+	}
+	return count, nil
+}
+
+// CountMembersWithRole cuenta las membresías de proyecto que usan el rol
+func CountMembersWithRole(name string) (int, error) {
+	var count int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM project_members WHERE role = ?", name).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error al contar miembros con el rol %s: %w", name, err)
+	}
+	return count, nil
+}
+
+// DeleteRole borra un rol (no de sistema) y sus asignaciones de permisos
+func DeleteRole(name string) (int64, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error al iniciar transacción (DeleteRole): %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM roles WHERE name = ? AND sistema = 0", name)
+	if err != nil {
+		return 0, fmt.Errorf("error al borrar rol %s: %w", name, err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return 0, nil
+	}
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role = ?", name); err != nil {
+		return 0, fmt.Errorf("error al borrar permisos del rol %s: %w", name, err)
+	}
+	return affected, tx.Commit()
+}
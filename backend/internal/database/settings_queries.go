@@ -0,0 +1,30 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// QUERIES DE CONFIGURACIÓN (app_settings)
+
+// GetSetting devuelve el valor de una clave; ok es false si no está definida
+func GetSetting(clave string) (string, bool, error) {
+	var valor string
+	err := DB.QueryRow("SELECT valor FROM app_settings WHERE clave = ?", clave).Scan(&valor)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("error al leer configuración %q: %w", clave, err)
+	}
+	return valor, true, nil
+}
+
+// SetSetting crea o reemplaza el valor de una clave
+func SetSetting(clave, valor string) error {
+	_, err := DB.Exec("INSERT INTO app_settings (clave, valor) VALUES (?, ?) ON CONFLICT(clave) DO UPDATE SET valor = excluded.valor", clave, valor)
+	if err != nil {
+		return fmt.Errorf("error al guardar configuración %q: %w", clave, err)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"proyecto/internal/models"
+)
+
+// QUERIES DE REFRESH TOKENS (Sesiones)
+
+// CreateRefreshToken guarda el hash de un refresh token nuevo y devuelve el ID de la sesión
+func CreateRefreshToken(userID int, tokenHash string, expiresAt time.Time, ip, userAgent string) (int64, error) {
+	stmt, err := DB.Prepare("INSERT INTO refresh_tokens (user_id, token_hash, expires_at, ip, user_agent) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return 0, fmt.Errorf("error al preparar inserción (CreateRefreshToken): %w", err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(userID, tokenHash, expiresAt.UTC().Format(time.DateTime), ip, userAgent)
+	if err != nil {
+		return 0, fmt.Errorf("error al ejecutar inserción (CreateRefreshToken): %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetRefreshTokenByHash busca la sesión a la que pertenece un refresh token
+func GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error) {
+	row := DB.QueryRow("SELECT id, user_id, token_hash, expires_at, revocado FROM refresh_tokens WHERE token_hash = ?", tokenHash)
+	return scanRefreshToken(row)
+}
+
+// GetRefreshTokenByID busca una sesión por su ID (claim "sid" del access token)
+func GetRefreshTokenByID(id int) (*models.RefreshToken, error) {
+	row := DB.QueryRow("SELECT id, user_id, token_hash, expires_at, revocado FROM refresh_tokens WHERE id = ?", id)
+	return scanRefreshToken(row)
+}
+
+func scanRefreshToken(row *sql.Row) (*models.RefreshToken, error) {
+	var t models.RefreshToken
+	var expiresAt string
+	if err := row.Scan(&t.ID, &t.UserID, &t.TokenHash, &expiresAt, &t.Revocado); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("sesión no encontrada")
+		}
+		log.Printf("Error al escanear refresh token: %v", err)
+		return nil, err
+	}
+
+	parsed, err := parseDBTime(expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("fecha de expiración inválida en sesión %d: %w", t.ID, err)
+	}
+	t.ExpiresAt = parsed
+	return &t, nil
+}
+
+// RotateRefreshToken reemplaza el hash de una sesión activa (rotación en cada refresh)
+func RotateRefreshToken(id int, newHash string, expiresAt time.Time) (int64, error) {
+	res, err := DB.Exec("UPDATE refresh_tokens SET token_hash = ?, expires_at = ?, last_used_at = ? WHERE id = ? AND revocado = 0",
+		newHash, expiresAt.UTC().Format(time.DateTime), time.Now().UTC().Format(time.DateTime), id)
+	if err != nil {
+		return 0, fmt.Errorf("error al rotar refresh token: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// RevokeRefreshToken revoca una sesión concreta (logout)
+func RevokeRefreshToken(id int) (int64, error) {
+	res, err := DB.Exec("UPDATE refresh_tokens SET revocado = 1 WHERE id = ?", id)
+	if err != nil {
+		return 0, fmt.Errorf("error al revocar sesión %d: %w", id, err)
+	}
+	return res.RowsAffected()
+}
+
+// RevokeSessionOfUser revoca una sesión solo si pertenece al usuario indicado
+func RevokeSessionOfUser(userID, id int) (int64, error) {
+	res, err := DB.Exec("UPDATE refresh_tokens SET revocado = 1 WHERE id = ? AND user_id = ? AND revocado = 0", id, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error al revocar sesión %d: %w", id, err)
+	}
+	return res.RowsAffected()
+}
+
+// GetActiveSessions lista las sesiones vigentes (no revocadas ni expiradas) de un usuario
+func GetActiveSessions(userID int, now time.Time) ([]models.Session, error) {
+	rows, err := DB.Query(`
+		SELECT id, ip, user_agent, fecha_creacion, last_used_at, expires_at
+		FROM refresh_tokens
+		WHERE user_id = ? AND revocado = 0 AND expires_at > ?
+		ORDER BY id DESC
+	`, userID, now.UTC().Format(time.DateTime))
+	if err != nil {
+		return nil, fmt.Errorf("error al listar sesiones del usuario %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var s models.Session
+		var lastUsed sql.NullString
+		if err := rows.Scan(&s.ID, &s.IP, &s.UserAgent, &s.CreatedAt, &lastUsed, &s.ExpiresAt); err != nil {
+			log.Printf("Error en GetActiveSessions (Scan): %v", err)
+			continue
+		}
+		if lastUsed.Valid {
+			s.LastUsedAt = &lastUsed.String
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeUserRefreshTokens revoca todas las sesiones de un usuario
+func RevokeUserRefreshTokens(userID int) (int64, error) {
+	res, err := DB.Exec("UPDATE refresh_tokens SET revocado = 1 WHERE user_id = ? AND revocado = 0", userID)
+	if err != nil {
+		return 0, fmt.Errorf("error al revocar sesiones del usuario %d: %w", userID, err)
+	}
+	return res.RowsAffected()
+}
+
+// RevokeOtherRefreshTokens revoca todas las sesiones de un usuario salvo una (la actual)
+func RevokeOtherRefreshTokens(userID int, keepID int) (int64, error) {
+	res, err := DB.Exec("UPDATE refresh_tokens SET revocado = 1 WHERE user_id = ? AND id != ? AND revocado = 0", userID, keepID)
+	if err != nil {
+		return 0, fmt.Errorf("error al revocar otras sesiones del usuario %d: %w", userID, err)
+	}
+	return res.RowsAffected()
+}
+
+// QUERIES DE TOKENS DE RECUPERACIÓN DE CONTRASEÑA
+
+// CreatePasswordResetToken invalida los tokens pendientes del usuario y guarda uno nuevo
+func CreatePasswordResetToken(userID int, tokenHash string, expiresAt time.Time) (int64, error) {
+	if _, err := DB.Exec("UPDATE password_reset_tokens SET usado = 1 WHERE user_id = ? AND usado = 0", userID); err != nil {
+		return 0, fmt.Errorf("error al invalidar tokens previos (CreatePasswordResetToken): %w", err)
+	}
+
+	res, err := DB.Exec("INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+		userID, tokenHash, expiresAt.UTC().Format(time.DateTime))
+	if err != nil {
+		return 0, fmt.Errorf("error al ejecutar inserción (CreatePasswordResetToken): %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetPasswordResetTokenByHash busca un token de recuperación por su hash
+func GetPasswordResetTokenByHash(tokenHash string) (*models.PasswordResetToken, error) {
+	var t models.PasswordResetToken
+	var expiresAt string
+	err := DB.QueryRow("SELECT id, user_id, token_hash, expires_at, usado FROM password_reset_tokens WHERE token_hash = ?", tokenHash).
+		Scan(&t.ID, &t.UserID, &t.TokenHash, &expiresAt, &t.Usado)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("token de recuperación no encontrado")
+		}
+		log.Printf("Error al escanear token de recuperación: %v", err)
+		return nil, err
+	}
+
+	parsed, err := parseDBTime(expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("fecha de expiración inválida en token %d: %w", t.ID, err)
+	}
+	t.ExpiresAt = parsed
+	return &t, nil
+}
+
+// ConsumePasswordResetToken marca el token como usado; devuelve 0 si ya lo estaba
+func ConsumePasswordResetToken(id int) (int64, error) {
+	res, err := DB.Exec("UPDATE password_reset_tokens SET usado = 1 WHERE id = ? AND usado = 0", id)
+	if err != nil {
+		return 0, fmt.Errorf("error al consumir token de recuperación %d: %w", id, err)
+	}
+	return res.RowsAffected()
+}
+
+// parseDBTime interpreta las fechas guardadas por SQLite (texto) en UTC
+func parseDBTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.DateTime, time.RFC3339, "2006-01-02T15:04:05Z"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("formato de fecha no reconocido: %q", value)
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// QUERIES DEL SEGUNDO FACTOR (TOTP y códigos de recuperación)
+
+// GetUserTOTP devuelve el secreto TOTP (vacío si no tiene), si está activo y el último paso usado
+func GetUserTOTP(userID int) (string, bool, int64, error) {
+	var secret sql.NullString
+	var enabled bool
+	var lastStep int64
+	err := DB.QueryRow("SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = ?", userID).Scan(&secret, &enabled, &lastStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, 0, errors.New("Usuario no encontrado.")
+		}
+		return "", false, 0, fmt.Errorf("error al leer TOTP del usuario %d: %w", userID, err)
+	}
+	return secret.String, enabled, lastStep, nil
+}
+
+// SetPendingTOTPSecret guarda un secreto nuevo aún sin activar (enrolamiento en curso)
+func SetPendingTOTPSecret(userID int, secret string) error {
+	_, err := DB.Exec("UPDATE users SET totp_secret = ?, totp_enabled = 0, totp_last_step = 0 WHERE id = ?", secret, userID)
+	if err != nil {
+		return fmt.Errorf("error al guardar secreto TOTP del usuario %d: %w", userID, err)
+	}
+	return nil
+}
+
+// EnableTOTP activa el segundo factor y reemplaza los códigos de recuperación
+func EnableTOTP(userID int, lastStep int64, recoveryHashes []string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error al iniciar transacción (EnableTOTP): %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET totp_enabled = 1, totp_last_step = ? WHERE id = ?", lastStep, userID); err != nil {
+		return fmt.Errorf("error al activar TOTP del usuario %d: %w", userID, err)
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("error al borrar códigos de recuperación del usuario %d: %w", userID, err)
+	}
+	for _, hash := range recoveryHashes {
+		if _, err := tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return fmt.Errorf("error al guardar código de recuperación del usuario %d: %w", userID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// DisableTOTP quita el segundo factor y sus códigos de recuperación
+func DisableTOTP(userID int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error al iniciar transacción (DisableTOTP): %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET totp_secret = NULL, totp_enabled = 0, totp_last_step = 0 WHERE id = ?", userID); err != nil {
+		return fmt.Errorf("error al desactivar TOTP del usuario %d: %w", userID, err)
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("error al borrar códigos de recuperación del usuario %d: %w", userID, err)
+	}
+	return tx.Commit()
+}
+
+// AdvanceTOTPStep registra el último paso aceptado; devuelve 0 si otro login ya lo usó
+func AdvanceTOTPStep(userID int, step int64) (int64, error) {
+	res, err := DB.Exec("UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?", step, userID, step)
+	if err != nil {
+		return 0, fmt.Errorf("error al registrar paso TOTP del usuario %d: %w", userID, err)
+	}
+	return res.RowsAffected()
+}
+
+// ConsumeRecoveryCode marca como usado un código de recuperación; devuelve 0 si no existe o ya se usó
+func ConsumeRecoveryCode(userID int, codeHash string) (int64, error) {
+	res, err := DB.Exec("UPDATE recovery_codes SET usado = 1 WHERE user_id = ? AND code_hash = ? AND usado = 0", userID, codeHash)
+	if err != nil {
+		return 0, fmt.Errorf("error al consumir código de recuperación del usuario %d: %w", userID, err)
+	}
+	return res.RowsAffected()
+}
@@ -1,26 +1,48 @@
 package database
 
 import (
+	"database/sql"
+
 	"proyecto/internal/models"
 )
 
-// Recibe proyectoID
-func GetUnidadesByProyectoID(proyectoID int) ([]models.UnidadMedida, error) {
-	rows, err := DB.Query("SELECT id, proyecto_id, nombre, abreviatura, tipo, dimension, fecha_creacion FROM unidades_medida WHERE proyecto_id = ? ORDER BY fecha_creacion DESC", proyectoID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+var unidadesList = listSpec{
+	name:    "GetUnidades",
+	columns: "id, proyecto_id, nombre, abreviatura, tipo, dimension, fecha_creacion",
+	from:    "unidades_medida",
+	id:      "id",
+	sorts: map[string]string{
+		"id":             "id",
+		"nombre":         "nombre",
+		"abreviatura":    "abreviatura",
+		"tipo":           "tipo",
+		"fecha_creacion": "COALESCE(fecha_creacion, '')",
+	},
+	sort:   "-fecha_creacion",
+	search: []string{"nombre", "abreviatura"},
+	count:  true,
+}
 
-	var unidades []models.UnidadMedida
-	for rows.Next() {
+// GetUnidades: una página de las unidades de un proyecto
+func GetUnidades(req models.GetUnidadesRequest) ([]models.UnidadMedida, *models.Page, error) {
+	var filter listFilter
+	filter.add("proyecto_id = ?", req.ProyectoID)
+	filter.equal("tipo", req.Tipo)
+	filter.equal("dimension", req.Dimension)
+
+	unidades := []models.UnidadMedida{}
+	page, err := queryList(unidadesList, req.ListParams, filter, func(rows *sql.Rows, key *cursorKey) error {
 		var u models.UnidadMedida
-		if err := rows.Scan(&u.ID, &u.ProyectoID, &u.Nombre, &u.Abreviatura, &u.Tipo, &u.Dimension, &u.FechaCreacion); err != nil {
-			continue
+		if err := rows.Scan(append([]interface{}{&u.ID, &u.ProyectoID, &u.Nombre, &u.Abreviatura, &u.Tipo, &u.Dimension, &u.FechaCreacion}, key.dest()...)...); err != nil {
+			return err
 		}
 		unidades = append(unidades, u)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	return unidades, nil
+	return unidades, page, nil
 }
 
 func GetUnidadByID(id int) (*models.UnidadMedida, error) {
@@ -69,3 +91,8 @@ func DeleteUnidad(id int) (int64, error) {
 	}
 	return res.RowsAffected()
 }
+
+// GetUnidadProyectoID devuelve el proyecto al que pertenece el registro
+func GetUnidadProyectoID(id int) (int, error) {
+	return proyectoIDOf("unidades_medida", id)
+}
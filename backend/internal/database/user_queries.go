@@ -5,8 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"time"
 
+	"proyecto/internal/apperrors"
 	"proyecto/internal/models"
 
 	"golang.org/x/crypto/bcrypt"
@@ -14,32 +17,24 @@ import (
 
 //  QUERIES DE USUARIOS
 
-func RegisterUser(username, password, nombre, apellido, cedula string) (int64, error) {
+func RegisterUser(username, password, nombre, apellido, cedula, email string) (int64, error) {
 	// Hashear la contraseña
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return 0, fmt.Errorf("error al hashear password: %w", err)
 	}
 
-	// Añadido 'nombre', 'apellido' y 'cedula'
-	stmt, err := DB.Prepare("INSERT INTO users (username, password, role, nombre, apellido, cedula) VALUES (?, ?, ?, ?, ?, ?)")
+	// Añadido 'nombre', 'apellido', 'cedula' y 'email' (opcional)
+	stmt, err := DB.Prepare("INSERT INTO users (username, password, role, nombre, apellido, cedula, email) VALUES (?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return 0, fmt.Errorf("error al preparar inserción: %w", err)
 	}
 	defer stmt.Close()
 
 	// Por defecto, el rol es 'user'
-	res, err := stmt.Exec(username, string(hashedPassword), "user", nombre, apellido, cedula)
+	res, err := stmt.Exec(username, string(hashedPassword), "user", nombre, apellido, cedula, nullIfEmpty(email))
 	if err != nil {
-		// Manejo de error específico para 'UNIQUE constraint failed: users.username'
-		if strings.Contains(err.Error(), "UNIQUE constraint failed: users.username") {
-			return 0, errors.New("El nombre de usuario ya existe.")
-		}
-		// Manejo de error específico para 'UNIQUE constraint failed: users.cedula'
-		if strings.Contains(err.Error(), "UNIQUE constraint failed: users.cedula") {
-			return 0, errors.New("La cédula ya está registrada.")
-		}
-		return 0, fmt.Errorf("error al ejecutar inserción: %w", err)
+		return 0, userUniqueError(err)
 	}
 
 	id, err := res.LastInsertId()
@@ -50,8 +45,27 @@ func RegisterUser(username, password, nombre, apellido, cedula string) (int64, e
 	return id, nil
 }
 
+// Conflictos de las restricciones UNIQUE de users
+var (
+	errUsernameTaken = apperrors.Conflict("El nombre de usuario ya existe.", apperrors.Duplicate("username", "ya está en uso"))
+	errCedulaTaken   = apperrors.Conflict("La cédula ya está registrada.", apperrors.Duplicate("cedula", "ya está registrada"))
+)
+
+// userUniqueError traduce las restricciones UNIQUE de users (al insertar o actualizar) a mensajes para el cliente
+func userUniqueError(err error) error {
+	// Manejo de error específico para 'UNIQUE constraint failed: users.username'
+	if strings.Contains(err.Error(), "UNIQUE constraint failed: users.username") {
+		return errUsernameTaken
+	}
+	// Manejo de error específico para 'UNIQUE constraint failed: users.cedula'
+	if strings.Contains(err.Error(), "UNIQUE constraint failed: users.cedula") {
+		return errCedulaTaken
+	}
+	return fmt.Errorf("error al guardar usuario: %w", err)
+}
+
 func GetUserByUsername(username string) (*models.UserDB, error) {
-	row := DB.QueryRow("SELECT id, username, password, role, nombre, apellido, cedula, proyecto_id FROM users WHERE username = ?", username)
+	row := DB.QueryRow("SELECT id, username, password, role, nombre, apellido, cedula, proyecto_id, must_change_password, COALESCE(email, ''), totp_enabled, es_servicio, activo, idioma FROM users WHERE username = ?", username)
 	var user models.UserDB
 	err := row.Scan(
 		&user.ID,
@@ -62,6 +76,12 @@ func GetUserByUsername(username string) (*models.UserDB, error) {
 		&user.Apellido,
 		&user.Cedula,
 		&user.ProyectoID,
+		&user.MustChangePassword,
+		&user.Email,
+		&user.TOTPEnabled,
+		&user.EsServicio,
+		&user.Activo,
+		&user.Idioma,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -73,6 +93,62 @@ func GetUserByUsername(username string) (*models.UserDB, error) {
 	return &user, nil
 }
 
+func GetUserByID(id int) (*models.UserDB, error) {
+	row := DB.QueryRow("SELECT id, username, password, role, nombre, apellido, cedula, proyecto_id, must_change_password, COALESCE(email, ''), totp_enabled, es_servicio, activo, idioma FROM users WHERE id = ?", id)
+	var user models.UserDB
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.HashedPassword,
+		&user.Role,
+		&user.Nombre,
+		&user.Apellido,
+		&user.Cedula,
+		&user.ProyectoID,
+		&user.MustChangePassword,
+		&user.Email,
+		&user.TOTPEnabled,
+		&user.EsServicio,
+		&user.Activo,
+		&user.Idioma,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("Usuario no encontrado.")
+		}
+		log.Printf("Error al escanear usuario (GetUserByID): %v", err)
+		return nil, fmt.Errorf("Error al buscar usuario: %w", err)
+	}
+	return &user, nil
+}
+
+// UpdateUserPassword hashea y guarda una contraseña nueva.
+// mustChange marca la contraseña como temporal (se exigirá cambiarla tras el login).
+func UpdateUserPassword(id int, password string, mustChange bool) (int64, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, fmt.Errorf("error al hashear password: %w", err)
+	}
+
+	stmt, err := DB.Prepare("UPDATE users SET password = ?, must_change_password = ? WHERE id = ?")
+	if err != nil {
+		return 0, fmt.Errorf("error al preparar update (UpdateUserPassword): %w", err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(string(hashedPassword), mustChange, id)
+	if err != nil {
+		return 0, fmt.Errorf("error al ejecutar update (UpdateUserPassword): %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error al obtener filas afectadas (UpdateUserPassword): %w", err)
+	}
+
+	return affected, nil
+}
+
 func GetUserRole(username string) (string, error) {
 	var role string
 	err := DB.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
@@ -86,50 +162,87 @@ func GetUserRole(username string) (string, error) {
 	return role, nil
 }
 
-func GetAllUsersWithProjectNames() ([]models.UserListResponse, error) {
+var usersList = listSpec{
+	name: "GetUsers",
+	columns: `u.id, u.username, u.role, u.nombre, u.apellido, u.cedula, u.activo,
+		CASE WHEN u.locked_until > ? THEN u.locked_until END, u.last_login_at`,
+	from: "users u",
+	id:   "u.id",
+	sorts: map[string]string{
+		"id":         "u.id",
+		"username":   "u.username",
+		"nombre":     "u.nombre",
+		"apellido":   "u.apellido",
+		"role":       "u.role",
+		"cedula":     "u.cedula",
+		"last_login": "COALESCE(u.last_login_at, '')",
+	},
+	sort:   "id",
+	search: []string{"u.username", "u.nombre", "u.apellido", "u.cedula"},
+	count:  true,
+}
 
-	rows, err := DB.Query(`
-        SELECT u.id, u.username, u.role, u.nombre, u.apellido, u.cedula, u.proyecto_id, p.nombre 
-        FROM users u 
-        LEFT JOIN proyectos p ON u.proyecto_id = p.id
-        ORDER BY u.id ASC
-    `)
-	if err != nil {
-		log.Printf("Error en GetAllUsersWithProjectNames (Query): %v", err)
-		return nil, err
+// GetUsers: una página de usuarios con sus proyectos. Con memberID solo el propio
+// usuario y los de los proyectos donde su rol tiene permission (0 = todos).
+func GetUsers(req models.GetUsersRequest, memberID int, permission string) ([]models.UserListResponse, *models.Page, error) {
+	var filter listFilter
+	if memberID != 0 {
+		filter.add(`(u.id = ? OR u.id IN (
+			SELECT other.user_id FROM project_members mine
+			JOIN role_permissions rp ON rp.role = mine.role AND rp.permission = ?
+			JOIN project_members other ON other.proyecto_id = mine.proyecto_id
+			WHERE mine.user_id = ?))`, memberID, permission, memberID)
+	}
+	filter.equal("u.role", req.Role)
+	if req.Activo != "" {
+		activo, err := strconv.ParseBool(req.Activo)
+		if err != nil {
+			return nil, nil, apperrors.InvalidField("activo", "activo debe ser true o false")
+		}
+		filter.add("u.activo = ?", activo)
 	}
-	defer rows.Close()
 
-	var users []models.UserListResponse
-	for rows.Next() {
-		var user models.UserListResponse
-		var proyectoID sql.NullInt64      // Usamos sql.NullInt64 para proyecto_id
-		var proyectoNombre sql.NullString // Usamos sql.NullString para p.nombre
+	spec := usersList
+	spec.columnArgs = []interface{}{time.Now().UTC().Format(time.DateTime)}
 
-		// Se escanean los campos nuevos
-		if err := rows.Scan(&user.ID, &user.Username, &user.Role, &user.Nombre, &user.Apellido, &user.Cedula, &proyectoID, &proyectoNombre); err != nil {
-			log.Printf("Error en GetAllUsersWithProjectNames (Scan): %v", err)
-			continue
+	users := []models.UserListResponse{}
+	page, err := queryList(spec, req.ListParams, filter, func(rows *sql.Rows, key *cursorKey) error {
+		var user models.UserListResponse
+		var lockedUntil, lastLogin sql.NullString
+		dest := []interface{}{&user.ID, &user.Username, &user.Role, &user.Nombre, &user.Apellido, &user.Cedula, &user.Activo, &lockedUntil, &lastLogin}
+		if err := rows.Scan(append(dest, key.dest()...)...); err != nil {
+			return err
 		}
-
-		// Convertir de sql.NullString a *string
-		if proyectoNombre.Valid {
-			user.ProyectoNombre = &proyectoNombre.String
-		} else {
-			user.ProyectoNombre = nil
+		if lockedUntil.Valid {
+			user.LockedUntil = &lockedUntil.String
 		}
-
-		// Convertir de sql.NullInt64 a *int
-		if proyectoID.Valid {
-			idInt := int(proyectoID.Int64)
-			user.ProyectoID = &idInt
-		} else {
-			user.ProyectoID = nil
+		if lastLogin.Valid {
+			user.LastLogin = &lastLogin.String
 		}
-
 		users = append(users, user)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Proyectos de cada usuario (una sola consulta para toda la página)
+	memberships, err := getAllMemberships()
+	if err != nil {
+		log.Printf("Error en GetUsers (memberships): %v", err)
+		return nil, nil, err
+	}
+	for i := range users {
+		users[i].Proyectos = memberships[users[i].ID]
+		if users[i].Proyectos == nil {
+			users[i].Proyectos = []models.UserProjectRef{}
+			continue
+		}
+		first := users[i].Proyectos[0]
+		users[i].ProyectoID = &first.ProyectoID
+		users[i].ProyectoNombre = &first.Nombre
 	}
-	return users, nil
+	return users, page, nil
 }
 
 func AddUser(user models.User, defaultRole string) (int64, error) {
@@ -144,19 +257,19 @@ func AddUser(user models.User, defaultRole string) (int64, error) {
 		role = "user"
 	}
 
-	stmt, err := DB.Prepare("INSERT INTO users (username, password, role, nombre, apellido, cedula) VALUES (?, ?, ?, ?, ?, ?)")
+	stmt, err := DB.Prepare("INSERT INTO users (username, password, role, nombre, apellido, cedula, email) VALUES (?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return 0, fmt.Errorf("error al preparar inserción (AddUser): %w", err)
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(user.Username, string(hashedPassword), role, user.Nombre, user.Apellido, user.Cedula)
+	res, err := stmt.Exec(user.Username, string(hashedPassword), role, user.Nombre, user.Apellido, user.Cedula, nullIfEmpty(user.Email))
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint failed: users.username") {
-			return 0, errors.New("El nombre de usuario ya existe.")
+			return 0, errUsernameTaken
 		}
 		if strings.Contains(err.Error(), "UNIQUE constraint failed: users.cedula") {
-			return 0, errors.New("La cédula ya está registrada.")
+			return 0, errCedulaTaken
 		}
 		return 0, fmt.Errorf("error al ejecutar inserción (AddUser): %w", err)
 	}
@@ -168,160 +281,86 @@ func AddUser(user models.User, defaultRole string) (int64, error) {
 	return id, nil
 }
 
-func DeleteUser(id int) (int64, error) {
-	stmt, err := DB.Prepare("DELETE FROM users WHERE id = ?")
+// SetUserActivo desactiva o reactiva una cuenta. Los usuarios no se borran: sus
+// actividades y el log de auditoría siguen apuntando a ellos.
+func SetUserActivo(id int, activo bool) (int64, error) {
+	res, err := DB.Exec("UPDATE users SET activo = ? WHERE id = ?", activo, id)
 	if err != nil {
-		return 0, fmt.Errorf("error al preparar delete (DeleteUser): %w", err)
+		return 0, fmt.Errorf("error al ejecutar update (SetUserActivo): %w", err)
 	}
-	defer stmt.Close()
-
-	res, err := stmt.Exec(id)
-	if err != nil {
-		return 0, fmt.Errorf("error al ejecutar delete (DeleteUser): %w", err)
-	}
-
 	affected, err := res.RowsAffected()
 	if err != nil {
-		return 0, fmt.Errorf("error al obtener filas afectadas (DeleteUser): %w", err)
+		return 0, fmt.Errorf("error al obtener filas afectadas (SetUserActivo): %w", err)
 	}
-
 	return affected, nil
 }
 
-func UpdateUserRole(id int, newRole string) (int64, error) {
-	stmt, err := DB.Prepare("UPDATE users SET role = ? WHERE id = ?")
-	if err != nil {
-		return 0, fmt.Errorf("error al preparar update (UpdateUserRole): %w", err)
-	}
-	defer stmt.Close()
-
-	res, err := stmt.Exec(newRole, id)
+// SetUserIdioma guarda el idioma preferido del usuario ("" = el de Accept-Language)
+func SetUserIdioma(id int, idioma string) (int64, error) {
+	res, err := DB.Exec("UPDATE users SET idioma = ? WHERE id = ?", idioma, id)
 	if err != nil {
-		return 0, fmt.Errorf("error al ejecutar update (UpdateUserRole): %w", err)
+		return 0, fmt.Errorf("error al ejecutar update (SetUserIdioma): %w", err)
 	}
-
 	affected, err := res.RowsAffected()
 	if err != nil {
-		return 0, fmt.Errorf("error al obtener filas afectadas (UpdateUserRole): %w", err)
+		return 0, fmt.Errorf("error al obtener filas afectadas (SetUserIdioma): %w", err)
 	}
-
 	return affected, nil
 }
 
-func AssignProjectToUser(userID int, proyectoID int) (int64, error) {
-	var stmt *sql.Stmt
-	var err error
-
-	// Si proyectoID es 0, queremos desasignar (poner NULL)
-	if proyectoID == 0 {
-		stmt, err = DB.Prepare("UPDATE users SET proyecto_id = NULL WHERE id = ?")
-		if err != nil {
-			return 0, fmt.Errorf("error al preparar update (AssignProjectToUser NULL): %w", err)
-		}
-		defer stmt.Close()
-
-		res, err := stmt.Exec(userID)
-		if err != nil {
-			return 0, fmt.Errorf("error al ejecutar update (AssignProjectToUser NULL): %w", err)
-		}
-		return res.RowsAffected()
-
-	} else {
-		// Si proyectoID no es 0, asignamos el proyecto
-		stmt, err = DB.Prepare("UPDATE users SET proyecto_id = ? WHERE id = ?")
-		if err != nil {
-			return 0, fmt.Errorf("error al preparar update (AssignProjectToUser): %w", err)
-		}
-		defer stmt.Close()
-
-		res, err := stmt.Exec(proyectoID, userID)
-		if err != nil {
-			return 0, fmt.Errorf("error al ejecutar update (AssignProjectToUser): %w", err)
-		}
-		return res.RowsAffected()
+// CedulaTakenByOther indica si la cédula ya pertenece a otro usuario
+func CedulaTakenByOther(cedula string, userID int) (bool, error) {
+	var count int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM users WHERE cedula = ? AND id <> ?", cedula, userID).Scan(&count); err != nil {
+		return false, err
 	}
+	return count > 0, nil
 }
 
-func GetProjectDetailsForUser(userID int) (*models.UserProjectDetailsResponse, error) {
-	// 1. Obtener el ID del proyecto del usuario
-	var proyectoID sql.NullInt64
-	err := DB.QueryRow("SELECT proyecto_id FROM users WHERE id = ?", userID).Scan(&proyectoID)
+// UpdateUserProfile actualiza los datos personales del usuario
+func UpdateUserProfile(id int, nombre, apellido, cedula string) (int64, error) {
+	res, err := DB.Exec("UPDATE users SET nombre = ?, apellido = ?, cedula = ? WHERE id = ?", nombre, apellido, cedula, id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("Usuario no encontrado.")
-		}
-		log.Printf("Error obteniendo proyecto_id de usuario %d: %v", userID, err)
-		return nil, errors.New("Error al buscar el usuario.")
-	}
-
-	// Si no tiene proyecto asignado
-	if !proyectoID.Valid {
-		return &models.UserProjectDetailsResponse{
-			Proyecto: nil,
-			Gerentes: nil,
-			Miembros: nil,
-		}, nil
+		return 0, userUniqueError(err)
 	}
-
-	// 2. Obtener los detalles del proyecto
-	var proyecto models.Proyecto
-	projID := proyectoID.Int64
-
-	err = DB.QueryRow("SELECT id, nombre, fecha_inicio, fecha_cierre, estado, fecha_creacion FROM proyectos WHERE id = ?", projID).Scan(
-		&proyecto.ID, &proyecto.Nombre, &proyecto.FechaInicio, &proyecto.FechaCierre, &proyecto.Estado, &proyecto.FechaCreacion,
-	)
+	affected, err := res.RowsAffected()
 	if err != nil {
-		log.Printf("Error obteniendo detalles del proyecto %d: %v", projID, err)
-		return nil, errors.New("Error al obtener detalles del proyecto.")
+		return 0, fmt.Errorf("error al obtener filas afectadas (UpdateUserProfile): %w", err)
 	}
+	return affected, nil
+}
 
-	// 3. Obtener los "gerentes" de ese proyecto
+// UsernameExists indica si el nombre de usuario ya está tomado
+func UsernameExists(username string) (bool, error) {
+	var count int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", username).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
 
-	var gerentes []models.ProjectMember
-	rows, err := DB.Query("SELECT id, username, nombre, apellido FROM users WHERE proyecto_id = ? AND role = 'gerente'", projID)
+func UpdateUserRole(id int, newRole string) (int64, error) {
+	stmt, err := DB.Prepare("UPDATE users SET role = ? WHERE id = ?")
 	if err != nil {
-		log.Printf("Error obteniendo gerentes del proyecto %d: %v", projID, err)
-		return nil, errors.New("Error al obtener gerentes.")
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var u models.ProjectMember
-		if err := rows.Scan(&u.ID, &u.Username, &u.Nombre, &u.Apellido); err != nil {
-			log.Printf("Error escaneando gerente: %v", err)
-			continue
-		}
-		gerentes = append(gerentes, u)
+		return 0, fmt.Errorf("error al preparar update (UpdateUserRole): %w", err)
 	}
+	defer stmt.Close()
 
-	// 4. Obtener los "miembros" (users) de ese proyecto (excluyendo al usuario actual)
-	var miembros []models.ProjectMember
-	rowsMiembros, err := DB.Query("SELECT id, username, nombre, apellido FROM users WHERE proyecto_id = ? AND role = 'user' AND id != ?", projID, userID)
+	res, err := stmt.Exec(newRole, id)
 	if err != nil {
-		log.Printf("Error obteniendo miembros del proyecto %d: %v", projID, err)
-		return nil, errors.New("Error al obtener miembros del proyecto.")
-	}
-	defer rowsMiembros.Close()
-	for rowsMiembros.Next() {
-		var u models.ProjectMember
-		if err := rowsMiembros.Scan(&u.ID, &u.Username, &u.Nombre, &u.Apellido); err != nil {
-			log.Printf("Error escaneando miembro: %v", err)
-			continue
-		}
-		miembros = append(miembros, u)
+		return 0, fmt.Errorf("error al ejecutar update (UpdateUserRole): %w", err)
 	}
 
-	// 5. Construir la respuesta
-	response := &models.UserProjectDetailsResponse{
-		Proyecto: &proyecto,
-		Gerentes: gerentes,
-		Miembros: miembros,
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error al obtener filas afectadas (UpdateUserRole): %w", err)
 	}
 
-	return response, nil
+	return affected, nil
 }
 
 func GetEncargados() ([]models.EncargadoResponse, error) {
-	rows, err := DB.Query("SELECT id, nombre, apellido, cedula FROM users WHERE role = 'encargado'")
+	rows, err := DB.Query("SELECT id, nombre, apellido, cedula FROM users WHERE role = 'encargado' AND activo = 1")
 	if err != nil {
 		log.Printf("Error en GetEncargados (Query): %v", err)
 		return nil, err
@@ -339,3 +378,19 @@ func GetEncargados() ([]models.EncargadoResponse, error) {
 	}
 	return encargados, nil
 }
+
+// nullIfEmpty guarda NULL en vez de "" para columnas opcionales
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// nullIfZero guarda NULL en vez de 0 para referencias opcionales
+func nullIfZero(value int) interface{} {
+	if value == 0 {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"proyecto/internal/models"
+)
+
+// QUERIES DE VISIBILIDAD DE CAMPOS (tabla hidden_fields)
+
+// GetHiddenFields devuelve los campos ocultos agrupados por rol y entidad
+func GetHiddenFields() ([]models.FieldVisibility, error) {
+	rows, err := DB.Query("SELECT role, entidad, campo FROM hidden_fields ORDER BY role ASC, entidad ASC, campo ASC")
+	if err != nil {
+		return nil, fmt.Errorf("error al leer campos ocultos: %w", err)
+	}
+	defer rows.Close()
+
+	list := []models.FieldVisibility{}
+	for rows.Next() {
+		var role, entidad, campo string
+		if err := rows.Scan(&role, &entidad, &campo); err != nil {
+			log.Printf("Error en GetHiddenFields (Scan): %v", err)
+			continue
+		}
+		if n := len(list); n > 0 && list[n-1].Role == role && list[n-1].Entidad == entidad {
+			list[n-1].Campos = append(list[n-1].Campos, campo)
+			continue
+		}
+		list = append(list, models.FieldVisibility{Role: role, Entidad: entidad, Campos: []string{campo}})
+	}
+	return list, nil
+}
+
+// SetHiddenFields reemplaza los campos ocultos de una entidad para un rol
+func SetHiddenFields(role, entidad string, campos []string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error al iniciar transacción (SetHiddenFields): %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM hidden_fields WHERE role = ? AND entidad = ?", role, entidad); err != nil {
+		return fmt.Errorf("error al limpiar campos ocultos de %s en %s: %w", role, entidad, err)
+	}
+	for _, campo := range campos {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO hidden_fields (role, entidad, campo) VALUES (?, ?, ?)", role, entidad, campo); err != nil {
+			return fmt.Errorf("error al ocultar %s.%s a %s: %w", entidad, campo, role, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetProjectRolesOfUser devuelve el rol del usuario en cada proyecto del que es miembro
+func GetProjectRolesOfUser(userID int) (map[int]string, error) {
+	rows, err := DB.Query("SELECT proyecto_id, role FROM project_members WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer proyectos del usuario %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	roles := make(map[int]string)
+	for rows.Next() {
+		var proyectoID int
+		var role string
+		if err := rows.Scan(&proyectoID, &role); err != nil {
+			log.Printf("Error en GetProjectRolesOfUser (Scan): %v", err)
+			continue
+		}
+		roles[proyectoID] = role
+	}
+	return roles, nil
+}
@@ -0,0 +1,380 @@
+package docs
+
+import (
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//  ESPECIFICACIÓN OPENAPI 3
+// El documento se arma al iniciar a partir de las rutas registradas en el mux y de
+// la tabla de operaciones (operations.go). Los esquemas salen por reflexión de los
+// mismos structs que decodifican y devuelven los handlers, así no se desactualizan.
+
+// Param es un comodín del path y el campo JSON del handler que recibe su valor
+type Param struct {
+	Name  string
+	Field string
+	Text  bool
+}
+
+// Route es una ruta registrada. Las rutas antiguas indican su ruta REST en Successor.
+type Route struct {
+	Pattern   string // "GET /api/v1/labores/{id}" o, sin método, "/api/admin/get-labores"
+	Params    []Param
+	Successor string
+}
+
+// Envelope describe una respuesta del tipo {"clave": valor} (map[string]interface{} en el handler)
+type Envelope map[string]interface{}
+
+// Operation documenta una ruta REST (o una ruta propia sin alias)
+type Operation struct {
+	Tag      string
+	Summary  string
+	Request  interface{} // struct que decodifica el handler; nil si no lee cuerpo
+	Response interface{} // cuerpo de la respuesta exitosa
+	Status   int         // código de éxito; 0 = 200
+	Public   bool        // no exige autenticación
+	// ContentType de la respuesta cuando no es JSON (por ejemplo, text/html)
+	ContentType string
+}
+
+// Document es el documento OpenAPI que se sirve en /api/docs/openapi.json
+type Document struct {
+	OpenAPI    string                               `json:"openapi"`
+	Info       Info                                 `json:"info"`
+	Tags       []Tag                                `json:"tags"`
+	Paths      map[string]map[string]*PathOperation `json:"paths"`
+	Components Components                           `json:"components"`
+	Security   []map[string][]string                `json:"security"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type Tag struct {
+	Name string `json:"name"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+type PathOperation struct {
+	Tags        []string               `json:"tags"`
+	Summary     string                 `json:"summary"`
+	Description string                 `json:"description,omitempty"`
+	Deprecated  bool                   `json:"deprecated,omitempty"`
+	Parameters  []Parameter            `json:"parameters,omitempty"`
+	RequestBody *RequestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]*Response   `json:"responses"`
+	Security    *[]map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Build arma el documento. Las rutas sin operación en la tabla quedan fuera (y se
+// avisa en el log): la prueba de la especificación falla si falta alguna.
+func Build(routes []Route) *Document {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:   "API de Gestión de Proyectos Agrícolas",
+			Version: "1.0.0",
+			Description: "Las rutas /api/v1 son la API vigente. Las rutas antiguas (marcadas como obsoletas) " +
+				"aceptan cualquier método y reciben todos los parámetros en el cuerpo JSON.",
+		},
+		Paths: make(map[string]map[string]*PathOperation),
+		Components: Components{
+			Schemas: make(map[string]*Schema),
+			SecuritySchemes: map[string]*SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				"apiKey":     {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			},
+		},
+		Security: []map[string][]string{{"bearerAuth": {}}, {"apiKey": {}}},
+	}
+	b := &schemaBuilder{components: doc.Components.Schemas, types: make(map[string]reflect.Type)}
+
+	tags := map[string]bool{}
+	for _, route := range routes {
+		key := route.Pattern
+		if route.Successor != "" {
+			key = route.Successor
+		}
+		op, ok := operations[key]
+		if !ok {
+			log.Printf("⚠️ Ruta sin documentar en OpenAPI: %s", route.Pattern)
+			continue
+		}
+
+		method, path := splitPattern(route.Pattern)
+		var pathOp *PathOperation
+		if route.Successor != "" {
+			method = legacyMethod(route.Successor, op)
+			pathOp = b.operation(op, http.MethodPost, nil)
+			pathOp.Deprecated = true
+			_, successorPath := splitPattern(route.Successor)
+			pathOp.Description = "Alias obsoleto de " + successorPath + ": todos los parámetros van en el cuerpo JSON."
+			if method == "get" {
+				pathOp.Description = "Alias obsoleto de " + successorPath + "."
+			}
+		} else {
+			pathOp = b.operation(op, strings.ToUpper(method), route.Params)
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*PathOperation)
+		}
+		doc.Paths[path][method] = pathOp
+		tags[op.Tag] = true
+	}
+
+	for name := range tags {
+		doc.Tags = append(doc.Tags, Tag{Name: name})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+	return doc
+}
+
+// splitPattern separa "GET /ruta" en ("get", "/ruta"). Sin método se asume GET;
+// el comodín {$} (fin de ruta) no existe en OpenAPI y se quita.
+func splitPattern(pattern string) (method, path string) {
+	method, path = "get", pattern
+	if i := strings.Index(pattern, " "); i >= 0 {
+		method, path = strings.ToLower(pattern[:i]), pattern[i+1:]
+	}
+	return method, strings.TrimSuffix(path, "{$}")
+}
+
+// legacyMethod: el frontend llama a las rutas antiguas con GET si no llevan cuerpo
+// y con POST en los demás casos
+func legacyMethod(successor string, op Operation) string {
+	if method, _ := splitPattern(successor); method == "get" && op.Request == nil {
+		return "get"
+	}
+	return "post"
+}
+
+func (b *schemaBuilder) operation(op Operation, method string, params []Param) *PathOperation {
+	pathOp := &PathOperation{
+		Tags:      []string{op.Tag},
+		Summary:   op.Summary,
+		Responses: make(map[string]*Response),
+	}
+	if op.Public {
+		pathOp.Security = &[]map[string][]string{}
+	}
+
+	bound := map[string]bool{}
+	for _, p := range params {
+		bound[p.Field] = true
+		schema := &Schema{Type: "integer"}
+		if p.Text {
+			schema = &Schema{Type: "string"}
+		}
+		pathOp.Parameters = append(pathOp.Parameters, Parameter{
+			Name: p.Name, In: "path", Required: true, Schema: schema,
+			Description: "Se envía al handler como " + p.Field + " (tiene prioridad sobre el cuerpo)",
+		})
+	}
+
+	if op.Request != nil {
+		if method == http.MethodGet {
+			pathOp.Parameters = append(pathOp.Parameters, b.queryParameters(reflect.TypeOf(op.Request), bound)...)
+		} else {
+			pathOp.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{"application/json": {Schema: b.schemaOf(reflect.TypeOf(op.Request))}},
+			}
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := &Response{Description: http.StatusText(status)}
+	switch {
+	case op.ContentType != "":
+		success.Content = map[string]MediaType{op.ContentType: {Schema: &Schema{Type: "string"}}}
+	case op.Response != nil:
+		success.Content = map[string]MediaType{"application/json": {Schema: b.responseSchema(op.Response)}}
+	}
+	pathOp.Responses[strconv.Itoa(status)] = success
+
+	errorBody := map[string]MediaType{"application/json": {Schema: b.schemaOf(reflect.TypeOf(errorResponse))}}
+	if !op.Public {
+		pathOp.Responses["401"] = &Response{Description: "Token o API key ausente o inválido", Content: errorBody}
+		pathOp.Responses["403"] = &Response{Description: "Sin el permiso necesario", Content: errorBody}
+	}
+	pathOp.Responses["default"] = &Response{Description: "Error", Content: errorBody}
+	return pathOp
+}
+
+func (b *schemaBuilder) responseSchema(response interface{}) *Schema {
+	env, ok := response.(Envelope)
+	if !ok {
+		return b.schemaOf(reflect.TypeOf(response))
+	}
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for key, value := range env {
+		schema.Properties[key] = b.schemaOf(reflect.TypeOf(value))
+	}
+	return schema
+}
+
+// queryParameters: en los GET, los campos del struct se reciben en la query
+func (b *schemaBuilder) queryParameters(t reflect.Type, bound map[string]bool) []Parameter {
+	var params []Parameter
+	props := b.objectSchema(t).Properties
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !bound[name] {
+			params = append(params, Parameter{Name: name, In: "query", Schema: props[name]})
+		}
+	}
+	return params
+}
+
+// schemaBuilder genera esquemas por reflexión; los structs con nombre van a components
+type schemaBuilder struct {
+	components map[string]*Schema
+	types      map[string]reflect.Type
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (b *schemaBuilder) schemaOf(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		inner := b.schemaOf(t.Elem())
+		if inner.Ref == "" {
+			inner.Nullable = true
+		}
+		return inner
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+		if t.Name() == "" {
+			return b.objectSchema(t)
+		}
+		name := b.componentName(t)
+		if _, ok := b.components[name]; !ok {
+			b.components[name] = &Schema{} // evita recursión infinita en tipos que se refieren a sí mismos
+			*b.components[name] = *b.objectSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{} // interface{}: cualquier valor
+}
+
+// componentName usa el nombre del tipo; si otro paquete ya lo usó, le antepone el paquete
+func (b *schemaBuilder) componentName(t reflect.Type) string {
+	name := t.Name()
+	if other, ok := b.types[name]; ok && other != t {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+	b.types[name] = t
+	return name
+}
+
+// objectSchema describe los campos de un struct tal como los serializa encoding/json
+func (b *schemaBuilder) objectSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for k, v := range b.objectSchema(field.Type).Properties {
+				schema.Properties[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = b.schemaOf(field.Type)
+	}
+	return schema
+}
@@ -0,0 +1,158 @@
+package docs
+
+import (
+	"net/http"
+
+	"proyecto/internal/actividades"
+	"proyecto/internal/models"
+)
+
+// LoginRequest: LoginHandler decodifica un models.User, pero solo lee estos campos
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ExternalLoginQuery: parámetro de /api/v1/auth/oidc/login (por defecto "oidc")
+type ExternalLoginQuery struct {
+	Provider string `json:"provider"`
+}
+
+var (
+	mensaje = models.SimpleResponse{}
+	creado  = http.StatusCreated
+)
+
+// page: respuesta de un listado paginado (ver models.ListParams)
+func page(key string, items interface{}) Envelope {
+	return Envelope{key: items, "next_cursor": (*string)(nil), "total": 0}
+}
+
+// operations documenta cada ruta REST por su patrón. Las rutas antiguas se
+// documentan a partir de la ruta REST que las reemplaza.
+var operations = map[string]Operation{
+	// Generales
+	"/{$}":                       {Tag: "general", Summary: "Saludo del servidor", Public: true, ContentType: "text/plain"},
+	"GET /api/docs/openapi.json": {Tag: "general", Summary: "Esta especificación OpenAPI", Public: true, Response: Envelope{}},
+	"GET /api/docs":              {Tag: "general", Summary: "Documentación navegable de la API", Public: true, ContentType: "text/html"},
+
+	// Autenticación
+	"POST /api/v1/auth/register":        {Tag: "auth", Summary: "Registrar un usuario", Public: true, Request: models.User{}, Response: mensaje, Status: creado},
+	"POST /api/v1/auth/login":           {Tag: "auth", Summary: "Iniciar sesión", Public: true, Request: LoginRequest{}, Response: models.LoginResponse{}},
+	"POST /api/v1/auth/refresh":         {Tag: "auth", Summary: "Renovar el token de acceso", Public: true, Request: models.RefreshRequest{}, Response: models.LoginResponse{}},
+	"POST /api/v1/auth/logout":          {Tag: "auth", Summary: "Cerrar la sesión actual", Response: mensaje},
+	"PUT /api/v1/auth/password":         {Tag: "auth", Summary: "Cambiar la contraseña propia", Request: models.ChangePasswordRequest{}, Response: mensaje},
+	"GET /api/v1/auth/sessions":         {Tag: "auth", Summary: "Listar las sesiones abiertas propias", Response: Envelope{"sessions": []models.Session{}}},
+	"DELETE /api/v1/auth/sessions/{id}": {Tag: "auth", Summary: "Cerrar una sesión propia", Request: models.RevokeSessionRequest{}, Response: mensaje},
+	"POST /api/v1/auth/forgot-password": {Tag: "auth", Summary: "Solicitar un enlace de recuperación", Public: true, Request: models.ForgotPasswordRequest{}, Response: mensaje},
+	"POST /api/v1/auth/reset-password":  {Tag: "auth", Summary: "Restablecer la contraseña con el token recibido", Public: true, Request: models.ResetPasswordWithTokenRequest{}, Response: mensaje},
+	"POST /api/v1/auth/2fa/verify":      {Tag: "auth", Summary: "Completar el login con el código de verificación", Public: true, Request: models.TwoFactorVerifyRequest{}, Response: models.LoginResponse{}},
+	"GET /api/v1/auth/providers":        {Tag: "auth", Summary: "Proveedores de login externo configurados", Public: true, Response: Envelope{"providers": []string{}}},
+	"GET /api/v1/auth/oidc/login":       {Tag: "auth", Summary: "Iniciar login con un proveedor externo", Public: true, Request: ExternalLoginQuery{}, Response: models.ExternalLoginStart{}},
+	"POST /api/v1/auth/oidc/callback":   {Tag: "auth", Summary: "Completar login con un proveedor externo", Public: true, Request: models.ExternalLoginCallbackRequest{}, Response: models.LoginResponse{}},
+	"POST /api/v1/auth/2fa/setup":       {Tag: "auth", Summary: "Generar el secreto de verificación en dos pasos", Response: models.TwoFactorSetupResponse{}},
+	"POST /api/v1/auth/2fa/enable":      {Tag: "auth", Summary: "Activar la verificación en dos pasos", Request: models.TwoFactorCodeRequest{}, Response: models.TwoFactorEnableResponse{}},
+	"POST /api/v1/auth/2fa/disable":     {Tag: "auth", Summary: "Desactivar la verificación en dos pasos", Request: models.TwoFactorDisableRequest{}, Response: mensaje},
+
+	// Configuración
+	"GET /api/v1/settings/2fa-policy":          {Tag: "configuracion", Summary: "Roles que deben usar verificación en dos pasos", Response: models.TwoFactorPolicy{}},
+	"PUT /api/v1/settings/2fa-policy":          {Tag: "configuracion", Summary: "Cambiar la política de verificación en dos pasos", Request: models.TwoFactorPolicy{}, Response: mensaje},
+	"GET /api/v1/settings/registration-policy": {Tag: "configuracion", Summary: "Consultar si el registro está abierto", Response: models.RegistrationPolicy{}},
+	"PUT /api/v1/settings/registration-policy": {Tag: "configuracion", Summary: "Abrir o cerrar el registro", Request: models.RegistrationPolicy{}, Response: mensaje},
+
+	// Invitaciones
+	"GET /api/v1/invitations":         {Tag: "invitaciones", Summary: "Listar invitaciones", Response: Envelope{"invitations": []models.Invitation{}}},
+	"POST /api/v1/invitations":        {Tag: "invitaciones", Summary: "Crear una invitación", Request: models.CreateInvitationRequest{}, Response: models.CreateInvitationResponse{}, Status: creado},
+	"DELETE /api/v1/invitations/{id}": {Tag: "invitaciones", Summary: "Revocar una invitación", Request: models.RevokeInvitationRequest{}, Response: mensaje},
+
+	// Roles, permisos y visibilidad de campos
+	"GET /api/v1/roles":                    {Tag: "roles", Summary: "Listar roles", Response: Envelope{"roles": []models.Role{}}},
+	"GET /api/v1/permissions":              {Tag: "roles", Summary: "Listar permisos", Response: Envelope{"permissions": []models.Permission{}}},
+	"POST /api/v1/roles":                   {Tag: "roles", Summary: "Crear un rol", Request: models.CreateRoleRequest{}, Response: mensaje, Status: creado},
+	"PUT /api/v1/roles/{name}/permissions": {Tag: "roles", Summary: "Reemplazar los permisos de un rol", Request: models.UpdateRolePermissionsRequest{}, Response: mensaje},
+	"DELETE /api/v1/roles/{name}":          {Tag: "roles", Summary: "Eliminar un rol", Request: models.DeleteRoleRequest{}, Response: mensaje},
+	"GET /api/v1/field-visibility":         {Tag: "roles", Summary: "Campos ocultos por rol y entidad", Response: Envelope{"campos_ocultos": []models.FieldVisibility{}}},
+	"PUT /api/v1/field-visibility":         {Tag: "roles", Summary: "Reemplazar los campos ocultos de una entidad para un rol", Request: models.FieldVisibility{}, Response: mensaje},
+
+	// Cuentas de servicio
+	"GET /api/v1/service-accounts":                {Tag: "cuentas de servicio", Summary: "Listar cuentas de servicio", Response: Envelope{"service_accounts": []models.ServiceAccount{}}},
+	"POST /api/v1/service-accounts":               {Tag: "cuentas de servicio", Summary: "Crear una cuenta de servicio", Request: models.CreateServiceAccountRequest{}, Response: Envelope{"id": 0, "mensaje": ""}, Status: creado},
+	"POST /api/v1/service-accounts/{id}/api-keys": {Tag: "cuentas de servicio", Summary: "Emitir una API key", Request: models.CreateAPIKeyRequest{}, Response: models.CreateAPIKeyResponse{}, Status: creado},
+	"DELETE /api/v1/api-keys/{id}":                {Tag: "cuentas de servicio", Summary: "Revocar una API key", Request: models.RevokeAPIKeyRequest{}, Response: mensaje},
+
+	// Usuarios y miembros de proyectos
+	"GET /api/v1/users":                               {Tag: "usuarios", Summary: "Listar usuarios", Request: models.GetUsersRequest{}, Response: page("users", []models.UserListResponse{})},
+	"POST /api/v1/users":                              {Tag: "usuarios", Summary: "Crear un usuario", Request: models.AddUserRequest{}, Response: mensaje, Status: creado},
+	"POST /api/v1/users/{id}/deactivate":              {Tag: "usuarios", Summary: "Desactivar un usuario", Request: models.SetUserActivoRequest{}, Response: mensaje},
+	"POST /api/v1/users/{id}/reactivate":              {Tag: "usuarios", Summary: "Reactivar un usuario", Request: models.SetUserActivoRequest{}, Response: mensaje},
+	"PUT /api/v1/users/{id}":                          {Tag: "usuarios", Summary: "Editar el perfil de un usuario", Request: models.UpdateUserProfileRequest{}, Response: mensaje},
+	"PUT /api/v1/users/{id}/role":                     {Tag: "usuarios", Summary: "Cambiar el rol global de un usuario", Request: models.UpdateRoleRequest{}, Response: mensaje},
+	"POST /api/v1/users/{id}/reset-password":          {Tag: "usuarios", Summary: "Generar una contraseña temporal", Request: models.ResetPasswordRequest{}, Response: models.ResetPasswordResponse{}},
+	"POST /api/v1/users/{id}/unlock":                  {Tag: "usuarios", Summary: "Desbloquear una cuenta", Request: models.UnlockUserRequest{}, Response: mensaje},
+	"GET /api/v1/users/{id}/login-history":            {Tag: "usuarios", Summary: "Historial de inicios de sesión", Request: models.LoginHistoryRequest{}, Response: Envelope{"logins": []models.LoginRecord{}}},
+	"POST /api/v1/users/{id}/impersonate":             {Tag: "usuarios", Summary: "Obtener un token para actuar como el usuario", Request: models.ImpersonateRequest{}, Response: models.LoginResponse{}},
+	"PUT /api/v1/users/{id}/project":                  {Tag: "usuarios", Summary: "Asignar el proyecto de un usuario", Request: models.AssignProjectRequest{}, Response: mensaje},
+	"GET /api/v1/proyectos/{id}/members":              {Tag: "usuarios", Summary: "Miembros de un proyecto", Request: models.GetProjectMembersRequest{}, Response: Envelope{"miembros": []models.ProjectMember{}}},
+	"PUT /api/v1/proyectos/{id}/members/{user_id}":    {Tag: "usuarios", Summary: "Agregar un miembro (o cambiar su rol)", Request: models.AddProjectMemberRequest{}, Response: mensaje},
+	"DELETE /api/v1/proyectos/{id}/members/{user_id}": {Tag: "usuarios", Summary: "Quitar un miembro de un proyecto", Request: models.RemoveProjectMemberRequest{}, Response: mensaje},
+	"GET /api/v1/me/projects":                         {Tag: "usuarios", Summary: "Proyectos del usuario autenticado", Response: models.UserProjectDetailsResponse{}},
+	"GET /api/v1/me/preferences":                      {Tag: "usuarios", Summary: "Preferencias de la propia cuenta (idioma)", Response: models.UserPreferences{}},
+	"PUT /api/v1/me/preferences":                      {Tag: "usuarios", Summary: "Cambiar el idioma preferido de los mensajes", Request: models.UserPreferences{}, Response: models.UserPreferences{}},
+
+	// Proyectos
+	"GET /api/v1/proyectos":             {Tag: "proyectos", Summary: "Listar proyectos", Request: models.GetProyectosRequest{}, Response: page("proyectos", []models.Proyecto{})},
+	"POST /api/v1/proyectos":            {Tag: "proyectos", Summary: "Crear un proyecto", Request: models.CreateProyectoRequest{}, Response: models.Proyecto{}, Status: creado},
+	"PUT /api/v1/proyectos/{id}":        {Tag: "proyectos", Summary: "Editar un proyecto", Request: models.UpdateProyectoRequest{}, Response: models.Proyecto{}},
+	"DELETE /api/v1/proyectos/{id}":     {Tag: "proyectos", Summary: "Eliminar un proyecto", Request: models.DeleteProyectoRequest{}, Response: mensaje},
+	"PUT /api/v1/proyectos/{id}/estado": {Tag: "proyectos", Summary: "Habilitar o cerrar un proyecto", Request: models.SetProyectoEstadoRequest{}, Response: mensaje},
+
+	// Labores agronómicas
+	"GET /api/v1/proyectos/{id}/labores":  {Tag: "labores", Summary: "Labores de un proyecto", Request: models.GetLaboresRequest{}, Response: page("labores", []models.LaborAgronomica{})},
+	"POST /api/v1/proyectos/{id}/labores": {Tag: "labores", Summary: "Crear una labor", Request: models.CreateLaborRequest{}, Response: models.LaborAgronomica{}, Status: creado},
+	"PUT /api/v1/labores/{id}":            {Tag: "labores", Summary: "Editar una labor", Request: models.UpdateLaborRequest{}, Response: mensaje},
+	"DELETE /api/v1/labores/{id}":         {Tag: "labores", Summary: "Eliminar una labor", Request: models.DeleteLaborRequest{}, Response: mensaje},
+
+	// Equipos e implementos
+	"GET /api/v1/proyectos/{id}/equipos":  {Tag: "equipos", Summary: "Equipos de un proyecto", Request: models.GetEquiposRequest{}, Response: page("equipos", []models.EquipoImplemento{})},
+	"POST /api/v1/proyectos/{id}/equipos": {Tag: "equipos", Summary: "Crear un equipo", Request: models.CreateEquipoRequest{}, Response: models.EquipoImplemento{}, Status: creado},
+	"PUT /api/v1/equipos/{id}":            {Tag: "equipos", Summary: "Editar un equipo", Request: models.UpdateEquipoRequest{}, Response: mensaje},
+	"DELETE /api/v1/equipos/{id}":         {Tag: "equipos", Summary: "Eliminar un equipo", Request: models.DeleteEquipoRequest{}, Response: mensaje},
+
+	// Unidades de medida
+	"GET /api/v1/proyectos/{id}/unidades":  {Tag: "unidades", Summary: "Unidades de medida de un proyecto (con limit o cursor: {unidades, next_cursor, total})", Request: models.GetUnidadesRequest{}, Response: []models.UnidadMedida{}},
+	"POST /api/v1/proyectos/{id}/unidades": {Tag: "unidades", Summary: "Crear una unidad de medida", Request: models.CreateUnidadRequest{}, Response: models.UnidadMedida{}, Status: creado},
+	"PUT /api/v1/unidades/{id}":            {Tag: "unidades", Summary: "Editar una unidad de medida", Request: models.UpdateUnidadRequest{}, Response: mensaje},
+	"DELETE /api/v1/unidades/{id}":         {Tag: "unidades", Summary: "Eliminar una unidad de medida", Request: models.DeleteUnidadRequest{}, Response: mensaje},
+
+	// Actividades
+	"GET /api/v1/proyectos/{id}/actividades":  {Tag: "actividades", Summary: "Actividades de un proyecto, con sus labores, equipos y encargados", Request: models.GetDatosProyectoRequest{}, Response: actividades.GetDatosProyectoResponse{}},
+	"POST /api/v1/proyectos/{id}/actividades": {Tag: "actividades", Summary: "Crear una actividad (devuelve la lista actualizada)", Request: models.CreateActividadRequest{}, Response: Envelope{"actividades": []models.ActividadResponse{}}},
+	"PUT /api/v1/actividades/{id}":            {Tag: "actividades", Summary: "Editar una actividad (devuelve la lista actualizada)", Request: models.UpdateActividadRequest{}, Response: Envelope{"actividades": []models.ActividadResponse{}}},
+	"DELETE /api/v1/actividades/{id}":         {Tag: "actividades", Summary: "Eliminar una actividad", Request: models.DeleteActividadRequest{}, Response: mensaje},
+
+	// Planes de acción
+	"GET /api/v1/proyectos/{id}/planes":  {Tag: "planes", Summary: "Planes de acción de un proyecto", Request: models.GetPlanesRequest{}, Response: page("planes", []models.PlanAccion{})},
+	"POST /api/v1/proyectos/{id}/planes": {Tag: "planes", Summary: "Crear un plan de acción", Request: models.CreatePlanRequest{}, Response: mensaje, Status: creado},
+	"PUT /api/v1/planes/{id}":            {Tag: "planes", Summary: "Editar un plan de acción", Request: models.UpdatePlanRequest{}, Response: mensaje},
+	"DELETE /api/v1/planes/{id}":         {Tag: "planes", Summary: "Eliminar un plan de acción", Request: models.DeletePlanRequest{}, Response: mensaje},
+
+	// Recursos humanos
+	"GET /api/v1/proyectos/{id}/recursos":  {Tag: "recursos", Summary: "Recursos humanos de un proyecto", Request: models.GetRecursosRequest{}, Response: page("recursos", []models.RecursoHumano{})},
+	"POST /api/v1/proyectos/{id}/recursos": {Tag: "recursos", Summary: "Crear un recurso humano", Request: models.CreateRecursoRequest{}, Response: mensaje, Status: creado},
+	"PUT /api/v1/recursos/{id}":            {Tag: "recursos", Summary: "Editar un recurso humano", Request: models.UpdateRecursoRequest{}, Response: mensaje},
+	"DELETE /api/v1/recursos/{id}":         {Tag: "recursos", Summary: "Eliminar un recurso humano", Request: models.DeleteRecursoRequest{}, Response: mensaje},
+
+	// Materiales e insumos
+	"GET /api/v1/proyectos/{id}/materiales":  {Tag: "materiales", Summary: "Materiales e insumos de un proyecto", Request: models.GetMaterialesRequest{}, Response: page("materiales", []models.MaterialInsumo{})},
+	"POST /api/v1/proyectos/{id}/materiales": {Tag: "materiales", Summary: "Crear un material o insumo", Request: models.CreateMaterialRequest{}, Response: mensaje, Status: creado},
+	"PUT /api/v1/materiales/{id}":            {Tag: "materiales", Summary: "Editar un material o insumo", Request: models.UpdateMaterialRequest{}, Response: mensaje},
+	"DELETE /api/v1/materiales/{id}":         {Tag: "materiales", Summary: "Eliminar un material o insumo", Request: models.DeleteMaterialRequest{}, Response: mensaje},
+
+	// Auditoría
+	"GET /api/v1/logs":          {Tag: "auditoria", Summary: "Consultar el registro de eventos (con limit o cursor: {logs, next_cursor})", Request: models.GetLogsRequest{}, Response: []models.EventLogResponse{}},
+	"DELETE /api/v1/logs":       {Tag: "auditoria", Summary: "Eliminar eventos por id", Request: models.DeleteLogsRequest{}, Response: mensaje},
+	"DELETE /api/v1/logs/range": {Tag: "auditoria", Summary: "Eliminar los eventos de un rango de fechas", Request: models.DeleteLogsRangeRequest{}, Response: mensaje},
+}
+
+// errorResponse: cuerpo de todas las respuestas de error
+var errorResponse = models.ErrorResponse{}
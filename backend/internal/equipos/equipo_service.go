@@ -1,21 +1,23 @@
 package equipos
 
 import (
+	"database/sql"
 	"errors"
 	"log"
 	"strconv"
-	"strings"
 
+	"proyecto/internal/apperrors"
 	"proyecto/internal/database"
 	"proyecto/internal/models"
 )
 
 // 1. EL CONTRATO (Interface)
 type EquipoService interface {
-	GetEquiposByProyectoID(proyectoID int) ([]models.EquipoImplemento, error)
+	GetEquipos(req models.GetEquiposRequest) ([]models.EquipoImplemento, *models.Page, error)
 	CreateEquipo(req models.CreateEquipoRequest) (*models.EquipoImplemento, error)
 	UpdateEquipo(req models.UpdateEquipoRequest) (int64, error)
 	DeleteEquipo(id int) (int64, error)
+	GetEquipoProyectoID(id int) (int, error)
 }
 
 // 2. LA IMPLEMENTACIÓN (Struct)
@@ -30,22 +32,29 @@ func NewEquipoService() EquipoService {
 
 //  4. LOS MÉTODOS (Lógica de Negocion)
 
-func (s *equipoService) GetEquiposByProyectoID(proyectoID int) ([]models.EquipoImplemento, error) {
-	if proyectoID == 0 {
-		return nil, errors.New("id de proyecto requerido")
+func (s *equipoService) GetEquipos(req models.GetEquiposRequest) ([]models.EquipoImplemento, *models.Page, error) {
+	if req.ProyectoID == 0 {
+		return nil, nil, apperrors.Required("proyecto_id", "id de proyecto requerido")
 	}
-	equipos, err := database.GetEquiposByProyectoID(proyectoID)
+	equipos, page, err := database.GetEquipos(req)
 	if err != nil {
-		log.Printf("Error en equipoService.GetEquiposByProyectoID: %v", err)
-		return nil, errors.New("error al obtener equipos")
+		if _, ok := apperrors.As(err); ok {
+			return nil, nil, err
+		}
+		log.Printf("Error en equipoService.GetEquipos: %v", err)
+		return nil, nil, errors.New("error al obtener equipos")
 	}
-	return equipos, nil
+	return equipos, page, nil
 }
 
 func (s *equipoService) CreateEquipo(req models.CreateEquipoRequest) (*models.EquipoImplemento, error) {
 	// 1. Validación
-	if req.ProyectoID == 0 || req.Nombre == "" || req.Tipo == "" {
-		return nil, errors.New("ProyectoID, Nombre y Tipo son requeridos")
+	var check apperrors.Check
+	check.Required("proyecto_id", req.ProyectoID != 0)
+	check.Required("nombre", req.Nombre != "")
+	check.Required("tipo", req.Tipo != "")
+	if err := check.Err("ProyectoID, Nombre y Tipo son requeridos"); err != nil {
+		return nil, err
 	}
 
 	// 2. LÓGICA NUEVA: Obtener el siguiente código
@@ -72,7 +81,7 @@ func (s *equipoService) CreateEquipo(req models.CreateEquipoRequest) (*models.Eq
 	equipoID, err := database.CreateEquipo(equipo)
 	if err != nil {
 		log.Printf("Error en equipoService.CreateEquipo (CreateEquipo): %v", err)
-		if strings.Contains(err.Error(), "ya existe") {
+		if apperrors.Is(err, apperrors.CodeConflict) {
 			return nil, err
 		}
 		return nil, errors.New("error al crear equipo")
@@ -89,27 +98,33 @@ func (s *equipoService) CreateEquipo(req models.CreateEquipoRequest) (*models.Eq
 }
 
 func (s *equipoService) UpdateEquipo(req models.UpdateEquipoRequest) (int64, error) {
-	if req.ID == 0 || req.CodigoEquipo == "" || req.Nombre == "" || req.Tipo == "" || req.Estado == "" {
-		return 0, errors.New("ID, Código, Nombre, Tipo y Estado son requeridos")
+	var check apperrors.Check
+	check.Required("id", req.ID != 0)
+	check.Required("codigo_equipo", req.CodigoEquipo != "")
+	check.Required("nombre", req.Nombre != "")
+	check.Required("tipo", req.Tipo != "")
+	check.Required("estado", req.Estado != "")
+	if err := check.Err("ID, Código, Nombre, Tipo y Estado son requeridos"); err != nil {
+		return 0, err
 	}
 
 	affected, err := database.UpdateEquipo(req.ID, req.CodigoEquipo, req.Nombre, req.Tipo, req.Estado)
 	if err != nil {
 		log.Printf("Error en equipoService.UpdateEquipo (ID %d): %v", req.ID, err)
-		if strings.Contains(err.Error(), "ya existe") {
+		if apperrors.Is(err, apperrors.CodeConflict) {
 			return 0, err
 		}
 		return 0, errors.New("error al actualizar el equipo")
 	}
 	if affected == 0 {
-		return 0, errors.New("equipo no encontrado")
+		return 0, apperrors.NotFound("equipo no encontrado")
 	}
 	return affected, nil
 }
 
 func (s *equipoService) DeleteEquipo(id int) (int64, error) {
 	if id == 0 {
-		return 0, errors.New("id de equipo requerido")
+		return 0, apperrors.Required("id", "id de equipo requerido")
 	}
 	affected, err := database.DeleteEquipo(id)
 	if err != nil {
@@ -118,3 +133,15 @@ func (s *equipoService) DeleteEquipo(id int) (int64, error) {
 	}
 	return affected, nil
 }
+
+// GetEquipoProyectoID: proyecto dueño del registro (para verificar permisos por proyecto)
+func (s *equipoService) GetEquipoProyectoID(id int) (int, error) {
+	proyectoID, err := database.GetEquipoProyectoID(id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error en equipoService.GetEquipoProyectoID (ID: %d): %v", id, err)
+		}
+		return 0, apperrors.NotFound("equipo no encontrado")
+	}
+	return proyectoID, nil
+}
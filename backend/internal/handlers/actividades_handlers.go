@@ -29,13 +29,14 @@ func NewActividadHandler(as auth.AuthService, acs actividades.ActividadService,
 //  3. LOS MÉTODOS (Handlers)
 
 func (h *ActividadHandler) GetDatosProyectoHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.GetDatosProyectoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermActividadesRead)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
@@ -45,9 +46,9 @@ func (h *ActividadHandler) GetDatosProyectoHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	datos, err := h.actividadSvc.GetDatosProyecto(req.ProyectoID)
+	datos, err := h.actividadSvc.GetDatosProyecto(req)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -55,13 +56,14 @@ func (h *ActividadHandler) GetDatosProyectoHandler(w http.ResponseWriter, r *htt
 }
 
 func (h *ActividadHandler) CreateActividadHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.CreateActividadRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermActividadesWrite)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
@@ -73,23 +75,25 @@ func (h *ActividadHandler) CreateActividadHandler(w http.ResponseWriter, r *http
 
 	actividades, err := h.actividadSvc.CreateActividad(req)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithServiceError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin/gerente", "CREACIÓN (Actividad)", "Proyectos", req.ProyectoID)
+	logAction(h.loggerSvc, caller, "CREACIÓN (Actividad)", "Proyectos", req.ProyectoID)
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{"actividades": actividades})
 }
 
 func (h *ActividadHandler) UpdateActividadHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.UpdateActividadRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	// El UPDATE filtra por id y proyecto_id: basta con autorizar el proyecto del request
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermActividadesWrite)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
@@ -101,23 +105,29 @@ func (h *ActividadHandler) UpdateActividadHandler(w http.ResponseWriter, r *http
 
 	actividades, err := h.actividadSvc.UpdateActividad(req)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithServiceError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin/gerente", "MODIFICACIÓN", "Actividades", req.ID)
+	logAction(h.loggerSvc, caller, "MODIFICACIÓN", "Actividades", req.ID)
 
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{"actividades": actividades})
 }
 
 func (h *ActividadHandler) DeleteActividadHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.DeleteActividadRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	proyectoID, err := h.actividadSvc.GetActividadProyectoID(req.ID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "actividad no encontrada")
+		return
+	}
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, proyectoID, models.PermActividadesWrite)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
@@ -129,7 +139,7 @@ func (h *ActividadHandler) DeleteActividadHandler(w http.ResponseWriter, r *http
 
 	affected, err := h.actividadSvc.DeleteActividad(req.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 	if affected == 0 {
@@ -137,7 +147,7 @@ func (h *ActividadHandler) DeleteActividadHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin/gerente", "ELIMINACIÓN", "Actividades", req.ID)
+	logAction(h.loggerSvc, caller, "ELIMINACIÓN", "Actividades", req.ID)
 
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Actividad borrada."})
 }
@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"proyecto/internal/auth"
 	"proyecto/internal/logger"
@@ -39,13 +43,17 @@ func (h *AuthHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	lastID, err := h.authSvc.Register(user)
+	lastID, role, err := h.authSvc.Register(user)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithServiceError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	h.loggerSvc.Log(user.Username, "user", "REGISTRO", "Usuarios", int(lastID))
+	accion := "REGISTRO"
+	if strings.TrimSpace(user.InvitationCode) != "" {
+		accion = "REGISTRO (Invitación)"
+	}
+	h.loggerSvc.Log(user.Username, role, accion, "Usuarios", int(lastID))
 
 	respondWithJSON(w, http.StatusCreated, models.SimpleResponse{Mensaje: fmt.Sprintf("Usuario '%s' (ID: %d) registrado con éxito.", user.Username, lastID)})
 }
@@ -58,14 +66,401 @@ func (h *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	loginResponse, err := h.authSvc.Login(creds.Username, creds.Password)
+	loginResponse, err := h.authSvc.Login(creds.Username, creds.Password, clientInfo(r))
+	if err != nil {
+		h.respondLoginError(w, creds.Username, err)
+		return
+	}
+
+	// Con 2FA el login termina en /api/auth/2fa/verify
+	if !loginResponse.TwoFactorRequired {
+		h.loggerSvc.Log(loginResponse.User.Username, loginResponse.Role, "INICIO DE SESIÓN", "Auth", loginResponse.UserId)
+	}
+
+	respondWithJSON(w, http.StatusOK, loginResponse)
+}
+
+// respondLoginError traduce los errores del login (y del segundo factor) a HTTP
+// y registra los intentos fallidos y bloqueos en el log de eventos
+func (h *AuthHandler) respondLoginError(w http.ResponseWriter, username string, err error) {
+	var blocked *auth.LoginBlockedError
+	var secondFactor *auth.SecondFactorError
+	switch {
+	case errors.As(err, &blocked):
+		if blocked.JustLocked {
+			h.loggerSvc.Log(blocked.Username, "anónimo", "LOGIN FALLIDO", "Auth", 0)
+			h.loggerSvc.Log(blocked.Username, "anónimo", "CUENTA BLOQUEADA", "Auth", 0)
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+		respondWithServiceError(w, http.StatusTooManyRequests, err)
+	case errors.As(err, &secondFactor):
+		h.loggerSvc.Log(secondFactor.Username, "anónimo", "LOGIN FALLIDO", "Auth", 0)
+		respondWithServiceError(w, http.StatusUnauthorized, err)
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		h.loggerSvc.Log(username, "anónimo", "LOGIN FALLIDO", "Auth", 0)
+		respondWithServiceError(w, http.StatusUnauthorized, err)
+	case errors.Is(err, auth.ErrAccountDisabled):
+		h.loggerSvc.Log(username, "anónimo", "LOGIN RECHAZADO (Cuenta desactivada)", "Auth", 0)
+		respondWithServiceError(w, http.StatusForbidden, err)
+	default:
+		respondWithServiceError(w, http.StatusUnauthorized, err)
+	}
+}
+
+// RefreshHandler: canjea un refresh token por un nuevo par de tokens
+func (h *AuthHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	loginResponse, err := h.authSvc.Refresh(req.RefreshToken)
+	if err != nil {
+		respondWithServiceError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, loginResponse)
+}
+
+// LogoutHandler: revoca la sesión del token actual
+func (h *AuthHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+
+	if err := h.authSvc.Logout(caller.SessionID); err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "CIERRE DE SESIÓN", "Auth", caller.UserID)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Sesión cerrada."})
+}
+
+// GetSessionsHandler: sesiones abiertas del usuario (IP, navegador, fechas)
+func (h *AuthHandler) GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+
+	sessions, err := h.authSvc.GetSessions(caller.UserID, caller.SessionID)
+	if err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"sessions": sessions})
+}
+
+// RevokeSessionHandler: cierra una de las sesiones propias (puede ser la actual)
+func (h *AuthHandler) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.RevokeSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	if err := h.authSvc.RevokeSession(caller.UserID, req.ID); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "CIERRE DE SESIÓN (Remoto)", "Auth", req.ID)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Sesión cerrada."})
+}
+
+// GetLoginHistoryHandler: últimos inicios de sesión de un usuario (cuándo y desde dónde)
+func (h *AuthHandler) GetLoginHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.LoginHistoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermUsersLoginHistory)
+	if err != nil || !hasPermission {
+		respondWithError(w, http.StatusForbidden, "No autorizado")
+		return
+	}
+
+	history, err := h.authSvc.GetLoginHistory(req.UserID)
 	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"logins": history})
+}
 
-		respondWithError(w, http.StatusUnauthorized, err.Error())
+// ChangePasswordHandler: el usuario cambia su propia contraseña
+func (h *AuthHandler) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	if err := h.authSvc.ChangePassword(caller.UserID, caller.SessionID, req.CurrentPassword, req.NewPassword); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "CAMBIO CONTRASEÑA", "Usuarios", caller.UserID)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Contraseña actualizada."})
+}
+
+// ForgotPasswordHandler: envía un enlace de recuperación al email del usuario.
+// Siempre responde igual, exista o no el usuario.
+func (h *AuthHandler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	userID, err := h.authSvc.RequestPasswordReset(req.Username)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	h.loggerSvc.Log(loginResponse.User.Username, loginResponse.Role, "INICIO DE SESIÓN", "Auth", loginResponse.UserId)
+	if userID != 0 {
+		h.loggerSvc.Log(req.Username, "anónimo", "SOLICITUD RECUPERACIÓN CONTRASEÑA", "Usuarios", userID)
+	}
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Si el usuario existe y tiene un email registrado, recibirá un enlace para restablecer su contraseña."})
+}
+
+// ResetPasswordHandler: canjea el token de recuperación por una contraseña nueva
+func (h *AuthHandler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordWithTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	user, err := h.authSvc.ResetPasswordWithToken(req.Token, req.NewPassword)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	h.loggerSvc.Log(user.Username, user.Role, "RECUPERACIÓN CONTRASEÑA", "Usuarios", user.UserID)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Contraseña restablecida. Ya puede iniciar sesión."})
+}
+
+// TwoFactorVerifyHandler: segundo paso del login con 2FA
+func (h *AuthHandler) TwoFactorVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	loginResponse, err := h.authSvc.VerifyTwoFactor(req.ChallengeToken, req.Code, req.RecoveryCode, clientInfo(r))
+	if err != nil {
+		h.respondLoginError(w, "", err)
+		return
+	}
+
+	accion := "INICIO DE SESIÓN"
+	if req.Code == "" {
+		accion = "INICIO DE SESIÓN (CÓDIGO DE RECUPERACIÓN)"
+	}
+	h.loggerSvc.Log(loginResponse.User.Username, loginResponse.Role, accion, "Auth", loginResponse.UserId)
 
 	respondWithJSON(w, http.StatusOK, loginResponse)
 }
+
+// ProvidersHandler: proveedores de autenticación habilitados (para mostrar los botones de login)
+func (h *AuthHandler) ProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"providers": h.authSvc.GetProviders()})
+}
+
+// ExternalLoginHandler: devuelve la URL del proveedor externo (?provider=oidc por defecto)
+func (h *AuthHandler) ExternalLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider := r.URL.Query().Get("provider")
+	if provider == "" {
+		provider = "oidc"
+	}
+
+	start, err := h.authSvc.StartExternalLogin(r.Context(), provider)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, start)
+}
+
+// ExternalCallbackHandler: canjea el code del proveedor externo y abre la sesión
+func (h *AuthHandler) ExternalCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.ExternalLoginCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	loginResponse, err := h.authSvc.CompleteExternalLogin(r.Context(), req.State, req.Code, clientInfo(r))
+	if err != nil {
+		respondWithServiceError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	h.loggerSvc.Log(loginResponse.User.Username, loginResponse.Role, "INICIO DE SESIÓN (Externo)", "Auth", loginResponse.UserId)
+
+	respondWithJSON(w, http.StatusOK, loginResponse)
+}
+
+// TwoFactorSetupHandler: genera el secreto y la URI para la app autenticadora
+func (h *AuthHandler) TwoFactorSetupHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+
+	setup, err := h.authSvc.SetupTwoFactor(caller.UserID)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, setup)
+}
+
+// TwoFactorEnableHandler: confirma el enrolamiento y entrega los códigos de recuperación
+func (h *AuthHandler) TwoFactorEnableHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	codes, err := h.authSvc.EnableTwoFactor(caller.UserID, req.Code)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "ACTIVACIÓN 2FA", "Usuarios", caller.UserID)
+
+	respondWithJSON(w, http.StatusOK, models.TwoFactorEnableResponse{
+		Mensaje:       "Verificación en dos pasos activada. Guarde los códigos de recuperación.",
+		RecoveryCodes: codes,
+	})
+}
+
+// TwoFactorDisableHandler: desactiva el 2FA propio (si el rol no lo exige)
+func (h *AuthHandler) TwoFactorDisableHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.TwoFactorDisableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	if err := h.authSvc.DisableTwoFactor(caller.UserID, req.Password, req.Code); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "DESACTIVACIÓN 2FA", "Usuarios", caller.UserID)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Verificación en dos pasos desactivada."})
+}
+
+// GetTwoFactorPolicyHandler: roles que deben usar 2FA (solo admin)
+func (h *AuthHandler) GetTwoFactorPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermSecurityManage)
+	if err != nil || !hasPermission {
+		respondWithError(w, http.StatusForbidden, "No autorizado (Solo Admin)")
+		return
+	}
+
+	roles, err := h.authSvc.GetTwoFactorRoles()
+	if err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, models.TwoFactorPolicy{RequiredRoles: roles})
+}
+
+// SetTwoFactorPolicyHandler: define los roles que deben usar 2FA (solo admin)
+func (h *AuthHandler) SetTwoFactorPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.TwoFactorPolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermSecurityManage)
+	if err != nil || !hasPermission {
+		respondWithError(w, http.StatusForbidden, "No autorizado (Solo Admin)")
+		return
+	}
+
+	if err := h.authSvc.SetTwoFactorRoles(req.RequiredRoles); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logMsg := fmt.Sprintf("POLÍTICA 2FA (%s)", strings.Join(req.RequiredRoles, ", "))
+	logAction(h.loggerSvc, caller, logMsg, "Auth", 0)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Política de verificación en dos pasos actualizada."})
+}
+
+// GetRegistrationPolicyHandler: indica si el registro sin invitación está abierto (solo admin)
+func (h *AuthHandler) GetRegistrationPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermSecurityManage)
+	if err != nil || !hasPermission {
+		respondWithError(w, http.StatusForbidden, "No autorizado (Solo Admin)")
+		return
+	}
+
+	open, err := h.authSvc.IsRegistrationOpen()
+	if err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, models.RegistrationPolicy{Open: open})
+}
+
+// SetRegistrationPolicyHandler: abre o cierra el registro sin invitación (solo admin)
+func (h *AuthHandler) SetRegistrationPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.RegistrationPolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermSecurityManage)
+	if err != nil || !hasPermission {
+		respondWithError(w, http.StatusForbidden, "No autorizado (Solo Admin)")
+		return
+	}
+
+	if err := h.authSvc.SetRegistrationOpen(req.Open); err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logMsg := "REGISTRO ABIERTO"
+	if !req.Open {
+		logMsg = "REGISTRO SOLO POR INVITACIÓN"
+	}
+	logAction(h.loggerSvc, caller, logMsg, "Auth", 0)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Política de registro actualizada."})
+}
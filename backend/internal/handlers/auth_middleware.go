@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"proyecto/internal/auth"
+	"proyecto/internal/i18n"
+	"proyecto/internal/logger"
+	"proyecto/internal/visibility"
+)
+
+// 1. EL STRUCT DEL MIDDLEWARE
+type AuthMiddleware struct {
+	authSvc       auth.AuthService
+	visibilitySvc visibility.VisibilityService
+}
+
+// 2. EL CONSTRUCTOR
+func NewAuthMiddleware(as auth.AuthService, vs visibility.VisibilityService) *AuthMiddleware {
+	return &AuthMiddleware{authSvc: as, visibilitySvc: vs}
+}
+
+// 3. LOS MÉTODOS
+
+// Require exige un token "Authorization: Bearer <jwt>" válido (o una API key de
+// cuenta de servicio, en "X-API-Key" o como Bearer) y deja la identidad del
+// usuario en el contexto de la petición. Las respuestas JSON pasan por el filtro
+// de visibilidad de campos del rol del usuario.
+// Si el usuario tiene pasos pendientes (contraseña temporal o 2FA obligatorio
+// sin activar), responde 403.
+func (m *AuthMiddleware) Require(next http.HandlerFunc) http.Handler {
+	return m.authenticate(next, false)
+}
+
+// RequireAllowingPendingSetup es como Require pero deja pasar a los usuarios con
+// pasos pendientes (rutas de cambio de contraseña, enrolamiento 2FA y logout).
+func (m *AuthMiddleware) RequireAllowingPendingSetup(next http.HandlerFunc) http.Handler {
+	return m.authenticate(next, true)
+}
+
+func (m *AuthMiddleware) authenticate(next http.HandlerFunc, allowPendingSetup bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString, ok := bearerToken(r)
+		if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+			tokenString, ok = key, true
+		}
+		if !ok {
+			respondWithError(w, http.StatusUnauthorized, "token de autenticación requerido")
+			return
+		}
+
+		if auth.IsAPIKey(tokenString) {
+			// Las rutas de sesión (logout, contraseña, 2FA) son solo para personas
+			if allowPendingSetup {
+				respondWithError(w, http.StatusForbidden, "esta ruta no acepta API keys")
+				return
+			}
+			identity, err := m.authSvc.ValidateAPIKey(tokenString)
+			if err != nil {
+				respondWithError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			next(m.withFieldFilter(w, identity), r.WithContext(auth.WithIdentity(r.Context(), identity)))
+			return
+		}
+
+		identity, err := m.authSvc.ValidateToken(tokenString)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if identity.Impersonated() {
+			// Las rutas de sesión tocarían la cuenta real (del admin o del suplantado)
+			if allowPendingSetup {
+				respondWithError(w, http.StatusForbidden, "esta ruta no está disponible durante una suplantación")
+				return
+			}
+			// Aviso para el frontend: todas las respuestas llevan al admin que suplanta
+			w.Header().Set(impersonationHeader, identity.ImpersonatorUsername)
+		}
+
+		// El idioma guardado en la cuenta tiene prioridad sobre Accept-Language
+		if lang, ok := i18n.Parse(identity.Idioma); ok {
+			setLanguage(w, lang)
+		}
+
+		if !allowPendingSetup {
+			if identity.MustChangePassword {
+				respondWithError(w, http.StatusForbidden, "debe cambiar su contraseña temporal antes de continuar")
+				return
+			}
+			if identity.MustSetupTwoFactor {
+				respondWithError(w, http.StatusForbidden, "su rol exige activar la verificación en dos pasos antes de continuar")
+				return
+			}
+		}
+
+		next(m.withFieldFilter(w, identity), r.WithContext(auth.WithIdentity(r.Context(), identity)))
+	})
+}
+
+// withFieldFilter hace que respondWithJSON oculte los campos según el rol del usuario
+// (en una suplantación, el del suplantado: se ve lo mismo que él)
+func (m *AuthMiddleware) withFieldFilter(w http.ResponseWriter, identity *auth.Identity) http.ResponseWriter {
+	viewer := visibility.Viewer{UserID: identity.UserID, Username: identity.Username, Role: identity.Role}
+	return &fieldFilterWriter{
+		ResponseWriter: w,
+		apply: func(payload interface{}) (interface{}, error) {
+			return m.visibilitySvc.Apply(viewer, payload)
+		},
+	}
+}
+
+// impersonationHeader marca las respuestas dadas a un token de suplantación
+const impersonationHeader = "X-Impersonated-By"
+
+// bearerToken extrae el token de la cabecera Authorization.
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// clientIP devuelve la IP de origen de la petición (sin el puerto).
+// No se confía en X-Forwarded-For: el backend se expone sin proxy intermedio.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientInfo reúne IP y User-Agent para el historial de inicios de sesión
+func clientInfo(r *http.Request) auth.ClientInfo {
+	return auth.ClientInfo{IP: clientIP(r), UserAgent: r.UserAgent()}
+}
+
+// currentUser devuelve la identidad autenticada de la petición.
+// Solo debe usarse en handlers protegidos por AuthMiddleware.Require.
+func currentUser(r *http.Request) *auth.Identity {
+	if id := auth.IdentityFromContext(r.Context()); id != nil {
+		return id
+	}
+	return &auth.Identity{}
+}
+
+// logAction registra una acción del usuario autenticado; si un admin lo está
+// suplantando, el evento guarda ambas identidades.
+func logAction(ls logger.LoggerService, caller *auth.Identity, accion, entidad string, entidadID int) {
+	if caller.Impersonated() {
+		ls.LogImpersonated(caller.Username, caller.Role, caller.ImpersonatorUsername, accion, entidad, entidadID)
+		return
+	}
+	ls.Log(caller.Username, caller.Role, accion, entidad, entidadID)
+}
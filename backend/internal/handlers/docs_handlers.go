@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"proyecto/internal/docs"
+)
+
+// DocsHandler sirve la especificación OpenAPI y una página para explorarla
+type DocsHandler struct {
+	spec *docs.Document
+}
+
+func NewDocsHandler() *DocsHandler {
+	return &DocsHandler{}
+}
+
+// SetSpec recibe el documento una vez registradas todas las rutas
+func (h *DocsHandler) SetSpec(spec *docs.Document) {
+	h.spec = spec
+}
+
+// OpenAPIHandler devuelve la especificación en JSON
+func (h *DocsHandler) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if h.spec == nil {
+		respondWithError(w, http.StatusServiceUnavailable, "la documentación aún no está disponible")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, h.spec)
+}
+
+// UIHandler: Swagger UI (desde CDN) apuntando a /api/docs/openapi.json
+func (h *DocsHandler) UIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, swaggerUIPage)
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="es">
+<head>
+  <meta charset="utf-8">
+  <title>API de Gestión de Proyectos Agrícolas</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/api/docs/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
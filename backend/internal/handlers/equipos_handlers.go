@@ -29,13 +29,14 @@ func NewEquipoHandler(as auth.AuthService, es equipos.EquipoService, logs logger
 // 3. LOS MÉTODOS (Handlers)
 
 func (h *EquipoHandler) GetEquiposHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.GetEquiposRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermEquiposRead)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
@@ -45,23 +46,24 @@ func (h *EquipoHandler) GetEquiposHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	equipos, err := h.equipoSvc.GetEquiposByProyectoID(req.ProyectoID)
+	equipos, page, err := h.equipoSvc.GetEquipos(req)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string][]models.EquipoImplemento{"equipos": equipos})
+	respondWithList(w, "equipos", equipos, page)
 }
 
 func (h *EquipoHandler) CreateEquipoHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.CreateEquipoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermEquiposWrite)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
@@ -73,25 +75,31 @@ func (h *EquipoHandler) CreateEquipoHandler(w http.ResponseWriter, r *http.Reque
 
 	nuevoEquipo, err := h.equipoSvc.CreateEquipo(req)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithServiceError(w, http.StatusBadRequest, err)
 		return
 	}
 
 	if nuevoEquipo != nil {
-		h.loggerSvc.Log(req.AdminUsername, "admin/gerente", "CREACIÓN", "Equipos/Implementos", nuevoEquipo.ID)
+		logAction(h.loggerSvc, caller, "CREACIÓN", "Equipos/Implementos", nuevoEquipo.ID)
 	}
 
 	respondWithJSON(w, http.StatusCreated, nuevoEquipo)
 }
 
 func (h *EquipoHandler) UpdateEquipoHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.UpdateEquipoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	proyectoID, err := h.equipoSvc.GetEquipoProyectoID(req.ID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "equipo no encontrado")
+		return
+	}
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, proyectoID, models.PermEquiposWrite)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
@@ -103,7 +111,7 @@ func (h *EquipoHandler) UpdateEquipoHandler(w http.ResponseWriter, r *http.Reque
 
 	affected, err := h.equipoSvc.UpdateEquipo(req)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithServiceError(w, http.StatusBadRequest, err)
 		return
 	}
 	if affected == 0 {
@@ -111,19 +119,25 @@ func (h *EquipoHandler) UpdateEquipoHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin/gerente", "MODIFICACIÓN", "Equipos/Implementos", req.ID)
+	logAction(h.loggerSvc, caller, "MODIFICACIÓN", "Equipos/Implementos", req.ID)
 
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Equipo actualizado."})
 }
 
 func (h *EquipoHandler) DeleteEquipoHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.DeleteEquipoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	proyectoID, err := h.equipoSvc.GetEquipoProyectoID(req.ID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "equipo no encontrado")
+		return
+	}
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, proyectoID, models.PermEquiposWrite)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
@@ -135,7 +149,7 @@ func (h *EquipoHandler) DeleteEquipoHandler(w http.ResponseWriter, r *http.Reque
 
 	affected, err := h.equipoSvc.DeleteEquipo(req.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 	if affected == 0 {
@@ -143,7 +157,7 @@ func (h *EquipoHandler) DeleteEquipoHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin/gerente", "ELIMINACIÓN", "Equipos/Implementos", req.ID)
+	logAction(h.loggerSvc, caller, "ELIMINACIÓN", "Equipos/Implementos", req.ID)
 
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Equipo borrado."})
 }
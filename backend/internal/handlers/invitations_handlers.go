@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"proyecto/internal/auth"
+	"proyecto/internal/logger"
+	"proyecto/internal/models"
+)
+
+// 1. EL STRUCT DEL HANDLER
+type InvitationHandler struct {
+	authSvc   auth.AuthService
+	loggerSvc logger.LoggerService
+}
+
+// 2. EL CONSTRUCTOR
+func NewInvitationHandler(as auth.AuthService, ls logger.LoggerService) *InvitationHandler {
+	return &InvitationHandler{
+		authSvc:   as,
+		loggerSvc: ls,
+	}
+}
+
+//  3. LOS MÉTODOS (Handlers)
+
+// canManageInvitations: todas las rutas de invitaciones exigen invitations:manage
+func (h *InvitationHandler) canManageInvitations(w http.ResponseWriter, r *http.Request) bool {
+	caller := currentUser(r)
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermInvitesManage)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return false
+	}
+	if !hasPermission {
+		respondWithError(w, http.StatusForbidden, "acceso denegado")
+		return false
+	}
+	return true
+}
+
+// GetInvitationsHandler: Lista las invitaciones (sin los códigos)
+func (h *InvitationHandler) GetInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageInvitations(w, r) {
+		return
+	}
+
+	invitations, err := h.authSvc.GetInvitations()
+	if err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"invitations": invitations})
+}
+
+// CreateInvitationHandler: Emite un código; solo se muestra en esta respuesta
+func (h *InvitationHandler) CreateInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.CreateInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+	if !h.canManageInvitations(w, r) {
+		return
+	}
+
+	resp, err := h.authSvc.CreateInvitation(req, caller.Username)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "CREACIÓN (Invitación)", "Usuarios", resp.Invitation.ID)
+
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+// RevokeInvitationHandler: Revoca una invitación
+func (h *InvitationHandler) RevokeInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.RevokeInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+	if !h.canManageInvitations(w, r) {
+		return
+	}
+
+	if err := h.authSvc.RevokeInvitation(req.ID); err != nil {
+		respondWithServiceError(w, http.StatusNotFound, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "REVOCACIÓN (Invitación)", "Usuarios", req.ID)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Invitación revocada"})
+}
@@ -29,13 +29,14 @@ func NewLaborHandler(as auth.AuthService, ls labores.LaborService, logs logger.L
 //  3. LOS MÉTODOS (Handlers)
 
 func (h *LaborHandler) GetLaboresHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.GetLaboresRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermLaboresRead)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
@@ -45,23 +46,24 @@ func (h *LaborHandler) GetLaboresHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	labores, err := h.laborSvc.GetLaboresByProyectoID(req.ProyectoID)
+	labores, page, err := h.laborSvc.GetLabores(req)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string][]models.LaborAgronomica{"labores": labores})
+	respondWithList(w, "labores", labores, page)
 }
 
 func (h *LaborHandler) CreateLaborHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.CreateLaborRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermLaboresWrite)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
@@ -73,25 +75,31 @@ func (h *LaborHandler) CreateLaborHandler(w http.ResponseWriter, r *http.Request
 
 	nuevaLabor, err := h.laborSvc.CreateLabor(req)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithServiceError(w, http.StatusBadRequest, err)
 		return
 	}
 
 	if nuevaLabor != nil {
-		h.loggerSvc.Log(req.AdminUsername, "admin/gerente", "CREACIÓN", "Labores", nuevaLabor.ID)
+		logAction(h.loggerSvc, caller, "CREACIÓN", "Labores", nuevaLabor.ID)
 	}
 
 	respondWithJSON(w, http.StatusCreated, nuevaLabor)
 }
 
 func (h *LaborHandler) UpdateLaborHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.UpdateLaborRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	proyectoID, err := h.laborSvc.GetLaborProyectoID(req.ID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "labor no encontrada")
+		return
+	}
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, proyectoID, models.PermLaboresWrite)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
@@ -103,7 +111,7 @@ func (h *LaborHandler) UpdateLaborHandler(w http.ResponseWriter, r *http.Request
 
 	affected, err := h.laborSvc.UpdateLabor(req)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithServiceError(w, http.StatusBadRequest, err)
 		return
 	}
 	if affected == 0 {
@@ -111,19 +119,25 @@ func (h *LaborHandler) UpdateLaborHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin/gerente", "MODIFICACIÓN", "Labores", req.ID)
+	logAction(h.loggerSvc, caller, "MODIFICACIÓN", "Labores", req.ID)
 
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Labor actualizada."})
 }
 
 func (h *LaborHandler) DeleteLaborHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.DeleteLaborRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	proyectoID, err := h.laborSvc.GetLaborProyectoID(req.ID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "labor no encontrada")
+		return
+	}
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, proyectoID, models.PermLaboresWrite)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
@@ -135,7 +149,7 @@ func (h *LaborHandler) DeleteLaborHandler(w http.ResponseWriter, r *http.Request
 
 	affected, err := h.laborSvc.DeleteLabor(req.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 	if affected == 0 {
@@ -143,7 +157,7 @@ func (h *LaborHandler) DeleteLaborHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin/gerente", "ELIMINACIÓN", "Labores", req.ID)
+	logAction(h.loggerSvc, caller, "ELIMINACIÓN", "Labores", req.ID)
 
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Labor borrada."})
 }
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"proyecto/internal/i18n"
+	"proyecto/internal/models"
+)
+
+//  IDIOMA DE LAS RESPUESTAS
+// Localize elige el idioma de la petición con Accept-Language; AuthMiddleware lo
+// reemplaza por el idioma preferido del usuario si lo configuró. Los errores se
+// responden en ese idioma (ver localizeError); la cabecera Content-Language lo indica.
+
+// Localize deja el idioma negociado en la respuesta para respondWithError
+func Localize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lw := &localeWriter{ResponseWriter: w}
+		lw.setLang(i18n.Negotiate(r.Header.Get("Accept-Language")))
+		next.ServeHTTP(lw, r)
+	})
+}
+
+// localeWriter lleva el idioma de la respuesta
+type localeWriter struct {
+	http.ResponseWriter
+	lang i18n.Lang
+}
+
+func (lw *localeWriter) setLang(lang i18n.Lang) {
+	lw.lang = lang
+	lw.Header().Set("Content-Language", string(lang))
+}
+
+func (lw *localeWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// findLocaleWriter recorre los envoltorios de w (filtro de campos, etc.) hasta el de Localize
+func findLocaleWriter(w http.ResponseWriter) *localeWriter {
+	for {
+		switch v := w.(type) {
+		case *localeWriter:
+			return v
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// languageOf: idioma de la respuesta (Default fuera de Localize)
+func languageOf(w http.ResponseWriter) i18n.Lang {
+	if lw := findLocaleWriter(w); lw != nil {
+		return lw.lang
+	}
+	return i18n.Default
+}
+
+// setLanguage cambia el idioma de la respuesta (preferencia del usuario autenticado)
+func setLanguage(w http.ResponseWriter, lang i18n.Lang) {
+	if lw := findLocaleWriter(w); lw != nil {
+		lw.setLang(lang)
+	}
+}
+
+// localizeError traduce un error al idioma de la respuesta. Los servicios ya
+// escriben en el idioma por defecto, así que su mensaje (más específico que el
+// del catálogo) se mantiene; en otro idioma se usan los textos del catálogo por
+// code, y el mensaje nombra los campos de los detalles.
+func localizeError(lang i18n.Lang, resp models.ErrorResponse) models.ErrorResponse {
+	if lang == i18n.Default {
+		return resp
+	}
+	if message, ok := i18n.Message(lang, resp.Code); ok {
+		resp.Error = message
+	}
+	if len(resp.Details) == 0 {
+		return resp
+	}
+
+	details := make([]models.FieldError, len(resp.Details))
+	fields := make([]string, len(resp.Details))
+	for i, d := range resp.Details {
+		if message, ok := i18n.Message(lang, d.Code); ok {
+			d.Message = message
+		}
+		details[i] = d
+		fields[i] = d.Field
+	}
+	resp.Details = details
+	resp.Error = strings.TrimSuffix(resp.Error, ".") + ": " + strings.Join(fields, ", ") + "."
+	return resp
+}
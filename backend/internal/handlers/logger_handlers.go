@@ -24,18 +24,10 @@ func NewLoggerHandler(as auth.AuthService, ls logger.LoggerService) *LoggerHandl
 	}
 }
 
-//  3. ESTRUCTURAS DE PETICIÓN (DTOs Locales)
-
-// Estructura para recibir el rango de fechas del Frontend
-type DeleteLogsRangeRequest struct {
-	AdminUsername string `json:"admin_username"`
-	FechaInicio   string `json:"fecha_inicio"`
-	FechaFin      string `json:"fecha_fin"`
-}
-
-// 4. LOS MÉTODOS (Handlers)
+// 3. LOS MÉTODOS (Handlers)
 
 func (h *LoggerHandler) GetLogsHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.GetLogsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
@@ -43,26 +35,27 @@ func (h *LoggerHandler) GetLogsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verificación de permisos
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin")
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermLogsRead)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
 	}
 	if !hasPermission {
-		respondWithError(w, http.StatusForbidden, "acceso denegado. se requiere rol de admin")
+		respondWithError(w, http.StatusForbidden, "No autorizado")
 		return
 	}
 
-	logs, err := h.loggerSvc.GetLogs(req)
+	logs, page, err := h.loggerSvc.GetLogs(req)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, logs)
+	respondWithArrayOrList(w, req.ListParams, "logs", logs, page)
 }
 
 func (h *LoggerHandler) DeleteLogsHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.DeleteLogsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "JSON inválido")
@@ -70,7 +63,7 @@ func (h *LoggerHandler) DeleteLogsHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	// Solo Admin
-	perm, err := h.authSvc.CheckPermission(req.AdminUsername, "admin")
+	perm, err := h.authSvc.CheckPermission(caller, models.PermLogsDelete)
 	if err != nil || !perm {
 		respondWithError(w, http.StatusForbidden, "No autorizado. Solo el administrador puede borrar logs.")
 		return
@@ -78,25 +71,26 @@ func (h *LoggerHandler) DeleteLogsHandler(w http.ResponseWriter, r *http.Request
 
 	err = h.loggerSvc.DeleteLogs(req.IDs)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	// Logueamos la acción
-	h.loggerSvc.Log(req.AdminUsername, "admin", "ELIMINACIÓN", "Logs", 0)
+	logAction(h.loggerSvc, caller, "ELIMINACIÓN", "Logs", 0)
 
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Logs eliminados correctamente"})
 }
 
 func (h *LoggerHandler) DeleteLogsRangeHandler(w http.ResponseWriter, r *http.Request) {
-	var req DeleteLogsRangeRequest
+	caller := currentUser(r)
+	var req models.DeleteLogsRangeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "JSON inválido")
 		return
 	}
 
 	// 1. Validar Permisos
-	perm, err := h.authSvc.CheckPermission(req.AdminUsername, "admin")
+	perm, err := h.authSvc.CheckPermission(caller, models.PermLogsDelete)
 	if err != nil || !perm {
 		respondWithError(w, http.StatusForbidden, "No autorizado. Solo admin puede borrar historial masivo.")
 		return
@@ -105,7 +99,7 @@ func (h *LoggerHandler) DeleteLogsRangeHandler(w http.ResponseWriter, r *http.Re
 	// 2. Ejecutar borrado
 	cantidad, err := h.loggerSvc.DeleteLogsByRange(req.FechaInicio, req.FechaFin)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -113,7 +107,7 @@ func (h *LoggerHandler) DeleteLogsRangeHandler(w http.ResponseWriter, r *http.Re
 
 	logMsg := fmt.Sprintf("ELIMINACIÓN MASIVA (%d eventos entre %s y %s)", cantidad, req.FechaInicio, req.FechaFin)
 
-	h.loggerSvc.Log(req.AdminUsername, "admin", logMsg, "Logs", 0)
+	logAction(h.loggerSvc, caller, logMsg, "Logs", 0)
 
 	// 4. Responder
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{
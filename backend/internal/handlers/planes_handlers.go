@@ -20,83 +20,97 @@ func NewPlanHandler(as auth.AuthService, ls logger.LoggerService) *PlanHandler {
 
 // CreatePlanHandler guarda un nuevo plan
 func (h *PlanHandler) CreatePlanHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.CreatePlanRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "JSON inválido")
 		return
 	}
 
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermPlanesWrite)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return
+	}
+	if !hasPermission {
+		respondWithError(w, http.StatusForbidden, "acceso denegado")
+		return
+	}
+
 	stmt, err := database.DB.Prepare(`
 		INSERT INTO planes_accion (proyecto_id, actividad, accion, fecha_inicio, fecha_cierre, horas, responsable, costo_unitario, monto)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithInternalError(w, err, "CreatePlanHandler", "error al crear el plan")
 		return
 	}
 	defer stmt.Close()
 
 	res, err := stmt.Exec(req.ProyectoID, req.Actividad, req.Accion, req.FechaInicio, req.FechaCierre, req.Horas, req.Responsable, req.CostoUnitario, req.Monto)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithInternalError(w, err, "CreatePlanHandler", "error al crear el plan")
 		return
 	}
 
 	id, _ := res.LastInsertId()
-	h.loggerSvc.Log(req.AdminUsername, "admin", "CREACIÓN", "Plan Accion", int(id))
+	logAction(h.loggerSvc, caller, "CREACIÓN", "Plan Accion", int(id))
 
 	respondWithJSON(w, http.StatusCreated, models.SimpleResponse{Mensaje: "Plan creado exitosamente"})
 }
 
 // GetPlanesHandler obtiene los planes
 func (h *PlanHandler) GetPlanesHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.GetPlanesRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "JSON inválido")
 		return
 	}
 
-	rows, err := database.DB.Query("SELECT id, proyecto_id, actividad, accion, fecha_inicio, fecha_cierre, horas, responsable, costo_unitario, monto FROM planes_accion WHERE proyecto_id = ?", req.ProyectoID)
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermPlanesRead)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return
+	}
+	if !hasPermission {
+		respondWithError(w, http.StatusForbidden, "acceso denegado")
 		return
 	}
-	defer rows.Close()
 
-	var planes []models.PlanAccion
-	for rows.Next() {
-		var p models.PlanAccion
-		if err := rows.Scan(&p.ID, &p.ProyectoID, &p.Actividad, &p.Accion, &p.FechaInicio, &p.FechaCierre, &p.Horas, &p.Responsable, &p.CostoUnitario, &p.Monto); err != nil {
-			continue
-		}
-		planes = append(planes, p)
+	planes, page, err := database.GetPlanes(req)
+	if err != nil {
+		respondWithInternalError(w, err, "GetPlanesHandler", "error al obtener planes")
+		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{"planes": planes})
+	respondWithList(w, "planes", planes, page)
 }
 
 // UPDATE PLAN
 func (h *PlanHandler) UpdatePlanHandler(w http.ResponseWriter, r *http.Request) {
-
-	type UpdatePlanRequest struct {
-		ID            int     `json:"id"`
-		Actividad     string  `json:"actividad"`
-		Accion        string  `json:"accion"`
-		FechaInicio   string  `json:"fecha_inicio"`
-		FechaCierre   string  `json:"fecha_cierre"`
-		Horas         float64 `json:"horas"`
-		Responsable   string  `json:"responsable"`
-		CostoUnitario float64 `json:"costo_unitario"`
-		Monto         float64 `json:"monto"`
-		AdminUsername string  `json:"admin_username"`
-	}
-
-	var req UpdatePlanRequest
+	caller := currentUser(r)
+	var req models.UpdatePlanRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "JSON inválido")
 		return
 	}
 
+	proyectoID, err := database.GetPlanProyectoID(req.ID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "plan no encontrado")
+		return
+	}
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, proyectoID, models.PermPlanesWrite)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return
+	}
+	if !hasPermission {
+		respondWithError(w, http.StatusForbidden, "acceso denegado")
+		return
+	}
+
 	stmt, err := database.DB.Prepare(`
 		UPDATE planes_accion SET 
 			actividad=?, accion=?, fecha_inicio=?, fecha_cierre=?, 
@@ -104,46 +118,58 @@ func (h *PlanHandler) UpdatePlanHandler(w http.ResponseWriter, r *http.Request)
 		WHERE id=?
 	`)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithInternalError(w, err, "UpdatePlanHandler", "error al actualizar el plan")
 		return
 	}
 	defer stmt.Close()
 
 	_, err = stmt.Exec(req.Actividad, req.Accion, req.FechaInicio, req.FechaCierre, req.Horas, req.Responsable, req.CostoUnitario, req.Monto, req.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithInternalError(w, err, "UpdatePlanHandler", "error al actualizar el plan")
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin", "MODIFICACIÓN", "Plan Accion", req.ID)
+	logAction(h.loggerSvc, caller, "MODIFICACIÓN", "Plan Accion", req.ID)
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Plan actualizado"})
 }
 
 // DELETE PLAN
 func (h *PlanHandler) DeletePlanHandler(w http.ResponseWriter, r *http.Request) {
-	type DeletePlanRequest struct {
-		ID            int    `json:"id"`
-		AdminUsername string `json:"admin_username"`
-	}
-	var req DeletePlanRequest
+	caller := currentUser(r)
+	var req models.DeletePlanRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "JSON inválido")
 		return
 	}
 
+	proyectoID, err := database.GetPlanProyectoID(req.ID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "plan no encontrado")
+		return
+	}
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, proyectoID, models.PermPlanesWrite)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return
+	}
+	if !hasPermission {
+		respondWithError(w, http.StatusForbidden, "acceso denegado")
+		return
+	}
+
 	stmt, err := database.DB.Prepare("DELETE FROM planes_accion WHERE id=?")
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithInternalError(w, err, "DeletePlanHandler", "error al eliminar el plan")
 		return
 	}
 	defer stmt.Close()
 
 	_, err = stmt.Exec(req.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithInternalError(w, err, "DeletePlanHandler", "error al eliminar el plan")
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin", "ELIMINACIÓN", "Plan Accion", req.ID)
+	logAction(h.loggerSvc, caller, "ELIMINACIÓN", "Plan Accion", req.ID)
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Plan eliminado"})
 }
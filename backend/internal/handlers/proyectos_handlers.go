@@ -30,38 +30,61 @@ func NewProyectoHandler(as auth.AuthService, ps proyectos.ProyectoService, ls lo
 
 // GetProyectosHandler: Obtiene la lista de proyectos
 func (h *ProyectoHandler) GetProyectosHandler(w http.ResponseWriter, r *http.Request) {
-
-	var req models.AdminActionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	caller := currentUser(r)
+	var req models.GetProyectosRequest
+	if err := decodeOptionalJSON(r, &req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	// Validamos que sea admin o gerente
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
-	if err != nil || !hasPermission {
-		respondWithError(w, http.StatusForbidden, "No autorizado")
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermProyectosRead)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return
+	}
+	allProjects, err := h.authSvc.CheckPermission(caller, models.PermProyectosAll)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
 	}
 
-	proyectos, err := h.proyectoSvc.GetAllProyectos()
+	// Con proyectos:all se ven todos; si no, solo aquellos de los que es miembro
+	memberID := 0
+	if !hasPermission || !allProjects {
+		memberID = caller.UserID
+	}
+	// Sin el permiso global hace falta ser miembro de algún proyecto (sin importar los filtros)
+	if !hasPermission {
+		propios, _, err := h.proyectoSvc.GetProyectos(models.GetProyectosRequest{ListParams: models.ListParams{Limit: 1}}, memberID)
+		if err != nil {
+			respondWithServiceError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if len(propios) == 0 {
+			respondWithError(w, http.StatusForbidden, "No autorizado")
+			return
+		}
+	}
+
+	proyectos, page, err := h.proyectoSvc.GetProyectos(req, memberID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{"proyectos": proyectos})
+	respondWithList(w, "proyectos", proyectos, page)
 }
 
 // CreateProyectoHandler: Crea un nuevo proyecto
 func (h *ProyectoHandler) CreateProyectoHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.CreateProyectoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermProyectosWrite)
 	if err != nil || !hasPermission {
 		respondWithError(w, http.StatusForbidden, "No autorizado")
 		return
@@ -69,25 +92,34 @@ func (h *ProyectoHandler) CreateProyectoHandler(w http.ResponseWriter, r *http.R
 
 	nuevoProyecto, err := h.proyectoSvc.CreateProyecto(req.Nombre, req.FechaInicio, req.FechaCierre)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	// Quien no tiene acceso a todos los proyectos queda como miembro del que crea
+	if allProjects, _ := h.authSvc.CheckPermission(caller, models.PermProyectosAll); !allProjects {
+		if err := h.proyectoSvc.AddMember(nuevoProyecto.ID, caller.UserID, caller.Role); err != nil {
+			respondWithServiceError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
 	// Log
-	h.loggerSvc.Log(req.AdminUsername, "admin/gerente", "CREACIÓN", "Proyectos", nuevoProyecto.ID)
+	logAction(h.loggerSvc, caller, "CREACIÓN", "Proyectos", nuevoProyecto.ID)
 
 	respondWithJSON(w, http.StatusCreated, nuevoProyecto)
 }
 
 // UpdateProyectoHandler: Actualiza un proyecto
 func (h *ProyectoHandler) UpdateProyectoHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.UpdateProyectoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ID, models.PermProyectosWrite)
 	if err != nil || !hasPermission {
 		respondWithError(w, http.StatusForbidden, "No autorizado")
 		return
@@ -95,18 +127,19 @@ func (h *ProyectoHandler) UpdateProyectoHandler(w http.ResponseWriter, r *http.R
 
 	proyectoActualizado, err := h.proyectoSvc.UpdateProyecto(req.ID, req.Nombre, req.FechaInicio, req.FechaCierre)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	// Log
-	h.loggerSvc.Log(req.AdminUsername, "admin/gerente", "MODIFICACIÓN", "Proyectos", req.ID)
+	logAction(h.loggerSvc, caller, "MODIFICACIÓN", "Proyectos", req.ID)
 
 	respondWithJSON(w, http.StatusOK, proyectoActualizado)
 }
 
 // DeleteProyectoHandler: Elimina un proyecto
 func (h *ProyectoHandler) DeleteProyectoHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.DeleteProyectoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
@@ -114,7 +147,7 @@ func (h *ProyectoHandler) DeleteProyectoHandler(w http.ResponseWriter, r *http.R
 	}
 
 	// Solo Admin puede borrar proyectos
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin")
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ID, models.PermProyectosDelete)
 	if err != nil || !hasPermission {
 		respondWithError(w, http.StatusForbidden, "No autorizado (Solo Admin)")
 		return
@@ -122,32 +155,26 @@ func (h *ProyectoHandler) DeleteProyectoHandler(w http.ResponseWriter, r *http.R
 
 	_, err = h.proyectoSvc.DeleteProyecto(req.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	// Log
-	h.loggerSvc.Log(req.AdminUsername, "admin", "ELIMINACIÓN", "Proyectos", req.ID)
+	logAction(h.loggerSvc, caller, "ELIMINACIÓN", "Proyectos", req.ID)
 
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Proyecto eliminado"})
 }
 
 // AdminSetProyectoEstadoHandler: Cambia estado (Activo/Cerrado)
 func (h *ProyectoHandler) AdminSetProyectoEstadoHandler(w http.ResponseWriter, r *http.Request) {
-	// Definimos struct local para esta petición específica
-	type SetProyectoEstadoRequest struct {
-		ID            int    `json:"id"`
-		Estado        string `json:"estado"`
-		AdminUsername string `json:"admin_username"`
-	}
-
-	var req SetProyectoEstadoRequest
+	caller := currentUser(r)
+	var req models.SetProyectoEstadoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ID, models.PermProyectosWrite)
 	if err != nil || !hasPermission {
 		respondWithError(w, http.StatusForbidden, "No autorizado")
 		return
@@ -155,11 +182,11 @@ func (h *ProyectoHandler) AdminSetProyectoEstadoHandler(w http.ResponseWriter, r
 
 	_, err = h.proyectoSvc.SetProyectoEstado(req.ID, req.Estado)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin/gerente", "CAMBIO ESTADO", "Proyectos", req.ID)
+	logAction(h.loggerSvc, caller, "CAMBIO ESTADO", "Proyectos", req.ID)
 
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Estado actualizado"})
 }
@@ -3,7 +3,11 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
+
+	"proyecto/internal/apperrors"
 	"proyecto/internal/auth"
+	"proyecto/internal/cedula"
 	"proyecto/internal/database"
 	"proyecto/internal/logger"
 	"proyecto/internal/models"
@@ -20,117 +24,168 @@ func NewRecursoHandler(as auth.AuthService, ls logger.LoggerService) *RecursoHan
 
 // CREATE
 func (h *RecursoHandler) CreateRecursoHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.CreateRecursoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "JSON inválido")
 		return
 	}
 
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermRecursosWrite)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return
+	}
+	if !hasPermission {
+		respondWithError(w, http.StatusForbidden, "acceso denegado")
+		return
+	}
+	doc, err := recursoCedula(req.Cedula)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	req.Cedula = doc
+
 	stmt, err := database.DB.Prepare(`
 		INSERT INTO recursos_humanos (proyecto_id, actividad, accion, nombre, cedula, tiempo, cantidad, costo_unitario, monto)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithInternalError(w, err, "CreateRecursoHandler", "error al crear el recurso")
 		return
 	}
 	defer stmt.Close()
 
 	res, err := stmt.Exec(req.ProyectoID, req.Actividad, req.Accion, req.Nombre, req.Cedula, req.Tiempo, req.Cantidad, req.CostoUnitario, req.Monto)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithInternalError(w, err, "CreateRecursoHandler", "error al crear el recurso")
 		return
 	}
 
 	id, _ := res.LastInsertId()
-	h.loggerSvc.Log(req.AdminUsername, "admin", "CREACIÓN", "Recurso Humano", int(id))
+	logAction(h.loggerSvc, caller, "CREACIÓN", "Recurso Humano", int(id))
 	respondWithJSON(w, http.StatusCreated, models.SimpleResponse{Mensaje: "Recurso creado"})
 }
 
 // GET
 func (h *RecursoHandler) GetRecursosHandler(w http.ResponseWriter, r *http.Request) {
-	type GetReq struct {
-		ProyectoID int `json:"proyecto_id"`
-	}
-	var req GetReq
+	caller := currentUser(r)
+	var req models.GetRecursosRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "JSON inválido")
 		return
 	}
 
-	rows, err := database.DB.Query("SELECT id, proyecto_id, actividad, accion, nombre, cedula, tiempo, cantidad, costo_unitario, monto FROM recursos_humanos WHERE proyecto_id = ?", req.ProyectoID)
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermRecursosRead)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return
+	}
+	if !hasPermission {
+		respondWithError(w, http.StatusForbidden, "acceso denegado")
 		return
 	}
-	defer rows.Close()
 
-	var lista []models.RecursoHumano
-	for rows.Next() {
-		var r models.RecursoHumano
-		if err := rows.Scan(&r.ID, &r.ProyectoID, &r.Actividad, &r.Accion, &r.Nombre, &r.Cedula, &r.Tiempo, &r.Cantidad, &r.CostoUnitario, &r.Monto); err != nil {
-			continue
-		}
-		lista = append(lista, r)
+	lista, page, err := database.GetRecursos(req)
+	if err != nil {
+		respondWithInternalError(w, err, "GetRecursosHandler", "error al obtener recursos")
+		return
 	}
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{"recursos": lista})
+	respondWithList(w, "recursos", lista, page)
 }
 
 // UPDATE
 func (h *RecursoHandler) UpdateRecursoHandler(w http.ResponseWriter, r *http.Request) {
-	type UpdateReq struct {
-		ID            int     `json:"id"`
-		Actividad     string  `json:"actividad"`
-		Accion        string  `json:"accion"`
-		Nombre        string  `json:"nombre"`
-		Cedula        string  `json:"cedula"`
-		Tiempo        float64 `json:"tiempo"`
-		Cantidad      float64 `json:"cantidad"`
-		CostoUnitario float64 `json:"costo_unitario"`
-		Monto         float64 `json:"monto"`
-		AdminUsername string  `json:"admin_username"`
-	}
-	var req UpdateReq
+	caller := currentUser(r)
+	var req models.UpdateRecursoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "JSON inválido")
 		return
 	}
 
+	proyectoID, err := database.GetRecursoProyectoID(req.ID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "recurso no encontrado")
+		return
+	}
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, proyectoID, models.PermRecursosWrite)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return
+	}
+	if !hasPermission {
+		respondWithError(w, http.StatusForbidden, "acceso denegado")
+		return
+	}
+	doc, err := recursoCedula(req.Cedula)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	req.Cedula = doc
+
 	stmt, err := database.DB.Prepare(`
 		UPDATE recursos_humanos SET actividad=?, accion=?, nombre=?, cedula=?, tiempo=?, cantidad=?, costo_unitario=?, monto=? WHERE id=?
 	`)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithInternalError(w, err, "UpdateRecursoHandler", "error al actualizar el recurso")
 		return
 	}
 	defer stmt.Close()
 
 	_, err = stmt.Exec(req.Actividad, req.Accion, req.Nombre, req.Cedula, req.Tiempo, req.Cantidad, req.CostoUnitario, req.Monto, req.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithInternalError(w, err, "UpdateRecursoHandler", "error al actualizar el recurso")
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin", "MODIFICACIÓN", "Recurso Humano", req.ID)
+	logAction(h.loggerSvc, caller, "MODIFICACIÓN", "Recurso Humano", req.ID)
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Recurso actualizado"})
 }
 
 // DELETE
 func (h *RecursoHandler) DeleteRecursoHandler(w http.ResponseWriter, r *http.Request) {
-	type DeleteReq struct {
-		ID            int    `json:"id"`
-		AdminUsername string `json:"admin_username"`
-	}
-	var req DeleteReq
+	caller := currentUser(r)
+	var req models.DeleteRecursoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "JSON inválido")
 		return
 	}
-	_, err := database.DB.Exec("DELETE FROM recursos_humanos WHERE id=?", req.ID)
+
+	proyectoID, err := database.GetRecursoProyectoID(req.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, http.StatusNotFound, "recurso no encontrado")
 		return
 	}
-	h.loggerSvc.Log(req.AdminUsername, "admin", "ELIMINACIÓN", "Recurso Humano", req.ID)
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, proyectoID, models.PermRecursosWrite)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return
+	}
+	if !hasPermission {
+		respondWithError(w, http.StatusForbidden, "acceso denegado")
+		return
+	}
+
+	_, err = database.DB.Exec("DELETE FROM recursos_humanos WHERE id=?", req.ID)
+	if err != nil {
+		respondWithInternalError(w, err, "DeleteRecursoHandler", "error al eliminar el recurso")
+		return
+	}
+	logAction(h.loggerSvc, caller, "ELIMINACIÓN", "Recurso Humano", req.ID)
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Recurso eliminado"})
 }
+
+// recursoCedula normaliza la cédula de un recurso humano; es opcional
+// (un recurso puede ser un puesto aún sin persona asignada)
+func recursoCedula(raw string) (string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return "", nil
+	}
+	doc, err := cedula.Normalize(raw)
+	if err != nil {
+		return "", apperrors.InvalidField("cedula", err.Error())
+	}
+	return doc, nil
+}
@@ -2,19 +2,98 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
 
+	"proyecto/internal/apperrors"
 	"proyecto/internal/models"
 )
 
 // UTILIDADES
 func respondWithError(w http.ResponseWriter, code int, message string) {
-	respondWithJSON(w, code, models.SimpleResponse{Error: message})
+	respondWithJSON(w, code, localizeError(languageOf(w), models.ErrorResponse{Error: message, Code: string(apperrors.CodeForStatus(code))}))
+}
+
+// respondWithServiceError responde el error de un servicio: los errores de dominio
+// con su código HTTP, su code y sus detalles; los demás con fallback
+func respondWithServiceError(w http.ResponseWriter, fallback int, err error) {
+	appErr, ok := apperrors.As(err)
+	if !ok {
+		respondWithError(w, fallback, err.Error())
+		return
+	}
+	respondWithJSON(w, apperrors.Status(appErr.Code), localizeError(languageOf(w), models.ErrorResponse{
+		Error:   appErr.Message,
+		Code:    string(appErr.Code),
+		Details: appErr.Fields,
+	}))
+}
+
+// respondWithInternalError responde un fallo de la base de datos sin mostrar su
+// texto al cliente: se registra en el log y se responde message. Los errores de
+// dominio (un cursor o un orden inválidos) se responden como tales.
+func respondWithInternalError(w http.ResponseWriter, err error, handler, message string) {
+	if _, ok := apperrors.As(err); ok {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	log.Printf("Error en %s: %v", handler, err)
+	respondWithError(w, http.StatusInternalServerError, message)
+}
+
+// decodeOptionalJSON lee el cuerpo de los listados que antes no lo tenían: sin
+// cuerpo, v queda con sus valores por defecto
+func decodeOptionalJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// respondWithList responde una página de un listado: {"<key>": [...], "next_cursor": ..., "total": ...}
+func respondWithList(w http.ResponseWriter, key string, items interface{}, page *models.Page) {
+	body := map[string]interface{}{key: items, "next_cursor": page.NextCursor}
+	if page.Total != nil {
+		body["total"] = *page.Total
+	}
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+// respondWithArrayOrList: los listados que respondían un arreglo lo siguen
+// haciendo mientras no se pida una página; con limit o cursor responden como
+// respondWithList
+func respondWithArrayOrList(w http.ResponseWriter, params models.ListParams, key string, items interface{}, page *models.Page) {
+	if !params.Paged() {
+		respondWithJSON(w, http.StatusOK, items)
+		return
+	}
+	respondWithList(w, key, items, page)
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	// En rutas autenticadas se quitan los campos que el rol no puede ver
+	if fw, ok := w.(*fieldFilterWriter); ok {
+		filtered, err := fw.apply(payload)
+		if err != nil {
+			code, filtered = http.StatusInternalServerError, localizeError(languageOf(w), models.ErrorResponse{Error: err.Error(), Code: string(apperrors.CodeInternal)})
+		}
+		payload = filtered
+	}
 	response, _ := json.Marshal(payload)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	w.Write(response)
 }
+
+// fieldFilterWriter envuelve la respuesta de una ruta protegida con el filtro de
+// visibilidad del usuario autenticado (lo instala AuthMiddleware)
+type fieldFilterWriter struct {
+	http.ResponseWriter
+	apply func(payload interface{}) (interface{}, error)
+}
+
+func (fw *fieldFilterWriter) Unwrap() http.ResponseWriter {
+	return fw.ResponseWriter
+}
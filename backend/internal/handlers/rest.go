@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//  RUTAS REST (/api/v1)
+// Los handlers leen sus parámetros de un cuerpo JSON (así los llaman las rutas
+// antiguas). Las rutas REST los reciben en el path y, en los GET, en la query:
+// FromREST los copia al cuerpo antes de llamar al mismo handler.
+
+// PathParam asocia un comodín del patrón ({id}) con el campo JSON que lee el handler
+type PathParam struct {
+	Name  string
+	Field string
+	Text  bool // el valor se pasa como texto; por defecto debe ser un entero
+}
+
+// IntParam: comodín numérico (ids)
+func IntParam(name, field string) PathParam {
+	return PathParam{Name: name, Field: field}
+}
+
+// TextParam: comodín de texto (por ejemplo, el nombre de un rol)
+func TextParam(name, field string) PathParam {
+	return PathParam{Name: name, Field: field, Text: true}
+}
+
+// FromREST arma el cuerpo JSON que espera el handler: parte del cuerpo recibido
+// (o de la query, si no hay cuerpo) y le agrega los parámetros del path, que
+// tienen prioridad sobre los del cuerpo.
+func FromREST(next http.Handler, params ...PathParam) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "no se pudo leer el cuerpo de la petición")
+			return
+		}
+
+		body := map[string]interface{}{}
+		if len(bytes.TrimSpace(raw)) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(raw))
+			dec.UseNumber() // los números pasan al handler tal como llegaron
+			if err := dec.Decode(&body); err != nil {
+				respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+				return
+			}
+		} else {
+			for key, values := range r.URL.Query() {
+				body[key] = values[len(values)-1]
+			}
+		}
+
+		for _, p := range params {
+			value := r.PathValue(p.Name)
+			if p.Text {
+				body[p.Field] = value
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				respondWithError(w, http.StatusBadRequest, "parámetro {"+p.Name+"} inválido")
+				return
+			}
+			body[p.Field] = n
+		}
+
+		encoded, _ := json.Marshal(body)
+		r.Body = io.NopCloser(bytes.NewReader(encoded))
+		r.ContentLength = int64(len(encoded))
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Deprecated marca una ruta antigua como alias obsoleto de su ruta REST
+// (cabeceras Deprecation y Link con la ruta nueva)
+func Deprecated(next http.Handler, successor string) http.Handler {
+	if i := strings.Index(successor, " "); i >= 0 {
+		successor = successor[i+1:] // sin el método
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
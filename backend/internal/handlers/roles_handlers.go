@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"proyecto/internal/auth"
+	"proyecto/internal/logger"
+	"proyecto/internal/models"
+	"proyecto/internal/roles"
+)
+
+type RoleHandler struct {
+	authSvc   auth.AuthService
+	roleSvc   roles.RoleService
+	loggerSvc logger.LoggerService
+}
+
+func NewRoleHandler(as auth.AuthService, rs roles.RoleService, ls logger.LoggerService) *RoleHandler {
+	return &RoleHandler{
+		authSvc:   as,
+		roleSvc:   rs,
+		loggerSvc: ls,
+	}
+}
+
+// canManageRoles: todas las rutas de roles exigen roles:manage
+func (h *RoleHandler) canManageRoles(w http.ResponseWriter, r *http.Request) bool {
+	caller := currentUser(r)
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermRolesManage)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return false
+	}
+	if !hasPermission {
+		respondWithError(w, http.StatusForbidden, "acceso denegado")
+		return false
+	}
+	return true
+}
+
+// GetRolesHandler: Lista los roles con sus permisos
+func (h *RoleHandler) GetRolesHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageRoles(w, r) {
+		return
+	}
+
+	list, err := h.roleSvc.GetAllRoles()
+	if err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"roles": list})
+}
+
+// GetPermissionsHandler: Catálogo de permisos disponibles
+func (h *RoleHandler) GetPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageRoles(w, r) {
+		return
+	}
+
+	list, err := h.roleSvc.GetAllPermissions()
+	if err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"permissions": list})
+}
+
+// CreateRoleHandler: Crea un rol nuevo
+func (h *RoleHandler) CreateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.CreateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+	if !h.canManageRoles(w, r) {
+		return
+	}
+
+	if err := h.roleSvc.CreateRole(req); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "CREACIÓN", "Roles", 0)
+	respondWithJSON(w, http.StatusCreated, models.SimpleResponse{Mensaje: "Rol creado exitosamente"})
+}
+
+// UpdateRolePermissionsHandler: Reemplaza los permisos de un rol
+func (h *RoleHandler) UpdateRolePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.UpdateRolePermissionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+	if !h.canManageRoles(w, r) {
+		return
+	}
+
+	if err := h.roleSvc.UpdateRolePermissions(req.Name, req.Permissions); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "CAMBIO PERMISOS", "Roles", 0)
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Permisos del rol actualizados"})
+}
+
+// DeleteRoleHandler: Elimina un rol sin usuarios asignados
+func (h *RoleHandler) DeleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.DeleteRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+	if !h.canManageRoles(w, r) {
+		return
+	}
+
+	if err := h.roleSvc.DeleteRole(req.Name); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "ELIMINACIÓN", "Roles", 0)
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Rol eliminado"})
+}
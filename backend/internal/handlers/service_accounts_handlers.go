@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"proyecto/internal/auth"
+	"proyecto/internal/logger"
+	"proyecto/internal/models"
+)
+
+// 1. EL STRUCT DEL HANDLER
+type ServiceAccountHandler struct {
+	authSvc   auth.AuthService
+	loggerSvc logger.LoggerService
+}
+
+// 2. EL CONSTRUCTOR
+func NewServiceAccountHandler(as auth.AuthService, ls logger.LoggerService) *ServiceAccountHandler {
+	return &ServiceAccountHandler{
+		authSvc:   as,
+		loggerSvc: ls,
+	}
+}
+
+//  3. LOS MÉTODOS (Handlers)
+
+// canManageAPIKeys: todas las rutas de cuentas de servicio exigen api-keys:manage
+func (h *ServiceAccountHandler) canManageAPIKeys(w http.ResponseWriter, r *http.Request) bool {
+	caller := currentUser(r)
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermAPIKeysManage)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return false
+	}
+	if !hasPermission {
+		respondWithError(w, http.StatusForbidden, "acceso denegado")
+		return false
+	}
+	return true
+}
+
+// GetServiceAccountsHandler: Lista las cuentas de servicio con sus API keys (sin secretos)
+func (h *ServiceAccountHandler) GetServiceAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageAPIKeys(w, r) {
+		return
+	}
+
+	accounts, err := h.authSvc.GetServiceAccounts()
+	if err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"service_accounts": accounts})
+}
+
+// CreateServiceAccountHandler: Crea una cuenta de servicio
+func (h *ServiceAccountHandler) CreateServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.CreateServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+	if !h.canManageAPIKeys(w, r) {
+		return
+	}
+
+	id, err := h.authSvc.CreateServiceAccount(req)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "CREACIÓN (Cuenta de servicio)", "Usuarios", int(id))
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{"id": id, "mensaje": "Cuenta de servicio creada"})
+}
+
+// CreateAPIKeyHandler: Emite una API key; la llave completa solo se muestra en esta respuesta
+func (h *ServiceAccountHandler) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+	if !h.canManageAPIKeys(w, r) {
+		return
+	}
+
+	resp, err := h.authSvc.CreateAPIKey(req)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "CREACIÓN (API key)", "Usuarios", req.ServiceAccountID)
+
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+// RevokeAPIKeyHandler: Revoca una API key
+func (h *ServiceAccountHandler) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.RevokeAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+	if !h.canManageAPIKeys(w, r) {
+		return
+	}
+
+	if err := h.authSvc.RevokeAPIKey(req.ID); err != nil {
+		respondWithServiceError(w, http.StatusNotFound, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "REVOCACIÓN (API key)", "Usuarios", req.ID)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "API key revocada"})
+}
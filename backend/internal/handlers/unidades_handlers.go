@@ -20,6 +20,7 @@ func NewUnidadHandler(as auth.AuthService, us unidades.UnidadService, ls logger.
 }
 
 func (h *UnidadHandler) GetUnidadesHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 
 	var req models.GetUnidadesRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -28,77 +29,90 @@ func (h *UnidadHandler) GetUnidadesHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Validar permisos
-	perm, _ := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	perm, _ := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermUnidadesRead)
 	if !perm {
 		respondWithError(w, http.StatusForbidden, "No autorizado")
 		return
 	}
 
-	unidades, err := h.unidadSvc.GetUnidadesByProyectoID(req.ProyectoID)
+	unidades, page, err := h.unidadSvc.GetUnidades(req)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, unidades)
+	respondWithArrayOrList(w, req.ListParams, "unidades", unidades, page)
 }
 
 // CreateUnidadHandler
 func (h *UnidadHandler) CreateUnidadHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.CreateUnidadRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "JSON inválido")
 		return
 	}
-	perm, _ := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	perm, _ := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermUnidadesWrite)
 	if !perm {
 		respondWithError(w, http.StatusForbidden, "No autorizado")
 		return
 	}
 	nueva, err := h.unidadSvc.CreateUnidad(req)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
-	h.loggerSvc.Log(req.AdminUsername, "admin", "CREACIÓN", "Unidades Medida", nueva.ID)
+	logAction(h.loggerSvc, caller, "CREACIÓN", "Unidades Medida", nueva.ID)
 	respondWithJSON(w, http.StatusCreated, nueva)
 }
 
 // Update y Delete Handler
 func (h *UnidadHandler) UpdateUnidadHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.UpdateUnidadRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "JSON inválido")
 		return
 	}
-	perm, _ := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	proyectoID, err := h.unidadSvc.GetUnidadProyectoID(req.ID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "unidad no encontrada")
+		return
+	}
+	perm, _ := h.authSvc.CheckProjectPermission(caller, proyectoID, models.PermUnidadesWrite)
 	if !perm {
 		respondWithError(w, http.StatusForbidden, "No autorizado")
 		return
 	}
-	_, err := h.unidadSvc.UpdateUnidad(req)
+	_, err = h.unidadSvc.UpdateUnidad(req)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
-	h.loggerSvc.Log(req.AdminUsername, "admin", "MODIFICACIÓN", "Unidades Medida", req.ID)
+	logAction(h.loggerSvc, caller, "MODIFICACIÓN", "Unidades Medida", req.ID)
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Actualizado"})
 }
 func (h *UnidadHandler) DeleteUnidadHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.DeleteUnidadRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "JSON inválido")
 		return
 	}
-	perm, _ := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	proyectoID, err := h.unidadSvc.GetUnidadProyectoID(req.ID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "unidad no encontrada")
+		return
+	}
+	perm, _ := h.authSvc.CheckProjectPermission(caller, proyectoID, models.PermUnidadesWrite)
 	if !perm {
 		respondWithError(w, http.StatusForbidden, "No autorizado")
 		return
 	}
-	_, err := h.unidadSvc.DeleteUnidad(req.ID)
+	_, err = h.unidadSvc.DeleteUnidad(req.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
-	h.loggerSvc.Log(req.AdminUsername, "admin", "ELIMINACIÓN", "Unidades Medida", req.ID)
+	logAction(h.loggerSvc, caller, "ELIMINACIÓN", "Unidades Medida", req.ID)
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Eliminado"})
 }
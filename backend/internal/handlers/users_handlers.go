@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"proyecto/internal/auth"
+	"proyecto/internal/i18n"
 	"proyecto/internal/logger"
 	"proyecto/internal/models"
 	"proyecto/internal/users"
@@ -27,13 +28,14 @@ func NewUserHandler(as auth.AuthService, us users.UserService, ls logger.LoggerS
 
 // AdminUsersHandler: Listar usuarios
 func (h *UserHandler) AdminUsersHandler(w http.ResponseWriter, r *http.Request) {
-	var req models.AdminActionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	caller := currentUser(r)
+	var req models.GetUsersRequest
+	if err := decodeOptionalJSON(r, &req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermUsersRead)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
 		return
@@ -43,30 +45,37 @@ func (h *UserHandler) AdminUsersHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	usersList, err := h.userSvc.GetAllUsers()
+	// Sin proyectos:all solo se listan los usuarios de sus propios proyectos
+	allProjects, err := h.authSvc.CheckPermission(caller, models.PermProyectosAll)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return
+	}
+
+	memberID := 0
+	if !allProjects {
+		memberID = caller.UserID
+	}
+	usersList, page, err := h.userSvc.GetUsers(req, memberID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{"users": usersList})
+	respondWithList(w, "users", usersList, page)
 }
 
 // AdminAddUserHandler: Crear usuario (desde admin)
 func (h *UserHandler) AdminAddUserHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 
-	type AdminAddUserRequest struct {
-		User          models.User `json:"user"`
-		AdminUsername string      `json:"admin_username"`
-	}
-
-	var req AdminAddUserRequest
+	var req models.AddUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermUsersCreate)
 	if err != nil || !hasPermission {
 		respondWithError(w, http.StatusForbidden, "No autorizado")
 		return
@@ -74,49 +83,107 @@ func (h *UserHandler) AdminAddUserHandler(w http.ResponseWriter, r *http.Request
 
 	lastID, err := h.userSvc.AddUser(req.User)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithServiceError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin/gerente", "CREACIÓN", "Usuarios", int(lastID))
+	logAction(h.loggerSvc, caller, "CREACIÓN", "Usuarios", int(lastID))
 
 	respondWithJSON(w, http.StatusCreated, models.SimpleResponse{Mensaje: "Usuario creado exitosamente"})
 }
 
-// AdminDeleteUserHandler: Borrar usuario
-func (h *UserHandler) AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
-	var req models.DeleteUserRequest
+// AdminDeactivateUserHandler: Desactiva un usuario (también atiende /api/admin/delete-user:
+// los usuarios ya no se borran para no perder quién fue encargado de cada actividad)
+func (h *UserHandler) AdminDeactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.SetUserActivoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin")
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermUsersDelete)
 	if err != nil || !hasPermission {
 		respondWithError(w, http.StatusForbidden, "No autorizado (Solo Admin)")
 		return
 	}
 
-	_, err = h.userSvc.DeleteUser(req.ID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+	if err := h.userSvc.DeactivateUser(req.ID, caller.UserID); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Cualquier sesión abierta del usuario desactivado deja de ser válida
+	if err := h.authSvc.RevokeUserTokens(req.ID); err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "DESACTIVACIÓN", "Usuarios", req.ID)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Usuario desactivado"})
+}
+
+// AdminReactivateUserHandler: Reactiva un usuario desactivado
+func (h *UserHandler) AdminReactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.SetUserActivoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermUsersDelete)
+	if err != nil || !hasPermission {
+		respondWithError(w, http.StatusForbidden, "No autorizado (Solo Admin)")
+		return
+	}
+
+	if err := h.userSvc.ReactivateUser(req.ID); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin", "ELIMINACIÓN", "Usuarios", req.ID)
+	logAction(h.loggerSvc, caller, "REACTIVACIÓN", "Usuarios", req.ID)
 
-	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Usuario eliminado"})
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Usuario reactivado"})
+}
+
+// AdminUpdateUserProfileHandler: Edita nombre, apellido y cédula de un usuario
+func (h *UserHandler) AdminUpdateUserProfileHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.UpdateUserProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermUsersUpdate)
+	if err != nil || !hasPermission {
+		respondWithError(w, http.StatusForbidden, "No autorizado (Solo Admin)")
+		return
+	}
+
+	if err := h.userSvc.UpdateUserProfile(req); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "MODIFICACIÓN (Perfil)", "Usuarios", req.ID)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Usuario actualizado"})
 }
 
 // AdminUpdateUserRoleHandler: Actualizar rol de usuario
 func (h *UserHandler) AdminUpdateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.UpdateRoleRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin")
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermUsersUpdateRole)
 	if err != nil || !hasPermission {
 		respondWithError(w, http.StatusForbidden, "No autorizado (Solo Admin)")
 		return
@@ -124,24 +191,119 @@ func (h *UserHandler) AdminUpdateUserRoleHandler(w http.ResponseWriter, r *http.
 
 	_, err = h.userSvc.UpdateUserRole(req.ID, req.NewRole)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	h.loggerSvc.Log(req.AdminUsername, "admin", "CAMBIO ROL", "Usuarios", req.ID)
+	// Obliga a iniciar sesión de nuevo para que el token refleje el rol nuevo
+	if err := h.authSvc.RevokeUserTokens(req.ID); err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "CAMBIO ROL", "Usuarios", req.ID)
 
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Rol actualizado"})
 }
 
+// AdminResetPasswordHandler: Asigna una contraseña temporal a un usuario
+func (h *UserHandler) AdminResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermUsersResetPassword)
+	if err != nil || !hasPermission {
+		respondWithError(w, http.StatusForbidden, "No autorizado (Solo Admin)")
+		return
+	}
+
+	temporary, err := h.authSvc.ResetPassword(req.ID)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "RESTABLECER CONTRASEÑA", "Usuarios", req.ID)
+
+	respondWithJSON(w, http.StatusOK, models.ResetPasswordResponse{
+		Mensaje:           "Contraseña restablecida. El usuario deberá cambiarla al iniciar sesión.",
+		TemporaryPassword: temporary,
+	})
+}
+
+// AdminUnlockUserHandler: Quita el bloqueo por intentos fallidos de login
+func (h *UserHandler) AdminUnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.UnlockUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermUsersUnlock)
+	if err != nil || !hasPermission {
+		respondWithError(w, http.StatusForbidden, "No autorizado (Solo Admin)")
+		return
+	}
+
+	if err := h.authSvc.UnlockUser(req.ID); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "DESBLOQUEO CUENTA", "Usuarios", req.ID)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Cuenta desbloqueada"})
+}
+
+// AdminImpersonateHandler: emite un token para ver el sistema como otro usuario (soporte).
+// Todo lo que se haga con ese token queda en el log con ambas identidades.
+func (h *UserHandler) AdminImpersonateHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.ImpersonateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermUsersImpersonate)
+	if err != nil || !hasPermission {
+		respondWithError(w, http.StatusForbidden, "No autorizado (Solo Admin)")
+		return
+	}
+
+	resp, err := h.authSvc.Impersonate(caller, req.UserID)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "INICIO SUPLANTACIÓN", "Usuarios", req.UserID)
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
 // AdminAssignProjectToUserHandler: Asignar usuario a proyecto
 func (h *UserHandler) AdminAssignProjectToUserHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
 	var req models.AssignProjectRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	hasPermission, err := h.authSvc.CheckPermission(req.AdminUsername, "admin", "gerente")
+	// Quitar de todos los proyectos (proyecto_id 0) no tiene un proyecto donde evaluar el rol
+	var hasPermission bool
+	var err error
+	if req.ProyectoID == 0 {
+		hasPermission, err = h.authSvc.CheckPermission(caller, models.PermUsersAssignProject)
+	} else {
+		hasPermission, err = h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermUsersAssignProject)
+	}
 	if err != nil || !hasPermission {
 		respondWithError(w, http.StatusForbidden, "No autorizado")
 		return
@@ -149,29 +311,173 @@ func (h *UserHandler) AdminAssignProjectToUserHandler(w http.ResponseWriter, r *
 
 	_, err = h.userSvc.AssignProjectToUser(req.UserID, req.ProyectoID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	logMsg := fmt.Sprintf("ASIGNACIÓN PROYECTO %d", req.ProyectoID)
-	h.loggerSvc.Log(req.AdminUsername, "admin/gerente", logMsg, "Usuarios", req.UserID)
+	logAction(h.loggerSvc, caller, logMsg, "Usuarios", req.UserID)
 
 	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Asignación actualizada"})
 }
 
+// GetProjectMembersHandler: Miembros de un proyecto con su rol en él
+func (h *UserHandler) GetProjectMembersHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.GetProjectMembersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermProyectosRead)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return
+	}
+	if !hasPermission {
+		respondWithError(w, http.StatusForbidden, "acceso denegado")
+		return
+	}
+
+	members, err := h.userSvc.GetProjectMembers(req.ProyectoID)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"miembros": members})
+}
+
+// AddProjectMemberHandler: Agrega un usuario a un proyecto (o cambia su rol en él)
+func (h *UserHandler) AddProjectMemberHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.AddProjectMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermUsersAssignProject)
+	if err != nil || !hasPermission {
+		respondWithError(w, http.StatusForbidden, "No autorizado")
+		return
+	}
+	if req.UserID == caller.UserID {
+		respondWithError(w, http.StatusForbidden, "no puede cambiar su propia asignación al proyecto")
+		return
+	}
+
+	role, explicit, err := h.userSvc.ProjectMemberRole(req.UserID, req.Role)
+	if err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+	// Un rol distinto del global es un cambio de rol
+	if explicit {
+		canChangeRole, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermUsersUpdateRole)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+			return
+		}
+		if !canChangeRole {
+			respondWithError(w, http.StatusForbidden, "se requiere users:update-role para asignar otro rol")
+			return
+		}
+	}
+	canGrant, err := h.authSvc.CanGrantProjectRole(caller, req.ProyectoID, role)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return
+	}
+	if !canGrant {
+		respondWithError(w, http.StatusForbidden, "no puede asignar un rol con permisos que no tiene en el proyecto")
+		return
+	}
+
+	if err := h.userSvc.AddProjectMember(req.UserID, req.ProyectoID, role); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logMsg := fmt.Sprintf("ALTA MIEMBRO PROYECTO %d", req.ProyectoID)
+	logAction(h.loggerSvc, caller, logMsg, "Usuarios", req.UserID)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Miembro agregado al proyecto"})
+}
+
+// RemoveProjectMemberHandler: Quita a un usuario de un proyecto
+func (h *UserHandler) RemoveProjectMemberHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.RemoveProjectMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+
+	hasPermission, err := h.authSvc.CheckProjectPermission(caller, req.ProyectoID, models.PermUsersAssignProject)
+	if err != nil || !hasPermission {
+		respondWithError(w, http.StatusForbidden, "No autorizado")
+		return
+	}
+
+	if _, err := h.userSvc.RemoveProjectMember(req.UserID, req.ProyectoID); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logMsg := fmt.Sprintf("BAJA MIEMBRO PROYECTO %d", req.ProyectoID)
+	logAction(h.loggerSvc, caller, logMsg, "Usuarios", req.UserID)
+
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Miembro quitado del proyecto"})
+}
+
 // UserProjectDetailsHandler: Dashboard de usuario
 func (h *UserHandler) UserProjectDetailsHandler(w http.ResponseWriter, r *http.Request) {
-	var req models.UserProjectDetailsRequest
+	// El usuario solo puede consultar sus propios proyectos (los del token)
+	caller := currentUser(r)
+
+	response, err := h.userSvc.GetProjectDetailsForUser(caller.UserID)
+	if err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// GetPreferencesHandler: preferencias de la propia cuenta
+func (h *UserHandler) GetPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+
+	prefs, err := h.userSvc.GetPreferences(caller.UserID)
+	if err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, prefs)
+}
+
+// SetPreferencesHandler: cambia las preferencias de la propia cuenta; la misma
+// respuesta ya sale en el idioma elegido
+func (h *UserHandler) SetPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.UserPreferences
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
 		return
 	}
 
-	response, err := h.userSvc.GetProjectDetailsForUser(req.UserID)
+	prefs, err := h.userSvc.SetPreferences(caller.UserID, req)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithServiceError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, response)
+	logAction(h.loggerSvc, caller, "MODIFICACIÓN (Preferencias)", "Usuarios", caller.UserID)
+
+	if lang, ok := i18n.Parse(prefs.Idioma); ok {
+		setLanguage(w, lang)
+	}
+	respondWithJSON(w, http.StatusOK, prefs)
 }
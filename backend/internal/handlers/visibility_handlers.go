@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"proyecto/internal/auth"
+	"proyecto/internal/logger"
+	"proyecto/internal/models"
+	"proyecto/internal/visibility"
+)
+
+type VisibilityHandler struct {
+	authSvc       auth.AuthService
+	visibilitySvc visibility.VisibilityService
+	loggerSvc     logger.LoggerService
+}
+
+func NewVisibilityHandler(as auth.AuthService, vs visibility.VisibilityService, ls logger.LoggerService) *VisibilityHandler {
+	return &VisibilityHandler{
+		authSvc:       as,
+		visibilitySvc: vs,
+		loggerSvc:     ls,
+	}
+}
+
+// canManageVisibility: los campos ocultos son parte de la configuración de roles (roles:manage)
+func (h *VisibilityHandler) canManageVisibility(w http.ResponseWriter, r *http.Request) bool {
+	caller := currentUser(r)
+	hasPermission, err := h.authSvc.CheckPermission(caller, models.PermRolesManage)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error verificando permisos")
+		return false
+	}
+	if !hasPermission {
+		respondWithError(w, http.StatusForbidden, "acceso denegado")
+		return false
+	}
+	return true
+}
+
+// GetFieldVisibilityHandler: Lista los campos ocultos por rol y entidad
+func (h *VisibilityHandler) GetFieldVisibilityHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageVisibility(w, r) {
+		return
+	}
+
+	list, err := h.visibilitySvc.GetHiddenFields()
+	if err != nil {
+		respondWithServiceError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"campos_ocultos": list})
+}
+
+// SetFieldVisibilityHandler: Reemplaza los campos ocultos de una entidad para un rol
+func (h *VisibilityHandler) SetFieldVisibilityHandler(w http.ResponseWriter, r *http.Request) {
+	caller := currentUser(r)
+	var req models.FieldVisibility
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "formato JSON inválido")
+		return
+	}
+	if !h.canManageVisibility(w, r) {
+		return
+	}
+
+	if err := h.visibilitySvc.SetHiddenFields(req); err != nil {
+		respondWithServiceError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logAction(h.loggerSvc, caller, "CAMBIO VISIBILIDAD", "Roles", 0)
+	respondWithJSON(w, http.StatusOK, models.SimpleResponse{Mensaje: "Campos ocultos actualizados"})
+}
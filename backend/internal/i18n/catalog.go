@@ -0,0 +1,62 @@
+package i18n
+
+// catalog: mensajes por code de error (apperrors.Code) y por código de detalle
+// de campo (apperrors.FieldRequired, ...). Un idioma nuevo necesita un texto
+// para cada clave.
+var catalog = map[string]map[Lang]string{
+	// Codes de error
+	"bad_request": {
+		Spanish: "La petición no es válida.",
+		English: "The request is not valid.",
+	},
+	"validation_failed": {
+		Spanish: "Hay campos requeridos o con valores no válidos.",
+		English: "Some fields are missing or have invalid values.",
+	},
+	"unauthorized": {
+		Spanish: "Se requiere autenticación o las credenciales no son válidas.",
+		English: "Authentication is required or the credentials are not valid.",
+	},
+	"forbidden": {
+		Spanish: "Acceso denegado.",
+		English: "Access denied.",
+	},
+	"not_found": {
+		Spanish: "El registro no existe.",
+		English: "The requested record does not exist.",
+	},
+	"conflict": {
+		Spanish: "La operación entra en conflicto con un registro existente.",
+		English: "The request conflicts with an existing record.",
+	},
+	"too_many_requests": {
+		Spanish: "Demasiados intentos; vuelva a intentarlo más tarde.",
+		English: "Too many attempts; please try again later.",
+	},
+	"internal_error": {
+		Spanish: "Error interno del servidor.",
+		English: "Internal server error.",
+	},
+	"bad_gateway": {
+		Spanish: "Falló un servicio externo.",
+		English: "An external service failed.",
+	},
+	"service_unavailable": {
+		Spanish: "El servicio aún no está disponible.",
+		English: "The service is not available yet.",
+	},
+
+	// Detalles por campo
+	"required": {
+		Spanish: "campo requerido",
+		English: "field is required",
+	},
+	"invalid": {
+		Spanish: "valor no válido",
+		English: "invalid value",
+	},
+	"duplicate": {
+		Spanish: "ya está en uso",
+		English: "already in use",
+	},
+}
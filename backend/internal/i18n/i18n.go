@@ -0,0 +1,89 @@
+package i18n
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//  IDIOMAS DE LA API
+// Los servicios escriben sus mensajes en español. Las respuestas de error se
+// traducen con el catálogo de este paquete, que tiene un texto por cada code
+// estable de error (ver internal/apperrors) y por cada código de detalle de campo.
+
+// Lang: etiqueta de idioma (ISO 639-1)
+type Lang string
+
+const (
+	Spanish Lang = "es"
+	English Lang = "en"
+
+	// Default: idioma de los mensajes de los servicios y de los clientes que no piden otro
+	Default = Spanish
+)
+
+// Supported: idiomas con catálogo, en orden de preferencia
+func Supported() []Lang {
+	return []Lang{Spanish, English}
+}
+
+// Parse reconoce una etiqueta de idioma ("en", "en-US", "ES") entre los soportados
+func Parse(tag string) (Lang, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	for _, lang := range Supported() {
+		if Lang(tag) == lang {
+			return lang, true
+		}
+	}
+	return "", false
+}
+
+// Negotiate elige el idioma de una cabecera Accept-Language según sus pesos (q);
+// sin cabecera o sin ningún idioma soportado, Default
+func Negotiate(acceptLanguage string) Lang {
+	type candidate struct {
+		lang Lang
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		lang, ok := Parse(tag)
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{lang, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return Default
+	}
+	// Con el mismo peso gana el que aparece primero en la cabecera
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].lang
+}
+
+// Message: texto de key (un code de error o de detalle) en lang; si lang no lo
+// tiene, el del idioma por defecto. ok es falso si key no está en el catálogo.
+func Message(lang Lang, key string) (string, bool) {
+	texts, ok := catalog[key]
+	if !ok {
+		return "", false
+	}
+	if text, ok := texts[lang]; ok {
+		return text, true
+	}
+	return texts[Default], true
+}
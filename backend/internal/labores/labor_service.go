@@ -1,21 +1,23 @@
 package labores
 
 import (
+	"database/sql"
 	"errors"
 	"log"
 	"strconv"
-	"strings"
 
+	"proyecto/internal/apperrors"
 	"proyecto/internal/database"
 	"proyecto/internal/models"
 )
 
 // 1. EL CONTRATO (Interface)
 type LaborService interface {
-	GetLaboresByProyectoID(proyectoID int) ([]models.LaborAgronomica, error)
+	GetLabores(req models.GetLaboresRequest) ([]models.LaborAgronomica, *models.Page, error)
 	CreateLabor(req models.CreateLaborRequest) (*models.LaborAgronomica, error)
 	UpdateLabor(req models.UpdateLaborRequest) (int64, error)
 	DeleteLabor(id int) (int64, error)
+	GetLaborProyectoID(id int) (int, error)
 }
 
 // 2. LA IMPLEMENTACIÓN (Struct)
@@ -30,22 +32,27 @@ func NewLaborService() LaborService {
 
 //  4. LOS MÉTODOS (Lógica de Negocio)
 
-func (s *laborService) GetLaboresByProyectoID(proyectoID int) ([]models.LaborAgronomica, error) {
-	if proyectoID == 0 {
-		return nil, errors.New("id de proyecto requerido")
+func (s *laborService) GetLabores(req models.GetLaboresRequest) ([]models.LaborAgronomica, *models.Page, error) {
+	if req.ProyectoID == 0 {
+		return nil, nil, apperrors.Required("proyecto_id", "id de proyecto requerido")
 	}
-	labores, err := database.GetLaboresByProyectoID(proyectoID)
+	labores, page, err := database.GetLabores(req)
 	if err != nil {
-		log.Printf("Error en laborService.GetLaboresByProyectoID: %v", err)
-		return nil, errors.New("error al obtener labores")
+		if _, ok := apperrors.As(err); ok {
+			return nil, nil, err
+		}
+		log.Printf("Error en laborService.GetLabores: %v", err)
+		return nil, nil, errors.New("error al obtener labores")
 	}
-	return labores, nil
+	return labores, page, nil
 }
 
 func (s *laborService) CreateLabor(req models.CreateLaborRequest) (*models.LaborAgronomica, error) {
-
-	if req.ProyectoID == 0 || req.Descripcion == "" {
-		return nil, errors.New("ProyectoID y Descripcion son requeridos")
+	var check apperrors.Check
+	check.Required("proyecto_id", req.ProyectoID != 0)
+	check.Required("descripcion", req.Descripcion != "")
+	if err := check.Err("ProyectoID y Descripcion son requeridos"); err != nil {
+		return nil, err
 	}
 
 	nextCodigoInt, err := database.GetNextLaborCodigo(req.ProyectoID)
@@ -66,9 +73,8 @@ func (s *laborService) CreateLabor(req models.CreateLaborRequest) (*models.Labor
 	laborID, err := database.CreateLabor(labor)
 	if err != nil {
 		log.Printf("Error en laborService.CreateLabor (CreateLabor): %v", err)
-
-		if strings.Contains(err.Error(), "ya existe") {
-			return nil, errors.New("el código de labor ya existe")
+		if apperrors.Is(err, apperrors.CodeConflict) {
+			return nil, err
 		}
 		return nil, errors.New("error al crear la labor")
 	}
@@ -83,27 +89,32 @@ func (s *laborService) CreateLabor(req models.CreateLaborRequest) (*models.Labor
 }
 
 func (s *laborService) UpdateLabor(req models.UpdateLaborRequest) (int64, error) {
-	if req.ID == 0 || req.CodigoLabor == "" || req.Descripcion == "" || req.Estado == "" {
-		return 0, errors.New("ID, Código, Descripcion y Estado son requeridos")
+	var check apperrors.Check
+	check.Required("id", req.ID != 0)
+	check.Required("codigo_labor", req.CodigoLabor != "")
+	check.Required("descripcion", req.Descripcion != "")
+	check.Required("estado", req.Estado != "")
+	if err := check.Err("ID, Código, Descripcion y Estado son requeridos"); err != nil {
+		return 0, err
 	}
 
 	affected, err := database.UpdateLabor(req.ID, req.CodigoLabor, req.Descripcion, req.Estado)
 	if err != nil {
 		log.Printf("Error en laborService.UpdateLabor (ID %d): %v", req.ID, err)
-		if strings.Contains(err.Error(), "ya existe") {
-			return 0, errors.New("el código de labor ya existe para este proyecto")
+		if apperrors.Is(err, apperrors.CodeConflict) {
+			return 0, err
 		}
 		return 0, errors.New("error al actualizar la labor")
 	}
 	if affected == 0 {
-		return 0, errors.New("labor no encontrada")
+		return 0, apperrors.NotFound("labor no encontrada")
 	}
 	return affected, nil
 }
 
 func (s *laborService) DeleteLabor(id int) (int64, error) {
 	if id == 0 {
-		return 0, errors.New("id de labor requerido")
+		return 0, apperrors.Required("id", "id de labor requerido")
 	}
 	affected, err := database.DeleteLabor(id)
 	if err != nil {
@@ -112,3 +123,15 @@ func (s *laborService) DeleteLabor(id int) (int64, error) {
 	}
 	return affected, nil
 }
+
+// GetLaborProyectoID: proyecto dueño del registro (para verificar permisos por proyecto)
+func (s *laborService) GetLaborProyectoID(id int) (int, error) {
+	proyectoID, err := database.GetLaborProyectoID(id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error en laborService.GetLaborProyectoID (ID: %d): %v", id, err)
+		}
+		return 0, apperrors.NotFound("labor no encontrada")
+	}
+	return proyectoID, nil
+}
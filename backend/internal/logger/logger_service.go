@@ -12,8 +12,11 @@ type LoggerService interface {
 	// Log escribe un evento en la base de datos de forma asíncrona
 	Log(usuarioUsername string, usuarioRol string, accion string, entidad string, entidadID int)
 
+	// LogImpersonated es Log para acciones hechas por un admin que suplanta al usuario
+	LogImpersonated(usuarioUsername string, usuarioRol string, suplantadoPor string, accion string, entidad string, entidadID int)
+
 	// GetLogs obtiene los eventos con filtros
-	GetLogs(filtros models.GetLogsRequest) ([]models.EventLogResponse, error)
+	GetLogs(filtros models.GetLogsRequest) ([]models.EventLogResponse, *models.Page, error)
 
 	// DeleteLogs elimina una lista de eventos por sus IDs (Ya lo tenías)
 	DeleteLogs(ids []int) error
@@ -36,6 +39,11 @@ func NewLoggerService() LoggerService {
 
 // Log: Registra un evento en segundo plano
 func (s *loggerService) Log(usuarioUsername string, usuarioRol string, accion string, entidad string, entidadID int) {
+	s.LogImpersonated(usuarioUsername, usuarioRol, "", accion, entidad, entidadID)
+}
+
+// LogImpersonated: como Log, guardando también quién actuaba realmente
+func (s *loggerService) LogImpersonated(usuarioUsername string, usuarioRol string, suplantadoPor string, accion string, entidad string, entidadID int) {
 
 	logEntry := models.EventLog{
 		UsuarioUsername: usuarioUsername,
@@ -43,6 +51,7 @@ func (s *loggerService) Log(usuarioUsername string, usuarioRol string, accion st
 		Accion:          accion,
 		Entidad:         entidad,
 		EntidadID:       entidadID,
+		SuplantadoPor:   suplantadoPor,
 	}
 
 	// Usamos una goroutine (go func()) para que el log no detenga la operación principal
@@ -56,7 +65,7 @@ func (s *loggerService) Log(usuarioUsername string, usuarioRol string, accion st
 }
 
 // GetLogs: Obtiene logs filtrados
-func (s *loggerService) GetLogs(filtros models.GetLogsRequest) ([]models.EventLogResponse, error) {
+func (s *loggerService) GetLogs(filtros models.GetLogsRequest) ([]models.EventLogResponse, *models.Page, error) {
 	return database.GetLogs(filtros)
 }
 
@@ -0,0 +1,87 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"proyecto/internal/database"
+	"proyecto/internal/models"
+)
+
+// envOutboxDir: si se define, los correos se escriben como archivos .eml en ese directorio
+const envOutboxDir = "MAIL_OUTBOX_DIR"
+
+// 1. EL CONTRATO (Interface)
+// Sender entrega un correo. Cambiar de implementación (SMTP, API externa...)
+// no requiere tocar los servicios que envían correos.
+type Sender interface {
+	Send(msg models.MailMessage) error
+}
+
+// 2. LAS IMPLEMENTACIONES
+
+// outboxSender guarda los correos en la tabla mail_outbox (sin servidor SMTP)
+type outboxSender struct{}
+
+// directorySender escribe cada correo como un archivo .eml
+type directorySender struct {
+	dir string
+}
+
+// 3. LOS CONSTRUCTORES
+func NewOutboxSender() Sender {
+	return &outboxSender{}
+}
+
+func NewDirectorySender(dir string) Sender {
+	return &directorySender{dir: dir}
+}
+
+// NewSenderFromEnv elige el sender por defecto según la configuración
+func NewSenderFromEnv() Sender {
+	if dir := os.Getenv(envOutboxDir); dir != "" {
+		log.Printf("📧 Correos salientes en el directorio %s", dir)
+		return NewDirectorySender(dir)
+	}
+	return NewOutboxSender()
+}
+
+//  4. LOS MÉTODOS
+
+func (s *outboxSender) Send(msg models.MailMessage) error {
+	if _, err := database.InsertOutboxMail(msg); err != nil {
+		log.Printf("Error en outboxSender.Send (%s): %v", msg.To, err)
+		return fmt.Errorf("error al encolar el correo: %w", err)
+	}
+	return nil
+}
+
+func (s *directorySender) Send(msg models.MailMessage) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("error al crear el directorio de salida: %w", err)
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s_%s.eml", now.Format("20060102T150405.000000000"), sanitizeFileName(msg.To))
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		msg.To, msg.Subject, now.Format(time.RFC1123Z), msg.Body)
+
+	if err := os.WriteFile(filepath.Join(s.dir, name), []byte(content), 0o600); err != nil {
+		log.Printf("Error en directorySender.Send (%s): %v", msg.To, err)
+		return fmt.Errorf("error al escribir el correo: %w", err)
+	}
+	return nil
+}
+
+func sanitizeFileName(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, value)
+}
@@ -2,6 +2,10 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -14,65 +18,103 @@ type User struct {
 	Nombre   string `json:"nombre"`
 	Apellido string `json:"apellido"`
 	Cedula   string `json:"cedula"`
+	Email    string `json:"email,omitempty"` // Opcional: necesario para recuperar la contraseña
+	// InvitationCode: obligatorio si el registro abierto está desactivado; define rol y proyecto
+	InvitationCode string `json:"invitation_code,omitempty"`
 }
 
 type UserDB struct {
-	ID             int
-	Username       string
-	HashedPassword string
-	Role           string
-	Nombre         string
-	Apellido       string
-	Cedula         string
-	ProyectoID     sql.NullInt64
+	ID                 int
+	Username           string
+	HashedPassword     string
+	Role               string
+	Nombre             string
+	Apellido           string
+	Cedula             string
+	ProyectoID         sql.NullInt64
+	MustChangePassword bool
+	Email              string
+	TOTPEnabled        bool
+	EsServicio         bool   // Cuenta de servicio: no inicia sesión con contraseña
+	Activo             bool   // false = cuenta desactivada (no inicia sesión, no aparece como encargado)
+	Idioma             string // Idioma preferido de los mensajes ("" = el de Accept-Language)
+}
+
+// GetUsersRequest: filtros del listado de usuarios
+type GetUsersRequest struct {
+	ListParams
+	Role   string `json:"role,omitempty"`
+	Activo string `json:"activo,omitempty"` // "true" o "false"; vacío = todos
 }
 
 type UserListResponse struct {
-	ID             int     `json:"id"`
-	Username       string  `json:"username"`
-	Role           string  `json:"role"`
-	Nombre         string  `json:"nombre"`
-	Apellido       string  `json:"apellido"`
-	Cedula         string  `json:"cedula"`
-	ProyectoID     *int    `json:"proyecto_id"`
-	ProyectoNombre *string `json:"proyecto_nombre"`
+	ID             int              `json:"id"`
+	Username       string           `json:"username"`
+	Role           string           `json:"role"`
+	Nombre         string           `json:"nombre"`
+	Apellido       string           `json:"apellido"`
+	Cedula         string           `json:"cedula"`
+	Activo         bool             `json:"activo"`
+	ProyectoID     *int             `json:"proyecto_id"`     // Primer proyecto asignado (compatibilidad)
+	ProyectoNombre *string          `json:"proyecto_nombre"` // Nombre del primer proyecto asignado
+	LockedUntil    *string          `json:"locked_until"`    // Solo si la cuenta está bloqueada ahora
+	LastLogin      *string          `json:"last_login"`      // Último inicio de sesión (nil si nunca entró)
+	Proyectos      []UserProjectRef `json:"proyectos"`
+}
+
+// UserProjectRef: un proyecto al que pertenece el usuario y su rol en él
+type UserProjectRef struct {
+	ProyectoID int    `json:"proyecto_id"`
+	Nombre     string `json:"nombre"`
+	Role       string `json:"role"`
 }
 
 type UpdateRoleRequest struct {
-	ID            int    `json:"id"`
-	NewRole       string `json:"new_role"`
-	AdminUsername string `json:"admin_username"`
+	ID      int    `json:"id"`
+	NewRole string `json:"new_role"`
 }
 
-type AdminActionRequest struct {
-	AdminUsername string `json:"admin_username"`
+type AddUserRequest struct {
+	User User `json:"user"`
 }
 
-type AddUserRequest struct {
-	User          User   `json:"user"`
-	AdminUsername string `json:"admin_username"`
+// SetUserActivoRequest: desactivar o reactivar una cuenta
+type SetUserActivoRequest struct {
+	ID int `json:"id"`
 }
 
-type DeleteUserRequest struct {
-	ID            int    `json:"id"`
-	AdminUsername string `json:"admin_username"`
+type UpdateUserProfileRequest struct {
+	ID       int    `json:"id"`
+	Nombre   string `json:"nombre"`
+	Apellido string `json:"apellido"`
+	Cedula   string `json:"cedula"`
 }
 
 type AssignProjectRequest struct {
-	UserID        int    `json:"user_id"`
-	ProyectoID    int    `json:"proyecto_id"`
-	AdminUsername string `json:"admin_username"`
+	UserID     int `json:"user_id"`
+	ProyectoID int `json:"proyecto_id"`
 }
 
-// Para el dashboard del rol 'user'
-type UserProjectDetailsRequest struct {
-	UserID int `json:"user_id"`
+// UserPreferences: preferencias de la cuenta del usuario autenticado
+type UserPreferences struct {
+	// Idioma de los mensajes de error ("es" o "en"); vacío = el de la cabecera Accept-Language
+	Idioma string `json:"idioma"`
 }
 
 type UserProjectDetailsResponse struct {
-	Proyecto *Proyecto       `json:"proyecto"` // Puede ser nil si no tiene proyecto
-	Gerentes []ProjectMember `json:"gerentes"` // Lista de gerentes
-	Miembros []ProjectMember `json:"miembros"` // Lista de compañeros
+	// Proyecto, Gerentes y Miembros describen el primer proyecto (compatibilidad con el dashboard)
+	Proyecto  *Proyecto        `json:"proyecto"` // Puede ser nil si no tiene proyecto
+	Gerentes  []ProjectMember  `json:"gerentes"` // Lista de gerentes
+	Miembros  []ProjectMember  `json:"miembros"` // Lista de compañeros
+	Proyectos []ProjectDetails `json:"proyectos"`
+}
+
+// ProjectDetails: un proyecto del usuario con su rol y sus compañeros
+type ProjectDetails struct {
+	Proyecto Proyecto        `json:"proyecto"`
+	Role     string          `json:"role"`
+	Gerentes []ProjectMember `json:"gerentes"`
+	Miembros []ProjectMember `json:"miembros"`
 }
 
 type ProjectMember struct {
@@ -80,6 +122,23 @@ type ProjectMember struct {
 	Username string `json:"username"`
 	Nombre   string `json:"nombre"`
 	Apellido string `json:"apellido"`
+	Role     string `json:"role,omitempty"` // Rol dentro del proyecto
+}
+
+type GetProjectMembersRequest struct {
+	ProyectoID int `json:"proyecto_id"`
+}
+
+// AddProjectMemberRequest: si Role está vacío se usa el rol global del usuario
+type AddProjectMemberRequest struct {
+	UserID     int    `json:"user_id"`
+	ProyectoID int    `json:"proyecto_id"`
+	Role       string `json:"role"`
+}
+
+type RemoveProjectMemberRequest struct {
+	UserID     int `json:"user_id"`
+	ProyectoID int `json:"proyecto_id"`
 }
 
 // --- Proyectos ---
@@ -92,30 +151,32 @@ type Proyecto struct {
 	FechaCreacion string `json:"fecha_creacion"`
 }
 
+// GetProyectosRequest: filtros del listado de proyectos
+type GetProyectosRequest struct {
+	ListParams
+	Estado string `json:"estado,omitempty"`
+}
+
 type CreateProyectoRequest struct {
-	Nombre        string `json:"nombre"`
-	FechaInicio   string `json:"fecha_inicio"`
-	FechaCierre   string `json:"fecha_cierre"`
-	AdminUsername string `json:"admin_username"`
+	Nombre      string `json:"nombre"`
+	FechaInicio string `json:"fecha_inicio"`
+	FechaCierre string `json:"fecha_cierre"`
 }
 
 type UpdateProyectoRequest struct {
-	ID            int    `json:"id"`
-	Nombre        string `json:"nombre"`
-	FechaInicio   string `json:"fecha_inicio"`
-	FechaCierre   string `json:"fecha_cierre"`
-	AdminUsername string `json:"admin_username"`
+	ID          int    `json:"id"`
+	Nombre      string `json:"nombre"`
+	FechaInicio string `json:"fecha_inicio"`
+	FechaCierre string `json:"fecha_cierre"`
 }
 
 type DeleteProyectoRequest struct {
-	ID            int    `json:"id"`
-	AdminUsername string `json:"admin_username"`
+	ID int `json:"id"`
 }
 
 type SetProyectoEstadoRequest struct {
-	ID            int    `json:"id"`
-	Estado        string `json:"estado"`
-	AdminUsername string `json:"admin_username"`
+	ID     int    `json:"id"`
+	Estado string `json:"estado"`
 }
 
 type LaborAgronomica struct {
@@ -128,28 +189,26 @@ type LaborAgronomica struct {
 }
 
 type GetLaboresRequest struct {
-	ProyectoID    int    `json:"proyecto_id"`
-	AdminUsername string `json:"admin_username"`
+	ListParams
+	ProyectoID int    `json:"proyecto_id"`
+	Estado     string `json:"estado,omitempty"`
 }
 
 type CreateLaborRequest struct {
-	ProyectoID    int    `json:"proyecto_id"`
-	Descripcion   string `json:"descripcion"`
-	Estado        string `json:"estado"`
-	AdminUsername string `json:"admin_username"`
+	ProyectoID  int    `json:"proyecto_id"`
+	Descripcion string `json:"descripcion"`
+	Estado      string `json:"estado"`
 }
 
 type UpdateLaborRequest struct {
-	ID            int    `json:"id"`
-	CodigoLabor   string `json:"codigo_labor"`
-	Descripcion   string `json:"descripcion"`
-	Estado        string `json:"estado"`
-	AdminUsername string `json:"admin_username"`
+	ID          int    `json:"id"`
+	CodigoLabor string `json:"codigo_labor"`
+	Descripcion string `json:"descripcion"`
+	Estado      string `json:"estado"`
 }
 
 type DeleteLaborRequest struct {
-	ID            int    `json:"id"`
-	AdminUsername string `json:"admin_username"`
+	ID int `json:"id"`
 }
 
 type EquipoImplemento struct {
@@ -163,30 +222,29 @@ type EquipoImplemento struct {
 }
 
 type GetEquiposRequest struct {
-	ProyectoID    int    `json:"proyecto_id"`
-	AdminUsername string `json:"admin_username"`
+	ListParams
+	ProyectoID int    `json:"proyecto_id"`
+	Tipo       string `json:"tipo,omitempty"`
+	Estado     string `json:"estado,omitempty"`
 }
 
 type CreateEquipoRequest struct {
-	ProyectoID    int    `json:"proyecto_id"`
-	Nombre        string `json:"nombre"`
-	Tipo          string `json:"tipo"`
-	Estado        string `json:"estado"`
-	AdminUsername string `json:"admin_username"`
+	ProyectoID int    `json:"proyecto_id"`
+	Nombre     string `json:"nombre"`
+	Tipo       string `json:"tipo"`
+	Estado     string `json:"estado"`
 }
 
 type UpdateEquipoRequest struct {
-	ID            int    `json:"id"`
-	CodigoEquipo  string `json:"codigo_equipo"`
-	Nombre        string `json:"nombre"`
-	Tipo          string `json:"tipo"`
-	Estado        string `json:"estado"`
-	AdminUsername string `json:"admin_username"`
+	ID           int    `json:"id"`
+	CodigoEquipo string `json:"codigo_equipo"`
+	Nombre       string `json:"nombre"`
+	Tipo         string `json:"tipo"`
+	Estado       string `json:"estado"`
 }
 
 type DeleteEquipoRequest struct {
-	ID            int    `json:"id"`
-	AdminUsername string `json:"admin_username"`
+	ID int `json:"id"`
 }
 
 type Actividad struct {
@@ -226,8 +284,11 @@ type EncargadoResponse struct {
 }
 
 type GetDatosProyectoRequest struct {
-	ProyectoID    int    `json:"proyecto_id"`
-	AdminUsername string `json:"admin_username"`
+	ListParams
+	ProyectoID         int    `json:"proyecto_id"`
+	LaborAgronomicaID  string `json:"labor_agronomica_id,omitempty"`
+	EquipoImplementoID string `json:"equipo_implemento_id,omitempty"`
+	EncargadoID        string `json:"encargado_id,omitempty"`
 }
 
 type CreateActividadRequest struct {
@@ -239,7 +300,6 @@ type CreateActividadRequest struct {
 	RecursoHumano      int     `json:"recurso_humano"`
 	Costo              float64 `json:"costo"`
 	Observaciones      string  `json:"observaciones"`
-	AdminUsername      string  `json:"admin_username"`
 }
 
 type UpdateActividadRequest struct {
@@ -252,25 +312,132 @@ type UpdateActividadRequest struct {
 	RecursoHumano      int     `json:"recurso_humano"`
 	Costo              float64 `json:"costo"`
 	Observaciones      string  `json:"observaciones"`
-	AdminUsername      string  `json:"admin_username"`
 }
 
 type DeleteActividadRequest struct {
-	ID            int    `json:"id"`
-	AdminUsername string `json:"admin_username"`
+	ID int `json:"id"`
 }
 
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Role   string `json:"role"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID int    `json:"sid"`
+	// ImpersonatorID: admin que suplanta a UserID; la sesión (sid) es la del admin
+	ImpersonatorID int `json:"imp,omitempty"`
 	jwt.RegisteredClaims
 }
 
 type LoginResponse struct {
-	Token  string      `json:"token"`
-	User   UserDetails `json:"user"`
-	Role   string      `json:"role"`
-	UserId int         `json:"userId"`
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresIn    int         `json:"expires_in"` // Segundos de vida del access token
+	User         UserDetails `json:"user"`
+	Role         string      `json:"role"`
+	UserId       int         `json:"userId"`
+	// ImpersonatedBy: admin que suplanta al usuario (el frontend muestra un aviso)
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
+	// Contraseña temporal: el resto de la API queda bloqueada hasta cambiarla
+	MustChangePassword bool `json:"must_change_password,omitempty"`
+	// El rol exige 2FA y el usuario aún no lo activó: solo puede enrolarse
+	TwoFactorSetupRequired bool `json:"two_factor_setup_required,omitempty"`
+
+	// Paso intermedio del login con 2FA: no hay token todavía, solo el desafío
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
+}
+
+// ChallengeClaims: token corto que solo sirve para completar el segundo factor
+type ChallengeClaims struct {
+	UserID  int    `json:"user_id"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorEnableResponse struct {
+	Mensaje       string   `json:"mensaje"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// TwoFactorVerifyRequest acepta el código TOTP o, en su defecto, un código de recuperación
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+type TwoFactorPolicy struct {
+	RequiredRoles []string `json:"required_roles"`
+}
+
+// RefreshToken es una sesión persistida (solo se guarda el hash del token)
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	ExpiresAt time.Time
+	Revocado  bool
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type UnlockUserRequest struct {
+	ID int `json:"id"`
+}
+
+type ResetPasswordRequest struct {
+	ID int `json:"id"`
+}
+
+type ResetPasswordResponse struct {
+	Mensaje           string `json:"mensaje"`
+	TemporaryPassword string `json:"temporary_password"`
+}
+
+type ForgotPasswordRequest struct {
+	Username string `json:"username"`
+}
+
+type ResetPasswordWithTokenRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// PasswordResetToken es un token de recuperación persistido (solo el hash)
+type PasswordResetToken struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	ExpiresAt time.Time
+	Usado     bool
+}
+
+// MailMessage es un correo saliente (ver internal/mail)
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 type UserDetails struct {
@@ -285,6 +452,62 @@ type SimpleResponse struct {
 	Error   string `json:"error,omitempty"`
 }
 
+// --- Listados ---
+
+// ListParams: paginación, orden y búsqueda comunes a todos los listados. En los
+// GET de /api/v1 llegan en la query (?limit=20&sort=-fecha_creacion); en las
+// rutas antiguas, en el cuerpo.
+type ListParams struct {
+	Limit  QueryInt `json:"limit,omitempty"`  // filas por página; 0 = página por defecto
+	Cursor string   `json:"cursor,omitempty"` // next_cursor de la página anterior
+	Sort   string   `json:"sort,omitempty"`   // campo de orden; "-campo" = descendente
+	Q      string   `json:"q,omitempty"`      // búsqueda por texto
+}
+
+// Page acompaña a cada listado
+type Page struct {
+	NextCursor *string `json:"next_cursor"`     // null en la última página
+	Total      *int    `json:"total,omitempty"` // filas que cumplen los filtros (si es barato contarlas)
+}
+
+// Paged indica si el cliente pidió una página (limit o cursor)
+func (p ListParams) Paged() bool {
+	return p.Limit > 0 || p.Cursor != ""
+}
+
+// QueryInt es un entero que también acepta texto ("20"): los parámetros de la
+// query llegan como texto al cuerpo que lee el handler
+type QueryInt int
+
+func (n *QueryInt) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "" || text == "null" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil {
+		return fmt.Errorf("se esperaba un número entero: %s", data)
+	}
+	*n = QueryInt(v)
+	return nil
+}
+
+// ErrorResponse: cuerpo de todas las respuestas de error. Code es estable (ver
+// apperrors); Details indica los campos que causaron un error de validación o conflicto.
+type ErrorResponse struct {
+	Error   string       `json:"error"`
+	Code    string       `json:"code"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// FieldError: detalle de un campo (code: required, invalid o duplicate)
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 type EventLog struct {
 	ID              int
 	Timestamp       string
@@ -293,20 +516,22 @@ type EventLog struct {
 	Accion          string
 	Entidad         string
 	EntidadID       int
+	SuplantadoPor   string // Admin que actuaba en nombre del usuario (vacío si no)
 }
 
 type EventLogResponse struct {
-	ID              int    `json:"id"`
-	Timestamp       string `json:"timestamp"`
-	UsuarioUsername string `json:"usuario_username"`
-	UsuarioRol      string `json:"usuario_rol"`
-	Accion          string `json:"accion"`
-	Entidad         string `json:"entidad"`
-	EntidadID       int    `json:"entidad_id"`
+	ID              int     `json:"id"`
+	Timestamp       string  `json:"timestamp"`
+	UsuarioUsername string  `json:"usuario_username"`
+	UsuarioRol      string  `json:"usuario_rol"`
+	Accion          string  `json:"accion"`
+	Entidad         string  `json:"entidad"`
+	EntidadID       int     `json:"entidad_id"`
+	SuplantadoPor   *string `json:"suplantado_por"`
 }
 
 type GetLogsRequest struct {
-	AdminUsername   string `json:"admin_username"`
+	ListParams
 	FechaInicio     string `json:"fecha_inicio"`
 	FechaCierre     string `json:"fecha_cierre"`
 	UsuarioUsername string `json:"usuario_username"`
@@ -325,35 +550,39 @@ type UnidadMedida struct {
 }
 
 type CreateUnidadRequest struct {
-	ProyectoID    int     `json:"proyecto_id"`
-	Nombre        string  `json:"nombre"`
-	Abreviatura   string  `json:"abreviatura"`
-	Tipo          string  `json:"tipo"`
-	Dimension     float64 `json:"dimension"`
-	AdminUsername string  `json:"admin_username"`
+	ProyectoID  int     `json:"proyecto_id"`
+	Nombre      string  `json:"nombre"`
+	Abreviatura string  `json:"abreviatura"`
+	Tipo        string  `json:"tipo"`
+	Dimension   float64 `json:"dimension"`
 }
 
 type UpdateUnidadRequest struct {
-	ID            int     `json:"id"`
-	Nombre        string  `json:"nombre"`
-	Abreviatura   string  `json:"abreviatura"`
-	Tipo          string  `json:"tipo"`
-	Dimension     float64 `json:"dimension"`
-	AdminUsername string  `json:"admin_username"`
+	ID          int     `json:"id"`
+	Nombre      string  `json:"nombre"`
+	Abreviatura string  `json:"abreviatura"`
+	Tipo        string  `json:"tipo"`
+	Dimension   float64 `json:"dimension"`
 }
 
 type DeleteUnidadRequest struct {
-	ID            int    `json:"id"`
-	AdminUsername string `json:"admin_username"`
+	ID int `json:"id"`
 }
 type GetUnidadesRequest struct {
-	ProyectoID    int    `json:"proyecto_id"`
-	AdminUsername string `json:"admin_username"`
+	ListParams
+	ProyectoID int    `json:"proyecto_id"`
+	Tipo       string `json:"tipo,omitempty"`
+	Dimension  string `json:"dimension,omitempty"`
 }
 
 type DeleteLogsRequest struct {
-	IDs           []int  `json:"ids"`
-	AdminUsername string `json:"admin_username"`
+	IDs []int `json:"ids"`
+}
+
+// DeleteLogsRangeRequest: rango de fechas de los eventos a borrar
+type DeleteLogsRangeRequest struct {
+	FechaInicio string `json:"fecha_inicio"`
+	FechaFin    string `json:"fecha_fin"`
 }
 
 type PlanAccion struct {
@@ -379,12 +608,29 @@ type CreatePlanRequest struct {
 	Responsable   string  `json:"responsable"`
 	CostoUnitario float64 `json:"costo_unitario"`
 	Monto         float64 `json:"monto"`
-	AdminUsername string  `json:"admin_username"`
+}
+
+type UpdatePlanRequest struct {
+	ID            int     `json:"id"`
+	Actividad     string  `json:"actividad"`
+	Accion        string  `json:"accion"`
+	FechaInicio   string  `json:"fecha_inicio"`
+	FechaCierre   string  `json:"fecha_cierre"`
+	Horas         float64 `json:"horas"`
+	Responsable   string  `json:"responsable"`
+	CostoUnitario float64 `json:"costo_unitario"`
+	Monto         float64 `json:"monto"`
+}
+
+type DeletePlanRequest struct {
+	ID int `json:"id"`
 }
 
 type GetPlanesRequest struct {
-	ProyectoID    int    `json:"proyecto_id"`
-	AdminUsername string `json:"admin_username"`
+	ListParams
+	ProyectoID  int    `json:"proyecto_id"`
+	Actividad   string `json:"actividad,omitempty"`
+	Responsable string `json:"responsable,omitempty"`
 }
 
 type RecursoHumano struct {
@@ -410,7 +656,29 @@ type CreateRecursoRequest struct {
 	Cantidad      float64 `json:"cantidad"`
 	CostoUnitario float64 `json:"costo_unitario"`
 	Monto         float64 `json:"monto"`
-	AdminUsername string  `json:"admin_username"`
+}
+
+type UpdateRecursoRequest struct {
+	ID            int     `json:"id"`
+	Actividad     string  `json:"actividad"`
+	Accion        string  `json:"accion"`
+	Nombre        string  `json:"nombre"`
+	Cedula        string  `json:"cedula"`
+	Tiempo        float64 `json:"tiempo"`
+	Cantidad      float64 `json:"cantidad"`
+	CostoUnitario float64 `json:"costo_unitario"`
+	Monto         float64 `json:"monto"`
+}
+
+type DeleteRecursoRequest struct {
+	ID int `json:"id"`
+}
+
+type GetRecursosRequest struct {
+	ListParams
+	ProyectoID int    `json:"proyecto_id"`
+	Actividad  string `json:"actividad,omitempty"`
+	Cedula     string `json:"cedula,omitempty"`
 }
 
 type MaterialInsumo struct {
@@ -438,10 +706,177 @@ type CreateMaterialRequest struct {
 	Cantidad      float64 `json:"cantidad"`
 	CostoUnitario float64 `json:"costo_unitario"`
 	Monto         float64 `json:"monto"`
-	AdminUsername string  `json:"admin_username"`
+}
+
+// UpdateMaterialRequest: el proyecto_id del cuerpo se ignora (el material no cambia de proyecto)
+type UpdateMaterialRequest struct {
+	CreateMaterialRequest
+	ID int `json:"id"`
+}
+
+type DeleteMaterialRequest struct {
+	ID int `json:"id"`
 }
 
 type GetMaterialesRequest struct {
-	ProyectoID    int    `json:"proyecto_id"`
-	AdminUsername string `json:"admin_username"`
+	ListParams
+	ProyectoID int    `json:"proyecto_id"`
+	Actividad  string `json:"actividad,omitempty"`
+	Categoria  string `json:"categoria,omitempty"`
+}
+
+// --- Cuentas de servicio y API keys ---
+
+// ServiceAccount es un usuario no humano (integraciones) que se autentica con API keys
+type ServiceAccount struct {
+	ID       int      `json:"id"`
+	Username string   `json:"username"`
+	Nombre   string   `json:"nombre"`
+	Role     string   `json:"role"`
+	Keys     []APIKey `json:"keys"`
+}
+
+// APIKey describe una llave sin exponer el secreto (solo se muestra al crearla)
+type APIKey struct {
+	ID          int      `json:"id"`
+	UserID      int      `json:"service_account_id"`
+	Nombre      string   `json:"nombre"`
+	Prefijo     string   `json:"prefijo"`
+	Permissions []string `json:"permissions"`
+	ExpiresAt   string   `json:"expires_at"`
+	LastUsedAt  *string  `json:"last_used_at"`
+	CreatedAt   string   `json:"created_at"`
+	Revocada    bool     `json:"revocada"`
+}
+
+// APIKeyRecord es la fila de api_keys con los datos de la cuenta dueña (para autenticar)
+type APIKeyRecord struct {
+	ID          int
+	UserID      int
+	Username    string
+	Role        string
+	KeyHash     string
+	Permissions []string
+	ExpiresAt   time.Time
+	Revocada    bool
+}
+
+type CreateServiceAccountRequest struct {
+	Username string `json:"username"`
+	Nombre   string `json:"nombre"`
+	Role     string `json:"role"`
+}
+
+// CreateAPIKeyRequest: ExpiresInDays 0 usa la vigencia por defecto
+type CreateAPIKeyRequest struct {
+	ServiceAccountID int      `json:"service_account_id"`
+	Nombre           string   `json:"nombre"`
+	Permissions      []string `json:"permissions"`
+	ExpiresInDays    int      `json:"expires_in_days"`
+}
+
+type CreateAPIKeyResponse struct {
+	Key    string `json:"key"` // Solo se entrega esta vez
+	APIKey APIKey `json:"api_key"`
+}
+
+type RevokeAPIKeyRequest struct {
+	ID int `json:"id"`
+}
+
+// --- Invitaciones y registro ---
+
+// RegistrationPolicy indica si cualquiera puede registrarse o solo con invitación
+type RegistrationPolicy struct {
+	Open bool `json:"open"`
+}
+
+// Invitation describe un código de invitación (el código solo se muestra al crearlo)
+type Invitation struct {
+	ID         int    `json:"id"`
+	Role       string `json:"role"`
+	ProyectoID *int   `json:"proyecto_id"`
+	MaxUsos    int    `json:"max_usos"`
+	Usos       int    `json:"usos"`
+	ExpiresAt  string `json:"expires_at"`
+	CreatedBy  string `json:"created_by"`
+	CreatedAt  string `json:"created_at"`
+	Revocada   bool   `json:"revocada"`
+}
+
+type CreateInvitationRequest struct {
+	Role          string `json:"role"`
+	ProyectoID    int    `json:"proyecto_id"` // 0 = sin proyecto
+	MaxUsos       int    `json:"max_usos"`    // 0 = un solo uso
+	ExpiresInDays int    `json:"expires_in_days"`
+}
+
+type CreateInvitationResponse struct {
+	Codigo     string     `json:"codigo"`
+	Invitation Invitation `json:"invitation"`
+}
+
+type RevokeInvitationRequest struct {
+	ID int `json:"id"`
+}
+
+// --- Proveedores externos (OpenID Connect) ---
+
+// ExternalLoginStart: URL del proveedor a la que el frontend debe redirigir
+type ExternalLoginStart struct {
+	Provider         string `json:"provider"`
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
+
+// ExternalLoginCallbackRequest: lo que el proveedor devolvió al frontend en la redirección
+type ExternalLoginCallbackRequest struct {
+	State string `json:"state"`
+	Code  string `json:"code"`
+}
+
+// ExternalStateClaims: el parámetro "state" es un JWT firmado que ata el callback al
+// inicio del login (proveedor y nonce esperado en el ID token)
+type ExternalStateClaims struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Purpose  string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// --- Historial de logins y sesiones activas ---
+
+// Session es una sesión abierta del usuario (un refresh token vigente)
+type Session struct {
+	ID         int     `json:"id"`
+	IP         string  `json:"ip"`
+	UserAgent  string  `json:"user_agent"`
+	CreatedAt  string  `json:"created_at"`
+	LastUsedAt *string `json:"last_used_at"` // Último refresh (nil si no se renovó)
+	ExpiresAt  string  `json:"expires_at"`
+	Actual     bool    `json:"actual"` // La sesión del token con el que se consulta
+}
+
+type RevokeSessionRequest struct {
+	ID int `json:"id"`
+}
+
+// LoginRecord es una entrada del historial de inicios de sesión
+type LoginRecord struct {
+	ID        int    `json:"id"`
+	SessionID int    `json:"session_id"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Metodo    string `json:"metodo"` // password, 2fa u oidc:<proveedor>
+	Fecha     string `json:"fecha"`
+}
+
+type LoginHistoryRequest struct {
+	UserID int `json:"user_id"`
+}
+
+// --- Suplantación (soporte) ---
+
+type ImpersonateRequest struct {
+	UserID int `json:"user_id"`
 }
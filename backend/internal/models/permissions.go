@@ -0,0 +1,152 @@
+package models
+
+//  PERMISOS Y ROLES
+// Los handlers piden permisos con nombre (recurso:acción); qué roles los tienen
+// se guarda en la tabla role_permissions y lo administra el admin por la API.
+
+const (
+	PermUsersRead          = "users:read"
+	PermUsersCreate        = "users:create"
+	PermUsersUpdateRole    = "users:update-role"
+	PermUsersUpdate        = "users:update"
+	PermUsersDelete        = "users:delete" // Desactivar/reactivar: los usuarios ya no se borran
+	PermUsersResetPassword = "users:reset-password"
+	PermUsersUnlock        = "users:unlock"
+	PermUsersAssignProject = "users:assign-project"
+	// PermUsersLoginHistory: ver IPs y User-Agents de los inicios de sesión de otros usuarios
+	PermUsersLoginHistory = "users:login-history"
+	// PermUsersImpersonate: ver el sistema como otro usuario (soporte). Quien lo tiene
+	// no puede ser suplantado.
+	PermUsersImpersonate = "users:impersonate"
+
+	PermProyectosRead   = "proyectos:read"
+	PermProyectosWrite  = "proyectos:write"
+	PermProyectosDelete = "proyectos:delete"
+	// PermProyectosAll: el rol global vale en todos los proyectos, sin ser miembro
+	PermProyectosAll = "proyectos:all"
+
+	PermLaboresRead      = "labores:read"
+	PermLaboresWrite     = "labores:write"
+	PermEquiposRead      = "equipos:read"
+	PermEquiposWrite     = "equipos:write"
+	PermUnidadesRead     = "unidades:read"
+	PermUnidadesWrite    = "unidades:write"
+	PermActividadesRead  = "actividades:read"
+	PermActividadesWrite = "actividades:write"
+	PermPlanesRead       = "planes:read"
+	PermPlanesWrite      = "planes:write"
+	PermRecursosRead     = "recursos:read"
+	PermRecursosWrite    = "recursos:write"
+	PermMaterialesRead   = "materiales:read"
+	PermMaterialesWrite  = "materiales:write"
+
+	PermLogsRead   = "logs:read"
+	PermLogsDelete = "logs:delete"
+
+	PermSecurityManage = "security:manage"
+	PermRolesManage    = "roles:manage"
+	PermAPIKeysManage  = "api-keys:manage"
+	PermInvitesManage  = "invitations:manage"
+)
+
+// Roles que existen desde la instalación. Se pueden editar sus permisos, pero no borrarlos
+// (el código los usa para asignar roles por defecto y para armar vistas como "encargados").
+const (
+	RoleAdmin     = "admin"
+	RoleGerente   = "gerente"
+	RoleEncargado = "encargado"
+	RoleUser      = "user"
+	// RoleAuditor: auditores externos (entes financiadores). Solo lectura, en todos los proyectos.
+	RoleAuditor = "auditor"
+)
+
+// PermissionSeed describe un permiso del catálogo y los roles que lo reciben al crearse
+type PermissionSeed struct {
+	Name        string
+	Descripcion string
+	Roles       []string
+}
+
+// RoleSeed describe un rol del sistema
+type RoleSeed struct {
+	Name        string
+	Descripcion string
+}
+
+var DefaultRoles = []RoleSeed{
+	{RoleAdmin, "Administrador del sistema"},
+	{RoleGerente, "Gerente de proyectos"},
+	{RoleEncargado, "Encargado de actividades"},
+	{RoleUser, "Usuario regular"},
+	{RoleAuditor, "Auditor externo (solo lectura)"},
+}
+
+// DefaultPermissions: la asignación inicial reproduce los permisos que antes estaban fijos en el código
+var DefaultPermissions = []PermissionSeed{
+	{PermUsersRead, "Listar usuarios", []string{RoleAdmin, RoleGerente}},
+	{PermUsersCreate, "Crear usuarios", []string{RoleAdmin, RoleGerente}},
+	{PermUsersUpdateRole, "Cambiar el rol de un usuario", []string{RoleAdmin}},
+	{PermUsersUpdate, "Editar nombre, apellido y cédula de un usuario", []string{RoleAdmin}},
+	{PermUsersDelete, "Desactivar y reactivar usuarios", []string{RoleAdmin}},
+	{PermUsersResetPassword, "Asignar contraseñas temporales", []string{RoleAdmin}},
+	{PermUsersUnlock, "Desbloquear cuentas", []string{RoleAdmin}},
+	{PermUsersAssignProject, "Asignar usuarios a proyectos", []string{RoleAdmin, RoleGerente}},
+	{PermUsersLoginHistory, "Ver el historial de inicios de sesión de los usuarios", []string{RoleAdmin}},
+	{PermUsersImpersonate, "Suplantar a otro usuario para dar soporte", []string{RoleAdmin}},
+
+	{PermProyectosRead, "Ver proyectos", []string{RoleAdmin, RoleGerente, RoleAuditor}},
+	{PermProyectosWrite, "Crear y modificar proyectos", []string{RoleAdmin, RoleGerente}},
+	{PermProyectosDelete, "Eliminar proyectos", []string{RoleAdmin}},
+	{PermProyectosAll, "Acceso a todos los proyectos sin ser miembro", []string{RoleAdmin, RoleAuditor}},
+
+	{PermLaboresRead, "Ver labores agronómicas", []string{RoleAdmin, RoleGerente, RoleAuditor}},
+	{PermLaboresWrite, "Crear, modificar y borrar labores agronómicas", []string{RoleAdmin, RoleGerente}},
+	{PermEquiposRead, "Ver equipos e implementos", []string{RoleAdmin, RoleGerente, RoleAuditor}},
+	{PermEquiposWrite, "Crear, modificar y borrar equipos e implementos", []string{RoleAdmin, RoleGerente}},
+	{PermUnidadesRead, "Ver unidades de medida", []string{RoleAdmin, RoleGerente, RoleAuditor}},
+	{PermUnidadesWrite, "Crear, modificar y borrar unidades de medida", []string{RoleAdmin, RoleGerente}},
+	{PermActividadesRead, "Ver actividades del proyecto", []string{RoleAdmin, RoleGerente, RoleAuditor}},
+	{PermActividadesWrite, "Crear, modificar y borrar actividades", []string{RoleAdmin, RoleGerente}},
+	{PermPlanesRead, "Ver planes de acción", []string{RoleAdmin, RoleGerente, RoleAuditor}},
+	{PermPlanesWrite, "Crear, modificar y borrar planes de acción", []string{RoleAdmin, RoleGerente}},
+	{PermRecursosRead, "Ver recursos humanos", []string{RoleAdmin, RoleGerente, RoleAuditor}},
+	{PermRecursosWrite, "Crear, modificar y borrar recursos humanos", []string{RoleAdmin, RoleGerente}},
+	{PermMaterialesRead, "Ver materiales e insumos", []string{RoleAdmin, RoleGerente, RoleAuditor}},
+	{PermMaterialesWrite, "Crear, modificar y borrar materiales e insumos", []string{RoleAdmin, RoleGerente}},
+
+	{PermLogsRead, "Ver el log de auditoría", []string{RoleAdmin, RoleAuditor}},
+	{PermLogsDelete, "Borrar eventos del log de auditoría", []string{RoleAdmin}},
+
+	{PermSecurityManage, "Configurar políticas de seguridad (2FA, registro abierto)", []string{RoleAdmin}},
+	{PermRolesManage, "Administrar roles y permisos", []string{RoleAdmin}},
+	{PermAPIKeysManage, "Administrar cuentas de servicio y API keys", []string{RoleAdmin}},
+	{PermInvitesManage, "Emitir y revocar códigos de invitación", []string{RoleAdmin}},
+}
+
+// Role es un rol con sus permisos (respuesta de la API de roles)
+type Role struct {
+	Name        string   `json:"name"`
+	Descripcion string   `json:"descripcion"`
+	Sistema     bool     `json:"sistema"`
+	Permissions []string `json:"permissions"`
+}
+
+type Permission struct {
+	Name        string `json:"name"`
+	Descripcion string `json:"descripcion"`
+}
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name"`
+	Descripcion string   `json:"descripcion"`
+	Permissions []string `json:"permissions"`
+}
+
+type UpdateRolePermissionsRequest struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+type DeleteRoleRequest struct {
+	Name string `json:"name"`
+}
@@ -0,0 +1,67 @@
+package models
+
+//  VISIBILIDAD DE CAMPOS POR ROL
+// Algunos campos (costos y montos) solo los ven ciertos roles. Qué campos se ocultan
+// a cada rol se guarda por entidad en la tabla hidden_fields; el filtro se aplica a
+// todas las respuestas JSON autenticadas, sin que cada handler tenga que hacerlo.
+
+// Entidades con campos filtrables
+const (
+	EntityActividades = "actividades"
+	EntityPlanes      = "planes"
+	EntityRecursos    = "recursos"
+	EntityMateriales  = "materiales"
+)
+
+// FieldFiltered lo implementan las respuestas cuyos campos dependen del rol del que
+// las pide. El proyecto indica qué rol de proyecto se usa (0: solo el rol global).
+type FieldFiltered interface {
+	VisibilityEntity() string
+	VisibilityProject() int
+}
+
+func (a ActividadResponse) VisibilityEntity() string { return EntityActividades }
+func (a ActividadResponse) VisibilityProject() int   { return a.ProyectoID }
+
+func (p PlanAccion) VisibilityEntity() string { return EntityPlanes }
+func (p PlanAccion) VisibilityProject() int   { return p.ProyectoID }
+
+func (r RecursoHumano) VisibilityEntity() string { return EntityRecursos }
+func (r RecursoHumano) VisibilityProject() int   { return r.ProyectoID }
+
+func (m MaterialInsumo) VisibilityEntity() string { return EntityMateriales }
+func (m MaterialInsumo) VisibilityProject() int   { return m.ProyectoID }
+
+// FilteredEntities: tipo de respuesta de cada entidad (para validar los nombres de campo)
+var FilteredEntities = map[string]FieldFiltered{
+	EntityActividades: ActividadResponse{},
+	EntityPlanes:      PlanAccion{},
+	EntityRecursos:    RecursoHumano{},
+	EntityMateriales:  MaterialInsumo{},
+}
+
+// HiddenFieldsSeed describe los campos ocultos por defecto de un rol en una entidad
+type HiddenFieldsSeed struct {
+	Role    string
+	Entidad string
+	Campos  []string
+}
+
+// DefaultHiddenFields: encargados y usuarios ven los datos operativos, pero no los montos
+var DefaultHiddenFields = []HiddenFieldsSeed{
+	{RoleEncargado, EntityActividades, []string{"costo"}},
+	{RoleEncargado, EntityPlanes, []string{"costo_unitario", "monto"}},
+	{RoleEncargado, EntityRecursos, []string{"costo_unitario", "monto"}},
+	{RoleEncargado, EntityMateriales, []string{"costo_unitario", "monto"}},
+	{RoleUser, EntityActividades, []string{"costo"}},
+	{RoleUser, EntityPlanes, []string{"costo_unitario", "monto"}},
+	{RoleUser, EntityRecursos, []string{"costo_unitario", "monto"}},
+	{RoleUser, EntityMateriales, []string{"costo_unitario", "monto"}},
+}
+
+// FieldVisibility: campos ocultos de una entidad para un rol (respuesta y petición de la API)
+type FieldVisibility struct {
+	Role    string   `json:"role"`
+	Entidad string   `json:"entidad"`
+	Campos  []string `json:"campos"`
+}
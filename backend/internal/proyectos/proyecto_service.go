@@ -4,15 +4,16 @@ import (
 	"errors"
 
 	"log"
-	"strings"
 
+	"proyecto/internal/apperrors"
 	"proyecto/internal/database"
 	"proyecto/internal/models"
 )
 
 // 1. EL CONTRATO (Interface)
 type ProyectoService interface {
-	GetAllProyectos() ([]models.Proyecto, error)
+	GetProyectos(req models.GetProyectosRequest, memberID int) ([]models.Proyecto, *models.Page, error)
+	AddMember(proyectoID, userID int, role string) error
 	CreateProyecto(nombre, fechaInicio, fechaCierre string) (*models.Proyecto, error)
 	UpdateProyecto(id int, nombre, fechaInicio, fechaCierre string) (*models.Proyecto, error)
 	DeleteProyecto(id int) (int64, error)
@@ -31,24 +32,42 @@ func NewProyectoService() ProyectoService {
 
 //  4. LOS MÉTODOS (Lógica de Negocio)
 
-func (s *proyectoService) GetAllProyectos() ([]models.Proyecto, error) {
-	proyectos, err := database.GetAllProyectos()
+// GetProyectos: una página de proyectos; con memberID, solo los que ese usuario
+// puede ver por ser miembro (0 = todos)
+func (s *proyectoService) GetProyectos(req models.GetProyectosRequest, memberID int) ([]models.Proyecto, *models.Page, error) {
+	proyectos, page, err := database.GetProyectos(req, memberID, models.PermProyectosRead)
 	if err != nil {
-		log.Printf("Error en proyectoService.GetAllProyectos: %v", err)
-		return nil, errors.New("Error al obtener proyectos.")
+		if _, ok := apperrors.As(err); ok {
+			return nil, nil, err
+		}
+		log.Printf("Error en proyectoService.GetProyectos (User: %d): %v", memberID, err)
+		return nil, nil, errors.New("Error al obtener proyectos.")
+	}
+	return proyectos, page, nil
+}
+
+// AddMember agrega un usuario al proyecto (p. ej. el gerente que lo creó)
+func (s *proyectoService) AddMember(proyectoID, userID int, role string) error {
+	if err := database.AddProjectMember(userID, proyectoID, role); err != nil {
+		log.Printf("Error en proyectoService.AddMember (Proy: %d, User: %d): %v", proyectoID, userID, err)
+		return errors.New("Error al asignar el proyecto a su creador.")
 	}
-	return proyectos, nil
+	return nil
 }
 
 func (s *proyectoService) CreateProyecto(nombre, fechaInicio, fechaCierre string) (*models.Proyecto, error) {
-	if nombre == "" || fechaInicio == "" || fechaCierre == "" {
-		return nil, errors.New("Nombre, Fecha de Inicio y Fecha de Cierre son requeridos.")
+	var check apperrors.Check
+	check.Required("nombre", nombre != "")
+	check.Required("fecha_inicio", fechaInicio != "")
+	check.Required("fecha_cierre", fechaCierre != "")
+	if err := check.Err("Nombre, Fecha de Inicio y Fecha de Cierre son requeridos."); err != nil {
+		return nil, err
 	}
 
 	id, err := database.CreateProyecto(nombre, fechaInicio, fechaCierre)
 	if err != nil {
 		log.Printf("Error en proyectoService.CreateProyecto: %v", err)
-		if strings.Contains(err.Error(), "ya existe") {
+		if apperrors.Is(err, apperrors.CodeConflict) {
 			return nil, err
 		}
 		return nil, errors.New("Error al crear proyecto.")
@@ -64,20 +83,25 @@ func (s *proyectoService) CreateProyecto(nombre, fechaInicio, fechaCierre string
 }
 
 func (s *proyectoService) UpdateProyecto(id int, nombre, fechaInicio, fechaCierre string) (*models.Proyecto, error) {
-	if id == 0 || nombre == "" || fechaInicio == "" || fechaCierre == "" {
-		return nil, errors.New("ID, Nombre, Fecha de Inicio y Fecha de Cierre son requeridos.")
+	var check apperrors.Check
+	check.Required("id", id != 0)
+	check.Required("nombre", nombre != "")
+	check.Required("fecha_inicio", fechaInicio != "")
+	check.Required("fecha_cierre", fechaCierre != "")
+	if err := check.Err("ID, Nombre, Fecha de Inicio y Fecha de Cierre son requeridos."); err != nil {
+		return nil, err
 	}
 
 	affected, err := database.UpdateProyecto(id, nombre, fechaInicio, fechaCierre)
 	if err != nil {
 		log.Printf("Error en proyectoService.UpdateProyecto (ID: %d): %v", id, err)
-		if strings.Contains(err.Error(), "ya existe") {
+		if apperrors.Is(err, apperrors.CodeConflict) {
 			return nil, err
 		}
 		return nil, errors.New("Error al actualizar proyecto.")
 	}
 	if affected == 0 {
-		return nil, errors.New("Proyecto no encontrado.")
+		return nil, apperrors.NotFound("Proyecto no encontrado.")
 	}
 
 	// Devolvemos el proyecto actualizado
@@ -90,22 +114,25 @@ func (s *proyectoService) UpdateProyecto(id int, nombre, fechaInicio, fechaCierr
 
 func (s *proyectoService) DeleteProyecto(id int) (int64, error) {
 	if id == 0 {
-		return 0, errors.New("ID de proyecto requerido.")
+		return 0, apperrors.Required("id", "ID de proyecto requerido.")
 	}
 	affected, err := database.DeleteProyecto(id)
 	if err != nil {
 		log.Printf("Error en proyectoService.DeleteProyecto (ID: %d): %v", id, err)
 		return 0, errors.New("Error al borrar proyecto.")
 	}
+	if affected == 0 {
+		return 0, apperrors.NotFound("Proyecto no encontrado.")
+	}
 	return affected, nil
 }
 
 func (s *proyectoService) SetProyectoEstado(id int, estado string) (int64, error) {
-	if id == 0 {
-		return 0, errors.New("ID de proyecto requerido.")
-	}
-	if estado == "" {
-		return 0, errors.New("Estado requerido.")
+	var check apperrors.Check
+	check.Required("id", id != 0)
+	check.Required("estado", estado != "")
+	if err := check.Err("ID de proyecto y estado requeridos."); err != nil {
+		return 0, err
 	}
 
 	affected, err := database.SetProyectoEstado(id, estado)
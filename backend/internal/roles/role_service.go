@@ -0,0 +1,162 @@
+package roles
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"proyecto/internal/apperrors"
+	"proyecto/internal/database"
+	"proyecto/internal/models"
+)
+
+// roleNamePattern: nombres de rol en minúsculas, sin espacios (se guardan en users.role)
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// 1. EL CONTRATO (Interface)
+type RoleService interface {
+	GetAllRoles() ([]models.Role, error)
+	GetAllPermissions() ([]models.Permission, error)
+	CreateRole(req models.CreateRoleRequest) error
+	UpdateRolePermissions(name string, permissions []string) error
+	DeleteRole(name string) error
+}
+
+// 2. LA IMPLEMENTACIÓN (Struct)
+type roleService struct{}
+
+// 3. EL CONSTRUCTOR
+func NewRoleService() RoleService {
+	return &roleService{}
+}
+
+//  4. LOS MÉTODOS (Lógica de Negocio)
+
+func (s *roleService) GetAllRoles() ([]models.Role, error) {
+	roles, err := database.GetAllRoles()
+	if err != nil {
+		log.Printf("Error en roleService.GetAllRoles: %v", err)
+		return nil, errors.New("error al obtener roles")
+	}
+	return roles, nil
+}
+
+func (s *roleService) GetAllPermissions() ([]models.Permission, error) {
+	perms, err := database.GetAllPermissions()
+	if err != nil {
+		log.Printf("Error en roleService.GetAllPermissions: %v", err)
+		return nil, errors.New("error al obtener permisos")
+	}
+	return perms, nil
+}
+
+func (s *roleService) CreateRole(req models.CreateRoleRequest) error {
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if !roleNamePattern.MatchString(name) {
+		return apperrors.InvalidField("name", "nombre de rol inválido (minúsculas, números, '-' o '_', de 2 a 32 caracteres)")
+	}
+	perms, err := s.validatePermissions(req.Permissions)
+	if err != nil {
+		return err
+	}
+
+	if err := database.CreateRole(name, strings.TrimSpace(req.Descripcion), perms); err != nil {
+		if apperrors.Is(err, apperrors.CodeConflict) {
+			return err
+		}
+		log.Printf("Error en roleService.CreateRole (%s): %v", name, err)
+		return errors.New("error al crear rol")
+	}
+	return nil
+}
+
+func (s *roleService) UpdateRolePermissions(name string, permissions []string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, err := database.GetRoleSistema(name); err != nil {
+		return err
+	}
+	perms, err := s.validatePermissions(permissions)
+	if err != nil {
+		return err
+	}
+	// Sin esta regla el admin podría dejar el sistema sin nadie que administre roles
+	if name == models.RoleAdmin && !contains(perms, models.PermRolesManage) {
+		return apperrors.InvalidField("permissions", fmt.Sprintf("el rol %s no puede perder el permiso %s", models.RoleAdmin, models.PermRolesManage))
+	}
+
+	if err := database.SetRolePermissions(name, perms); err != nil {
+		log.Printf("Error en roleService.UpdateRolePermissions (%s): %v", name, err)
+		return errors.New("error al actualizar permisos del rol")
+	}
+	return nil
+}
+
+func (s *roleService) DeleteRole(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	sistema, err := database.GetRoleSistema(name)
+	if err != nil {
+		return err
+	}
+	if sistema {
+		return apperrors.Forbidden("los roles del sistema no se pueden eliminar")
+	}
+
+	count, err := database.CountUsersWithRole(name)
+	if err != nil {
+		log.Printf("Error en roleService.DeleteRole (CountUsersWithRole %s): %v", name, err)
+		return errors.New("error al eliminar rol")
+	}
+	if count > 0 {
+		return apperrors.Conflict(fmt.Sprintf("el rol tiene %d usuario(s) asignado(s); reasígnelos antes de eliminarlo", count))
+	}
+	members, err := database.CountMembersWithRole(name)
+	if err != nil {
+		log.Printf("Error en roleService.DeleteRole (CountMembersWithRole %s): %v", name, err)
+		return errors.New("error al eliminar rol")
+	}
+	if members > 0 {
+		return apperrors.Conflict(fmt.Sprintf("el rol se usa en %d membresía(s) de proyecto; reasígnelas antes de eliminarlo", members))
+	}
+
+	if _, err := database.DeleteRole(name); err != nil {
+		log.Printf("Error en roleService.DeleteRole (%s): %v", name, err)
+		return errors.New("error al eliminar rol")
+	}
+	return nil
+}
+
+// validatePermissions descarta duplicados y rechaza permisos que no están en el catálogo
+func (s *roleService) validatePermissions(permissions []string) ([]string, error) {
+	catalog, err := database.GetAllPermissions()
+	if err != nil {
+		log.Printf("Error en roleService.validatePermissions: %v", err)
+		return nil, errors.New("error al obtener permisos")
+	}
+	known := make(map[string]bool, len(catalog))
+	for _, p := range catalog {
+		known[p.Name] = true
+	}
+
+	clean := make([]string, 0, len(permissions))
+	for _, perm := range permissions {
+		perm = strings.TrimSpace(perm)
+		if !known[perm] {
+			return nil, apperrors.InvalidField("permissions", fmt.Sprintf("permiso desconocido: %q", perm))
+		}
+		if !contains(clean, perm) {
+			clean = append(clean, perm)
+		}
+	}
+	return clean, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,17 +1,20 @@
 package unidades
 
 import (
+	"database/sql"
 	"errors"
 	"log"
+	"proyecto/internal/apperrors"
 	"proyecto/internal/database"
 	"proyecto/internal/models"
 )
 
 type UnidadService interface {
-	GetUnidadesByProyectoID(proyectoID int) ([]models.UnidadMedida, error)
+	GetUnidades(req models.GetUnidadesRequest) ([]models.UnidadMedida, *models.Page, error)
 	CreateUnidad(req models.CreateUnidadRequest) (*models.UnidadMedida, error)
 	UpdateUnidad(req models.UpdateUnidadRequest) (int64, error)
 	DeleteUnidad(id int) (int64, error)
+	GetUnidadProyectoID(id int) (int, error)
 }
 
 type unidadService struct{}
@@ -21,19 +24,23 @@ func NewUnidadService() UnidadService {
 }
 
 // Acepta ID de proyecto
-func (s *unidadService) GetUnidadesByProyectoID(proyectoID int) ([]models.UnidadMedida, error) {
-	if proyectoID == 0 {
-		return nil, errors.New("ID de proyecto requerido")
+func (s *unidadService) GetUnidades(req models.GetUnidadesRequest) ([]models.UnidadMedida, *models.Page, error) {
+	if req.ProyectoID == 0 {
+		return nil, nil, apperrors.Required("proyecto_id", "ID de proyecto requerido")
 	}
-	return database.GetUnidadesByProyectoID(proyectoID)
+	return database.GetUnidades(req)
 }
 
 func (s *unidadService) CreateUnidad(req models.CreateUnidadRequest) (*models.UnidadMedida, error) {
 	if req.ProyectoID == 0 {
-		return nil, errors.New("ID de proyecto requerido")
+		return nil, apperrors.Required("proyecto_id", "ID de proyecto requerido")
 	}
-	if req.Nombre == "" || req.Abreviatura == "" || req.Tipo == "" {
-		return nil, errors.New("nombre, abreviatura y tipo son requeridos")
+	var check apperrors.Check
+	check.Required("nombre", req.Nombre != "")
+	check.Required("abreviatura", req.Abreviatura != "")
+	check.Required("tipo", req.Tipo != "")
+	if err := check.Err("nombre, abreviatura y tipo son requeridos"); err != nil {
+		return nil, err
 	}
 
 	id, err := database.CreateUnidad(models.UnidadMedida{
@@ -52,9 +59,25 @@ func (s *unidadService) CreateUnidad(req models.CreateUnidadRequest) (*models.Un
 }
 
 func (s *unidadService) UpdateUnidad(req models.UpdateUnidadRequest) (int64, error) {
-	if req.ID == 0 || req.Nombre == "" || req.Abreviatura == "" {
-		return 0, errors.New("datos incompletos")
+	var check apperrors.Check
+	check.Required("id", req.ID != 0)
+	check.Required("nombre", req.Nombre != "")
+	check.Required("abreviatura", req.Abreviatura != "")
+	if err := check.Err("datos incompletos"); err != nil {
+		return 0, err
 	}
 	return database.UpdateUnidad(req.ID, req.Nombre, req.Abreviatura, req.Tipo, req.Dimension)
 }
 func (s *unidadService) DeleteUnidad(id int) (int64, error) { return database.DeleteUnidad(id) }
+
+// GetUnidadProyectoID: proyecto dueño del registro (para verificar permisos por proyecto)
+func (s *unidadService) GetUnidadProyectoID(id int) (int, error) {
+	proyectoID, err := database.GetUnidadProyectoID(id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error en unidadService.GetUnidadProyectoID (ID: %d): %v", id, err)
+		}
+		return 0, apperrors.NotFound("unidad no encontrada")
+	}
+	return proyectoID, nil
+}
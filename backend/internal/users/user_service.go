@@ -3,20 +3,33 @@ package users
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 
+	"proyecto/internal/apperrors"
+	"proyecto/internal/cedula"
 	"proyecto/internal/database"
+	"proyecto/internal/i18n"
 	"proyecto/internal/models"
 )
 
 // 1. EL CONTRATO (Interface)
 type UserService interface {
-	GetAllUsers() ([]models.UserListResponse, error)
+	GetUsers(req models.GetUsersRequest, memberID int) ([]models.UserListResponse, *models.Page, error)
 	AddUser(user models.User) (int64, error)
-	DeleteUser(id int) (int64, error)
+	DeactivateUser(id, callerID int) error
+	ReactivateUser(id int) error
+	UpdateUserProfile(req models.UpdateUserProfileRequest) error
 	UpdateUserRole(id int, newRole string) (int64, error)
 	AssignProjectToUser(userID int, proyectoID int) (int64, error)
 	GetProjectDetailsForUser(userID int) (*models.UserProjectDetailsResponse, error)
+	GetProjectMembers(proyectoID int) ([]models.ProjectMember, error)
+	ProjectMemberRole(userID int, role string) (string, bool, error)
+	AddProjectMember(userID, proyectoID int, role string) error
+	RemoveProjectMember(userID, proyectoID int) (int64, error)
+	GetPreferences(userID int) (*models.UserPreferences, error)
+	SetPreferences(userID int, prefs models.UserPreferences) (*models.UserPreferences, error)
 }
 
 // 2. LA IMPLEMENTACIÓN (Struct)
@@ -31,22 +44,36 @@ func NewUserService() UserService {
 
 //  4. LOS MÉTODOS (Lógica de Negocio)
 
-func (s *userService) GetAllUsers() ([]models.UserListResponse, error) {
-	users, err := database.GetAllUsersWithProjectNames()
+// GetUsers: una página de usuarios; con memberID, solo los de los proyectos
+// donde ese usuario puede ver usuarios (0 = todos)
+func (s *userService) GetUsers(req models.GetUsersRequest, memberID int) ([]models.UserListResponse, *models.Page, error) {
+	users, page, err := database.GetUsers(req, memberID, models.PermUsersRead)
 	if err != nil {
-		log.Printf("Error en userService.GetAllUsers: %v", err)
-
-		return nil, errors.New("error al obtener usuarios")
+		if _, ok := apperrors.As(err); ok {
+			return nil, nil, err
+		}
+		log.Printf("Error en userService.GetUsers (User: %d): %v", memberID, err)
+		return nil, nil, errors.New("error al obtener usuarios")
 	}
-	return users, nil
+	return users, page, nil
 }
 
 func (s *userService) AddUser(user models.User) (int64, error) {
 	// La única lógica del servicio es validar.
-	if user.Username == "" || user.Password == "" || user.Nombre == "" || user.Apellido == "" || user.Cedula == "" {
-
-		return 0, errors.New("todos los campos (username, password, nombre, apellido, cedula) son requeridos")
+	var check apperrors.Check
+	check.Required("username", user.Username != "")
+	check.Required("password", user.Password != "")
+	check.Required("nombre", user.Nombre != "")
+	check.Required("apellido", user.Apellido != "")
+	check.Required("cedula", user.Cedula != "")
+	if err := check.Err("todos los campos (username, password, nombre, apellido, cedula) son requeridos"); err != nil {
+		return 0, err
+	}
+	canonical, err := cedula.Normalize(user.Cedula)
+	if err != nil {
+		return 0, apperrors.InvalidField("cedula", err.Error())
 	}
+	user.Cedula = canonical
 
 	// La función 'database.AddUser' (en user_queries.go) se encarga de la encriptación
 	// Asignamos "encargado" como rol por defecto desde este servicio
@@ -60,29 +87,91 @@ func (s *userService) AddUser(user models.User) (int64, error) {
 	return id, nil
 }
 
-func (s *userService) DeleteUser(id int) (int64, error) {
+// DeactivateUser desactiva la cuenta en lugar de borrarla: sus actividades conservan
+// al encargado y el log de auditoría sigue siendo legible
+func (s *userService) DeactivateUser(id, callerID int) error {
 	if id == 0 {
+		return apperrors.Required("id", "id de usuario requerido")
+	}
+	if id == callerID {
+		return apperrors.Forbidden("no puede desactivar su propia cuenta")
+	}
+	return s.setActivo(id, false)
+}
 
-		return 0, errors.New("id de usuario requerido")
+func (s *userService) ReactivateUser(id int) error {
+	if id == 0 {
+		return apperrors.Required("id", "id de usuario requerido")
 	}
+	return s.setActivo(id, true)
+}
 
-	affected, err := database.DeleteUser(id)
+func (s *userService) setActivo(id int, activo bool) error {
+	affected, err := database.SetUserActivo(id, activo)
 	if err != nil {
-		log.Printf("Error en userService.DeleteUser (ID: %d): %v", id, err)
-
-		return 0, errors.New("error al borrar usuario")
+		log.Printf("Error en userService.setActivo (ID: %d, activo: %t): %v", id, activo, err)
+		return errors.New("error al actualizar el estado del usuario")
 	}
-	return affected, nil
+	if affected == 0 {
+		return apperrors.NotFound("usuario no encontrado")
+	}
+	return nil
 }
 
-func (s *userService) UpdateUserRole(id int, newRole string) (int64, error) {
-	if id == 0 || newRole == "" {
+// UpdateUserProfile cambia nombre, apellido y cédula; la cédula debe seguir siendo única
+func (s *userService) UpdateUserProfile(req models.UpdateUserProfileRequest) error {
+	nombre := strings.TrimSpace(req.Nombre)
+	apellido := strings.TrimSpace(req.Apellido)
+	var check apperrors.Check
+	check.Required("id", req.ID != 0)
+	check.Required("nombre", nombre != "")
+	check.Required("apellido", apellido != "")
+	check.Required("cedula", strings.TrimSpace(req.Cedula) != "")
+	if err := check.Err("id, nombre, apellido y cedula son requeridos"); err != nil {
+		return err
+	}
+	doc, err := cedula.Normalize(req.Cedula)
+	if err != nil {
+		return apperrors.InvalidField("cedula", err.Error())
+	}
 
-		return 0, errors.New("id y newRole son requeridos")
+	taken, err := database.CedulaTakenByOther(doc, req.ID)
+	if err != nil {
+		log.Printf("Error en userService.UpdateUserProfile (CedulaTakenByOther %d): %v", req.ID, err)
+		return errors.New("error al actualizar el usuario")
+	}
+	if taken {
+		return apperrors.Conflict("La cédula ya está registrada.", apperrors.Duplicate("cedula", "ya está registrada"))
 	}
-	if newRole != "admin" && newRole != "gerente" && newRole != "user" && newRole != "encargado" {
 
-		return 0, errors.New("rol debe ser 'admin', 'gerente', 'encargado' o 'user'")
+	affected, err := database.UpdateUserProfile(req.ID, nombre, apellido, doc)
+	if err != nil {
+		log.Printf("Error en userService.UpdateUserProfile (ID: %d): %v", req.ID, err)
+		if apperrors.Is(err, apperrors.CodeConflict) {
+			return err
+		}
+		return errors.New("error al actualizar el usuario")
+	}
+	if affected == 0 {
+		return apperrors.NotFound("usuario no encontrado")
+	}
+	return nil
+}
+
+func (s *userService) UpdateUserRole(id int, newRole string) (int64, error) {
+	var check apperrors.Check
+	check.Required("id", id != 0)
+	check.Required("role", newRole != "")
+	if err := check.Err("id y newRole son requeridos"); err != nil {
+		return 0, err
+	}
+	exists, err := database.RoleExists(newRole)
+	if err != nil {
+		log.Printf("Error en userService.UpdateUserRole (RoleExists %s): %v", newRole, err)
+		return 0, errors.New("error al actualizar rol")
+	}
+	if !exists {
+		return 0, apperrors.InvalidField("role", fmt.Sprintf("rol desconocido: %q", newRole))
 	}
 
 	affected, err := database.UpdateUserRole(id, newRole)
@@ -94,32 +183,37 @@ func (s *userService) UpdateUserRole(id int, newRole string) (int64, error) {
 	return affected, nil
 }
 
+// AssignProjectToUser se mantiene por compatibilidad: agrega el proyecto a los del
+// usuario (con su rol global) sin quitarle los demás. proyectoID 0 lo quita de todos.
 func (s *userService) AssignProjectToUser(userID int, proyectoID int) (int64, error) {
 	if userID == 0 {
-
-		return 0, errors.New("id de usuario (user_id) requerido")
+		return 0, apperrors.Required("user_id", "id de usuario (user_id) requerido")
 	}
 
-	affected, err := database.AssignProjectToUser(userID, proyectoID)
-	if err != nil {
-		log.Printf("Error en userService.AssignProjectToUser (User: %d, Proy: %d): %v", userID, proyectoID, err)
+	if proyectoID == 0 {
+		affected, err := database.RemoveUserFromAllProjects(userID)
+		if err != nil {
+			log.Printf("Error en userService.AssignProjectToUser (User: %d): %v", userID, err)
+			return 0, errors.New("error al desasignar proyectos")
+		}
+		return affected, nil
+	}
 
-		return 0, errors.New("error al asignar proyecto")
+	if err := s.AddProjectMember(userID, proyectoID, ""); err != nil {
+		return 0, err
 	}
-	return affected, nil
+	return 1, nil
 }
 
 func (s *userService) GetProjectDetailsForUser(userID int) (*models.UserProjectDetailsResponse, error) {
 	if userID == 0 {
-
-		return nil, errors.New("id de usuario requerido")
+		return nil, apperrors.Required("user_id", "id de usuario requerido")
 	}
 
 	details, err := database.GetProjectDetailsForUser(userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-
-			return nil, errors.New("usuario no encontrado")
+			return nil, apperrors.NotFound("usuario no encontrado")
 		}
 		log.Printf("Error en userService.GetProjectDetailsForUser (User: %d): %v", userID, err)
 
@@ -128,3 +222,125 @@ func (s *userService) GetProjectDetailsForUser(userID int) (*models.UserProjectD
 
 	return details, nil
 }
+
+func (s *userService) GetProjectMembers(proyectoID int) ([]models.ProjectMember, error) {
+	if proyectoID == 0 {
+		return nil, apperrors.Required("proyecto_id", "proyecto_id requerido")
+	}
+	members, err := database.GetProjectMembers(proyectoID)
+	if err != nil {
+		log.Printf("Error en userService.GetProjectMembers (Proy: %d): %v", proyectoID, err)
+		return nil, errors.New("error al obtener miembros del proyecto")
+	}
+	return members, nil
+}
+
+// AddProjectMember agrega (o actualiza) la membresía. Sin rol explícito se usa el rol global.
+// ProjectMemberRole resuelve el rol con el que userID entraría a un proyecto: el
+// pedido o, si no se pidió, su rol global. explicit indica si difiere del global.
+func (s *userService) ProjectMemberRole(userID int, role string) (string, bool, error) {
+	if userID == 0 {
+		return "", false, apperrors.Required("user_id", "user_id y proyecto_id son requeridos")
+	}
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		return "", false, apperrors.NotFound("usuario no encontrado")
+	}
+	if role == "" || role == user.Role {
+		return user.Role, false, nil
+	}
+	exists, err := database.RoleExists(role)
+	if err != nil {
+		log.Printf("Error en userService.ProjectMemberRole (RoleExists %s): %v", role, err)
+		return "", false, errors.New("error al asignar proyecto")
+	}
+	if !exists {
+		return "", false, apperrors.InvalidField("role", fmt.Sprintf("rol desconocido: %q", role))
+	}
+	return role, true, nil
+}
+
+func (s *userService) AddProjectMember(userID, proyectoID int, role string) error {
+	var check apperrors.Check
+	check.Required("user_id", userID != 0)
+	check.Required("proyecto_id", proyectoID != 0)
+	if err := check.Err("user_id y proyecto_id son requeridos"); err != nil {
+		return err
+	}
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		return apperrors.NotFound("usuario no encontrado")
+	}
+	if _, err := database.GetProjectByID(int64(proyectoID)); err != nil {
+		return apperrors.NotFound("proyecto no encontrado")
+	}
+
+	if role == "" {
+		role = user.Role
+	}
+	exists, err := database.RoleExists(role)
+	if err != nil {
+		log.Printf("Error en userService.AddProjectMember (RoleExists %s): %v", role, err)
+		return errors.New("error al asignar proyecto")
+	}
+	if !exists {
+		return apperrors.InvalidField("role", fmt.Sprintf("rol desconocido: %q", role))
+	}
+
+	if err := database.AddProjectMember(userID, proyectoID, role); err != nil {
+		log.Printf("Error en userService.AddProjectMember (User: %d, Proy: %d): %v", userID, proyectoID, err)
+		return errors.New("error al asignar proyecto")
+	}
+	return nil
+}
+
+func (s *userService) RemoveProjectMember(userID, proyectoID int) (int64, error) {
+	var check apperrors.Check
+	check.Required("user_id", userID != 0)
+	check.Required("proyecto_id", proyectoID != 0)
+	if err := check.Err("user_id y proyecto_id son requeridos"); err != nil {
+		return 0, err
+	}
+	affected, err := database.RemoveProjectMember(userID, proyectoID)
+	if err != nil {
+		log.Printf("Error en userService.RemoveProjectMember (User: %d, Proy: %d): %v", userID, proyectoID, err)
+		return 0, errors.New("error al quitar al miembro del proyecto")
+	}
+	if affected == 0 {
+		return 0, apperrors.NotFound("el usuario no pertenece a ese proyecto")
+	}
+	return affected, nil
+}
+
+func (s *userService) GetPreferences(userID int) (*models.UserPreferences, error) {
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error en userService.GetPreferences (User: %d): %v", userID, err)
+		return nil, apperrors.NotFound("usuario no encontrado")
+	}
+	return &models.UserPreferences{Idioma: user.Idioma}, nil
+}
+
+// SetPreferences guarda el idioma preferido (normalizado: "en-US" queda "en");
+// vacío vuelve a usar el de Accept-Language
+func (s *userService) SetPreferences(userID int, prefs models.UserPreferences) (*models.UserPreferences, error) {
+	idioma := strings.TrimSpace(prefs.Idioma)
+	if idioma != "" {
+		lang, ok := i18n.Parse(idioma)
+		if !ok {
+			return nil, apperrors.InvalidField("idioma", fmt.Sprintf("idioma no soportado: %q (válidos: es, en)", idioma))
+		}
+		idioma = string(lang)
+	}
+
+	affected, err := database.SetUserIdioma(userID, idioma)
+	if err != nil {
+		log.Printf("Error en userService.SetPreferences (User: %d): %v", userID, err)
+		return nil, errors.New("error al guardar las preferencias")
+	}
+	if affected == 0 {
+		return nil, apperrors.NotFound("usuario no encontrado")
+	}
+	return &models.UserPreferences{Idioma: idioma}, nil
+}
@@ -0,0 +1,215 @@
+package visibility
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"proyecto/internal/models"
+)
+
+var filteredType = reflect.TypeOf((*models.FieldFiltered)(nil)).Elem()
+
+// rules: campos ocultos aplicables a un viewer
+type rules struct {
+	globalRole   string
+	allProjects  bool           // el rol global vale en todos los proyectos (proyectos:all)
+	projectRoles map[int]string // rol del viewer en cada proyecto del que es miembro
+	hidden       map[string]map[string]map[string]bool
+	cache        map[cacheKey]map[string]bool
+}
+
+type cacheKey struct {
+	entidad    string
+	proyectoID int
+}
+
+// hiddenFor devuelve los campos ocultos de una fila. Los roles que cuentan son los
+// mismos que para los permisos de proyecto (el de miembro y, con proyectos:all o sin
+// ser miembro, el global); un campo se oculta solo si todos ellos lo ocultan.
+func (r *rules) hiddenFor(entidad string, proyectoID int) map[string]bool {
+	key := cacheKey{entidad, proyectoID}
+	if campos, ok := r.cache[key]; ok {
+		return campos
+	}
+
+	var roles []string
+	memberRole, isMember := r.projectRoles[proyectoID]
+	if proyectoID != 0 && isMember {
+		roles = append(roles, memberRole)
+	}
+	if proyectoID == 0 || !isMember || r.allProjects {
+		roles = append(roles, r.globalRole)
+	}
+
+	var campos map[string]bool
+	for i, role := range roles {
+		ocultos := r.hidden[role][entidad]
+		if i == 0 {
+			campos = ocultos
+			continue
+		}
+		common := make(map[string]bool)
+		for c := range campos {
+			if ocultos[c] {
+				common[c] = true
+			}
+		}
+		campos = common
+	}
+	r.cache[key] = campos
+	return campos
+}
+
+// containsFiltered indica si el valor contiene alguna entidad filtrable (sin tocar la DB)
+func containsFiltered(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return false
+		}
+		return containsFiltered(v.Elem())
+	case reflect.Struct:
+		if v.Type().Implements(filteredType) {
+			return true
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() && containsFiltered(v.Field(i)) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if containsFiltered(v.Index(i)) {
+				return true
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if containsFiltered(iter.Value()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// prune serializa el payload y quita de cada entidad filtrable los campos ocultos.
+// El árbol JSON se recorre junto con el valor Go para saber qué tipo tiene cada nodo.
+func prune(payload interface{}, r *rules) (interface{}, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber() // sin pasar los enteros por float64
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	pruneNode(reflect.ValueOf(payload), tree, r)
+	return tree, nil
+}
+
+func pruneNode(v reflect.Value, node interface{}, r *rules) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			pruneNode(v.Elem(), node, r)
+		}
+	case reflect.Struct:
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return
+		}
+		if v.Type().Implements(filteredType) {
+			entity := v.Interface().(models.FieldFiltered)
+			for campo := range r.hiddenFor(entity.VisibilityEntity(), entity.VisibilityProject()) {
+				delete(obj, campo)
+			}
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, promoted := jsonName(field)
+			if promoted {
+				// Struct embebido sin tag: sus campos quedan en el mismo objeto
+				pruneNode(v.Field(i), obj, r)
+				continue
+			}
+			if child, ok := obj[name]; ok && name != "-" {
+				pruneNode(v.Field(i), child, r)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := node.([]interface{})
+		if !ok {
+			return
+		}
+		for i := 0; i < v.Len() && i < len(arr); i++ {
+			pruneNode(v.Index(i), arr[i], r)
+		}
+	case reflect.Map:
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if child, ok := obj[mapKey(iter.Key())]; ok {
+				pruneNode(iter.Value(), child, r)
+			}
+		}
+	}
+}
+
+// jsonName devuelve el nombre JSON del campo; promoted indica un struct embebido
+// sin tag, cuyos campos encoding/json sube al objeto que lo contiene
+func jsonName(field reflect.StructField) (name string, promoted bool) {
+	tag := field.Tag.Get("json")
+	name = strings.Split(tag, ",")[0]
+	if name == "" && field.Anonymous {
+		t := field.Type
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Struct {
+			return "", true
+		}
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, false
+}
+
+// jsonFieldNames lista los nombres JSON de los campos de un struct
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if name, _ := jsonName(field); name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// mapKey reproduce cómo encoding/json convierte las claves de un map en texto
+func mapKey(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	raw, err := json.Marshal(k.Interface())
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(string(raw), `"`)
+}
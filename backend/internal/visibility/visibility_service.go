@@ -0,0 +1,152 @@
+package visibility
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"proyecto/internal/apperrors"
+	"proyecto/internal/database"
+	"proyecto/internal/models"
+)
+
+// Viewer es quien recibe la respuesta (el usuario autenticado, o el suplantado)
+type Viewer struct {
+	UserID   int
+	Username string
+	Role     string
+}
+
+// 1. EL CONTRATO (Interface)
+type VisibilityService interface {
+	// Apply devuelve el payload sin los campos que el rol del viewer no puede ver
+	// (el mismo payload si no contiene entidades filtrables)
+	Apply(viewer Viewer, payload interface{}) (interface{}, error)
+	GetHiddenFields() ([]models.FieldVisibility, error)
+	SetHiddenFields(req models.FieldVisibility) error
+}
+
+// 2. LA IMPLEMENTACIÓN (Struct)
+type visibilityService struct{}
+
+// 3. EL CONSTRUCTOR
+func NewVisibilityService() VisibilityService {
+	return &visibilityService{}
+}
+
+//  4. LOS MÉTODOS (Lógica de Negocio)
+
+func (s *visibilityService) Apply(viewer Viewer, payload interface{}) (interface{}, error) {
+	if !containsFiltered(reflect.ValueOf(payload)) {
+		return payload, nil
+	}
+	rules, err := s.loadRules(viewer)
+	if err != nil {
+		log.Printf("Error en visibilityService.Apply (%s): %v", viewer.Username, err)
+		return nil, errors.New("error al aplicar la visibilidad de campos")
+	}
+	filtered, err := prune(payload, rules)
+	if err != nil {
+		log.Printf("Error en visibilityService.Apply (%s): %v", viewer.Username, err)
+		return nil, errors.New("error al aplicar la visibilidad de campos")
+	}
+	return filtered, nil
+}
+
+func (s *visibilityService) GetHiddenFields() ([]models.FieldVisibility, error) {
+	list, err := database.GetHiddenFields()
+	if err != nil {
+		log.Printf("Error en visibilityService.GetHiddenFields: %v", err)
+		return nil, errors.New("error al obtener campos ocultos")
+	}
+	return list, nil
+}
+
+func (s *visibilityService) SetHiddenFields(req models.FieldVisibility) error {
+	role := strings.ToLower(strings.TrimSpace(req.Role))
+	exists, err := database.RoleExists(role)
+	if err != nil {
+		log.Printf("Error en visibilityService.SetHiddenFields (RoleExists %s): %v", role, err)
+		return errors.New("error al actualizar campos ocultos")
+	}
+	if !exists {
+		return apperrors.InvalidField("role", fmt.Sprintf("rol inexistente: %q", role))
+	}
+
+	entidad := strings.ToLower(strings.TrimSpace(req.Entidad))
+	sample, ok := models.FilteredEntities[entidad]
+	if !ok {
+		return apperrors.InvalidField("entidad", fmt.Sprintf("entidad desconocida: %q (válidas: %s)", entidad, strings.Join(filteredEntityNames(), ", ")))
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(sample))
+	campos := make([]string, 0, len(req.Campos))
+	seen := make(map[string]bool, len(req.Campos))
+	for _, campo := range req.Campos {
+		campo = strings.TrimSpace(campo)
+		if !known[campo] {
+			return apperrors.InvalidField("campos", fmt.Sprintf("la entidad %s no tiene el campo %q", entidad, campo))
+		}
+		// Sin estos el frontend no puede identificar ni agrupar las filas
+		if campo == "id" || campo == "proyecto_id" {
+			return apperrors.InvalidField("campos", fmt.Sprintf("el campo %q no se puede ocultar", campo))
+		}
+		if !seen[campo] {
+			seen[campo] = true
+			campos = append(campos, campo)
+		}
+	}
+
+	if err := database.SetHiddenFields(role, entidad, campos); err != nil {
+		log.Printf("Error en visibilityService.SetHiddenFields (%s, %s): %v", role, entidad, err)
+		return errors.New("error al actualizar campos ocultos")
+	}
+	return nil
+}
+
+// loadRules reúne los campos ocultos por rol y los roles del viewer en cada proyecto
+func (s *visibilityService) loadRules(viewer Viewer) (*rules, error) {
+	list, err := database.GetHiddenFields()
+	if err != nil {
+		return nil, err
+	}
+	projectRoles, err := database.GetProjectRolesOfUser(viewer.UserID)
+	if err != nil {
+		return nil, err
+	}
+	allProjects, err := database.UserHasPermission(viewer.Username, models.PermProyectosAll)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &rules{
+		globalRole:   viewer.Role,
+		allProjects:  allProjects,
+		projectRoles: projectRoles,
+		hidden:       make(map[string]map[string]map[string]bool),
+		cache:        make(map[cacheKey]map[string]bool),
+	}
+	for _, fv := range list {
+		if r.hidden[fv.Role] == nil {
+			r.hidden[fv.Role] = make(map[string]map[string]bool)
+		}
+		campos := make(map[string]bool, len(fv.Campos))
+		for _, c := range fv.Campos {
+			campos[c] = true
+		}
+		r.hidden[fv.Role][fv.Entidad] = campos
+	}
+	return r, nil
+}
+
+func filteredEntityNames() []string {
+	names := make([]string, 0, len(models.FilteredEntities))
+	for name := range models.FilteredEntities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -9,21 +9,49 @@ import (
 	"proyecto/internal/actividades"
 	"proyecto/internal/auth"
 	"proyecto/internal/database"
+	"proyecto/internal/docs"
 	"proyecto/internal/equipos"
 	apphandlers "proyecto/internal/handlers"
 	"proyecto/internal/labores"
 	"proyecto/internal/logger"
+	"proyecto/internal/mail"
 	"proyecto/internal/proyectos"
+	"proyecto/internal/roles"
 	"proyecto/internal/unidades"
 	"proyecto/internal/users"
+	"proyecto/internal/visibility"
 )
 
 func setupApp() http.Handler {
+	handler, _ := buildApp()
+	return handler
+}
+
+// buildApp arma la aplicación y devuelve además los patrones de todas las rutas
+// registradas (las pruebas los recorren para verificar permisos por ruta)
+func buildApp() (http.Handler, []string) {
 	// 1. DEFINIR EL ROUTER (Mux)
-	mux := http.NewServeMux()
+	mux := newRouteMux()
 
 	// 2. INICIALIZAR TODOS LOS SERVICIOS
-	authService := auth.NewAuthService()
+	signingKeys, err := auth.LoadKeyRingFromEnv()
+	if err != nil {
+		log.Fatalf("Configuración de llaves JWT inválida: %v", err)
+	}
+	loginPolicy, err := auth.LoadLoginPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Configuración de login inválida: %v", err)
+	}
+	mailSender := mail.NewSenderFromEnv()
+	providers := []auth.AuthProvider{auth.NewLocalProvider()}
+	oidcConfig, oidcEnabled, err := auth.LoadOIDCConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Configuración OIDC inválida: %v", err)
+	}
+	if oidcEnabled {
+		providers = append(providers, auth.NewOIDCProvider(oidcConfig, nil))
+	}
+	authService := auth.NewAuthService(signingKeys, mailSender, loginPolicy, providers...)
 	loggerService := logger.NewLoggerService()
 
 	userService := users.NewUserService()
@@ -32,11 +60,17 @@ func setupApp() http.Handler {
 	equipoService := equipos.NewEquipoService()
 	actividadService := actividades.NewActividadService()
 	unidadService := unidades.NewUnidadService()
+	roleService := roles.NewRoleService()
+	visibilityService := visibility.NewVisibilityService()
 
 	// 3. INICIALIZAR HANDLERS (Controladores)
 	// Inyectamos los servicios necesarios en cada Handler
 	authHandler := apphandlers.NewAuthHandler(authService, loggerService)
 	userHandler := apphandlers.NewUserHandler(authService, userService, loggerService)
+	roleHandler := apphandlers.NewRoleHandler(authService, roleService, loggerService)
+	visibilityHandler := apphandlers.NewVisibilityHandler(authService, visibilityService, loggerService)
+	serviceAccountHandler := apphandlers.NewServiceAccountHandler(authService, loggerService)
+	invitationHandler := apphandlers.NewInvitationHandler(authService, loggerService)
 	proyectoHandler := apphandlers.NewProyectoHandler(authService, proyectoService, loggerService)
 	laborHandler := apphandlers.NewLaborHandler(authService, laborService, loggerService)
 	equipoHandler := apphandlers.NewEquipoHandler(authService, equipoService, loggerService)
@@ -46,83 +80,200 @@ func setupApp() http.Handler {
 	planHandler := apphandlers.NewPlanHandler(authService, loggerService)
 	recursoHandler := apphandlers.NewRecursoHandler(authService, loggerService)
 	materialHandler := apphandlers.NewMaterialHandler(authService, loggerService)
+	docsHandler := apphandlers.NewDocsHandler()
+
+	// Middleware que valida el token Bearer, deja la identidad en el contexto y
+	// filtra los campos que el rol no puede ver
+	authMiddleware := apphandlers.NewAuthMiddleware(authService, visibilityService)
+	protect := authMiddleware.Require
+	protectAllowingSetup := authMiddleware.RequireAllowingPendingSetup
+	public := func(next http.HandlerFunc) http.Handler { return next }
+
 	// 4. REGISTRAR RUTAS
-	mux.HandleFunc("/", apphandlers.SaludoHandler)
+	// Cada ruta REST de /api/v1 indica su ruta antigua (RPC), que queda como alias
+	// obsoleto hasta que los servicios del frontend migren. Los comodines del path
+	// se pasan al handler en el campo JSON indicado, ya autenticada la petición.
+	id := apphandlers.IntParam("id", "id")
+	proyecto := apphandlers.IntParam("id", "proyecto_id")
+	usuario := apphandlers.IntParam("id", "user_id")
+
+	mux.HandleFunc("/{$}", apphandlers.SaludoHandler)
+
+	//  Documentación (OpenAPI)
+	mux.HandleFunc("GET /api/docs/openapi.json", docsHandler.OpenAPIHandler)
+	mux.HandleFunc("GET /api/docs", docsHandler.UIHandler)
 
 	//  Rutas de Autenticación
-	mux.HandleFunc("/api/auth/register", authHandler.RegisterHandler)
-	mux.HandleFunc("/api/auth/login", authHandler.LoginHandler)
+	mux.route("POST /api/v1/auth/register", "/api/auth/register", public, authHandler.RegisterHandler)
+	mux.route("POST /api/v1/auth/login", "/api/auth/login", public, authHandler.LoginHandler)
+	mux.route("POST /api/v1/auth/refresh", "/api/auth/refresh", public, authHandler.RefreshHandler)
+	mux.route("POST /api/v1/auth/logout", "/api/auth/logout", protectAllowingSetup, authHandler.LogoutHandler)
+	mux.route("PUT /api/v1/auth/password", "/api/auth/change-password", protectAllowingSetup, authHandler.ChangePasswordHandler)
+	mux.route("GET /api/v1/auth/sessions", "/api/auth/sessions", protectAllowingSetup, authHandler.GetSessionsHandler)
+	mux.route("DELETE /api/v1/auth/sessions/{id}", "/api/auth/revoke-session", protectAllowingSetup, authHandler.RevokeSessionHandler, id)
+	mux.route("POST /api/v1/auth/forgot-password", "/api/auth/forgot-password", public, authHandler.ForgotPasswordHandler)
+	mux.route("POST /api/v1/auth/reset-password", "/api/auth/reset-password", public, authHandler.ResetPasswordHandler)
+	mux.route("POST /api/v1/auth/2fa/verify", "/api/auth/2fa/verify", public, authHandler.TwoFactorVerifyHandler)
+	mux.route("GET /api/v1/auth/providers", "/api/auth/providers", public, authHandler.ProvidersHandler)
+	mux.route("GET /api/v1/auth/oidc/login", "/api/auth/oidc/login", public, authHandler.ExternalLoginHandler)
+	mux.route("POST /api/v1/auth/oidc/callback", "/api/auth/oidc/callback", public, authHandler.ExternalCallbackHandler)
+	mux.route("POST /api/v1/auth/2fa/setup", "/api/auth/2fa/setup", protectAllowingSetup, authHandler.TwoFactorSetupHandler)
+	mux.route("POST /api/v1/auth/2fa/enable", "/api/auth/2fa/enable", protectAllowingSetup, authHandler.TwoFactorEnableHandler)
+	mux.route("POST /api/v1/auth/2fa/disable", "/api/auth/2fa/disable", protect, authHandler.TwoFactorDisableHandler)
+	mux.route("GET /api/v1/settings/2fa-policy", "/api/admin/get-2fa-policy", protect, authHandler.GetTwoFactorPolicyHandler)
+	mux.route("PUT /api/v1/settings/2fa-policy", "/api/admin/set-2fa-policy", protect, authHandler.SetTwoFactorPolicyHandler)
+	mux.route("GET /api/v1/settings/registration-policy", "/api/admin/get-registration-policy", protect, authHandler.GetRegistrationPolicyHandler)
+	mux.route("PUT /api/v1/settings/registration-policy", "/api/admin/set-registration-policy", protect, authHandler.SetRegistrationPolicyHandler)
+
+	//  Rutas de Invitaciones (requieren invitations:manage)
+	mux.route("GET /api/v1/invitations", "/api/admin/get-invitations", protect, invitationHandler.GetInvitationsHandler)
+	mux.route("POST /api/v1/invitations", "/api/admin/create-invitation", protect, invitationHandler.CreateInvitationHandler)
+	mux.route("DELETE /api/v1/invitations/{id}", "/api/admin/revoke-invitation", protect, invitationHandler.RevokeInvitationHandler, id)
+
+	//  Rutas de Roles y Permisos (requieren roles:manage)
+	mux.route("GET /api/v1/roles", "/api/admin/get-roles", protect, roleHandler.GetRolesHandler)
+	mux.route("GET /api/v1/permissions", "/api/admin/get-permissions", protect, roleHandler.GetPermissionsHandler)
+	mux.route("POST /api/v1/roles", "/api/admin/create-role", protect, roleHandler.CreateRoleHandler)
+	mux.route("PUT /api/v1/roles/{name}/permissions", "/api/admin/update-role-permissions", protect, roleHandler.UpdateRolePermissionsHandler, apphandlers.TextParam("name", "name"))
+	mux.route("DELETE /api/v1/roles/{name}", "/api/admin/delete-role", protect, roleHandler.DeleteRoleHandler, apphandlers.TextParam("name", "name"))
+	mux.route("GET /api/v1/field-visibility", "/api/admin/get-field-visibility", protect, visibilityHandler.GetFieldVisibilityHandler)
+	mux.route("PUT /api/v1/field-visibility", "/api/admin/set-field-visibility", protect, visibilityHandler.SetFieldVisibilityHandler)
+
+	//  Rutas de Cuentas de servicio y API keys (requieren api-keys:manage)
+	mux.route("GET /api/v1/service-accounts", "/api/admin/get-service-accounts", protect, serviceAccountHandler.GetServiceAccountsHandler)
+	mux.route("POST /api/v1/service-accounts", "/api/admin/create-service-account", protect, serviceAccountHandler.CreateServiceAccountHandler)
+	mux.route("POST /api/v1/service-accounts/{id}/api-keys", "/api/admin/create-api-key", protect, serviceAccountHandler.CreateAPIKeyHandler, apphandlers.IntParam("id", "service_account_id"))
+	mux.route("DELETE /api/v1/api-keys/{id}", "/api/admin/revoke-api-key", protect, serviceAccountHandler.RevokeAPIKeyHandler, id)
 
 	//  Rutas de Usuarios
-	mux.HandleFunc("/api/admin/users", userHandler.AdminUsersHandler)
-	mux.HandleFunc("/api/admin/add-user", userHandler.AdminAddUserHandler)
-	mux.HandleFunc("/api/admin/delete-user", userHandler.AdminDeleteUserHandler)
-	mux.HandleFunc("/api/admin/update-user", userHandler.AdminUpdateUserRoleHandler)
-	mux.HandleFunc("/api/admin/assign-project", userHandler.AdminAssignProjectToUserHandler)
-	mux.HandleFunc("/api/user/project-details", userHandler.UserProjectDetailsHandler)
+	mux.route("GET /api/v1/users", "/api/admin/users", protect, userHandler.AdminUsersHandler)
+	mux.route("POST /api/v1/users", "/api/admin/add-user", protect, userHandler.AdminAddUserHandler)
+	mux.route("POST /api/v1/users/{id}/deactivate", "/api/admin/deactivate-user", protect, userHandler.AdminDeactivateUserHandler, id)
+	mux.alias("/api/admin/delete-user", "POST /api/v1/users/{id}/deactivate", protect(userHandler.AdminDeactivateUserHandler)) // compatibilidad: desactiva
+	mux.route("POST /api/v1/users/{id}/reactivate", "/api/admin/reactivate-user", protect, userHandler.AdminReactivateUserHandler, id)
+	mux.route("PUT /api/v1/users/{id}", "/api/admin/update-user-profile", protect, userHandler.AdminUpdateUserProfileHandler, id)
+	mux.route("PUT /api/v1/users/{id}/role", "/api/admin/update-user", protect, userHandler.AdminUpdateUserRoleHandler, id)
+	mux.route("POST /api/v1/users/{id}/reset-password", "/api/admin/reset-password", protect, userHandler.AdminResetPasswordHandler, id)
+	mux.route("POST /api/v1/users/{id}/unlock", "/api/admin/unlock-user", protect, userHandler.AdminUnlockUserHandler, id)
+	mux.route("GET /api/v1/users/{id}/login-history", "/api/admin/get-login-history", protect, authHandler.GetLoginHistoryHandler, usuario)
+	mux.route("POST /api/v1/users/{id}/impersonate", "/api/admin/impersonate", protect, userHandler.AdminImpersonateHandler, usuario)
+	mux.route("PUT /api/v1/users/{id}/project", "/api/admin/assign-project", protect, userHandler.AdminAssignProjectToUserHandler, usuario)
+	mux.route("GET /api/v1/proyectos/{id}/members", "/api/admin/get-project-members", protect, userHandler.GetProjectMembersHandler, proyecto)
+	mux.route("PUT /api/v1/proyectos/{id}/members/{user_id}", "/api/admin/add-project-member", protect, userHandler.AddProjectMemberHandler, proyecto, apphandlers.IntParam("user_id", "user_id"))
+	mux.route("DELETE /api/v1/proyectos/{id}/members/{user_id}", "/api/admin/remove-project-member", protect, userHandler.RemoveProjectMemberHandler, proyecto, apphandlers.IntParam("user_id", "user_id"))
+	mux.route("GET /api/v1/me/projects", "/api/user/project-details", protect, userHandler.UserProjectDetailsHandler)
+	mux.route("GET /api/v1/me/preferences", "/api/user/get-preferences", protect, userHandler.GetPreferencesHandler)
+	mux.route("PUT /api/v1/me/preferences", "/api/user/set-preferences", protect, userHandler.SetPreferencesHandler)
 
 	//  Rutas de Proyectos
-	mux.HandleFunc("/api/admin/get-proyectos", proyectoHandler.GetProyectosHandler)
-	mux.HandleFunc("/api/admin/create-proyecto", proyectoHandler.CreateProyectoHandler)
-	mux.HandleFunc("/api/admin/update-proyecto", proyectoHandler.UpdateProyectoHandler)
-	mux.HandleFunc("/api/admin/delete-proyecto", proyectoHandler.DeleteProyectoHandler)
-	mux.HandleFunc("/api/admin/set-proyecto-estado", proyectoHandler.AdminSetProyectoEstadoHandler)
+	mux.route("GET /api/v1/proyectos", "/api/admin/get-proyectos", protect, proyectoHandler.GetProyectosHandler)
+	mux.route("POST /api/v1/proyectos", "/api/admin/create-proyecto", protect, proyectoHandler.CreateProyectoHandler)
+	mux.route("PUT /api/v1/proyectos/{id}", "/api/admin/update-proyecto", protect, proyectoHandler.UpdateProyectoHandler, id)
+	mux.route("DELETE /api/v1/proyectos/{id}", "/api/admin/delete-proyecto", protect, proyectoHandler.DeleteProyectoHandler, id)
+	mux.route("PUT /api/v1/proyectos/{id}/estado", "/api/admin/set-proyecto-estado", protect, proyectoHandler.AdminSetProyectoEstadoHandler, id)
 
 	//  Rutas de Labores Agronómicas
-	mux.HandleFunc("/api/admin/get-labores", laborHandler.GetLaboresHandler)
-	mux.HandleFunc("/api/admin/create-labor", laborHandler.CreateLaborHandler)
-	mux.HandleFunc("/api/admin/update-labor", laborHandler.UpdateLaborHandler)
-	mux.HandleFunc("/api/admin/delete-labor", laborHandler.DeleteLaborHandler)
+	mux.route("GET /api/v1/proyectos/{id}/labores", "/api/admin/get-labores", protect, laborHandler.GetLaboresHandler, proyecto)
+	mux.route("POST /api/v1/proyectos/{id}/labores", "/api/admin/create-labor", protect, laborHandler.CreateLaborHandler, proyecto)
+	mux.route("PUT /api/v1/labores/{id}", "/api/admin/update-labor", protect, laborHandler.UpdateLaborHandler, id)
+	mux.route("DELETE /api/v1/labores/{id}", "/api/admin/delete-labor", protect, laborHandler.DeleteLaborHandler, id)
 
 	//  Rutas de Equipos e Implementos
-	mux.HandleFunc("/api/admin/get-equipos", equipoHandler.GetEquiposHandler)
-	mux.HandleFunc("/api/admin/create-equipo", equipoHandler.CreateEquipoHandler)
-	mux.HandleFunc("/api/admin/update-equipo", equipoHandler.UpdateEquipoHandler)
-	mux.HandleFunc("/api/admin/delete-equipo", equipoHandler.DeleteEquipoHandler)
+	mux.route("GET /api/v1/proyectos/{id}/equipos", "/api/admin/get-equipos", protect, equipoHandler.GetEquiposHandler, proyecto)
+	mux.route("POST /api/v1/proyectos/{id}/equipos", "/api/admin/create-equipo", protect, equipoHandler.CreateEquipoHandler, proyecto)
+	mux.route("PUT /api/v1/equipos/{id}", "/api/admin/update-equipo", protect, equipoHandler.UpdateEquipoHandler, id)
+	mux.route("DELETE /api/v1/equipos/{id}", "/api/admin/delete-equipo", protect, equipoHandler.DeleteEquipoHandler, id)
 
 	//  Rutas de Unidades de Medida
-	mux.HandleFunc("/api/admin/get-unidades", unidadHandler.GetUnidadesHandler)
-	mux.HandleFunc("/api/admin/create-unidad", unidadHandler.CreateUnidadHandler)
-	mux.HandleFunc("/api/admin/update-unidad", unidadHandler.UpdateUnidadHandler)
-	mux.HandleFunc("/api/admin/delete-unidad", unidadHandler.DeleteUnidadHandler)
+	mux.route("GET /api/v1/proyectos/{id}/unidades", "/api/admin/get-unidades", protect, unidadHandler.GetUnidadesHandler, proyecto)
+	mux.route("POST /api/v1/proyectos/{id}/unidades", "/api/admin/create-unidad", protect, unidadHandler.CreateUnidadHandler, proyecto)
+	mux.route("PUT /api/v1/unidades/{id}", "/api/admin/update-unidad", protect, unidadHandler.UpdateUnidadHandler, id)
+	mux.route("DELETE /api/v1/unidades/{id}", "/api/admin/delete-unidad", protect, unidadHandler.DeleteUnidadHandler, id)
 
 	//  Rutas de Actividades (Datos del Proyecto)
-	mux.HandleFunc("/api/admin/get-datos-proyecto", actividadHandler.GetDatosProyectoHandler)
-	mux.HandleFunc("/api/admin/create-actividad", actividadHandler.CreateActividadHandler)
-	mux.HandleFunc("/api/admin/update-actividad", actividadHandler.UpdateActividadHandler)
-	mux.HandleFunc("/api/admin/delete-actividad", actividadHandler.DeleteActividadHandler)
+	mux.route("GET /api/v1/proyectos/{id}/actividades", "/api/admin/get-datos-proyecto", protect, actividadHandler.GetDatosProyectoHandler, proyecto)
+	mux.route("POST /api/v1/proyectos/{id}/actividades", "/api/admin/create-actividad", protect, actividadHandler.CreateActividadHandler, proyecto)
+	mux.route("PUT /api/v1/actividades/{id}", "/api/admin/update-actividad", protect, actividadHandler.UpdateActividadHandler, id)
+	mux.route("DELETE /api/v1/actividades/{id}", "/api/admin/delete-actividad", protect, actividadHandler.DeleteActividadHandler, id)
 
 	//  RUTAS DE PLANES DE ACCIÓN (Las 4 operaciones CRUD)
-	mux.HandleFunc("/api/admin/create-plan", planHandler.CreatePlanHandler)
-	mux.HandleFunc("/api/admin/get-planes", planHandler.GetPlanesHandler)
-	mux.HandleFunc("/api/admin/update-plan", planHandler.UpdatePlanHandler)
-	mux.HandleFunc("/api/admin/delete-plan", planHandler.DeletePlanHandler)
+	mux.route("GET /api/v1/proyectos/{id}/planes", "/api/admin/get-planes", protect, planHandler.GetPlanesHandler, proyecto)
+	mux.route("POST /api/v1/proyectos/{id}/planes", "/api/admin/create-plan", protect, planHandler.CreatePlanHandler, proyecto)
+	mux.route("PUT /api/v1/planes/{id}", "/api/admin/update-plan", protect, planHandler.UpdatePlanHandler, id)
+	mux.route("DELETE /api/v1/planes/{id}", "/api/admin/delete-plan", protect, planHandler.DeletePlanHandler, id)
 
 	//  Rutas Logger (Auditoría)
-	mux.HandleFunc("/api/admin/get-logs", loggerHandler.GetLogsHandler)
-	mux.HandleFunc("/api/admin/delete-logs", loggerHandler.DeleteLogsHandler)
-	mux.HandleFunc("/api/admin/delete-logs-range", loggerHandler.DeleteLogsRangeHandler)
+	mux.route("GET /api/v1/logs", "/api/admin/get-logs", protect, loggerHandler.GetLogsHandler)
+	mux.route("DELETE /api/v1/logs", "/api/admin/delete-logs", protect, loggerHandler.DeleteLogsHandler)
+	mux.route("DELETE /api/v1/logs/range", "/api/admin/delete-logs-range", protect, loggerHandler.DeleteLogsRangeHandler)
 
 	//  RUTAS DE RECURSOS HUMANOS
-	mux.HandleFunc("/api/admin/create-recurso", recursoHandler.CreateRecursoHandler)
-	mux.HandleFunc("/api/admin/get-recursos", recursoHandler.GetRecursosHandler)
-	mux.HandleFunc("/api/admin/update-recurso", recursoHandler.UpdateRecursoHandler)
-	mux.HandleFunc("/api/admin/delete-recurso", recursoHandler.DeleteRecursoHandler)
+	mux.route("GET /api/v1/proyectos/{id}/recursos", "/api/admin/get-recursos", protect, recursoHandler.GetRecursosHandler, proyecto)
+	mux.route("POST /api/v1/proyectos/{id}/recursos", "/api/admin/create-recurso", protect, recursoHandler.CreateRecursoHandler, proyecto)
+	mux.route("PUT /api/v1/recursos/{id}", "/api/admin/update-recurso", protect, recursoHandler.UpdateRecursoHandler, id)
+	mux.route("DELETE /api/v1/recursos/{id}", "/api/admin/delete-recurso", protect, recursoHandler.DeleteRecursoHandler, id)
 
 	// ⭐️ RUTAS DE MATERIALES E INSUMOS
-	mux.HandleFunc("/api/admin/create-material", materialHandler.CreateMaterialHandler)
-	mux.HandleFunc("/api/admin/get-materiales", materialHandler.GetMaterialesHandler)
-	mux.HandleFunc("/api/admin/update-material", materialHandler.UpdateMaterialHandler)
-	mux.HandleFunc("/api/admin/delete-material", materialHandler.DeleteMaterialHandler)
+	mux.route("GET /api/v1/proyectos/{id}/materiales", "/api/admin/get-materiales", protect, materialHandler.GetMaterialesHandler, proyecto)
+	mux.route("POST /api/v1/proyectos/{id}/materiales", "/api/admin/create-material", protect, materialHandler.CreateMaterialHandler, proyecto)
+	mux.route("PUT /api/v1/materiales/{id}", "/api/admin/update-material", protect, materialHandler.UpdateMaterialHandler, id)
+	mux.route("DELETE /api/v1/materiales/{id}", "/api/admin/delete-material", protect, materialHandler.DeleteMaterialHandler, id)
+
+	// La especificación se arma con todas las rutas ya registradas
+	docsHandler.SetSpec(docs.Build(mux.routes))
 
 	// 5. CONFIGURAR MIDDLEWARE CORS
 	corsHandler := handlers.CORS(
 		handlers.AllowedOrigins([]string{"http://localhost:3000"}),
 		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "X-API-Key"}),
+		handlers.ExposedHeaders([]string{"X-Impersonated-By", "Deprecation", "Link", "Content-Language"}),
 	)
 
-	return corsHandler(mux)
+	return corsHandler(apphandlers.Localize(mux)), mux.patterns
+}
+
+// routeMux es un http.ServeMux que recuerda los patrones que se registran en él
+// (y, para la especificación OpenAPI, los comodines y el alias de cada ruta)
+type routeMux struct {
+	*http.ServeMux
+	patterns []string
+	routes   []docs.Route
+}
+
+func newRouteMux() *routeMux {
+	return &routeMux{ServeMux: http.NewServeMux()}
+}
+
+func (m *routeMux) Handle(pattern string, handler http.Handler) {
+	m.register(docs.Route{Pattern: pattern}, handler)
+}
+
+func (m *routeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.register(docs.Route{Pattern: pattern}, http.HandlerFunc(handler))
+}
+
+// route registra la ruta REST y su ruta antigua como alias obsoleto. guard es el
+// middleware de autenticación (o public): envuelve a FromREST para que una petición
+// sin credenciales reciba 401 antes de que se validen el path y el cuerpo.
+func (m *routeMux) route(pattern, legacy string, guard func(http.HandlerFunc) http.Handler, handler http.HandlerFunc, params ...apphandlers.PathParam) {
+	route := docs.Route{Pattern: pattern}
+	for _, p := range params {
+		route.Params = append(route.Params, docs.Param{Name: p.Name, Field: p.Field, Text: p.Text})
+	}
+	m.register(route, guard(apphandlers.FromREST(handler, params...)))
+	m.alias(legacy, pattern, guard(handler))
+}
+
+// alias registra una ruta antigua que se sigue atendiendo con el handler de successor
+func (m *routeMux) alias(legacy, successor string, handler http.Handler) {
+	m.register(docs.Route{Pattern: legacy, Successor: successor}, apphandlers.Deprecated(handler, successor))
+}
+
+func (m *routeMux) register(route docs.Route, handler http.Handler) {
+	m.patterns = append(m.patterns, route.Pattern)
+	m.routes = append(m.routes, route)
+	m.ServeMux.Handle(route.Pattern, handler)
 }
 
 func main() {
@@ -2,15 +2,28 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"proyecto/internal/auth"
+	"proyecto/internal/cedula"
 	"proyecto/internal/database"
 	"proyecto/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 var (
@@ -83,10 +96,9 @@ func TestFlujoCompleto(t *testing.T) {
 	// 3. PROYECTO (Happy Path)
 	t.Run("3. Crear Proyecto", func(t *testing.T) {
 		payload := map[string]interface{}{
-			"nombre":         "Proyecto Maíz 2025",
-			"fecha_inicio":   "2025-01-01",
-			"fecha_cierre":   "2025-12-31",
-			"admin_username": adminUsername,
+			"nombre":       "Proyecto Maíz 2025",
+			"fecha_inicio": "2025-01-01",
+			"fecha_cierre": "2025-12-31",
 		}
 		w := performRequest(router, "POST", "/api/admin/create-proyecto", payload, authToken)
 
@@ -99,12 +111,11 @@ func TestFlujoCompleto(t *testing.T) {
 	// 4. UNIDAD (Happy Path)
 	t.Run("4. Crear Unidad de Medida", func(t *testing.T) {
 		payload := map[string]interface{}{
-			"proyecto_id":    proyectoID,
-			"nombre":         "Litros",
-			"abreviatura":    "Lts",
-			"tipo":           "Volumen",
-			"dimension":      1,
-			"admin_username": adminUsername,
+			"proyecto_id": proyectoID,
+			"nombre":      "Litros",
+			"abreviatura": "Lts",
+			"tipo":        "Volumen",
+			"dimension":   1,
 		}
 		w := performRequest(router, "POST", "/api/admin/create-unidad", payload, authToken)
 		if w.Code != http.StatusCreated {
@@ -115,12 +126,11 @@ func TestFlujoCompleto(t *testing.T) {
 	// 5. EQUIPO (Happy Path)
 	t.Run("5. Crear Equipo/Implemento", func(t *testing.T) {
 		payload := map[string]interface{}{
-			"proyecto_id":    proyectoID,
-			"codigo_equipo":  "TR-01",
-			"nombre":         "Tractor John Deere",
-			"tipo":           "Equipo",
-			"estado":         "Operativo",
-			"admin_username": adminUsername,
+			"proyecto_id":   proyectoID,
+			"codigo_equipo": "TR-01",
+			"nombre":        "Tractor John Deere",
+			"tipo":          "Equipo",
+			"estado":        "Operativo",
 		}
 		w := performRequest(router, "POST", "/api/admin/create-equipo", payload, authToken)
 		if w.Code != http.StatusCreated {
@@ -132,10 +142,9 @@ func TestFlujoCompleto(t *testing.T) {
 	// 6. LABOR (Happy Path)
 	t.Run("6. Crear Labor Agronómica", func(t *testing.T) {
 		payload := map[string]interface{}{
-			"proyecto_id":    proyectoID,
-			"codigo_labor":   "L-01",
-			"descripcion":    "Riego por Goteo",
-			"admin_username": adminUsername,
+			"proyecto_id":  proyectoID,
+			"codigo_labor": "L-01",
+			"descripcion":  "Riego por Goteo",
 		}
 		w := performRequest(router, "POST", "/api/admin/create-labor", payload, authToken)
 		if w.Code != http.StatusCreated {
@@ -157,7 +166,6 @@ func TestFlujoCompleto(t *testing.T) {
 			"cantidad":       50,
 			"costo_unitario": 25.5,
 			"monto":          1275.0,
-			"admin_username": adminUsername,
 		}
 		w := performRequest(router, "POST", "/api/admin/create-material", payload, authToken)
 		if w.Code != http.StatusOK && w.Code != http.StatusCreated {
@@ -191,9 +199,10 @@ func TestFlujoCompleto(t *testing.T) {
 
 		// C. Intentar borrar el Proyecto (Acción reservada para Admins)
 
+		// El campo admin_username ya no se usa: se intenta suplantar al admin sin éxito
 		delPayload := map[string]interface{}{
 			"id":             proyectoID,
-			"admin_username": intruderName,
+			"admin_username": "admin",
 		}
 
 		// Usamos el token del intruso
@@ -208,24 +217,2195 @@ func TestFlujoCompleto(t *testing.T) {
 		}
 	})
 
-	time.Sleep(200 * time.Millisecond)
-}
+	// 10. PETICIÓN SIN TOKEN
+	t.Run("10. Acceso sin token Bearer", func(t *testing.T) {
+		payload := map[string]interface{}{
+			"proyecto_id": proyectoID,
+		}
+		w := performRequest(router, "POST", "/api/admin/get-labores", payload, "")
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 sin token. Código: %d", w.Code)
+		}
 
-// Helper para realizar peticiones HTTP en el test
-func performRequest(r http.Handler, method, path string, payload interface{}, token string) *httptest.ResponseRecorder {
-	var reqBody []byte
-	if payload != nil {
-		reqBody, _ = json.Marshal(payload)
-	}
+		w = performRequest(router, "POST", "/api/admin/get-labores", payload, "token-falso")
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 con token inválido. Código: %d", w.Code)
+		}
+	})
 
-	req, _ := http.NewRequest(method, path, bytes.NewBuffer(reqBody))
-	req.Header.Set("Content-Type", "application/json")
+	// 11. REFRESH Y LOGOUT
+	t.Run("11. Refresh y Logout", func(t *testing.T) {
+		loginPayload := map[string]string{
+			"username": adminUsername,
+			"password": "password123",
+		}
+		wLogin := performRequest(router, "POST", "/api/auth/login", loginPayload, "")
+		var session models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &session)
+		if session.RefreshToken == "" {
+			t.Fatalf("El login no devolvió refresh_token: %s", wLogin.Body.String())
+		}
 
-	if token != "" {
-		req.Header.Set("Authorization", "Bearer "+token)
-	}
+		// A. Canjear el refresh token por un par nuevo
+		w := performRequest(router, "POST", "/api/auth/refresh", map[string]string{"refresh_token": session.RefreshToken}, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Falló refresh. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var refreshed models.LoginResponse
+		json.Unmarshal(w.Body.Bytes(), &refreshed)
 
-	w := httptest.NewRecorder()
-	r.ServeHTTP(w, req)
-	return w
+		// B. El refresh token anterior ya fue rotado
+		w = performRequest(router, "POST", "/api/auth/refresh", map[string]string{"refresh_token": session.RefreshToken}, "")
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 al reutilizar refresh token. Código: %d", w.Code)
+		}
+
+		// C. Logout: el access token de la sesión deja de servir
+		w = performRequest(router, "POST", "/api/auth/logout", nil, refreshed.Token)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Falló logout. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		w = performRequest(router, "POST", "/api/admin/get-labores", map[string]interface{}{"proyecto_id": proyectoID}, refreshed.Token)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 tras logout. Código: %d", w.Code)
+		}
+		w = performRequest(router, "POST", "/api/auth/refresh", map[string]string{"refresh_token": refreshed.RefreshToken}, "")
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 al refrescar una sesión cerrada. Código: %d", w.Code)
+		}
+
+		// D. La sesión original del admin sigue activa
+		w = performRequest(router, "POST", "/api/admin/get-labores", map[string]interface{}{"proyecto_id": proyectoID}, authToken)
+		if w.Code != http.StatusOK {
+			t.Errorf("El logout afectó a otra sesión. Código: %d", w.Code)
+		}
+	})
+
+	// 12. ROTACIÓN DE LLAVES JWT
+	t.Run("12. Rotación de llaves de firma", func(t *testing.T) {
+		nuevaLlave := "llave-nueva-de-rotacion-0123456789abcdef"
+		labores := map[string]interface{}{"proyecto_id": proyectoID}
+
+		// A. Se agrega una llave nueva como activa: los tokens viejos siguen valiendo
+		t.Setenv("JWT_KEYS", "dev:mi_llave_secreta_super_segura_12345,k2:"+nuevaLlave)
+		t.Setenv("JWT_ACTIVE_KID", "k2")
+		rotado := setupApp()
+
+		w := performRequest(rotado, "POST", "/api/admin/get-labores", labores, authToken)
+		if w.Code != http.StatusOK {
+			t.Errorf("El token firmado con la llave anterior debía seguir activo. Código: %d", w.Code)
+		}
+
+		wLogin := performRequest(rotado, "POST", "/api/auth/login", map[string]string{"username": adminUsername, "password": "password123"}, "")
+		var resp models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &resp)
+		if w = performRequest(rotado, "POST", "/api/admin/get-labores", labores, resp.Token); w.Code != http.StatusOK {
+			t.Errorf("El token firmado con la llave nueva fue rechazado. Código: %d", w.Code)
+		}
+
+		// B. Se retira la llave vieja: sus tokens fallan con un error explícito
+		t.Setenv("JWT_KEYS", "k2:"+nuevaLlave)
+		t.Setenv("JWT_RETIRED_KIDS", "dev")
+		retirado := setupApp()
+
+		w = performRequest(retirado, "POST", "/api/admin/get-labores", labores, authToken)
+		if w.Code != http.StatusUnauthorized || !bytes.Contains(w.Body.Bytes(), []byte("llave retirada")) {
+			t.Errorf("Se esperaba 401 por llave retirada. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w = performRequest(retirado, "POST", "/api/admin/get-labores", labores, resp.Token); w.Code != http.StatusOK {
+			t.Errorf("El token de la llave activa fue rechazado tras retirar la vieja. Código: %d", w.Code)
+		}
+	})
+
+	// 13. CAMBIO Y RESTABLECIMIENTO DE CONTRASEÑA
+	t.Run("13. Reset de contraseña por admin y cambio obligatorio", func(t *testing.T) {
+		var pepeID int
+		database.DB.QueryRow("SELECT id FROM users WHERE username = 'pepe_intruso'").Scan(&pepeID)
+
+		// A. Solo el admin puede restablecer contraseñas
+		w := performRequest(router, "POST", "/api/admin/reset-password", map[string]int{"id": pepeID}, authToken)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Falló reset de contraseña. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var reset models.ResetPasswordResponse
+		json.Unmarshal(w.Body.Bytes(), &reset)
+
+		// B. Login con la temporal: exige cambio y bloquea el resto de la API
+		wLogin := performRequest(router, "POST", "/api/auth/login", map[string]string{"username": "pepe_intruso", "password": reset.TemporaryPassword}, "")
+		var session models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &session)
+		if wLogin.Code != http.StatusOK || !session.MustChangePassword {
+			t.Fatalf("Se esperaba login con must_change_password. Código: %d, Resp: %s", wLogin.Code, wLogin.Body.String())
+		}
+		w = performRequest(router, "GET", "/api/user/project-details", nil, session.Token)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 con contraseña temporal. Código: %d", w.Code)
+		}
+
+		// C. Cambio con contraseña actual incorrecta
+		w = performRequest(router, "POST", "/api/auth/change-password", map[string]string{"current_password": "otra-cosa", "new_password": "nueva-clave-123"}, session.Token)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Se esperaba 400 con contraseña actual incorrecta. Código: %d", w.Code)
+		}
+
+		// D. Cambio correcto: la API se desbloquea
+		w = performRequest(router, "POST", "/api/auth/change-password", map[string]string{"current_password": reset.TemporaryPassword, "new_password": "nueva-clave-123"}, session.Token)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Falló cambio de contraseña. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		w = performRequest(router, "GET", "/api/user/project-details", nil, session.Token)
+		if w.Code != http.StatusOK {
+			t.Errorf("La API siguió bloqueada tras cambiar la contraseña. Código: %d", w.Code)
+		}
+		wLogin = performRequest(router, "POST", "/api/auth/login", map[string]string{"username": "pepe_intruso", "password": reset.TemporaryPassword}, "")
+		if wLogin.Code != http.StatusUnauthorized {
+			t.Errorf("La contraseña temporal siguió funcionando. Código: %d", wLogin.Code)
+		}
+	})
+
+	// 14. RECUPERACIÓN DE CONTRASEÑA
+	t.Run("14. Recuperación de contraseña por correo", func(t *testing.T) {
+		regPayload := map[string]string{
+			"username": "maria_olvido",
+			"password": "password123",
+			"nombre":   "Maria",
+			"apellido": "Olvido",
+			"cedula":   "V-777777",
+			"email":    "maria@example.com",
+		}
+		performRequest(router, "POST", "/api/auth/register", regPayload, "")
+
+		// A. Usuario inexistente: misma respuesta, sin correo
+		w := performRequest(router, "POST", "/api/auth/forgot-password", map[string]string{"username": "no_existe"}, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("Se esperaba 200 para usuario inexistente. Código: %d", w.Code)
+		}
+
+		// B. Solicitud real: el correo queda en la bandeja de salida
+		w = performRequest(router, "POST", "/api/auth/forgot-password", map[string]string{"username": "maria_olvido"}, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Falló forgot-password. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var cuerpo string
+		err := database.DB.QueryRow("SELECT cuerpo FROM mail_outbox WHERE destinatario = ? ORDER BY id DESC LIMIT 1", "maria@example.com").Scan(&cuerpo)
+		if err != nil {
+			t.Fatalf("No se encontró el correo en mail_outbox: %v", err)
+		}
+		match := regexp.MustCompile(`token=([A-Za-z0-9_-]+)`).FindStringSubmatch(cuerpo)
+		if match == nil {
+			t.Fatalf("El correo no contiene el token: %s", cuerpo)
+		}
+
+		// C. Canje del token y login con la contraseña nueva
+		resetPayload := map[string]string{"token": match[1], "new_password": "clave-recuperada"}
+		w = performRequest(router, "POST", "/api/auth/reset-password", resetPayload, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Falló reset-password. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		wLogin := performRequest(router, "POST", "/api/auth/login", map[string]string{"username": "maria_olvido", "password": "clave-recuperada"}, "")
+		if wLogin.Code != http.StatusOK {
+			t.Errorf("No se pudo iniciar sesión con la contraseña recuperada. Código: %d", wLogin.Code)
+		}
+
+		// D. El token es de un solo uso
+		w = performRequest(router, "POST", "/api/auth/reset-password", map[string]string{"token": match[1], "new_password": "otra-clave-123"}, "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Se esperaba 400 al reutilizar el token. Código: %d", w.Code)
+		}
+	})
+
+	// 15. PROTECCIÓN CONTRA FUERZA BRUTA
+	t.Run("15. Bloqueo de cuenta y backoff por IP", func(t *testing.T) {
+		regPayload := map[string]string{
+			"username": "victima_fb",
+			"password": "password123",
+			"nombre":   "Victor",
+			"apellido": "Ima",
+			"cedula":   "V-555555",
+		}
+		performRequest(router, "POST", "/api/auth/register", regPayload, "")
+		malos := map[string]string{"username": "victima_fb", "password": "incorrecta"}
+		buenos := map[string]string{"username": "victima_fb", "password": "password123"}
+
+		// A. Cinco fallos (desde IPs distintas) bloquean la cuenta
+		var w *httptest.ResponseRecorder
+		for i := 1; i <= 5; i++ {
+			w = performRequestFrom(router, "POST", "/api/auth/login", malos, "", fmt.Sprintf("10.0.0.%d:5000", i))
+		}
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Fatalf("Se esperaba 429 con Retry-After al bloquear la cuenta. Código: %d", w.Code)
+		}
+
+		// B. Bloqueada, ni la contraseña correcta entra
+		w = performRequestFrom(router, "POST", "/api/auth/login", buenos, "", "10.0.0.9:5000")
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("La cuenta bloqueada permitió el login. Código: %d", w.Code)
+		}
+
+		// C. El admin la desbloquea
+		var victimaID int
+		database.DB.QueryRow("SELECT id FROM users WHERE username = 'victima_fb'").Scan(&victimaID)
+		w = performRequest(router, "POST", "/api/admin/unlock-user", map[string]int{"id": victimaID}, authToken)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Falló unlock-user. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		w = performRequestFrom(router, "POST", "/api/auth/login", buenos, "", "10.0.0.9:5000")
+		if w.Code != http.StatusOK {
+			t.Errorf("No se pudo iniciar sesión tras el desbloqueo. Código: %d", w.Code)
+		}
+
+		// D. Backoff por IP: superados los intentos libres, la IP debe esperar
+		t.Setenv("LOGIN_IP_FREE_ATTEMPTS", "2")
+		estricto := setupApp()
+		desconocido := map[string]string{"username": "no_existe", "password": "x"}
+		performRequestFrom(estricto, "POST", "/api/auth/login", desconocido, "", "10.9.9.9:5000")
+		performRequestFrom(estricto, "POST", "/api/auth/login", desconocido, "", "10.9.9.9:5000")
+		// Con exactamente los intentos libres consumidos aún no hay espera
+		w = performRequestFrom(estricto, "POST", "/api/auth/login", desconocido, "", "10.9.9.9:5000")
+		if w.Code == http.StatusTooManyRequests {
+			t.Errorf("El backoff se aplicó antes de agotar los intentos libres. Código: %d", w.Code)
+		}
+		w = performRequestFrom(estricto, "POST", "/api/auth/login", buenos, "", "10.9.9.9:5000")
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("Se esperaba 429 por backoff de IP. Código: %d", w.Code)
+		}
+		w = performRequestFrom(estricto, "POST", "/api/auth/login", buenos, "", "10.9.9.10:5000")
+		if w.Code != http.StatusOK {
+			t.Errorf("El backoff afectó a otra IP. Código: %d", w.Code)
+		}
+	})
+
+	// 16. VERIFICACIÓN EN DOS PASOS (TOTP)
+	t.Run("16. 2FA obligatorio para gerentes", func(t *testing.T) {
+		regPayload := map[string]string{
+			"username": "gerente_2fa",
+			"password": "password123",
+			"nombre":   "Gema",
+			"apellido": "Rente",
+			"cedula":   "V-444444",
+		}
+		performRequest(router, "POST", "/api/auth/register", regPayload, "")
+		database.DB.Exec("UPDATE users SET role = 'gerente' WHERE username = 'gerente_2fa'")
+		credenciales := map[string]string{"username": "gerente_2fa", "password": "password123"}
+
+		// A. El admin exige 2FA a los gerentes
+		w := performRequest(router, "POST", "/api/admin/set-2fa-policy", map[string][]string{"required_roles": {"gerente"}}, authToken)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Falló set-2fa-policy. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		defer performRequest(router, "POST", "/api/admin/set-2fa-policy", map[string][]string{"required_roles": {}}, authToken)
+
+		// B. Sin 2FA activo, el gerente solo puede enrolarse
+		wLogin := performRequest(router, "POST", "/api/auth/login", credenciales, "")
+		var session models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &session)
+		if !session.TwoFactorSetupRequired {
+			t.Fatalf("Se esperaba two_factor_setup_required. Resp: %s", wLogin.Body.String())
+		}
+		if w = performRequest(router, "GET", "/api/admin/get-proyectos", nil, session.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 antes de activar 2FA. Código: %d", w.Code)
+		}
+
+		// C. Enrolamiento
+		w = performRequest(router, "POST", "/api/auth/2fa/setup", nil, session.Token)
+		var setup models.TwoFactorSetupResponse
+		json.Unmarshal(w.Body.Bytes(), &setup)
+		if w.Code != http.StatusOK || setup.ProvisioningURI == "" {
+			t.Fatalf("Falló 2fa/setup. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		code, _ := auth.GenerateTOTP(setup.Secret, time.Now())
+		w = performRequest(router, "POST", "/api/auth/2fa/enable", map[string]string{"code": code}, session.Token)
+		var enabled models.TwoFactorEnableResponse
+		json.Unmarshal(w.Body.Bytes(), &enabled)
+		if w.Code != http.StatusOK || len(enabled.RecoveryCodes) == 0 {
+			t.Fatalf("Falló 2fa/enable. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// D. El login ahora devuelve un desafío en vez del token
+		wLogin = performRequest(router, "POST", "/api/auth/login", credenciales, "")
+		var step models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &step)
+		if !step.TwoFactorRequired || step.Token != "" || step.ChallengeToken == "" {
+			t.Fatalf("Se esperaba el desafío 2FA. Resp: %s", wLogin.Body.String())
+		}
+		if w = performRequest(router, "GET", "/api/admin/get-proyectos", nil, step.ChallengeToken); w.Code != http.StatusUnauthorized {
+			t.Errorf("El desafío no debe servir como access token. Código: %d", w.Code)
+		}
+
+		// E. El código usado en el enrolamiento no se puede repetir; el siguiente sí
+		w = performRequest(router, "POST", "/api/auth/2fa/verify", map[string]string{"challenge_token": step.ChallengeToken, "code": code}, "")
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Se aceptó un código TOTP reutilizado. Código: %d", w.Code)
+		}
+		next, _ := auth.GenerateTOTP(setup.Secret, time.Now().Add(30*time.Second))
+		w = performRequest(router, "POST", "/api/auth/2fa/verify", map[string]string{"challenge_token": step.ChallengeToken, "code": next}, "")
+		var verified models.LoginResponse
+		json.Unmarshal(w.Body.Bytes(), &verified)
+		if w.Code != http.StatusOK || verified.Token == "" {
+			t.Fatalf("Falló 2fa/verify. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w = performRequest(router, "GET", "/api/admin/get-proyectos", nil, verified.Token); w.Code != http.StatusOK {
+			t.Errorf("El token tras 2FA fue rechazado. Código: %d", w.Code)
+		}
+
+		// F. Códigos de recuperación: un solo uso
+		recovery := map[string]string{"challenge_token": step.ChallengeToken, "recovery_code": enabled.RecoveryCodes[0]}
+		if w = performRequest(router, "POST", "/api/auth/2fa/verify", recovery, ""); w.Code != http.StatusOK {
+			t.Errorf("Falló el login con código de recuperación. Código: %d", w.Code)
+		}
+		if w = performRequest(router, "POST", "/api/auth/2fa/verify", recovery, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("Se aceptó un código de recuperación reutilizado. Código: %d", w.Code)
+		}
+	})
+
+	t.Run("17. Roles y permisos configurables", func(t *testing.T) {
+		// A. El admin crea un rol que solo puede leer el log de auditoría
+		rol := map[string]interface{}{"name": "lector_logs", "descripcion": "Consulta de auditoría", "permissions": []string{models.PermLogsRead}}
+		if w := performRequest(router, "POST", "/api/admin/create-role", rol, authToken); w.Code != http.StatusCreated {
+			t.Fatalf("Falló create-role. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		malo := map[string]interface{}{"name": "rol_malo", "permissions": []string{"logs:todo"}}
+		if w := performRequest(router, "POST", "/api/admin/create-role", malo, authToken); w.Code != http.StatusBadRequest {
+			t.Errorf("Se aceptó un permiso inexistente. Código: %d", w.Code)
+		}
+
+		// B. Se asigna el rol a un usuario nuevo
+		regPayload := map[string]string{
+			"username": "lector_test",
+			"password": "password123",
+			"nombre":   "Lector",
+			"apellido": "Logs",
+			"cedula":   "V-888888",
+		}
+		performRequest(router, "POST", "/api/auth/register", regPayload, "")
+		var userID int
+		database.DB.QueryRow("SELECT id FROM users WHERE username = 'lector_test'").Scan(&userID)
+		if w := performRequest(router, "POST", "/api/admin/update-user", models.UpdateRoleRequest{ID: userID, NewRole: "lector_logs"}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló update-user-role. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "POST", "/api/admin/update-user", models.UpdateRoleRequest{ID: userID, NewRole: "inexistente"}, authToken); w.Code == http.StatusOK {
+			t.Errorf("Se asignó un rol inexistente")
+		}
+
+		// C. El permiso decide el acceso, no el nombre del rol
+		wLogin := performRequest(router, "POST", "/api/auth/login", map[string]string{"username": "lector_test", "password": "password123"}, "")
+		var session models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &session)
+		if w := performRequest(router, "POST", "/api/admin/get-logs", map[string]string{}, session.Token); w.Code != http.StatusOK {
+			t.Errorf("logs:read no permitió ver el log. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "POST", "/api/admin/delete-logs", map[string][]int{"ids": {}}, session.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 sin logs:delete. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "POST", "/api/admin/get-labores", map[string]int{"proyecto_id": 1}, session.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 sin labores:read. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "GET", "/api/admin/get-roles", nil, session.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 sin roles:manage. Código: %d", w.Code)
+		}
+
+		// D. Cambiar los permisos del rol surte efecto sin volver a iniciar sesión
+		// (sin ser miembro del proyecto, labores:read solo vale junto con proyectos:all)
+		update := models.UpdateRolePermissionsRequest{Name: "lector_logs", Permissions: []string{models.PermLogsRead, models.PermLaboresRead, models.PermProyectosAll}}
+		if w := performRequest(router, "POST", "/api/admin/update-role-permissions", update, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló update-role-permissions. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "POST", "/api/admin/get-labores", map[string]int{"proyecto_id": 1}, session.Token); w.Code != http.StatusOK {
+			t.Errorf("labores:read no se aplicó. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// E. Reglas de protección
+		sinGestion := models.UpdateRolePermissionsRequest{Name: "admin", Permissions: []string{models.PermLogsRead}}
+		if w := performRequest(router, "POST", "/api/admin/update-role-permissions", sinGestion, authToken); w.Code != http.StatusBadRequest {
+			t.Errorf("El admin no debe perder roles:manage. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "POST", "/api/admin/delete-role", models.DeleteRoleRequest{Name: "gerente"}, authToken); w.Code != http.StatusForbidden {
+			t.Errorf("Se borró un rol del sistema. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "POST", "/api/admin/delete-role", models.DeleteRoleRequest{Name: "lector_logs"}, authToken); w.Code != http.StatusConflict {
+			t.Errorf("Se borró un rol con usuarios asignados. Código: %d", w.Code)
+		}
+		performRequest(router, "POST", "/api/admin/update-user", models.UpdateRoleRequest{ID: userID, NewRole: "user"}, authToken)
+		miembro := models.AddProjectMemberRequest{UserID: userID, ProyectoID: proyectoID, Role: "lector_logs"}
+		if w := performRequest(router, "POST", "/api/admin/add-project-member", miembro, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló add-project-member con el rol propio. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "POST", "/api/admin/delete-role", models.DeleteRoleRequest{Name: "lector_logs"}, authToken); w.Code != http.StatusConflict {
+			t.Errorf("Se borró un rol usado en una membresía de proyecto. Código: %d", w.Code)
+		}
+		performRequest(router, "POST", "/api/admin/remove-project-member", models.RemoveProjectMemberRequest{UserID: userID, ProyectoID: proyectoID}, authToken)
+		if w := performRequest(router, "POST", "/api/admin/delete-role", models.DeleteRoleRequest{Name: "lector_logs"}, authToken); w.Code != http.StatusOK {
+			t.Errorf("Falló delete-role. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("18. Varios proyectos por usuario con rol por proyecto", func(t *testing.T) {
+		otros := make([]int, 0, 2)
+		for _, nombre := range []string{"Finca Norte", "Finca Sur"} {
+			payload := map[string]string{"nombre": nombre, "fecha_inicio": "2025-01-01", "fecha_cierre": "2025-12-31"}
+			if w := performRequest(router, "POST", "/api/admin/create-proyecto", payload, authToken); w.Code != http.StatusCreated {
+				t.Fatalf("Error creando proyecto %s: %d - %s", nombre, w.Code, w.Body.String())
+			}
+			var id int
+			database.DB.QueryRow("SELECT id FROM proyectos WHERE nombre = ?", nombre).Scan(&id)
+			otros = append(otros, id)
+		}
+		norte, sur := otros[0], otros[1]
+
+		regPayload := map[string]string{
+			"username": "agronomo_multi",
+			"password": "password123",
+			"nombre":   "Ana",
+			"apellido": "Gronoma",
+			"cedula":   "V-121212",
+		}
+		performRequest(router, "POST", "/api/auth/register", regPayload, "")
+		var userID int
+		database.DB.QueryRow("SELECT id FROM users WHERE username = 'agronomo_multi'").Scan(&userID)
+
+		// A. Gerente en un proyecto, usuario regular en otro
+		if w := performRequest(router, "POST", "/api/admin/add-project-member", models.AddProjectMemberRequest{UserID: userID, ProyectoID: proyectoID, Role: "gerente"}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló add-project-member. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "POST", "/api/admin/add-project-member", models.AddProjectMemberRequest{UserID: userID, ProyectoID: norte}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló add-project-member sin rol. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "POST", "/api/admin/add-project-member", models.AddProjectMemberRequest{UserID: userID, ProyectoID: norte, Role: "capataz"}, authToken); w.Code != http.StatusBadRequest {
+			t.Errorf("Se aceptó un rol inexistente. Código: %d", w.Code)
+		}
+
+		// B. assign-project ya no reemplaza: suma un proyecto más
+		if w := performRequest(router, "POST", "/api/admin/assign-project", models.AssignProjectRequest{UserID: userID, ProyectoID: sur}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló assign-project. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		wLogin := performRequest(router, "POST", "/api/auth/login", map[string]string{"username": "agronomo_multi", "password": "password123"}, "")
+		var session models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &session)
+
+		w := performRequest(router, "POST", "/api/user/project-details", nil, session.Token)
+		var details models.UserProjectDetailsResponse
+		json.Unmarshal(w.Body.Bytes(), &details)
+		if w.Code != http.StatusOK || len(details.Proyectos) != 3 {
+			t.Fatalf("Se esperaban 3 proyectos. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if details.Proyecto == nil || details.Proyecto.ID != proyectoID || details.Proyectos[0].Role != "gerente" {
+			t.Errorf("El primer proyecto debe ser el asignado primero, con rol gerente. Resp: %s", w.Body.String())
+		}
+
+		// C. La autorización usa el rol dentro del proyecto
+		if w := performRequest(router, "POST", "/api/admin/get-labores", map[string]int{"proyecto_id": proyectoID}, session.Token); w.Code != http.StatusOK {
+			t.Errorf("Como gerente del proyecto debería ver sus labores. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "POST", "/api/admin/get-labores", map[string]int{"proyecto_id": norte}, session.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Como usuario regular no debería ver labores. Código: %d", w.Code)
+		}
+
+		// D. Listado y baja de miembros
+		w = performRequest(router, "POST", "/api/admin/get-project-members", map[string]int{"proyecto_id": proyectoID}, authToken)
+		var members struct {
+			Miembros []models.ProjectMember `json:"miembros"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &members)
+		found := false
+		for _, m := range members.Miembros {
+			found = found || (m.ID == userID && m.Role == "gerente")
+		}
+		if w.Code != http.StatusOK || !found {
+			t.Errorf("El miembro no aparece con su rol. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "POST", "/api/admin/remove-project-member", models.RemoveProjectMemberRequest{UserID: userID, ProyectoID: sur}, authToken); w.Code != http.StatusOK {
+			t.Errorf("Falló remove-project-member. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		w = performRequest(router, "POST", "/api/user/project-details", nil, session.Token)
+		details = models.UserProjectDetailsResponse{}
+		json.Unmarshal(w.Body.Bytes(), &details)
+		if len(details.Proyectos) != 2 {
+			t.Errorf("Se esperaban 2 proyectos tras la baja. Resp: %s", w.Body.String())
+		}
+	})
+
+	t.Run("19. Gerente limitado a sus proyectos", func(t *testing.T) {
+		var norte int
+		database.DB.QueryRow("SELECT id FROM proyectos WHERE nombre = 'Finca Norte'").Scan(&norte)
+
+		regPayload := map[string]string{
+			"username": "gerente_norte",
+			"password": "password123",
+			"nombre":   "Gerardo",
+			"apellido": "Norte",
+			"cedula":   "V-131313",
+		}
+		performRequest(router, "POST", "/api/auth/register", regPayload, "")
+		var gerenteID int
+		database.DB.QueryRow("SELECT id FROM users WHERE username = 'gerente_norte'").Scan(&gerenteID)
+		performRequest(router, "POST", "/api/admin/update-user", models.UpdateRoleRequest{ID: gerenteID, NewRole: "gerente"}, authToken)
+		if w := performRequest(router, "POST", "/api/admin/add-project-member", models.AddProjectMemberRequest{UserID: gerenteID, ProyectoID: norte}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló add-project-member. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		wLogin := performRequest(router, "POST", "/api/auth/login", map[string]string{"username": "gerente_norte", "password": "password123"}, "")
+		var session models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &session)
+
+		// A. En su proyecto trabaja normalmente
+		if w := performRequest(router, "POST", "/api/admin/get-labores", map[string]int{"proyecto_id": norte}, session.Token); w.Code != http.StatusOK {
+			t.Errorf("El gerente no pudo ver labores de su proyecto. Código: %d", w.Code)
+		}
+		labor := map[string]interface{}{"proyecto_id": norte, "codigo_labor": "LN-01", "descripcion": "Poda"}
+		if w := performRequest(router, "POST", "/api/admin/create-labor", labor, session.Token); w.Code != http.StatusCreated {
+			t.Errorf("El gerente no pudo crear una labor en su proyecto. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// B. En proyectos ajenos recibe 403
+		if w := performRequest(router, "POST", "/api/admin/get-labores", map[string]int{"proyecto_id": proyectoID}, session.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 en get-labores de otro proyecto. Código: %d", w.Code)
+		}
+		equipo := map[string]interface{}{"proyecto_id": proyectoID, "codigo_equipo": "TR-99", "nombre": "Tractor", "tipo": "Equipo", "estado": "Operativo"}
+		if w := performRequest(router, "POST", "/api/admin/create-equipo", equipo, session.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 en create-equipo de otro proyecto. Código: %d", w.Code)
+		}
+		update := models.UpdateLaborRequest{ID: laborID, CodigoLabor: "L-01", Descripcion: "Cambiada", Estado: "Activo"}
+		if w := performRequest(router, "POST", "/api/admin/update-labor", update, session.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 al modificar una labor de otro proyecto. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "POST", "/api/admin/delete-equipo", map[string]int{"id": equipoID}, session.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 al borrar un equipo de otro proyecto. Código: %d", w.Code)
+		}
+
+		// C. Los listados solo muestran lo suyo
+		w := performRequest(router, "GET", "/api/admin/get-proyectos", nil, session.Token)
+		var lista struct {
+			Proyectos []models.Proyecto `json:"proyectos"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &lista)
+		if w.Code != http.StatusOK || len(lista.Proyectos) != 1 || lista.Proyectos[0].ID != norte {
+			t.Errorf("El gerente debe ver solo su proyecto. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		w = performRequest(router, "GET", "/api/admin/users", nil, session.Token)
+		var usuarios struct {
+			Users []models.UserListResponse `json:"users"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &usuarios)
+		if w.Code != http.StatusOK || len(usuarios.Users) == 0 {
+			t.Errorf("Falló el listado de usuarios del gerente. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		for _, u := range usuarios.Users {
+			if u.Username == "admin_test" || u.Username == "pepe_intruso" {
+				t.Errorf("El gerente ve usuarios de otros proyectos: %s", u.Username)
+			}
+		}
+
+		// D. El proyecto que crea un gerente queda a su cargo
+		nuevo := map[string]string{"nombre": "Finca Este", "fecha_inicio": "2025-01-01", "fecha_cierre": "2025-12-31"}
+		w = performRequest(router, "POST", "/api/admin/create-proyecto", nuevo, session.Token)
+		var creado models.Proyecto
+		json.Unmarshal(w.Body.Bytes(), &creado)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("El gerente no pudo crear un proyecto. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "POST", "/api/admin/get-labores", map[string]int{"proyecto_id": creado.ID}, session.Token); w.Code != http.StatusOK {
+			t.Errorf("El gerente no tiene acceso al proyecto que creó. Código: %d", w.Code)
+		}
+	})
+
+	t.Run("20. API keys de cuentas de servicio", func(t *testing.T) {
+		// A. Cuenta de servicio con rol gerente, miembro del proyecto principal
+		svc := models.CreateServiceAccountRequest{Username: "svc-nomina", Nombre: "Integración nómina", Role: "gerente"}
+		w := performRequest(router, "POST", "/api/admin/create-service-account", svc, authToken)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Falló create-service-account. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var creada struct {
+			ID int `json:"id"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &creada)
+		performRequest(router, "POST", "/api/admin/add-project-member", models.AddProjectMemberRequest{UserID: creada.ID, ProyectoID: proyectoID}, authToken)
+
+		// B. Llave limitada a labores
+		keyReq := models.CreateAPIKeyRequest{
+			ServiceAccountID: creada.ID,
+			Nombre:           "sync labores",
+			Permissions:      []string{models.PermLaboresRead, models.PermLaboresWrite},
+			ExpiresInDays:    30,
+		}
+		w = performRequest(router, "POST", "/api/admin/create-api-key", keyReq, authToken)
+		var emitida models.CreateAPIKeyResponse
+		json.Unmarshal(w.Body.Bytes(), &emitida)
+		if w.Code != http.StatusCreated || !auth.IsAPIKey(emitida.Key) {
+			t.Fatalf("Falló create-api-key. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if emitida.APIKey.LastUsedAt != nil {
+			t.Errorf("Una llave nueva no debe tener last_used_at")
+		}
+		badKey := keyReq
+		badKey.Permissions = []string{"labores:volar"}
+		if w := performRequest(router, "POST", "/api/admin/create-api-key", badKey, authToken); w.Code != http.StatusBadRequest {
+			t.Errorf("Se esperaba 400 con un permiso desconocido. Código: %d", w.Code)
+		}
+
+		// C. La llave funciona como Bearer y en X-API-Key dentro de su alcance
+		if w := performRequest(router, "POST", "/api/admin/get-labores", map[string]int{"proyecto_id": proyectoID}, emitida.Key); w.Code != http.StatusOK {
+			t.Errorf("La API key no pudo listar labores. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		body, _ := json.Marshal(map[string]interface{}{"proyecto_id": proyectoID, "descripcion": "Riego automático"})
+		req, _ := http.NewRequest("POST", "/api/admin/create-labor", bytes.NewBuffer(body))
+		req.Header.Set("X-API-Key", emitida.Key)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusCreated {
+			t.Errorf("La API key no pudo crear una labor. Código: %d, Resp: %s", rec.Code, rec.Body.String())
+		}
+		// Un cliente del navegador puede mandar X-API-Key (preflight CORS)
+		req, _ = http.NewRequest("OPTIONS", "/api/v1/proyectos", nil)
+		req.Header.Set("Origin", "http://localhost:3000")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		req.Header.Set("Access-Control-Request-Headers", "X-API-Key")
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if allowed := rec.Header().Get("Access-Control-Allow-Headers"); !strings.EqualFold(allowed, "X-API-Key") {
+			t.Errorf("El preflight CORS no permite X-API-Key. Código: %d, Allow-Headers: %q", rec.Code, allowed)
+		}
+		req, _ = http.NewRequest("GET", "/api/v1/proyectos", http.NoBody)
+		req.Header.Set("Origin", "http://localhost:3000")
+		req.Header.Set("X-API-Key", emitida.Key)
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if exposed := rec.Header().Get("Access-Control-Expose-Headers"); !strings.Contains(exposed, "X-Impersonated-By") {
+			t.Errorf("CORS debería exponer X-Impersonated-By al frontend. Expose-Headers: %q", exposed)
+		}
+
+		// D. La acción queda a nombre de la cuenta de servicio (el log se escribe en segundo plano)
+		var logs int
+		for i := 0; i < 20 && logs == 0; i++ {
+			time.Sleep(50 * time.Millisecond)
+			database.DB.QueryRow("SELECT COUNT(*) FROM event_logs WHERE usuario_username = 'svc-nomina' AND entidad = 'Labores'").Scan(&logs)
+		}
+		if logs == 0 {
+			t.Errorf("La creación con API key no quedó registrada a nombre de la cuenta de servicio")
+		}
+
+		// E. Fuera de su alcance: 403 aunque el rol lo permita
+		equipo := map[string]interface{}{"proyecto_id": proyectoID, "codigo_equipo": "TR-50", "nombre": "Tractor", "tipo": "Equipo", "estado": "Operativo"}
+		if w := performRequest(router, "POST", "/api/admin/create-equipo", equipo, emitida.Key); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 fuera del alcance de la llave. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "POST", "/api/auth/logout", nil, emitida.Key); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 en rutas de sesión con API key. Código: %d", w.Code)
+		}
+
+		// F. Se registra el último uso
+		w = performRequest(router, "GET", "/api/admin/get-service-accounts", nil, authToken)
+		var cuentas struct {
+			ServiceAccounts []models.ServiceAccount `json:"service_accounts"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &cuentas)
+		if len(cuentas.ServiceAccounts) != 1 || len(cuentas.ServiceAccounts[0].Keys) != 1 || cuentas.ServiceAccounts[0].Keys[0].LastUsedAt == nil {
+			t.Errorf("Listado de cuentas de servicio inesperado. Resp: %s", w.Body.String())
+		}
+
+		// G. La cuenta de servicio no puede iniciar sesión con contraseña
+		if w := performRequest(router, "POST", "/api/auth/login", map[string]string{"username": "svc-nomina", "password": "password123"}, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 en login de cuenta de servicio. Código: %d", w.Code)
+		}
+
+		// H. Llaves alteradas, expiradas o revocadas se rechazan
+		if w := performRequest(router, "POST", "/api/admin/get-labores", map[string]int{"proyecto_id": proyectoID}, emitida.Key+"x"); w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 con una llave alterada. Código: %d", w.Code)
+		}
+		database.DB.Exec("UPDATE api_keys SET expires_at = '2000-01-01 00:00:00' WHERE id = ?", emitida.APIKey.ID)
+		if w := performRequest(router, "POST", "/api/admin/get-labores", map[string]int{"proyecto_id": proyectoID}, emitida.Key); w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 con una llave expirada. Código: %d", w.Code)
+		}
+		database.DB.Exec("UPDATE api_keys SET expires_at = '2999-01-01 00:00:00' WHERE id = ?", emitida.APIKey.ID)
+		if w := performRequest(router, "POST", "/api/admin/revoke-api-key", models.RevokeAPIKeyRequest{ID: emitida.APIKey.ID}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló revoke-api-key. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "POST", "/api/admin/get-labores", map[string]int{"proyecto_id": proyectoID}, emitida.Key); w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 con una llave revocada. Código: %d", w.Code)
+		}
+	})
+
+	t.Run("21. Registro por invitación", func(t *testing.T) {
+		registro := func(username, cedula, codigo string) *httptest.ResponseRecorder {
+			payload := map[string]string{
+				"username":        username,
+				"password":        "password123",
+				"nombre":          "Invitado",
+				"apellido":        "Prueba",
+				"cedula":          cedula,
+				"invitation_code": codigo,
+			}
+			return performRequest(router, "POST", "/api/auth/register", payload, "")
+		}
+
+		// A. El admin cierra el registro abierto
+		if w := performRequest(router, "POST", "/api/admin/set-registration-policy", models.RegistrationPolicy{Open: false}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló set-registration-policy. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		w := performRequest(router, "GET", "/api/admin/get-registration-policy", nil, authToken)
+		var policy models.RegistrationPolicy
+		json.Unmarshal(w.Body.Bytes(), &policy)
+		if w.Code != http.StatusOK || policy.Open {
+			t.Errorf("La política debería estar cerrada. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := registro("sin_invitacion", "V-141414", ""); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 al registrarse sin invitación. Código: %d", w.Code)
+		}
+		if w := registro("codigo_falso", "V-141414", "no-existe"); w.Code != http.StatusBadRequest {
+			t.Errorf("Se esperaba 400 con un código inexistente. Código: %d", w.Code)
+		}
+
+		// B. Invitación de gerente para el proyecto principal, con dos usos
+		invReq := models.CreateInvitationRequest{Role: "gerente", ProyectoID: proyectoID, MaxUsos: 2, ExpiresInDays: 7}
+		w = performRequest(router, "POST", "/api/admin/create-invitation", invReq, authToken)
+		var inv models.CreateInvitationResponse
+		json.Unmarshal(w.Body.Bytes(), &inv)
+		if w.Code != http.StatusCreated || inv.Codigo == "" {
+			t.Fatalf("Falló create-invitation. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "POST", "/api/admin/create-invitation", models.CreateInvitationRequest{Role: "inexistente"}, authToken); w.Code != http.StatusBadRequest {
+			t.Errorf("Se esperaba 400 con un rol desconocido. Código: %d", w.Code)
+		}
+
+		// C. El registro asigna rol y proyecto de la invitación
+		if w := registro("invitado_uno", "V-141414", inv.Codigo); w.Code != http.StatusCreated {
+			t.Fatalf("Falló el registro con invitación. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var role, memberRole string
+		database.DB.QueryRow("SELECT role FROM users WHERE username = 'invitado_uno'").Scan(&role)
+		database.DB.QueryRow("SELECT pm.role FROM project_members pm JOIN users u ON u.id = pm.user_id WHERE u.username = 'invitado_uno' AND pm.proyecto_id = ?", proyectoID).Scan(&memberRole)
+		if role != "gerente" || memberRole != "gerente" {
+			t.Errorf("Rol o proyecto de la invitación no asignados. Rol: %q, Rol en proyecto: %q", role, memberRole)
+		}
+
+		// D. Un registro fallido no consume usos; al agotarse, el código deja de servir
+		if w := registro("invitado_repetido", "V-141414", inv.Codigo); w.Code != http.StatusConflict {
+			t.Errorf("Se esperaba 409 con una cédula repetida. Código: %d", w.Code)
+		}
+		if w := registro("invitado_dos", "V-151515", inv.Codigo); w.Code != http.StatusCreated {
+			t.Errorf("El segundo uso de la invitación falló. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := registro("invitado_tres", "V-161616", inv.Codigo); w.Code != http.StatusBadRequest {
+			t.Errorf("Se esperaba 400 con una invitación agotada. Código: %d", w.Code)
+		}
+
+		// E. Invitaciones expiradas o revocadas se rechazan
+		w = performRequest(router, "POST", "/api/admin/create-invitation", models.CreateInvitationRequest{}, authToken)
+		var otra models.CreateInvitationResponse
+		json.Unmarshal(w.Body.Bytes(), &otra)
+		if otra.Invitation.Role != "user" || otra.Invitation.MaxUsos != 1 || otra.Invitation.ProyectoID != nil {
+			t.Errorf("Valores por defecto inesperados en la invitación. Resp: %s", w.Body.String())
+		}
+		database.DB.Exec("UPDATE invitations SET expires_at = '2000-01-01 00:00:00' WHERE id = ?", otra.Invitation.ID)
+		if w := registro("invitado_tarde", "V-161616", otra.Codigo); w.Code != http.StatusBadRequest {
+			t.Errorf("Se esperaba 400 con una invitación expirada. Código: %d", w.Code)
+		}
+		database.DB.Exec("UPDATE invitations SET expires_at = '2999-01-01 00:00:00' WHERE id = ?", otra.Invitation.ID)
+		if w := performRequest(router, "POST", "/api/admin/revoke-invitation", models.RevokeInvitationRequest{ID: otra.Invitation.ID}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló revoke-invitation. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := registro("invitado_revocado", "V-161616", otra.Codigo); w.Code != http.StatusBadRequest {
+			t.Errorf("Se esperaba 400 con una invitación revocada. Código: %d", w.Code)
+		}
+
+		w = performRequest(router, "GET", "/api/admin/get-invitations", nil, authToken)
+		var lista struct {
+			Invitations []models.Invitation `json:"invitations"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &lista)
+		if len(lista.Invitations) != 2 || lista.Invitations[1].Usos != 2 || !lista.Invitations[0].Revocada {
+			t.Errorf("Listado de invitaciones inesperado. Resp: %s", w.Body.String())
+		}
+
+		// F. Se vuelve a abrir el registro para el resto del flujo
+		performRequest(router, "POST", "/api/admin/set-registration-policy", models.RegistrationPolicy{Open: true}, authToken)
+		if w := registro("registro_abierto", "V-161616", ""); w.Code != http.StatusCreated {
+			t.Errorf("El registro abierto debería funcionar de nuevo. Código: %d", w.Code)
+		}
+	})
+
+	t.Run("22. Login OIDC con alta automática y mapeo de grupos", func(t *testing.T) {
+		idp := newMockIdP(t)
+		defer idp.server.Close()
+
+		t.Setenv("OIDC_ISSUER", idp.server.URL)
+		t.Setenv("OIDC_CLIENT_ID", "agro-app")
+		t.Setenv("OIDC_CLIENT_SECRET", "secreto-del-cliente")
+		t.Setenv("OIDC_REDIRECT_URL", "http://localhost:3000/oidc/callback")
+		t.Setenv("OIDC_ROLE_MAP", "agro-admins=admin,agro-gerentes=gerente")
+		oidcRouter := setupApp()
+
+		w := performRequest(oidcRouter, "GET", "/api/auth/providers", nil, "")
+		var providers struct {
+			Providers []string `json:"providers"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &providers)
+		if len(providers.Providers) != 2 || providers.Providers[0] != "local" || providers.Providers[1] != "oidc" {
+			t.Fatalf("Proveedores inesperados. Resp: %s", w.Body.String())
+		}
+
+		// loginOIDC recorre el flujo: URL del proveedor, login en el IdP y callback
+		loginOIDC := func(claims map[string]interface{}, alterNonce bool) (*httptest.ResponseRecorder, string) {
+			w := performRequest(oidcRouter, "GET", "/api/auth/oidc/login?provider=oidc", nil, "")
+			var start models.ExternalLoginStart
+			json.Unmarshal(w.Body.Bytes(), &start)
+			authURL, err := url.Parse(start.AuthorizationURL)
+			if w.Code != http.StatusOK || err != nil {
+				t.Fatalf("Falló oidc/login. Código: %d, Resp: %s", w.Code, w.Body.String())
+			}
+			q := authURL.Query()
+			if q.Get("client_id") != "agro-app" || q.Get("state") != start.State || q.Get("response_type") != "code" {
+				t.Fatalf("URL de autorización inesperada: %s", start.AuthorizationURL)
+			}
+			nonce := q.Get("nonce")
+			if alterNonce {
+				nonce += "x"
+			}
+			code := idp.issueCode(claims, nonce)
+			return performRequest(oidcRouter, "POST", "/api/auth/oidc/callback", models.ExternalLoginCallbackRequest{State: start.State, Code: code}, ""), code
+		}
+
+		// A. Primer login: se crea el usuario con el rol del grupo
+		ana := map[string]interface{}{"sub": "ana-123", "preferred_username": "ana.oidc", "given_name": "Ana", "family_name": "Pérez", "email": "ana@example.com", "groups": []string{"agro-gerentes"}}
+		w, code := loginOIDC(ana, false)
+		var session models.LoginResponse
+		json.Unmarshal(w.Body.Bytes(), &session)
+		if w.Code != http.StatusOK || session.Token == "" || session.Role != "gerente" || session.User.Username != "ana.oidc" {
+			t.Fatalf("Falló el login OIDC. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(oidcRouter, "GET", "/api/admin/get-proyectos", nil, session.Token); w.Code != http.StatusOK {
+			t.Errorf("El token de la sesión OIDC no funciona. Código: %d", w.Code)
+		}
+
+		// B. Un código ya canjeado no sirve de nuevo
+		w = performRequest(oidcRouter, "GET", "/api/auth/oidc/login", nil, "")
+		var start models.ExternalLoginStart
+		json.Unmarshal(w.Body.Bytes(), &start)
+		if w := performRequest(oidcRouter, "POST", "/api/auth/oidc/callback", models.ExternalLoginCallbackRequest{State: start.State, Code: code}, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 con un código reutilizado. Código: %d", w.Code)
+		}
+
+		// C. Logins siguientes reutilizan el usuario y sincronizan el rol
+		ana["groups"] = []string{"agro-gerentes", "agro-admins"}
+		w, _ = loginOIDC(ana, false)
+		json.Unmarshal(w.Body.Bytes(), &session)
+		var cuentas int
+		database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE nombre = 'Ana' AND apellido = 'Pérez'").Scan(&cuentas)
+		if w.Code != http.StatusOK || session.Role != "admin" || cuentas != 1 {
+			t.Errorf("Se esperaba el mismo usuario con rol admin. Código: %d, Cuentas: %d, Resp: %s", w.Code, cuentas, w.Body.String())
+		}
+
+		// D. Sin grupo mapeado: rol por defecto y username libre
+		luis := map[string]interface{}{"sub": "luis-9", "preferred_username": "ana.oidc", "given_name": "Luis"}
+		w, _ = loginOIDC(luis, false)
+		json.Unmarshal(w.Body.Bytes(), &session)
+		if w.Code != http.StatusOK || session.Role != "user" || session.User.Username != "ana.oidc-2" {
+			t.Errorf("Alta sin grupo inesperada. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// E. Nonce distinto, state alterado o proveedor desconocido se rechazan
+		if w, _ := loginOIDC(ana, true); w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 con un nonce distinto. Código: %d", w.Code)
+		}
+		code = idp.issueCode(ana, "cualquiera")
+		if w := performRequest(oidcRouter, "POST", "/api/auth/oidc/callback", models.ExternalLoginCallbackRequest{State: start.State + "x", Code: code}, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 con un state alterado. Código: %d", w.Code)
+		}
+		if w := performRequest(oidcRouter, "GET", "/api/auth/oidc/login?provider=otro", nil, ""); w.Code != http.StatusNotFound {
+			t.Errorf("Se esperaba 404 con un proveedor desconocido. Código: %d", w.Code)
+		}
+
+		// F. Las cuentas creadas por OIDC no tienen contraseña local
+		if w := performRequestFrom(oidcRouter, "POST", "/api/auth/login", map[string]string{"username": "ana.oidc", "password": "password123"}, "", "10.0.0.22:4000"); w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 en login con contraseña de una cuenta OIDC. Código: %d", w.Code)
+		}
+	})
+
+	t.Run("23. Desactivación de usuarios y edición de perfil", func(t *testing.T) {
+		nuevo := map[string]interface{}{"user": map[string]string{
+			"username": "encargado_temp",
+			"password": "password123",
+			"nombre":   "Tomás",
+			"apellido": "Temporal",
+			"cedula":   "V-171717",
+		}}
+		if w := performRequest(router, "POST", "/api/admin/add-user", nuevo, authToken); w.Code != http.StatusCreated {
+			t.Fatalf("Falló add-user. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var encargadoID int
+		database.DB.QueryRow("SELECT id FROM users WHERE username = 'encargado_temp'").Scan(&encargadoID)
+
+		actividad := models.CreateActividadRequest{ProyectoID: proyectoID, Actividad: "Cosecha", EncargadoID: &encargadoID, RecursoHumano: 2, Costo: 100}
+		if w := performRequest(router, "POST", "/api/admin/create-actividad", actividad, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló create-actividad. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		wLogin := performRequestFrom(router, "POST", "/api/auth/login", map[string]string{"username": "encargado_temp", "password": "password123"}, "", "10.0.0.23:4000")
+		var session models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &session)
+
+		esEncargado := func() bool {
+			w := performRequest(router, "POST", "/api/admin/get-datos-proyecto", map[string]int{"proyecto_id": proyectoID}, authToken)
+			var datos struct {
+				Encargados []models.EncargadoResponse `json:"encargados"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &datos)
+			for _, e := range datos.Encargados {
+				if e.ID == encargadoID {
+					return true
+				}
+			}
+			return false
+		}
+		if !esEncargado() {
+			t.Fatalf("El encargado nuevo no aparece en la lista de encargados")
+		}
+
+		// A. Desactivar (también por la ruta antigua delete-user) conserva sus actividades
+		if w := performRequest(router, "POST", "/api/admin/delete-user", models.SetUserActivoRequest{ID: encargadoID}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló la desactivación. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var existe, asignadas int
+		database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE id = ? AND activo = 0", encargadoID).Scan(&existe)
+		database.DB.QueryRow("SELECT COUNT(*) FROM actividades WHERE encargado_id = ?", encargadoID).Scan(&asignadas)
+		if existe != 1 || asignadas != 1 {
+			t.Errorf("El usuario desactivado debe conservarse con sus actividades. Usuario: %d, Actividades: %d", existe, asignadas)
+		}
+		if esEncargado() {
+			t.Errorf("Un usuario desactivado no debe aparecer como encargado")
+		}
+
+		// B. Sin login ni sesiones
+		if w := performRequestFrom(router, "POST", "/api/auth/login", map[string]string{"username": "encargado_temp", "password": "password123"}, "", "10.0.0.23:4000"); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 en el login de una cuenta desactivada. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "GET", "/api/user/project-details", nil, session.Token); w.Code != http.StatusUnauthorized {
+			t.Errorf("La sesión previa debería quedar invalidada. Código: %d", w.Code)
+		}
+		var adminID int
+		database.DB.QueryRow("SELECT id FROM users WHERE username = ?", adminUsername).Scan(&adminID)
+		if w := performRequest(router, "POST", "/api/admin/deactivate-user", models.SetUserActivoRequest{ID: adminID}, authToken); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 al desactivar la propia cuenta. Código: %d", w.Code)
+		}
+
+		// C. Reactivación
+		if w := performRequest(router, "POST", "/api/admin/reactivate-user", models.SetUserActivoRequest{ID: encargadoID}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló reactivate-user. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequestFrom(router, "POST", "/api/auth/login", map[string]string{"username": "encargado_temp", "password": "password123"}, "", "10.0.0.23:4000"); w.Code != http.StatusOK {
+			t.Errorf("El usuario reactivado debería poder iniciar sesión. Código: %d", w.Code)
+		}
+		if !esEncargado() {
+			t.Errorf("El usuario reactivado debe volver a la lista de encargados")
+		}
+
+		// D. Edición de perfil con cédula única
+		perfil := models.UpdateUserProfileRequest{ID: encargadoID, Nombre: "Tomás", Apellido: "Definitivo", Cedula: "V-181818"}
+		if w := performRequest(router, "POST", "/api/admin/update-user-profile", perfil, authToken); w.Code != http.StatusOK {
+			t.Errorf("Falló update-user-profile. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var apellido, cedula string
+		database.DB.QueryRow("SELECT apellido, cedula FROM users WHERE id = ?", encargadoID).Scan(&apellido, &cedula)
+		if apellido != "Definitivo" || cedula != "V-181818" {
+			t.Errorf("Perfil no actualizado: %s / %s", apellido, cedula)
+		}
+		perfil.Cedula = "V-123456"
+		if w := performRequest(router, "POST", "/api/admin/update-user-profile", perfil, authToken); w.Code != http.StatusConflict {
+			t.Errorf("Se esperaba 409 con una cédula de otro usuario. Código: %d", w.Code)
+		}
+		perfil.Nombre = ""
+		if w := performRequest(router, "POST", "/api/admin/update-user-profile", perfil, authToken); w.Code != http.StatusBadRequest {
+			t.Errorf("Se esperaba 400 con el nombre vacío. Código: %d", w.Code)
+		}
+	})
+
+	t.Run("24. Cédulas en forma canónica", func(t *testing.T) {
+		registro := func(username, doc string) int {
+			payload := models.User{Username: username, Password: "password123", Nombre: "Ced", Apellido: "Ula", Cedula: doc}
+			return performRequest(router, "POST", "/api/auth/register", payload, "").Code
+		}
+
+		// A. Distintas escrituras de la misma cédula son la misma persona
+		if code := registro("cedula_uno", "v 19.191.919"); code != http.StatusCreated {
+			t.Fatalf("Falló el registro con cédula con puntos. Código: %d", code)
+		}
+		var guardada string
+		database.DB.QueryRow("SELECT cedula FROM users WHERE username = 'cedula_uno'").Scan(&guardada)
+		if guardada != "V-19191919" {
+			t.Errorf("Se esperaba la cédula canónica V-19191919, se guardó %q", guardada)
+		}
+		for _, doc := range []string{"19191919", "V-019.191.919"} {
+			if code := registro("cedula_dup", doc); code != http.StatusConflict {
+				t.Errorf("Se esperaba 409 por cédula duplicada (%q). Código: %d", doc, code)
+			}
+		}
+
+		// B. Documentos inválidos
+		for _, doc := range []string{"X-191919", "V-123456789", "V-0", "J-30012345-0", "P-12"} {
+			if code := registro("cedula_mala", doc); code != http.StatusBadRequest {
+				t.Errorf("Se esperaba 400 con la cédula %q. Código: %d", doc, code)
+			}
+		}
+		if code := registro("cedula_rif", "j300123456"); code != http.StatusCreated {
+			t.Errorf("Un RIF válido debe aceptarse. Código: %d", code)
+		}
+		database.DB.QueryRow("SELECT cedula FROM users WHERE username = 'cedula_rif'").Scan(&guardada)
+		if guardada != "J-30012345-6" {
+			t.Errorf("Se esperaba el RIF canónico J-30012345-6, se guardó %q", guardada)
+		}
+
+		// C. Recursos humanos: la cédula es opcional, pero si viene se normaliza
+		recurso := models.CreateRecursoRequest{ProyectoID: proyectoID, Actividad: "Riego", Nombre: "Jornalero", Cedula: "e-84.000.001", Cantidad: 1}
+		if w := performRequest(router, "POST", "/api/admin/create-recurso", recurso, authToken); w.Code != http.StatusCreated {
+			t.Fatalf("Falló create-recurso. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var recursoCedula string
+		database.DB.QueryRow("SELECT cedula FROM recursos_humanos WHERE nombre = 'Jornalero'").Scan(&recursoCedula)
+		if recursoCedula != "E-84000001" {
+			t.Errorf("Se esperaba la cédula canónica E-84000001 en el recurso, se guardó %q", recursoCedula)
+		}
+		recurso.Cedula = "abc"
+		w := performRequest(router, "POST", "/api/admin/create-recurso", recurso, authToken)
+		var errResp models.ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &errResp)
+		if w.Code != http.StatusBadRequest || errResp.Code != "validation_failed" || len(errResp.Details) != 1 || errResp.Details[0].Field != "cedula" {
+			t.Errorf("Se esperaba 400 con el campo cedula en una cédula inválida del recurso. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		recurso.Cedula = ""
+		if w := performRequest(router, "POST", "/api/admin/create-recurso", recurso, authToken); w.Code != http.StatusCreated {
+			t.Errorf("Un recurso sin cédula debe aceptarse. Código: %d", w.Code)
+		}
+
+		// D. Migración de filas antiguas: se normaliza lo válido y se respeta lo que chocaría
+		database.DB.Exec("INSERT INTO users (username, password, role, nombre, apellido, cedula) VALUES ('legado_uno', 'x', 'user', 'Le', 'Gado', 'v-20.202.020')")
+		database.DB.Exec("INSERT INTO users (username, password, role, nombre, apellido, cedula) VALUES ('legado_dup', 'x', 'user', 'Le', 'Gado', '019191919')")
+		database.DB.Exec("INSERT INTO recursos_humanos (proyecto_id, nombre, cedula) VALUES (?, 'Legado', '21212121')", proyectoID)
+		if _, err := database.NormalizeCedulas(); err != nil {
+			t.Fatalf("Falló la normalización: %v", err)
+		}
+		var uno, dup, rec string
+		database.DB.QueryRow("SELECT cedula FROM users WHERE username = 'legado_uno'").Scan(&uno)
+		database.DB.QueryRow("SELECT cedula FROM users WHERE username = 'legado_dup'").Scan(&dup)
+		database.DB.QueryRow("SELECT cedula FROM recursos_humanos WHERE nombre = 'Legado'").Scan(&rec)
+		if uno != "V-20202020" || dup != "019191919" || rec != "V-21212121" {
+			t.Errorf("Migración inesperada: %q, %q, %q", uno, dup, rec)
+		}
+
+		// E. El admin de la instalación tiene una cédula válida: su perfil se edita sin cambiarla
+		var adminID int
+		var adminDoc string
+		database.DB.QueryRow("SELECT id, cedula FROM users WHERE username = 'admin'").Scan(&adminID, &adminDoc)
+		if _, err := cedula.Parse(adminDoc); err != nil {
+			t.Errorf("La cédula del admin no es válida: %v", err)
+		}
+		perfil := models.UpdateUserProfileRequest{ID: adminID, Nombre: "Administrador", Apellido: "Del Sistema", Cedula: adminDoc}
+		if w := performRequest(router, "POST", "/api/admin/update-user-profile", perfil, authToken); w.Code != http.StatusOK {
+			t.Errorf("No se pudo editar el perfil del admin con su cédula. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("25. Historial de logins y sesiones activas", func(t *testing.T) {
+		registro := models.User{Username: "viajero", Password: "password123", Nombre: "Vera", Apellido: "Viajera", Cedula: "V-252525"}
+		if w := performRequest(router, "POST", "/api/auth/register", registro, ""); w.Code != http.StatusCreated {
+			t.Fatalf("Falló el registro. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		ultimoLogin := func() *string {
+			w := performRequest(router, "GET", "/api/admin/users", nil, authToken)
+			var usuarios struct {
+				Users []models.UserListResponse `json:"users"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &usuarios)
+			for _, u := range usuarios.Users {
+				if u.Username == "viajero" {
+					return u.LastLogin
+				}
+			}
+			t.Fatalf("El usuario no aparece en la lista")
+			return nil
+		}
+		if ultimoLogin() != nil {
+			t.Errorf("Un usuario que nunca inició sesión no debe tener last_login")
+		}
+
+		loginDesde := func(remoteAddr, userAgent string) models.LoginResponse {
+			body, _ := json.Marshal(map[string]string{"username": "viajero", "password": "password123"})
+			req, _ := http.NewRequest("POST", "/api/auth/login", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("User-Agent", userAgent)
+			req.RemoteAddr = remoteAddr
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Falló el login desde %s. Código: %d, Resp: %s", remoteAddr, w.Code, w.Body.String())
+			}
+			var resp models.LoginResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			return resp
+		}
+		laptop := loginDesde("10.0.0.25:4000", "Firefox/128.0")
+		movil := loginDesde("10.0.0.26:4000", "AgroMovil/2.1")
+
+		// A. Último login e historial (visible para quien tiene users:login-history)
+		if ultimoLogin() == nil {
+			t.Errorf("last_login debería tener la fecha del último inicio de sesión")
+		}
+		w := performRequest(router, "POST", "/api/admin/get-login-history", models.LoginHistoryRequest{UserID: movil.UserId}, authToken)
+		var historial struct {
+			Logins []models.LoginRecord `json:"logins"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &historial)
+		if w.Code != http.StatusOK || len(historial.Logins) != 2 {
+			t.Fatalf("Se esperaban 2 logins en el historial. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if ultimo := historial.Logins[0]; ultimo.IP != "10.0.0.26" || ultimo.UserAgent != "AgroMovil/2.1" || ultimo.Metodo != "password" {
+			t.Errorf("Último login inesperado: %+v", ultimo)
+		}
+		if w := performRequest(router, "POST", "/api/admin/get-login-history", models.LoginHistoryRequest{UserID: movil.UserId}, movil.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 al pedir el historial sin users:login-history. Código: %d", w.Code)
+		}
+
+		// Un gerente lista usuarios, pero no ve desde dónde entra el admin
+		database.DB.Exec("UPDATE users SET role = 'gerente' WHERE username = 'viajero'")
+		var adminID int
+		database.DB.QueryRow("SELECT id FROM users WHERE username = 'admin'").Scan(&adminID)
+		if w := performRequest(router, "POST", "/api/admin/get-login-history", models.LoginHistoryRequest{UserID: adminID}, movil.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 al pedir el historial del admin como gerente. Código: %d", w.Code)
+		}
+		database.DB.Exec("UPDATE users SET role = 'user' WHERE username = 'viajero'")
+
+		// B. Sesiones activas propias, con la actual marcada
+		sesiones := func(token string) []models.Session {
+			w := performRequest(router, "GET", "/api/auth/sessions", nil, token)
+			var resp struct {
+				Sessions []models.Session `json:"sessions"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			return resp.Sessions
+		}
+		lista := sesiones(movil.Token)
+		if len(lista) != 2 {
+			t.Fatalf("Se esperaban 2 sesiones activas, hay %d", len(lista))
+		}
+		var laptopID int
+		for _, s := range lista {
+			if s.IP == "10.0.0.25" {
+				laptopID = s.ID
+				if s.Actual || s.UserAgent != "Firefox/128.0" {
+					t.Errorf("Sesión del portátil inesperada: %+v", s)
+				}
+			} else if !s.Actual {
+				t.Errorf("La sesión del móvil debería ser la actual: %+v", s)
+			}
+		}
+
+		// C. Cerrar la sesión del portátil desde el móvil
+		if w := performRequest(router, "POST", "/api/auth/revoke-session", models.RevokeSessionRequest{ID: laptopID}, movil.Token); w.Code != http.StatusOK {
+			t.Fatalf("Falló revoke-session. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "GET", "/api/auth/sessions", nil, laptop.Token); w.Code != http.StatusUnauthorized {
+			t.Errorf("La sesión revocada no debería seguir valiendo. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "POST", "/api/auth/refresh", map[string]string{"refresh_token": laptop.RefreshToken}, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("El refresh token de la sesión revocada no debería servir. Código: %d", w.Code)
+		}
+		if n := len(sesiones(movil.Token)); n != 1 {
+			t.Errorf("Debería quedar 1 sesión activa, hay %d", n)
+		}
+		if w := performRequest(router, "POST", "/api/auth/revoke-session", models.RevokeSessionRequest{ID: laptopID}, movil.Token); w.Code != http.StatusNotFound {
+			t.Errorf("Se esperaba 404 al revocar una sesión ya cerrada. Código: %d", w.Code)
+		}
+
+		// D. No se pueden cerrar sesiones ajenas
+		adminSesiones := sesiones(authToken)
+		if len(adminSesiones) == 0 {
+			t.Fatalf("El admin debería tener al menos una sesión")
+		}
+		if w := performRequest(router, "POST", "/api/auth/revoke-session", models.RevokeSessionRequest{ID: adminSesiones[0].ID}, movil.Token); w.Code != http.StatusNotFound {
+			t.Errorf("Se esperaba 404 al revocar una sesión de otro usuario. Código: %d", w.Code)
+		}
+	})
+
+	t.Run("26. Suplantación de usuarios por el admin", func(t *testing.T) {
+		for _, u := range []models.User{
+			{Username: "soporte_gerente", Password: "password123", Nombre: "Gema", Apellido: "Gerente", Cedula: "V-262626"},
+			{Username: "soporte_user", Password: "password123", Nombre: "Ulises", Apellido: "Usuario", Cedula: "V-272727"},
+		} {
+			if w := performRequest(router, "POST", "/api/auth/register", u, ""); w.Code != http.StatusCreated {
+				t.Fatalf("Falló el registro de %s. Código: %d, Resp: %s", u.Username, w.Code, w.Body.String())
+			}
+		}
+		var gerenteID, adminID int
+		database.DB.QueryRow("SELECT id FROM users WHERE username = 'soporte_gerente'").Scan(&gerenteID)
+		database.DB.QueryRow("SELECT id FROM users WHERE username = ?", adminUsername).Scan(&adminID)
+		if w := performRequest(router, "POST", "/api/admin/update-user", models.UpdateRoleRequest{ID: gerenteID, NewRole: "gerente"}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló update-user. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// A. Solo quien tiene users:impersonate, y nunca sobre sí mismo
+		wUser := performRequestFrom(router, "POST", "/api/auth/login", map[string]string{"username": "soporte_user", "password": "password123"}, "", "10.0.0.27:4000")
+		var userSession models.LoginResponse
+		json.Unmarshal(wUser.Body.Bytes(), &userSession)
+		if w := performRequest(router, "POST", "/api/admin/impersonate", models.ImpersonateRequest{UserID: gerenteID}, userSession.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 al suplantar sin permiso. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "POST", "/api/admin/impersonate", models.ImpersonateRequest{UserID: adminID}, authToken); w.Code != http.StatusBadRequest {
+			t.Errorf("Se esperaba 400 al suplantarse a sí mismo. Código: %d", w.Code)
+		}
+
+		// B. Token con ambas identidades, sin refresh token y con aviso en cada respuesta
+		w := performRequest(router, "POST", "/api/admin/impersonate", models.ImpersonateRequest{UserID: gerenteID}, authToken)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Falló impersonate. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var suplantacion models.LoginResponse
+		json.Unmarshal(w.Body.Bytes(), &suplantacion)
+		if suplantacion.UserId != gerenteID || suplantacion.Role != "gerente" || suplantacion.ImpersonatedBy != adminUsername || suplantacion.RefreshToken != "" {
+			t.Errorf("Respuesta de suplantación inesperada: %+v", suplantacion)
+		}
+
+		payload := map[string]string{"nombre": "Finca Soporte", "fecha_inicio": "2025-01-01", "fecha_cierre": "2025-12-31"}
+		w = performRequest(router, "POST", "/api/admin/create-proyecto", payload, suplantacion.Token)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("El admin debería actuar con los permisos del gerente. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if banner := w.Header().Get("X-Impersonated-By"); banner != adminUsername {
+			t.Errorf("Se esperaba la cabecera X-Impersonated-By=%s, llegó %q", adminUsername, banner)
+		}
+		if w := performRequest(router, "GET", "/api/admin/users", nil, authToken); w.Header().Get("X-Impersonated-By") != "" {
+			t.Errorf("Las respuestas sin suplantación no deben llevar el aviso")
+		}
+
+		// C. El log guarda al usuario suplantado y al admin real
+		var suplantadoPor string
+		for i := 0; i < 20 && suplantadoPor == ""; i++ {
+			database.DB.QueryRow("SELECT COALESCE(suplantado_por, '') FROM event_logs WHERE usuario_username = 'soporte_gerente' AND accion = 'CREACIÓN' AND entidad = 'Proyectos'").Scan(&suplantadoPor)
+			time.Sleep(50 * time.Millisecond)
+		}
+		if suplantadoPor != adminUsername {
+			t.Errorf("El evento debería registrar al admin que suplanta, se guardó %q", suplantadoPor)
+		}
+		var inicio int
+		database.DB.QueryRow("SELECT COUNT(*) FROM event_logs WHERE usuario_username = ? AND accion = 'INICIO SUPLANTACIÓN' AND entidad_id = ?", adminUsername, gerenteID).Scan(&inicio)
+		if inicio != 1 {
+			t.Errorf("Se esperaba un evento INICIO SUPLANTACIÓN del admin, hay %d", inicio)
+		}
+
+		// D. Sin rutas de sesión ni suplantaciones encadenadas o entre admins
+		if w := performRequest(router, "POST", "/api/auth/logout", nil, suplantacion.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 en logout durante una suplantación. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "POST", "/api/admin/impersonate", models.ImpersonateRequest{UserID: adminID}, suplantacion.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 al suplantar durante una suplantación. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "POST", "/api/admin/update-user", models.UpdateRoleRequest{ID: gerenteID, NewRole: "admin"}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló update-user. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "POST", "/api/admin/impersonate", models.ImpersonateRequest{UserID: gerenteID}, authToken); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 al suplantar a otro admin. Código: %d", w.Code)
+		}
+		performRequest(router, "POST", "/api/admin/update-user", models.UpdateRoleRequest{ID: gerenteID, NewRole: "gerente"}, authToken)
+
+		// E. Al cerrar la sesión del admin termina la suplantación
+		wAdmin := performRequestFrom(router, "POST", "/api/auth/login", map[string]string{"username": adminUsername, "password": "password123"}, "", "10.0.0.28:4000")
+		var otraSesion models.LoginResponse
+		json.Unmarshal(wAdmin.Body.Bytes(), &otraSesion)
+		w = performRequest(router, "POST", "/api/admin/impersonate", models.ImpersonateRequest{UserID: gerenteID}, otraSesion.Token)
+		json.Unmarshal(w.Body.Bytes(), &suplantacion)
+		if w := performRequest(router, "GET", "/api/user/project-details", nil, suplantacion.Token); w.Code == http.StatusUnauthorized {
+			t.Fatalf("El token de suplantación debería ser válido")
+		}
+		performRequest(router, "POST", "/api/auth/logout", nil, otraSesion.Token)
+		if w := performRequest(router, "GET", "/api/user/project-details", nil, suplantacion.Token); w.Code != http.StatusUnauthorized {
+			t.Errorf("La suplantación debería terminar con la sesión del admin. Código: %d", w.Code)
+		}
+	})
+
+	t.Run("27. Rol auditor de solo lectura en todas las rutas", func(t *testing.T) {
+		registro := models.User{Username: "auditor_externo", Password: "password123", Nombre: "Aurora", Apellido: "Auditora", Cedula: "V-282828"}
+		if w := performRequest(router, "POST", "/api/auth/register", registro, ""); w.Code != http.StatusCreated {
+			t.Fatalf("Falló el registro. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var auditorID int
+		database.DB.QueryRow("SELECT id FROM users WHERE username = 'auditor_externo'").Scan(&auditorID)
+		if w := performRequest(router, "POST", "/api/admin/update-user", models.UpdateRoleRequest{ID: auditorID, NewRole: models.RoleAuditor}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló update-user. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		wLogin := performRequestFrom(router, "POST", "/api/auth/login", map[string]string{"username": "auditor_externo", "password": "password123"}, "", "10.0.0.29:4000")
+		var session models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &session)
+
+		// Toda ruta de setupApp debe estar en una de estas listas: así una ruta nueva
+		// no queda sin decidir si el auditor la puede usar.
+		lecturas := map[string]bool{
+			"/api/admin/get-proyectos":       true,
+			"/api/admin/get-datos-proyecto":  true,
+			"/api/admin/get-labores":         true,
+			"/api/admin/get-equipos":         true,
+			"/api/admin/get-unidades":        true,
+			"/api/admin/get-planes":          true,
+			"/api/admin/get-recursos":        true,
+			"/api/admin/get-materiales":      true,
+			"/api/admin/get-logs":            true,
+			"/api/admin/get-project-members": true,
+		}
+		// Configuración de seguridad y cuentas: tampoco cambian datos, pero no son del auditor
+		administracion := map[string]bool{
+			"/api/admin/users":                   true,
+			"/api/admin/get-login-history":       true,
+			"/api/admin/get-2fa-policy":          true,
+			"/api/admin/get-registration-policy": true,
+			"/api/admin/get-invitations":         true,
+			"/api/admin/get-roles":               true,
+			"/api/admin/get-permissions":         true,
+			"/api/admin/get-service-accounts":    true,
+			"/api/admin/get-field-visibility":    true,
+		}
+		// Rutas públicas o sobre la propia cuenta (login, contraseña, 2FA, sesiones)
+		propias := func(ruta string) bool {
+			return ruta == "/{$}" || strings.HasPrefix(ruta, "/api/auth/") || strings.HasPrefix(ruta, "/api/user/")
+		}
+
+		// Las modificaciones apuntan a filas reales del proyecto, para que el rechazo
+		// venga del permiso y no de un "no encontrado"
+		plan := models.CreatePlanRequest{ProyectoID: proyectoID, Actividad: "Siembra", Accion: "Preparar semilleros", Horas: 4}
+		if w := performRequest(router, "POST", "/api/admin/create-plan", plan, authToken); w.Code != http.StatusCreated {
+			t.Fatalf("Falló create-plan. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		tablas := map[string]string{
+			"labor":     "labores_agronomicas",
+			"equipo":    "equipos_implementos",
+			"unidad":    "unidades_medida",
+			"actividad": "actividades",
+			"plan":      "planes_accion",
+			"recurso":   "recursos_humanos",
+			"material":  "materiales_insumos",
+		}
+		_, rutas := buildApp()
+		for _, ruta := range rutas {
+			// Las rutas /api/v1 (con método) llevan a los mismos handlers que sus alias
+			if propias(ruta) || strings.Contains(ruta, " ") {
+				continue
+			}
+			payload := map[string]int{"proyecto_id": proyectoID}
+			if tabla, ok := tablas[ruta[strings.LastIndex(ruta, "-")+1:]]; ok {
+				var id int
+				database.DB.QueryRow("SELECT id FROM "+tabla+" WHERE proyecto_id = ? LIMIT 1", proyectoID).Scan(&id)
+				payload["id"] = id
+			}
+			w := performRequest(router, "POST", ruta, payload, session.Token)
+			switch {
+			case lecturas[ruta]:
+				if w.Code == http.StatusUnauthorized || w.Code == http.StatusForbidden {
+					t.Errorf("El auditor debería poder leer %s. Código: %d, Resp: %s", ruta, w.Code, w.Body.String())
+				}
+			case administracion[ruta]:
+				if w.Code != http.StatusForbidden {
+					t.Errorf("Se esperaba 403 para el auditor en %s. Código: %d", ruta, w.Code)
+				}
+			default:
+				// Todo lo demás modifica datos
+				if w.Code != http.StatusForbidden {
+					t.Errorf("El auditor no debería poder modificar con %s. Código: %d, Resp: %s", ruta, w.Code, w.Body.String())
+				}
+			}
+		}
+
+		// Las lecturas devuelven datos de proyectos de los que no es miembro
+		w := performRequest(router, "POST", "/api/admin/get-datos-proyecto", map[string]int{"proyecto_id": proyectoID}, session.Token)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Cosecha") {
+			t.Errorf("El auditor debería ver las actividades del proyecto. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("28. Campos de costo ocultos según el rol", func(t *testing.T) {
+		registro := models.User{Username: "encargada_campo", Password: "password123", Nombre: "Elena", Apellido: "Encargada", Cedula: "V-292929"}
+		if w := performRequest(router, "POST", "/api/auth/register", registro, ""); w.Code != http.StatusCreated {
+			t.Fatalf("Falló el registro. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var encargadaID int
+		database.DB.QueryRow("SELECT id FROM users WHERE username = 'encargada_campo'").Scan(&encargadaID)
+		if w := performRequest(router, "POST", "/api/admin/update-user", models.UpdateRoleRequest{ID: encargadaID, NewRole: models.RoleEncargado}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló update-user. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "POST", "/api/admin/add-project-member", models.AddProjectMemberRequest{UserID: encargadaID, ProyectoID: proyectoID, Role: models.RoleEncargado}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló add-project-member. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// Por defecto el encargado no lee actividades ni planes: se le dan para la prueba
+		var rolesResp struct {
+			Roles []models.Role `json:"roles"`
+		}
+		json.Unmarshal(performRequest(router, "GET", "/api/admin/get-roles", nil, authToken).Body.Bytes(), &rolesResp)
+		var permisosOriginales []string
+		for _, role := range rolesResp.Roles {
+			if role.Name == models.RoleEncargado {
+				permisosOriginales = role.Permissions
+			}
+		}
+		conLectura := append(append([]string{}, permisosOriginales...), models.PermActividadesRead, models.PermPlanesRead)
+		if w := performRequest(router, "POST", "/api/admin/update-role-permissions", models.UpdateRolePermissionsRequest{Name: models.RoleEncargado, Permissions: conLectura}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló update-role-permissions. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		defer performRequest(router, "POST", "/api/admin/update-role-permissions", models.UpdateRolePermissionsRequest{Name: models.RoleEncargado, Permissions: permisosOriginales}, authToken)
+
+		wLogin := performRequestFrom(router, "POST", "/api/auth/login", map[string]string{"username": "encargada_campo", "password": "password123"}, "", "10.0.0.30:4000")
+		var session models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &session)
+
+		// A. El encargado ve las actividades del proyecto, pero no su costo
+		datos := map[string]int{"proyecto_id": proyectoID}
+		w := performRequest(router, "POST", "/api/admin/get-datos-proyecto", datos, session.Token)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Cosecha") {
+			t.Fatalf("El encargado debería ver las actividades. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), `"costo"`) {
+			t.Errorf("El encargado no debería ver el costo de las actividades: %s", w.Body.String())
+		}
+		if w := performRequest(router, "POST", "/api/admin/get-datos-proyecto", datos, authToken); !strings.Contains(w.Body.String(), `"costo"`) {
+			t.Errorf("El admin debería ver el costo de las actividades: %s", w.Body.String())
+		}
+
+		// B. En los planes de acción se ocultan costo unitario y monto
+		plan := models.CreatePlanRequest{ProyectoID: proyectoID, Actividad: "Cosecha", Accion: "Contratar cosechadora", Horas: 8, CostoUnitario: 50, Monto: 400}
+		if w := performRequest(router, "POST", "/api/admin/create-plan", plan, authToken); w.Code != http.StatusCreated {
+			t.Fatalf("Falló create-plan. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		w = performRequest(router, "POST", "/api/admin/get-planes", datos, session.Token)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"accion"`) {
+			t.Fatalf("El encargado debería ver los planes. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), `"monto"`) || strings.Contains(w.Body.String(), `"costo_unitario"`) {
+			t.Errorf("El encargado no debería ver los montos de los planes: %s", w.Body.String())
+		}
+
+		// C. La configuración es por rol y entidad, y se cambia sin tocar los handlers
+		var visibilidad struct {
+			CamposOcultos []models.FieldVisibility `json:"campos_ocultos"`
+		}
+		json.Unmarshal(performRequest(router, "GET", "/api/admin/get-field-visibility", nil, authToken).Body.Bytes(), &visibilidad)
+		encontrado := false
+		for _, fv := range visibilidad.CamposOcultos {
+			if fv.Role == models.RoleEncargado && fv.Entidad == models.EntityPlanes {
+				encontrado = strings.Join(fv.Campos, ",") == "costo_unitario,monto"
+			}
+		}
+		if !encontrado {
+			t.Errorf("Se esperaban costo_unitario y monto ocultos al encargado en planes: %+v", visibilidad.CamposOcultos)
+		}
+
+		mostrarCosto := models.FieldVisibility{Role: models.RoleEncargado, Entidad: models.EntityActividades, Campos: []string{}}
+		if w := performRequest(router, "POST", "/api/admin/set-field-visibility", mostrarCosto, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló set-field-visibility. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "POST", "/api/admin/get-datos-proyecto", datos, session.Token); !strings.Contains(w.Body.String(), `"costo"`) {
+			t.Errorf("Sin campos ocultos el encargado debería ver el costo: %s", w.Body.String())
+		}
+		ocultarCosto := models.FieldVisibility{Role: models.RoleEncargado, Entidad: models.EntityActividades, Campos: []string{"costo"}}
+		if w := performRequest(router, "POST", "/api/admin/set-field-visibility", ocultarCosto, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló set-field-visibility. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// D. Validaciones y permisos de la configuración
+		invalidas := []models.FieldVisibility{
+			{Role: models.RoleEncargado, Entidad: models.EntityPlanes, Campos: []string{"precio"}},
+			{Role: models.RoleEncargado, Entidad: "proyectos", Campos: []string{"nombre"}},
+			{Role: "capataz", Entidad: models.EntityPlanes, Campos: []string{"monto"}},
+			{Role: models.RoleEncargado, Entidad: models.EntityPlanes, Campos: []string{"id"}},
+		}
+		for _, req := range invalidas {
+			if w := performRequest(router, "POST", "/api/admin/set-field-visibility", req, authToken); w.Code != http.StatusBadRequest {
+				t.Errorf("Se esperaba 400 para %+v. Código: %d", req, w.Code)
+			}
+		}
+		if w := performRequest(router, "POST", "/api/admin/set-field-visibility", mostrarCosto, session.Token); w.Code != http.StatusForbidden {
+			t.Errorf("Se esperaba 403 al configurar sin roles:manage. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "POST", "/api/admin/get-datos-proyecto", datos, session.Token); strings.Contains(w.Body.String(), `"costo"`) {
+			t.Errorf("El costo debería seguir oculto al encargado: %s", w.Body.String())
+		}
+	})
+
+	t.Run("29. Permisos por proyecto en planes, recursos y materiales", func(t *testing.T) {
+		var sur int
+		database.DB.QueryRow("SELECT id FROM proyectos WHERE nombre = 'Finca Sur'").Scan(&sur)
+		registro := models.User{Username: "gerente_sur", Password: "password123", Nombre: "Sergio", Apellido: "Sureño", Cedula: "V-303030"}
+		if w := performRequest(router, "POST", "/api/auth/register", registro, ""); w.Code != http.StatusCreated {
+			t.Fatalf("Falló el registro. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var gerenteID int
+		database.DB.QueryRow("SELECT id FROM users WHERE username = 'gerente_sur'").Scan(&gerenteID)
+		performRequest(router, "POST", "/api/admin/update-user", models.UpdateRoleRequest{ID: gerenteID, NewRole: models.RoleGerente}, authToken)
+		if w := performRequest(router, "POST", "/api/admin/add-project-member", models.AddProjectMemberRequest{UserID: gerenteID, ProyectoID: sur, Role: models.RoleGerente}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló add-project-member. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		wLogin := performRequestFrom(router, "POST", "/api/auth/login", map[string]string{"username": "gerente_sur", "password": "password123"}, "", "10.0.0.31:4000")
+		var session models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &session)
+
+		areas := []struct {
+			sufijo, listado, tabla string
+		}{
+			{"plan", "planes", "planes_accion"},
+			{"recurso", "recursos", "recursos_humanos"},
+			{"material", "materiales", "materiales_insumos"},
+		}
+
+		for _, area := range areas {
+			var ajenoID int
+			database.DB.QueryRow("SELECT id FROM "+area.tabla+" WHERE proyecto_id = ? LIMIT 1", proyectoID).Scan(&ajenoID)
+			if ajenoID == 0 {
+				t.Fatalf("Se esperaba al menos un registro en %s del proyecto principal", area.tabla)
+			}
+			crear := map[string]interface{}{"proyecto_id": proyectoID, "actividad": "Riego", "accion": "Revisar aspersores", "nombre": "Tubería", "admin_username": adminUsername}
+			modificar := map[string]interface{}{"id": ajenoID, "actividad": "Alterada", "accion": "Alterada", "nombre": "Alterado"}
+			rutas := []struct {
+				ruta    string
+				payload interface{}
+			}{
+				{"/api/admin/create-" + area.sufijo, crear},
+				{"/api/admin/get-" + area.listado, map[string]int{"proyecto_id": proyectoID}},
+				{"/api/admin/update-" + area.sufijo, modificar},
+				{"/api/admin/delete-" + area.sufijo, map[string]int{"id": ajenoID}},
+			}
+
+			// A. Sin token no se llega al handler
+			for _, rt := range rutas {
+				if w := performRequest(router, "POST", rt.ruta, rt.payload, ""); w.Code != http.StatusUnauthorized {
+					t.Errorf("Se esperaba 401 sin token en %s. Código: %d", rt.ruta, w.Code)
+				}
+			}
+
+			// B. Un gerente de otro proyecto no lee ni modifica el proyecto principal
+			var antes int
+			database.DB.QueryRow("SELECT COUNT(*) FROM "+area.tabla+" WHERE proyecto_id = ?", proyectoID).Scan(&antes)
+			for _, rt := range rutas {
+				if w := performRequest(router, "POST", rt.ruta, rt.payload, session.Token); w.Code != http.StatusForbidden {
+					t.Errorf("Se esperaba 403 para el gerente de otro proyecto en %s. Código: %d, Resp: %s", rt.ruta, w.Code, w.Body.String())
+				}
+			}
+			var despues int
+			var actividad string
+			database.DB.QueryRow("SELECT COUNT(*) FROM "+area.tabla+" WHERE proyecto_id = ?", proyectoID).Scan(&despues)
+			database.DB.QueryRow("SELECT actividad FROM "+area.tabla+" WHERE id = ?", ajenoID).Scan(&actividad)
+			if antes != despues || actividad == "Alterada" {
+				t.Errorf("Los rechazos no deberían cambiar %s (antes %d, después %d, actividad %q)", area.tabla, antes, despues, actividad)
+			}
+
+			// C. En su propio proyecto sí puede, y el log usa su identidad (no el admin_username del body)
+			crear["proyecto_id"] = sur
+			if w := performRequest(router, "POST", "/api/admin/create-"+area.sufijo, crear, session.Token); w.Code != http.StatusCreated {
+				t.Errorf("El gerente debería crear en su proyecto con create-%s. Código: %d, Resp: %s", area.sufijo, w.Code, w.Body.String())
+			}
+			if w := performRequest(router, "POST", "/api/admin/get-"+area.listado, map[string]int{"proyecto_id": sur}, session.Token); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Revisar aspersores") {
+				t.Errorf("El gerente debería ver %s de su proyecto. Código: %d, Resp: %s", area.listado, w.Code, w.Body.String())
+			}
+
+			// D. Un id inexistente es 404, no un éxito silencioso
+			if w := performRequest(router, "POST", "/api/admin/delete-"+area.sufijo, map[string]int{"id": 999999}, authToken); w.Code != http.StatusNotFound {
+				t.Errorf("Se esperaba 404 al borrar un %s inexistente. Código: %d", area.sufijo, w.Code)
+			}
+		}
+
+		var logs int
+		for i := 0; i < 20 && logs < len(areas); i++ {
+			time.Sleep(50 * time.Millisecond)
+			database.DB.QueryRow("SELECT COUNT(*) FROM event_logs WHERE usuario_username = 'gerente_sur' AND accion = 'CREACIÓN'").Scan(&logs)
+		}
+		if logs != len(areas) {
+			t.Errorf("Se esperaban %d creaciones a nombre de gerente_sur en el log, hay %d", len(areas), logs)
+		}
+	})
+
+	t.Run("30. Rutas REST en /api/v1 con alias obsoletos", func(t *testing.T) {
+		base := fmt.Sprintf("/api/v1/proyectos/%d", proyectoID)
+
+		// A. El GET REST devuelve lo mismo que la ruta antigua, que avisa que está obsoleta
+		wNueva := performRequest(router, "GET", base+"/labores", nil, authToken)
+		wVieja := performRequest(router, "POST", "/api/admin/get-labores", map[string]int{"proyecto_id": proyectoID}, authToken)
+		if wNueva.Code != http.StatusOK || wNueva.Body.String() != wVieja.Body.String() {
+			t.Errorf("GET %s/labores debería equivaler a get-labores. Código: %d, Resp: %s", base, wNueva.Code, wNueva.Body.String())
+		}
+		if wNueva.Header().Get("Deprecation") != "" {
+			t.Errorf("Las rutas /api/v1 no deberían marcarse como obsoletas")
+		}
+		if wVieja.Header().Get("Deprecation") != "true" || !strings.Contains(wVieja.Header().Get("Link"), "/api/v1/proyectos/{id}/labores") {
+			t.Errorf("get-labores debería indicar su reemplazo. Cabeceras: %v", wVieja.Header())
+		}
+
+		// B. CRUD completo con el id en el path; el del path manda sobre el del cuerpo
+		plan := map[string]interface{}{"proyecto_id": 999999, "actividad": "Fertilización", "accion": "Aplicar urea", "horas": 3}
+		if w := performRequest(router, "POST", base+"/planes", plan, authToken); w.Code != http.StatusCreated {
+			t.Fatalf("Falló POST %s/planes. Código: %d, Resp: %s", base, w.Code, w.Body.String())
+		}
+		var planID int
+		database.DB.QueryRow("SELECT id FROM planes_accion WHERE accion = 'Aplicar urea' AND proyecto_id = ?", proyectoID).Scan(&planID)
+		if planID == 0 {
+			t.Fatalf("El plan debería crearse en el proyecto del path")
+		}
+		cambio := map[string]interface{}{"actividad": "Fertilización", "accion": "Aplicar urea en banda", "horas": 4}
+		if w := performRequest(router, "PUT", fmt.Sprintf("/api/v1/planes/%d", planID), cambio, authToken); w.Code != http.StatusOK {
+			t.Errorf("Falló PUT /api/v1/planes/{id}. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "GET", base+"/planes", nil, authToken); !strings.Contains(w.Body.String(), "Aplicar urea en banda") {
+			t.Errorf("El listado debería reflejar el cambio: %s", w.Body.String())
+		}
+		if w := performRequest(router, "DELETE", fmt.Sprintf("/api/v1/planes/%d", planID), nil, authToken); w.Code != http.StatusOK {
+			t.Errorf("Falló DELETE /api/v1/planes/{id}. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "DELETE", fmt.Sprintf("/api/v1/planes/%d", planID), nil, authToken); w.Code != http.StatusNotFound {
+			t.Errorf("Se esperaba 404 al borrar de nuevo. Código: %d", w.Code)
+		}
+
+		// C. Método incorrecto: 405 con los métodos permitidos
+		w := performRequest(router, "POST", fmt.Sprintf("/api/v1/planes/%d", planID), nil, authToken)
+		if w.Code != http.StatusMethodNotAllowed || !strings.Contains(w.Header().Get("Allow"), "DELETE") {
+			t.Errorf("Se esperaba 405 con Allow. Código: %d, Allow: %q", w.Code, w.Header().Get("Allow"))
+		}
+		if w := performRequest(router, "DELETE", base+"/labores", nil, authToken); w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Se esperaba 405 para DELETE sobre la colección. Código: %d", w.Code)
+		}
+
+		// D. Parámetros inválidos, autenticación y rutas inexistentes
+		if w := performRequest(router, "GET", "/api/v1/proyectos/abc/labores", nil, authToken); w.Code != http.StatusBadRequest {
+			t.Errorf("Se esperaba 400 con un id no numérico. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "GET", base+"/labores", nil, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 sin token. Código: %d", w.Code)
+		}
+		// Sin token la respuesta es 401 aunque el path o el cuerpo sean inválidos
+		if w := performRequest(router, "GET", "/api/v1/proyectos/abc/labores", nil, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 sin token con un id no numérico. Código: %d", w.Code)
+		}
+		req, _ := http.NewRequest("POST", base+"/labores", strings.NewReader("{no es json"))
+		req.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Se esperaba 401 sin token con un cuerpo inválido. Código: %d", w.Code)
+		}
+		if w := performRequest(router, "GET", "/api/v1/inexistente", nil, authToken); w.Code != http.StatusNotFound {
+			t.Errorf("Se esperaba 404 para una ruta desconocida. Código: %d", w.Code)
+		}
+
+		// E. Los filtros de un GET van en la query
+		if w := performRequest(router, "GET", "/api/v1/logs?entidad=Plan+Accion", nil, authToken); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Plan Accion") {
+			t.Errorf("GET /api/v1/logs debería filtrar por entidad. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// F. Toda ruta /api/v1 declara su método
+		_, rutas := buildApp()
+		for _, ruta := range rutas {
+			if strings.Contains(ruta, "/api/v1/") && !strings.Contains(ruta, " ") {
+				t.Errorf("La ruta %s debería declarar su método", ruta)
+			}
+		}
+	})
+
+	t.Run("31. Especificación OpenAPI de todas las rutas", func(t *testing.T) {
+		// A. Es pública y está en JSON
+		w := performRequest(router, "GET", "/api/docs/openapi.json", nil, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Falló GET /api/docs/openapi.json. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		var spec struct {
+			OpenAPI    string                                           `json:"openapi"`
+			Paths      map[string]map[string]map[string]json.RawMessage `json:"paths"`
+			Components struct {
+				Schemas map[string]struct {
+					Properties map[string]json.RawMessage `json:"properties"`
+				} `json:"schemas"`
+			} `json:"components"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil || !strings.HasPrefix(spec.OpenAPI, "3.") {
+			t.Fatalf("La especificación debería ser OpenAPI 3 válida (err: %v, versión: %q)", err, spec.OpenAPI)
+		}
+
+		// B. Cada ruta registrada está documentada, con su método si lo declara
+		_, rutas := buildApp()
+		for _, ruta := range rutas {
+			metodo, path := "", ruta
+			if i := strings.Index(ruta, " "); i >= 0 {
+				metodo, path = strings.ToLower(ruta[:i]), ruta[i+1:]
+			}
+			path = strings.TrimSuffix(path, "{$}")
+			ops, ok := spec.Paths[path]
+			if !ok {
+				t.Errorf("La ruta %s no está en la especificación", ruta)
+				continue
+			}
+			if _, ok := ops[metodo]; metodo != "" && !ok {
+				t.Errorf("La ruta %s no documenta el método %s", ruta, metodo)
+			}
+		}
+
+		// C. Parámetros, cuerpos y esquemas salen de los structs de los handlers
+		crearPlan := spec.Paths["/api/v1/proyectos/{id}/planes"]["post"]
+		if !strings.Contains(string(crearPlan["requestBody"]), "#/components/schemas/CreatePlanRequest") ||
+			!strings.Contains(string(crearPlan["parameters"]), `"in":"path"`) {
+			t.Errorf("POST /api/v1/proyectos/{id}/planes debería documentar el path y el cuerpo: %v", crearPlan)
+		}
+		if _, ok := spec.Components.Schemas["PlanAccion"].Properties["costo_unitario"]; !ok {
+			t.Errorf("El esquema PlanAccion debería tener costo_unitario: %v", spec.Components.Schemas["PlanAccion"])
+		}
+		if logs := string(spec.Paths["/api/v1/logs"]["get"]["parameters"]); !strings.Contains(logs, `"name":"entidad"`) || !strings.Contains(logs, `"in":"query"`) {
+			t.Errorf("GET /api/v1/logs debería documentar sus filtros en la query: %s", logs)
+		}
+		if vieja := spec.Paths["/api/admin/get-labores"]["post"]; string(vieja["deprecated"]) != "true" {
+			t.Errorf("Las rutas antiguas deberían figurar como obsoletas: %v", vieja)
+		}
+		if login := spec.Paths["/api/v1/auth/login"]["post"]; string(login["security"]) != "[]" {
+			t.Errorf("El login debería documentarse sin autenticación: %v", login)
+		}
+
+		// D. La página navegable carga la especificación
+		w = performRequest(router, "GET", "/api/docs", nil, "")
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") || !strings.Contains(w.Body.String(), "/api/docs/openapi.json") {
+			t.Errorf("GET /api/docs debería servir la página de la documentación. Código: %d", w.Code)
+		}
+	})
+
+	t.Run("32. Errores con código estable y detalles por campo", func(t *testing.T) {
+		leer := func(w *httptest.ResponseRecorder) models.ErrorResponse {
+			var resp models.ErrorResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			return resp
+		}
+		tiene := func(resp models.ErrorResponse, campo, code string) bool {
+			for _, d := range resp.Details {
+				if d.Field == campo && d.Code == code {
+					return true
+				}
+			}
+			return false
+		}
+		base := fmt.Sprintf("/api/v1/proyectos/%d/equipos", proyectoID)
+
+		// A. Validación: 400 con los campos que faltan
+		w := performRequest(router, "POST", base, map[string]interface{}{"nombre": "Sin tipo"}, authToken)
+		if resp := leer(w); w.Code != http.StatusBadRequest || resp.Code != "validation_failed" || !tiene(resp, "tipo", "required") || tiene(resp, "nombre", "required") {
+			t.Errorf("Se esperaba 400 validation_failed con tipo requerido. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// B. Conflicto: 409 con el campo duplicado (sin comparar el texto del mensaje)
+		var codigos []string
+		for _, nombre := range []string{"Rastra", "Sembradora"} {
+			w := performRequest(router, "POST", base, map[string]interface{}{"nombre": nombre, "tipo": "Implemento", "estado": "Operativo"}, authToken)
+			var creado models.EquipoImplemento
+			if w.Code != http.StatusCreated || json.Unmarshal(w.Body.Bytes(), &creado) != nil {
+				t.Fatalf("Falló la creación del equipo %s. Código: %d, Resp: %s", nombre, w.Code, w.Body.String())
+			}
+			codigos = append(codigos, creado.CodigoEquipo)
+			defer performRequest(router, "DELETE", fmt.Sprintf("/api/v1/equipos/%d", creado.ID), nil, authToken)
+			if nombre == "Sembradora" {
+				dup := map[string]interface{}{"codigo_equipo": codigos[0], "nombre": nombre, "tipo": "Implemento", "estado": "Operativo"}
+				w = performRequest(router, "PUT", fmt.Sprintf("/api/v1/equipos/%d", creado.ID), dup, authToken)
+				if resp := leer(w); w.Code != http.StatusConflict || resp.Code != "conflict" || !tiene(resp, "codigo_equipo", "duplicate") {
+					t.Errorf("Se esperaba 409 conflict en codigo_equipo. Código: %d, Resp: %s", w.Code, w.Body.String())
+				}
+			}
+		}
+
+		// C. No encontrado, prohibido y sin autenticar
+		casos := []struct {
+			metodo, path string
+			payload      interface{}
+			token        string
+			status       int
+			code         string
+		}{
+			{"DELETE", "/api/v1/proyectos/999999", nil, authToken, http.StatusNotFound, "not_found"},
+			{"DELETE", "/api/v1/roles/gerente", nil, authToken, http.StatusForbidden, "forbidden"},
+			{"GET", "/api/v1/users", nil, "", http.StatusUnauthorized, "unauthorized"},
+			{"POST", "/api/v1/users/999999/unlock", nil, authToken, http.StatusNotFound, "not_found"},
+			{"POST", "/api/v1/users/999999/reset-password", nil, authToken, http.StatusNotFound, "not_found"},
+			{"POST", "/api/v1/users/999999/impersonate", nil, authToken, http.StatusNotFound, "not_found"},
+			{"POST", "/api/v1/auth/refresh", models.RefreshRequest{RefreshToken: "no-existe"}, "", http.StatusUnauthorized, "unauthorized"},
+		}
+		for _, c := range casos {
+			w := performRequest(router, c.metodo, c.path, c.payload, c.token)
+			if resp := leer(w); w.Code != c.status || resp.Code != c.code || resp.Error == "" {
+				t.Errorf("%s %s: se esperaba %d %s. Código: %d, Resp: %s", c.metodo, c.path, c.status, c.code, w.Code, w.Body.String())
+			}
+		}
+
+		// D. Errores de autenticación con su campo: contraseña actual incorrecta
+		w = performRequest(router, "PUT", "/api/v1/auth/password", models.ChangePasswordRequest{CurrentPassword: "no-es-la-actual", NewPassword: "OtraClave#2025"}, authToken)
+		if resp := leer(w); w.Code != http.StatusBadRequest || resp.Code != "validation_failed" || !tiene(resp, "current_password", "invalid") {
+			t.Errorf("Se esperaba 400 validation_failed en current_password. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		w = performRequest(router, "POST", "/api/admin/set-2fa-policy", map[string][]string{"required_roles": {"no-existe"}}, authToken)
+		if resp := leer(w); w.Code != http.StatusBadRequest || resp.Code != "validation_failed" || !tiene(resp, "required_roles", "invalid") {
+			t.Errorf("Se esperaba 400 validation_failed en required_roles. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// E. Los fallos de la base de datos no muestran el texto del driver
+		w = performRequest(router, "POST", "/api/admin/create-plan", models.CreatePlanRequest{ProyectoID: 999999, Actividad: "Siembra", Accion: "Sin proyecto"}, authToken)
+		if resp := leer(w); w.Code != http.StatusInternalServerError || resp.Code != "internal_error" || strings.Contains(strings.ToLower(resp.Error), "constraint") {
+			t.Errorf("Se esperaba 500 internal_error con un mensaje genérico. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("33. Mensajes de error en español e inglés", func(t *testing.T) {
+		conIdioma := func(method, path string, payload interface{}, token, acceptLanguage string) (*httptest.ResponseRecorder, models.ErrorResponse) {
+			body, _ := json.Marshal(payload)
+			req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			if acceptLanguage != "" {
+				req.Header.Set("Accept-Language", acceptLanguage)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			var resp models.ErrorResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			return w, resp
+		}
+		base := fmt.Sprintf("/api/v1/proyectos/%d/equipos", proyectoID)
+		sinTipo := map[string]interface{}{"nombre": "Sin tipo"}
+
+		// A. Sin cabecera (o sin un idioma soportado) los mensajes siguen en español
+		for _, cabecera := range []string{"", "fr-FR, de;q=0.9", "fr, es;q=0.8, en;q=0.5"} {
+			w, resp := conIdioma("POST", base, sinTipo, authToken, cabecera)
+			if w.Header().Get("Content-Language") != "es" || resp.Error != "ProyectoID, Nombre y Tipo son requeridos" || resp.Details[0].Message != "campo requerido" {
+				t.Errorf("Se esperaba el mensaje en español con Accept-Language %q: %s (Content-Language %q)", cabecera, w.Body.String(), w.Header().Get("Content-Language"))
+			}
+		}
+
+		// B. Con Accept-Language en inglés, el texto sale del catálogo; code y campos no cambian
+		w, resp := conIdioma("POST", base, sinTipo, authToken, "en-US,en;q=0.9,es;q=0.5")
+		if w.Code != http.StatusBadRequest || w.Header().Get("Content-Language") != "en" || resp.Code != "validation_failed" ||
+			resp.Error != "Some fields are missing or have invalid values: tipo." || len(resp.Details) != 1 ||
+			resp.Details[0].Field != "tipo" || resp.Details[0].Message != "field is required" {
+			t.Errorf("Se esperaba el error de validación en inglés. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w, resp := conIdioma("GET", "/api/v1/users", nil, "", "en"); w.Code != http.StatusUnauthorized || resp.Code != "unauthorized" || !strings.HasPrefix(resp.Error, "Authentication is required") {
+			t.Errorf("Se esperaba el 401 en inglés. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// C. La preferencia guardada en la cuenta tiene prioridad sobre la cabecera
+		registro := models.User{Username: "agronoma_visitante", Password: "password123", Nombre: "Grace", Apellido: "Field", Cedula: "V-333333"}
+		if w := performRequest(router, "POST", "/api/auth/register", registro, ""); w.Code != http.StatusCreated {
+			t.Fatalf("Falló el registro. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		wLogin := performRequestFrom(router, "POST", "/api/auth/login", map[string]string{"username": "agronoma_visitante", "password": "password123"}, "", "10.0.0.33:4000")
+		var session models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &session)
+
+		w = performRequest(router, "PUT", "/api/v1/me/preferences", models.UserPreferences{Idioma: "EN-gb"}, session.Token)
+		var prefs models.UserPreferences
+		json.Unmarshal(w.Body.Bytes(), &prefs)
+		if w.Code != http.StatusOK || prefs.Idioma != "en" || w.Header().Get("Content-Language") != "en" {
+			t.Fatalf("Falló PUT /api/v1/me/preferences. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		if w := performRequest(router, "GET", "/api/v1/me/preferences", nil, session.Token); !strings.Contains(w.Body.String(), `"idioma":"en"`) {
+			t.Errorf("GET /api/v1/me/preferences debería devolver el idioma guardado: %s", w.Body.String())
+		}
+		w, resp = conIdioma("POST", base, sinTipo, session.Token, "es")
+		if w.Code != http.StatusForbidden || resp.Error != "Access denied." || w.Header().Get("Content-Language") != "en" {
+			t.Errorf("Se esperaba el 403 en inglés por la preferencia del usuario. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		w, resp = conIdioma("PUT", "/api/v1/me/preferences", models.UserPreferences{Idioma: "fr"}, session.Token, "")
+		if w.Code != http.StatusBadRequest || resp.Code != "validation_failed" || len(resp.Details) != 1 || resp.Details[0].Field != "idioma" || resp.Details[0].Message != "invalid value" {
+			t.Errorf("Se esperaba 400 con un idioma no soportado. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// D. Sin preferencia vuelve a mandar la cabecera
+		performRequest(router, "PUT", "/api/v1/me/preferences", models.UserPreferences{Idioma: ""}, session.Token)
+		if w, resp := conIdioma("POST", base, sinTipo, session.Token, ""); resp.Error != "acceso denegado" || w.Header().Get("Content-Language") != "es" {
+			t.Errorf("Sin preferencia el error debería salir en español. Resp: %s", w.Body.String())
+		}
+	})
+
+	t.Run("34. Listados paginados con cursor, orden y filtros", func(t *testing.T) {
+		type pagina struct {
+			Equipos    []models.EquipoImplemento `json:"equipos"`
+			Proyectos  []models.Proyecto         `json:"proyectos"`
+			Users      []models.UserListResponse `json:"users"`
+			Logs       []models.EventLogResponse `json:"logs"`
+			NextCursor *string                   `json:"next_cursor"`
+			Total      *int                      `json:"total"`
+		}
+		leer := func(w *httptest.ResponseRecorder) pagina {
+			var p pagina
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatalf("Respuesta de listado inválida (%d): %s", w.Code, w.Body.String())
+			}
+			return p
+		}
+
+		// Proyecto propio con cinco equipos de dos tipos
+		w := performRequest(router, "POST", "/api/v1/proyectos", models.CreateProyectoRequest{Nombre: "Finca Paginada", FechaInicio: "2025-01-01", FechaCierre: "2025-12-31"}, authToken)
+		var proyecto models.Proyecto
+		json.Unmarshal(w.Body.Bytes(), &proyecto)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Falló la creación del proyecto. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		base := fmt.Sprintf("/api/v1/proyectos/%d/equipos", proyecto.ID)
+		for i, nombre := range []string{"Cosechadora", "Arado", "Tractor", "Rastra", "Sembradora"} {
+			tipo := "Equipo"
+			if i%2 == 1 {
+				tipo = "Implemento"
+			}
+			if w := performRequest(router, "POST", base, models.CreateEquipoRequest{Nombre: nombre, Tipo: tipo, Estado: "Operativo"}, authToken); w.Code != http.StatusCreated {
+				t.Fatalf("Falló la creación del equipo %s. Código: %d, Resp: %s", nombre, w.Code, w.Body.String())
+			}
+		}
+
+		// A. Páginas de 2 por nombre: 3 páginas, sin repetidos, con el total
+		var nombres []string
+		cursor := ""
+		for paginas := 0; ; paginas++ {
+			if paginas == 3 {
+				t.Fatalf("Demasiadas páginas; nombres hasta ahora: %v", nombres)
+			}
+			ruta := base + "?limit=2&sort=nombre"
+			if cursor != "" {
+				ruta += "&cursor=" + cursor
+			}
+			w := performRequest(router, "GET", ruta, nil, authToken)
+			p := leer(w)
+			if w.Code != http.StatusOK || p.Total == nil || *p.Total != 5 || len(p.Equipos) > 2 {
+				t.Fatalf("Página inesperada. Código: %d, Resp: %s", w.Code, w.Body.String())
+			}
+			for _, e := range p.Equipos {
+				nombres = append(nombres, e.Nombre)
+			}
+			if p.NextCursor == nil {
+				break
+			}
+			cursor = *p.NextCursor
+		}
+		if strings.Join(nombres, ",") != "Arado,Cosechadora,Rastra,Sembradora,Tractor" {
+			t.Errorf("Las páginas deberían recorrer los equipos por nombre sin repetir: %v", nombres)
+		}
+
+		// B. Filtro simple y orden descendente
+		w = performRequest(router, "GET", base+"?tipo=Implemento&sort=-nombre", nil, authToken)
+		if p := leer(w); len(p.Equipos) != 2 || *p.Total != 2 || p.Equipos[0].Nombre != "Rastra" || p.NextCursor != nil {
+			t.Errorf("Se esperaban los 2 implementos en orden descendente: %s", w.Body.String())
+		}
+
+		// C. Orden fuera de la lista, cursor ajeno y limit fuera de rango: 400 con el campo
+		primera := leer(performRequest(router, "GET", base+"?limit=2&sort=nombre", nil, authToken))
+		for ruta, campo := range map[string]string{
+			base + "?sort=codigo_secreto":                                "sort",
+			base + "?cursor=no-es-un-cursor":                             "cursor",
+			base + "?limit=2&sort=-nombre&cursor=" + *primera.NextCursor: "cursor",
+			base + "?limit=501":                                          "limit",
+		} {
+			w := performRequest(router, "GET", ruta, nil, authToken)
+			var resp models.ErrorResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if w.Code != http.StatusBadRequest || resp.Code != "validation_failed" || len(resp.Details) != 1 || resp.Details[0].Field != campo {
+				t.Errorf("%s: se esperaba 400 por %s. Código: %d, Resp: %s", ruta, campo, w.Code, w.Body.String())
+			}
+		}
+
+		// D. Búsqueda en proyectos y página de usuarios por la ruta antigua (cuerpo JSON)
+		w = performRequest(router, "GET", "/api/v1/proyectos?q=Paginada", nil, authToken)
+		if p := leer(w); len(p.Proyectos) != 1 || *p.Total != 1 || p.Proyectos[0].ID != proyecto.ID {
+			t.Errorf("La búsqueda de proyectos debería devolver solo el nuevo: %s", w.Body.String())
+		}
+		w = performRequest(router, "POST", "/api/admin/users", models.GetUsersRequest{ListParams: models.ListParams{Limit: 1}, Activo: "true"}, authToken)
+		if p := leer(w); w.Code != http.StatusOK || len(p.Users) != 1 || p.NextCursor == nil || *p.Total < 2 {
+			t.Errorf("Se esperaba una página de un usuario con más por leer. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// E. Logs y unidades siguen respondiendo un arreglo si no se pide una página
+		w = performRequest(router, "GET", "/api/v1/logs", nil, authToken)
+		if !strings.HasPrefix(w.Body.String(), "[") {
+			t.Errorf("Sin limit, los logs deberían ser un arreglo: %.80s", w.Body.String())
+		}
+		w = performRequest(router, "GET", "/api/v1/logs?limit=3", nil, authToken)
+		if p := leer(w); len(p.Logs) != 3 || p.NextCursor == nil || p.Total != nil {
+			t.Errorf("Se esperaba una página de 3 logs, sin total. Resp: %.200s", w.Body.String())
+		}
+		w = performRequest(router, "GET", fmt.Sprintf("/api/v1/proyectos/%d/unidades?limit=1", proyectoID), nil, authToken)
+		if !strings.Contains(w.Body.String(), `"unidades":[`) || !strings.Contains(w.Body.String(), `"total":`) {
+			t.Errorf("Con limit, las unidades deberían venir en una página: %s", w.Body.String())
+		}
+
+		// F. Sin limit la página tiene un tope: 500 filas con cursor, o 1000 logs en el arreglo
+		tx, _ := database.DB.Begin()
+		for i := 0; i < database.MaxListLimit; i++ {
+			tx.Exec("INSERT INTO equipos_implementos (proyecto_id, codigo_equipo, nombre, tipo) VALUES (?, ?, ?, 'Equipo')", proyecto.ID, fmt.Sprintf("MASIVO-%03d", i), fmt.Sprintf("Masivo %03d", i))
+		}
+		for i := 0; i < 1000; i++ {
+			tx.Exec("INSERT INTO event_logs (timestamp, usuario_username, usuario_rol, accion, entidad, entidad_id) VALUES ('2020-01-01 00:00:00', 'carga', 'admin', 'CARGA MASIVA', 'Test', ?)", i)
+		}
+		tx.Commit()
+		w = performRequest(router, "GET", base, nil, authToken)
+		if p := leer(w); len(p.Equipos) != database.MaxListLimit || p.NextCursor == nil || *p.Total != database.MaxListLimit+5 {
+			t.Errorf("Sin limit se esperaba una página de %d equipos con cursor. Recibidos: %d, cursor: %v", database.MaxListLimit, len(p.Equipos), p.NextCursor)
+		}
+		w = performRequest(router, "GET", "/api/v1/logs", nil, authToken)
+		var logs []models.EventLogResponse
+		if json.Unmarshal(w.Body.Bytes(), &logs); len(logs) != 1000 {
+			t.Errorf("Sin limit los logs deberían limitarse a 1000 eventos, hay %d", len(logs))
+		}
+	})
+
+	t.Run("35. Un gerente no puede ascenderse en su proyecto", func(t *testing.T) {
+		w := performRequest(router, "POST", "/api/v1/proyectos", models.CreateProyectoRequest{Nombre: "Finca Escalera", FechaInicio: "2025-01-01", FechaCierre: "2025-12-31"}, authToken)
+		var proyecto models.Proyecto
+		json.Unmarshal(w.Body.Bytes(), &proyecto)
+
+		ids := map[string]int{}
+		for _, username := range []string{"gerente_escalera", "peon_escalera"} {
+			registro := models.User{Username: username, Password: "password123", Nombre: "Esca", Apellido: "Lera", Cedula: fmt.Sprintf("V-35%d", len(ids))}
+			if w := performRequest(router, "POST", "/api/auth/register", registro, ""); w.Code != http.StatusCreated {
+				t.Fatalf("Falló el registro de %s. Código: %d, Resp: %s", username, w.Code, w.Body.String())
+			}
+			var id int
+			database.DB.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&id)
+			ids[username] = id
+		}
+		gerenteID, peonID := ids["gerente_escalera"], ids["peon_escalera"]
+		performRequest(router, "POST", "/api/admin/update-user", models.UpdateRoleRequest{ID: gerenteID, NewRole: "gerente"}, authToken)
+		if w := performRequest(router, "POST", "/api/admin/add-project-member", models.AddProjectMemberRequest{UserID: gerenteID, ProyectoID: proyecto.ID}, authToken); w.Code != http.StatusOK {
+			t.Fatalf("Falló add-project-member. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+		wLogin := performRequestFrom(router, "POST", "/api/auth/login", map[string]string{"username": "gerente_escalera", "password": "password123"}, "", "10.0.0.35:4000")
+		var session models.LoginResponse
+		json.Unmarshal(wLogin.Body.Bytes(), &session)
+
+		miembro := func(userID int) string {
+			return fmt.Sprintf("/api/v1/proyectos/%d/members/%d", proyecto.ID, userID)
+		}
+		rolEnProyecto := func(userID int) string {
+			var role string
+			database.DB.QueryRow("SELECT role FROM project_members WHERE user_id = ? AND proyecto_id = ?", userID, proyecto.ID).Scan(&role)
+			return role
+		}
+
+		// A. Ni ascenderse ni tocar su propia asignación
+		for _, body := range []map[string]string{{"role": "admin"}, {}} {
+			if w := performRequest(router, "PUT", miembro(gerenteID), body, session.Token); w.Code != http.StatusForbidden {
+				t.Errorf("Se esperaba 403 al cambiar la propia asignación (%v). Código: %d, Resp: %s", body, w.Code, w.Body.String())
+			}
+		}
+		if role := rolEnProyecto(gerenteID); role != "gerente" {
+			t.Errorf("El rol del gerente en el proyecto no debería cambiar: %q", role)
+		}
+		if w := performRequest(router, "DELETE", fmt.Sprintf("/api/v1/proyectos/%d", proyecto.ID), nil, session.Token); w.Code != http.StatusForbidden {
+			t.Errorf("El gerente no debería poder borrar el proyecto. Código: %d", w.Code)
+		}
+
+		// B. Tampoco puede dar a otro un rol explícito ni uno con permisos que no tiene
+		if w := performRequest(router, "PUT", miembro(peonID), map[string]string{"role": "admin"}, session.Token); w.Code != http.StatusForbidden || rolEnProyecto(peonID) != "" {
+			t.Errorf("Se esperaba 403 al asignar admin a otro. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+
+		// C. Con el rol por defecto del usuario la asignación sigue funcionando
+		if w := performRequest(router, "PUT", miembro(peonID), nil, session.Token); w.Code != http.StatusOK || rolEnProyecto(peonID) != "user" {
+			t.Errorf("El gerente debería poder sumar un usuario con su rol. Código: %d, Resp: %s", w.Code, w.Body.String())
+		}
+	})
+	time.Sleep(200 * time.Millisecond)
+}
+
+// Helper para realizar peticiones HTTP en el test
+func performRequest(r http.Handler, method, path string, payload interface{}, token string) *httptest.ResponseRecorder {
+	return performRequestFrom(r, method, path, payload, token, "")
+}
+
+// performRequestFrom permite fijar la dirección de origen (RemoteAddr) de la petición
+func performRequestFrom(r http.Handler, method, path string, payload interface{}, token, remoteAddr string) *httptest.ResponseRecorder {
+	var reqBody []byte
+	if payload != nil {
+		reqBody, _ = json.Marshal(payload)
+	}
+
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = remoteAddr
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// mockIdP es un proveedor OpenID Connect mínimo para las pruebas: publica el
+// descubrimiento y el JWKS, y canjea códigos emitidos con issueCode por ID tokens RS256.
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	codes  map[string]jwt.MapClaims
+	issued int
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("No se pudo generar la llave del IdP: %v", err)
+	}
+	idp := &mockIdP{key: key, codes: make(map[string]jwt.MapClaims)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "idp-1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "agro-app" || secret != "secreto-del-cliente" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+		idp.mu.Lock()
+		claims, found := idp.codes[r.Form.Get("code")]
+		delete(idp.codes, r.Form.Get("code"))
+		idp.mu.Unlock()
+		if !found || r.Form.Get("grant_type") != "authorization_code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "idp-1"
+		idToken, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+	})
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
+
+// issueCode simula que el usuario inició sesión en el IdP y devuelve el código
+func (m *mockIdP) issueCode(claims map[string]interface{}, nonce string) string {
+	idClaims := jwt.MapClaims{
+		"iss":   m.server.URL,
+		"aud":   "agro-app",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"nonce": nonce,
+	}
+	for k, v := range claims {
+		idClaims[k] = v
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.issued++
+	code := fmt.Sprintf("code-%d", m.issued)
+	m.codes[code] = idClaims
+	return code
 }
@@ -1,6 +1,6 @@
 import React, { createContext, useContext, useState, useEffect } from 'react';
 
-import { loginUser, registerUser } from '../services/authService';
+import { loginUser, registerUser, TOKEN_REFRESHED_EVENT, SESSION_EXPIRED_EVENT } from '../services/authService';
 
 const AuthContext = createContext();
 
@@ -28,6 +28,7 @@ export const AuthProvider = ({ children }) => {
         setToken(null);
 
         localStorage.removeItem('token');
+        localStorage.removeItem('refreshToken');
         localStorage.removeItem('user');
         localStorage.removeItem('role');
         localStorage.removeItem('userId');
@@ -57,6 +58,18 @@ export const AuthProvider = ({ children }) => {
         }
     }, []);
 
+    // apiCall renueva el token vencido: se toma el nuevo o se cierra la sesión si ya no se puede
+    useEffect(() => {
+        const onRefreshed = (event) => setToken(event.detail);
+        const onExpired = () => logout();
+        window.addEventListener(TOKEN_REFRESHED_EVENT, onRefreshed);
+        window.addEventListener(SESSION_EXPIRED_EVENT, onExpired);
+        return () => {
+            window.removeEventListener(TOKEN_REFRESHED_EVENT, onRefreshed);
+            window.removeEventListener(SESSION_EXPIRED_EVENT, onExpired);
+        };
+    }, []);
+
     // Función de Login
     const login = async (username, password) => {
         setLoading(true);
@@ -75,6 +88,7 @@ export const AuthProvider = ({ children }) => {
 
             // 2. Guarda en localStorage
             localStorage.setItem('token', data.token);
+            localStorage.setItem('refreshToken', data.refresh_token);
             localStorage.setItem('user', JSON.stringify(data.user)); // Se guarda el objeto user completo
             localStorage.setItem('role', data.role);
             localStorage.setItem('userId', data.userId); // Se guarda como string
@@ -1,8 +1,65 @@
 
 const API_BASE_URL = 'http://localhost:8080/api';
 
+// --- Renovación del token de acceso ---
+// El access token vence a los 15 minutos. Ante un 401, apiCall canjea el refresh
+// token guardado por un par nuevo y repite la petición una vez. Si ya no se puede
+// renovar, avisa con SESSION_EXPIRED_EVENT para que AuthContext cierre la sesión.
+
+export const TOKEN_REFRESHED_EVENT = 'auth:token-refreshed';
+export const SESSION_EXPIRED_EVENT = 'auth:session-expired';
+
+// Renovación en curso: las peticiones que fallan a la vez esperan la misma
+let refreshing = null;
+
+const refreshAccessToken = () => {
+    if (!refreshing) {
+        refreshing = (async () => {
+            const refreshToken = localStorage.getItem('refreshToken');
+            if (!refreshToken) {
+                return null;
+            }
+            try {
+                const response = await fetch(`${API_BASE_URL}/auth/refresh`, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ refresh_token: refreshToken }),
+                });
+                if (!response.ok) {
+                    return null;
+                }
+                const data = await response.json();
+                localStorage.setItem('token', data.token);
+                localStorage.setItem('refreshToken', data.refresh_token);
+                window.dispatchEvent(new CustomEvent(TOKEN_REFRESHED_EVENT, { detail: data.token }));
+                return data.token;
+            } catch (error) {
+                console.error('Error renovando el token:', error);
+                return null;
+            }
+        })().finally(() => {
+            refreshing = null;
+        });
+    }
+    return refreshing;
+};
+
+// renewToken devuelve un token con el que reintentar (null si la sesión terminó)
+const renewToken = async (usedToken) => {
+    // Otra petición ya lo renovó: basta con usar el guardado
+    const stored = localStorage.getItem('token');
+    if (stored && stored !== usedToken) {
+        return stored;
+    }
+    const renewed = await refreshAccessToken();
+    if (!renewed) {
+        window.dispatchEvent(new CustomEvent(SESSION_EXPIRED_EVENT));
+    }
+    return renewed;
+};
+
 
-export const apiCall = async (endpoint, method, body = null, token = null) => {
+export const apiCall = async (endpoint, method, body = null, token = null, retried = false) => {
     const url = `${API_BASE_URL}${endpoint}`;
 
     const headers = {
@@ -25,6 +82,16 @@ export const apiCall = async (endpoint, method, body = null, token = null) => {
     let response; // Mueve la declaración aquí para usarla en el catch
     try {
         response = await fetch(url, config);
+
+        // Token vencido: se renueva y se repite la petición una sola vez
+        if (response.status === 401 && token && !retried) {
+            const newToken = await renewToken(token);
+            if (newToken) {
+                // Sin await: los errores del reintento ya salen con su formato
+                return apiCall(endpoint, method, body, newToken, true);
+            }
+        }
+
         const responseText = await response.text();
 
         // Si la respuesta está vacía Y el status es OK (ej. 204 No Content), devuelve null o un objeto vacío